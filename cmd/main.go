@@ -156,15 +156,15 @@ func main() {
 		log.Fatalf("Failed to ping database: %v", err)
 	}
 
-	// Инициализация S3 клиента
+	// Инициализация хранилища (S3 или локальная файловая система)
 	s3Config, err := s3.NewConfig(".s3.env")
 	if err != nil {
-		log.Fatalf("Failed to load S3 config: %v", err)
+		log.Fatalf("Failed to load storage config: %v", err)
 	}
 
-	s3Client, err := s3.NewClient(s3Config)
+	s3Client, err := s3.NewStorage(s3Config)
 	if err != nil {
-		log.Fatalf("Failed to create S3 client: %v", err)
+		log.Fatalf("Failed to create storage client (driver %s): %v", s3Config.Driver, err)
 	}
 
 	// Подключение к сервису аутентификации
@@ -187,40 +187,90 @@ func main() {
 	shareRepo := repository.NewShareRepository(db)
 	trashRepo := repository.NewTrashRepository(db)
 	quotaRepo := repository.NewStorageQuotaRepository(db)
+	uploadSessionRepo := repository.NewUploadSessionRepository(db)
+	versionRetentionRepo := repository.NewVersionRetentionRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	searchRepo := repository.NewSearchRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	activityRepo := repository.NewActivityRepository(db)
+	fileRequestRepo := repository.NewFileRequestRepository(db)
+	shareAuditRepo := repository.NewShareAuditRepository(db)
 
 	// Инициализация сервисов
 	permissionService := service.NewPermissionService(shareRepo, fileRepo, folderRepo)
-	folderService := service.NewFolderService(folderRepo, fileRepo, permissionService)
-	shareService := service.NewShareService(shareRepo, fileRepo, folderRepo)
+	activityService := service.NewActivityService(activityRepo, permissionService)
+	folderService := service.NewFolderService(folderRepo, fileRepo, tagRepo, permissionService, activityService)
+	shareService := service.NewShareService(shareRepo, fileRepo, folderRepo, appConfig.Server.ShareLinkSecret)
+	shareAuditService := service.NewShareAuditService(shareAuditRepo, shareRepo, appConfig.Server.ShareAccessLogRetentionDays)
 	quotaService := service.NewStorageQuotaService(quotaRepo)
-	trashService := service.NewTrashService(trashRepo, fileRepo, folderRepo, s3Client, quotaService)
+	blobService := service.NewBlobService(blobRepo, s3Client)
+	trashService := service.NewTrashService(trashRepo, fileRepo, folderRepo, s3Client, quotaService, blobService)
 	previewService := preview.NewService(s3Client, db)
 	previewService.StartCleanupTask()
-	fileService := service.NewFileService(fileRepo, folderRepo, shareRepo, s3Client, permissionService, quotaService)
+	fileService := service.NewFileService(fileRepo, folderRepo, shareRepo, s3Client, permissionService, quotaService, blobService, activityService)
+	contentIndexer := preview.NewIndexer(db, fileService)
+	contentIndexer.Start()
+	uploadSessionService := service.NewUploadSessionService(uploadSessionRepo, fileRepo, fileService, s3Client)
+	tusService := service.NewTusService(uploadSessionService)
+	fileRequestService := service.NewFileRequestService(fileRequestRepo, shareRepo, shareService, fileService)
+	archiveService := service.NewArchiveService(folderRepo, shareRepo, fileService, shareService, permissionService)
+	copyService := service.NewCopyService(fileRepo, folderRepo, fileService, permissionService, quotaService, s3Client)
+	batchService := service.NewBatchService(db, fileService, folderService, trashService)
+	searchService := service.NewSearchService(searchRepo, permissionService)
+	tagService := service.NewTagService(tagRepo, permissionService)
+	versionRetentionService := service.NewVersionRetentionService(versionRetentionRepo, folderRepo, s3Client, quotaService, blobService)
 	videoService, err := service.NewVideoService(fileService, appConfig.Server.VideoDir)
 	if err != nil {
 		log.Fatalf("Failed to create video service: %v", err)
 	}
 
 	// Инициализация хендлеров
-	fileHandler := handler.NewFileHandler(fileService, folderService, trashService, videoService)
+	fileHandler := handler.NewFileHandler(fileService, folderService, trashService, videoService, activityService, shareAuditService)
 	folderHandler := handler.NewFolderHandler(folderService, trashService)
-	shareHandler := handler.NewShareHandler(shareService)
+	shareHandler := handler.NewShareHandler(shareService, shareAuditService)
 	trashHandler := handler.NewTrashHandler(trashService)
-	previewHandler := preview.NewHandler(previewService, fileService)
+	previewHandler := preview.NewHandler(previewService, fileService, activityService, shareAuditService)
 	quotaHandler := handler.NewStorageQuotaHandler(quotaService)
+	uploadSessionHandler := handler.NewUploadSessionHandler(uploadSessionService)
+	tusHandler := handler.NewTusHandler(tusService)
+	archiveHandler := handler.NewArchiveHandler(archiveService, shareAuditService)
+	versionRetentionHandler := handler.NewVersionRetentionHandler(versionRetentionService)
+	copyHandler := handler.NewCopyHandler(copyService)
+	batchHandler := handler.NewBatchHandler(batchService)
+	searchHandler := handler.NewSearchHandler(searchService)
+	tagHandler := handler.NewTagHandler(tagService)
+	activityHandler := handler.NewActivityHandler(activityService)
+	fileRequestHandler := handler.NewFileRequestHandler(fileRequestService, shareAuditService)
+
+	clientIPResolver, err := handler.NewClientIPResolver(appConfig.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
 
 	// Настройка HTTP роутера
 	r := chi.NewRouter()
 
+	// IP клиента за прокси нужен журналу обращений к ссылкам
+	r.Use(clientIPResolver.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(30 * time.Minute))
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link", "Content-Disposition"},
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Accept", "Authorization", "Content-Type",
+			// Заголовки протокола tus
+			"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset",
+			"Upload-Checksum", "Upload-Defer-Length", "X-HTTP-Method-Override",
+			// Токен доступа к ссылке с паролем
+			"X-Share-Access",
+		},
+		ExposedHeaders: []string{
+			"Link", "Content-Disposition",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires",
+		},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -241,10 +291,33 @@ func main() {
 		r.Route("/files/{uuid}", func(r chi.Router) {
 			r.Put("/rename", fileHandler.RenameFile)
 			r.Put("/move", fileHandler.MoveFile)
+			r.Post("/copy", copyHandler.CopyFile)
 			r.Get("/", fileHandler.DownloadFile)
 			r.Delete("/", fileHandler.DeleteFile)
 			r.Get("/preview", previewHandler.GetPreview)
+			r.Put("/star", activityHandler.StarFile)
+			r.Delete("/star", activityHandler.UnstarFile)
 			r.Get("/versions", fileHandler.GetFileVersions)
+			r.Patch("/versions/{version}", fileHandler.UpdateFileVersion)
+			r.Post("/versions/{version}/restore", fileHandler.RestoreFileVersion)
+		})
+
+		r.Route("/uploads", func(r chi.Router) {
+			r.Post("/", uploadSessionHandler.CreateSession)
+			r.Get("/{id}", uploadSessionHandler.GetSession)
+			r.Put("/{id}/parts/{number}", uploadSessionHandler.UploadPart)
+			r.Post("/{id}/complete", uploadSessionHandler.CompleteSession)
+			r.Delete("/{id}", uploadSessionHandler.AbortSession)
+		})
+
+		r.Route("/tus", func(r chi.Router) {
+			r.Use(tusHandler.Middleware)
+			r.Options("/", tusHandler.Options)
+			r.Post("/", tusHandler.CreateUpload)
+			r.Options("/{id}", tusHandler.Options)
+			r.Head("/{id}", tusHandler.GetUpload)
+			r.Patch("/{id}", tusHandler.WriteChunk)
+			r.Delete("/{id}", tusHandler.Terminate)
 		})
 
 		r.Route("/videos", func(r chi.Router) {
@@ -256,9 +329,33 @@ func main() {
 		r.Post("/folders", folderHandler.CreateFolder)
 		r.Get("/folders/{id}", folderHandler.GetFolderContent)
 		r.Delete("/folders/{id}", folderHandler.DeleteFolder)
+		r.Get("/folders/{id}/download", archiveHandler.DownloadFolder)
 		r.Get("/files/progress", fileHandler.GetUploadProgress)
 		r.Put("/folders/{id}/rename", folderHandler.RenameFolder)
 		r.Put("/folders/{id}/move", folderHandler.MoveFolder)
+		r.Post("/folders/{id}/copy", copyHandler.CopyFolder)
+		r.Put("/folders/{id}/star", activityHandler.StarFolder)
+		r.Delete("/folders/{id}/star", activityHandler.UnstarFolder)
+		r.Get("/folders/{id}/version-settings", versionRetentionHandler.GetFolderSettings)
+		r.Put("/folders/{id}/version-settings", versionRetentionHandler.UpdateFolderSettings)
+		r.Delete("/folders/{id}/version-settings", versionRetentionHandler.DeleteFolderSettings)
+
+		r.Post("/archives", archiveHandler.CreateArchive)
+		r.Post("/batch", batchHandler.Execute)
+		r.Get("/search", searchHandler.Search)
+		r.Get("/starred", activityHandler.GetStarred)
+		r.Get("/recent", activityHandler.GetRecent)
+		r.Get("/recent/modified", activityHandler.GetRecentlyModified)
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Get("/", tagHandler.ListTags)
+			r.Post("/", tagHandler.CreateTag)
+			r.Patch("/{id}", tagHandler.UpdateTag)
+			r.Delete("/{id}", tagHandler.DeleteTag)
+			r.Get("/{id}/items", tagHandler.GetTaggedItems)
+			r.Post("/{id}/items", tagHandler.TagItem)
+			r.Delete("/{id}/items/{type}/{itemID}", tagHandler.UntagItem)
+		})
 
 		r.Route("/trash", func(r chi.Router) {
 			r.Get("/", trashHandler.GetTrashItems)
@@ -269,6 +366,11 @@ func main() {
 			r.Put("/settings", trashHandler.UpdateSettings)
 		})
 
+		r.Route("/versions", func(r chi.Router) {
+			r.Get("/settings", versionRetentionHandler.GetSettings)
+			r.Put("/settings", versionRetentionHandler.UpdateSettings)
+		})
+
 		r.Route("/quota", func(r chi.Router) {
 			r.Get("/", quotaHandler.GetQuotaInfo)
 			r.Put("/limit", quotaHandler.UpdateQuotaLimit)
@@ -277,15 +379,31 @@ func main() {
 		r.Route("/shares", func(r chi.Router) {
 			r.Post("/", shareHandler.CreateShare)
 			r.Get("/shared-with-me", shareHandler.GetSharedWithMe)
+			r.Get("/mine", shareHandler.ListMyShares)
 			r.Get("/{id}/structure", shareHandler.GetSharedFolderStructure)
+			r.Get("/{id}/uploads", fileRequestHandler.ListUploads)
+			r.Get("/{id}/access-log", shareHandler.GetAccessLog)
 			r.Get("/{id}", shareHandler.GetSharedResource)
+			r.Patch("/{id}", shareHandler.UpdateShare)
+			r.Delete("/{id}", shareHandler.DeleteShare)
 
 			r.Route("/token/{token}", func(r chi.Router) {
-				r.Get("/", shareHandler.GetSharedResource)
+				r.Get("/", shareHandler.GetSharedByToken)
+				r.Post("/password", shareHandler.VerifyLinkPassword)
 				r.Post("/access", shareHandler.GrantAccess)
 				r.Get("/access", shareHandler.GetSharedFolderContent)
+				r.Get("/download", archiveHandler.DownloadSharedFolder)
 			})
 		})
+
+		// Запросы файлов: загрузка в папку по ссылке без доступа к ее содержимому.
+		// Маршруты /{token} доступны без авторизации
+		r.Route("/file-requests", func(r chi.Router) {
+			r.Post("/", fileRequestHandler.CreateFileRequest)
+			r.Get("/{token}", fileRequestHandler.GetFileRequest)
+			r.Post("/{token}/password", fileRequestHandler.VerifyPassword)
+			r.Post("/{token}/upload", fileRequestHandler.Upload)
+		})
 	})
 
 	// Создаем и настраиваем gRPC сервер
@@ -343,6 +461,15 @@ func main() {
 				if err := trashService.AutoCleanup(ctx); err != nil {
 					log.Printf("Error during trash auto cleanup: %v", err)
 				}
+				if err := uploadSessionService.CleanupExpiredSessions(ctx); err != nil {
+					log.Printf("Error during upload sessions cleanup: %v", err)
+				}
+				if err := versionRetentionService.PruneExpiredVersions(ctx); err != nil {
+					log.Printf("Error during file versions pruning: %v", err)
+				}
+				if err := shareAuditService.PruneAccessLog(ctx); err != nil {
+					log.Printf("Error during share access log pruning: %v", err)
+				}
 			case <-quit:
 				cleanupTicker.Stop()
 				return
@@ -15,6 +15,12 @@ type ServerConfig struct {
 	BaseURL  string `mapstructure:"BaseURL"`
 	VideoDir string `mapstructure:"VideoDir"`
 	GRPCPort string `mapstructure:"GRPCPort"`
+	// ShareLinkSecret - ключ подписи токенов доступа к ссылкам с паролем
+	ShareLinkSecret string `mapstructure:"ShareLinkSecret"`
+	// ShareAccessLogRetentionDays - срок хранения журнала обращений к ссылкам в днях
+	ShareAccessLogRetentionDays int `mapstructure:"ShareAccessLogRetentionDays"`
+	// TrustedProxies - адреса или подсети прокси через запятую, которым разрешено передавать IP клиента
+	TrustedProxies string `mapstructure:"TrustedProxies"`
 }
 
 type DatabaseConfig struct {
@@ -41,6 +47,9 @@ func NewConfig(path string) (*Config, error) {
 	v.BindEnv("Database.Name", "DATABASE_NAME")
 	v.BindEnv("Database.SSLMode", "DATABASE_SSLMODE")
 	v.BindEnv("Server.Port", "HTTP_PORT")
+	v.BindEnv("Server.ShareLinkSecret", "SHARE_LINK_SECRET")
+	v.BindEnv("Server.ShareAccessLogRetentionDays", "SHARE_ACCESS_LOG_RETENTION_DAYS")
+	v.BindEnv("Server.TrustedProxies", "TRUSTED_PROXIES")
 
 	// Читаем конфигурацию из файла
 	if err := v.ReadInConfig(); err != nil {
@@ -74,6 +83,15 @@ func NewConfig(path string) (*Config, error) {
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = v.GetString("HTTP_PORT")
 	}
+	if cfg.Server.ShareLinkSecret == "" {
+		cfg.Server.ShareLinkSecret = v.GetString("SHARE_LINK_SECRET")
+	}
+	if cfg.Server.ShareAccessLogRetentionDays == 0 {
+		cfg.Server.ShareAccessLogRetentionDays = v.GetInt("SHARE_ACCESS_LOG_RETENTION_DAYS")
+	}
+	if cfg.Server.TrustedProxies == "" {
+		cfg.Server.TrustedProxies = v.GetString("TRUSTED_PROXIES")
+	}
 	if cfg.Server.VideoDir == "" {
 		cfg.Server.VideoDir = "/tmp/videos" // Значение по умолчанию
 	}
@@ -102,6 +120,10 @@ func NewConfig(path string) (*Config, error) {
 		cfg.Server.GRPCPort = "50051"
 	}
 
+	if cfg.Server.ShareAccessLogRetentionDays <= 0 {
+		cfg.Server.ShareAccessLogRetentionDays = 90
+	}
+
 	return &cfg, nil
 }
 
@@ -0,0 +1,48 @@
+package domain
+
+// BatchAction - действие пакетной операции
+type BatchAction string
+
+const (
+	BatchActionMove              BatchAction = "move"
+	BatchActionRename            BatchAction = "rename"
+	BatchActionTrash             BatchAction = "trash"
+	BatchActionRestore           BatchAction = "restore"
+	BatchActionDeletePermanently BatchAction = "delete_permanently"
+)
+
+// Статусы результата отдельной операции
+const (
+	BatchStatusOK         = "ok"
+	BatchStatusFailed     = "failed"
+	BatchStatusSkipped    = "skipped"     // не выполнялась из-за ошибки в режиме "всё или ничего"
+	BatchStatusRolledBack = "rolled_back" // выполнилась, но транзакция была отменена
+)
+
+// BatchOperation - одна операция пакетного запроса над файлом или папкой
+type BatchOperation struct {
+	Action         BatchAction `json:"action"`
+	ItemID         string      `json:"item_id"`
+	ItemType       string      `json:"item_type"`                  // file или folder
+	TargetFolderID int64       `json:"target_folder_id,omitempty"` // для move
+	Name           string      `json:"name,omitempty"`             // для rename
+	ConflictPolicy string      `json:"conflict_policy,omitempty"`  // для move и restore
+}
+
+// BatchItemResult - результат отдельной операции пакетного запроса
+type BatchItemResult struct {
+	Index    int         `json:"index"`
+	Action   BatchAction `json:"action"`
+	ItemID   string      `json:"item_id"`
+	ItemType string      `json:"item_type"`
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// BatchResult - результат пакетного запроса
+type BatchResult struct {
+	Atomic    bool              `json:"atomic"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
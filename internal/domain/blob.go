@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Blob описывает объект хранилища, адресуемый по контрольной сумме содержимого.
+// На один объект может ссылаться несколько версий разных файлов одного владельца
+type Blob struct {
+	OwnerID   string    `json:"owner_id" db:"owner_id"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	S3Key     string    `json:"s3_key" db:"s3_key"`
+	SizeBytes int64     `json:"size_bytes" db:"size_bytes"`
+	RefCount  int       `json:"ref_count" db:"ref_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy определяет, что делать, если в целевой папке уже есть элемент с таким именем
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyFail - операция завершается ошибкой
+	ConflictPolicyFail ConflictPolicy = "fail"
+	// ConflictPolicyRename - элементу подбирается свободное имя вида "name (1).ext"
+	ConflictPolicyRename ConflictPolicy = "rename"
+	// ConflictPolicyVersion - файл сохраняется новой версией существующего,
+	// папки объединяются
+	ConflictPolicyVersion ConflictPolicy = "version"
+	// ConflictPolicyReplace - существующий элемент перемещается в корзину
+	ConflictPolicyReplace ConflictPolicy = "replace"
+)
+
+// MaxNameAttempts - сколько вариантов имени "name (n).ext" перебирается при конфликте
+const MaxNameAttempts = 1000
+
+// NumberedName добавляет к имени номер: "report.pdf" -> "report (1).pdf".
+// Для папок и файлов без расширения номер добавляется в конец
+func NumberedName(name string, n int, keepExt bool) string {
+	ext := ""
+	if keepExt {
+		ext = filepath.Ext(name)
+		// Скрытые файлы вроде ".env" не имеют расширения
+		if ext == name {
+			ext = ""
+		}
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "testing"
+
+func TestNumberedName(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		keepExt bool
+		want    string
+	}{
+		{"report.pdf", 1, true, "report (1).pdf"},
+		{"archive.tar.gz", 2, true, "archive.tar (2).gz"},
+		{"README", 3, true, "README (3)"},
+		{".env", 1, true, ".env (1)"},
+		{"photos.2024", 1, false, "photos.2024 (1)"},
+		{"report (1).pdf", 2, true, "report (1) (2).pdf"},
+	}
+
+	for _, tt := range tests {
+		if got := NumberedName(tt.name, tt.n, tt.keepExt); got != tt.want {
+			t.Errorf("NumberedName(%q, %d, %v) = %q, want %q", tt.name, tt.n, tt.keepExt, got, tt.want)
+		}
+	}
+}
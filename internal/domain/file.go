@@ -20,6 +20,8 @@ type File struct {
 	CurrentVersion  int                    `json:"current_version" db:"current_version"`
 	ContextType     *string                `json:"context_type,omitempty" db:"context_type"` // Изменено на *string
 	Metadata        map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Tags            []Tag                  `json:"tags,omitempty" db:"-"`    // Метки текущего пользователя
+	Starred         bool                   `json:"starred,omitempty" db:"-"` // Файл в избранном текущего пользователя
 }
 
 type FileUpload struct {
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// FileRequest - настройки ссылки только для загрузки файлов в папку владельца.
+// Срок приема файлов совпадает со сроком действия ссылки
+type FileRequest struct {
+	ShareID           uuid.UUID  `json:"share_id"`
+	Token             string     `json:"token"`
+	FolderID          int64      `json:"folder_id"`
+	FolderName        string     `json:"folder_name"`
+	MaxFileSize       *int64     `json:"max_file_size,omitempty"` // nil - ограничение только общим лимитом размера файла
+	AllowedExtensions []string   `json:"allowed_extensions"`      // Пустой список - любые расширения
+	Deadline          *time.Time `json:"deadline,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// Uploader - данные, которые загружающий указывает в форме запроса файлов
+type Uploader struct {
+	UserID string // Пустой для анонимной загрузки
+	Name   string
+	Email  string
+}
+
+// FileRequestUpload - файл, загруженный по запросу
+type FileRequestUpload struct {
+	ID            int64      `json:"id" db:"id"`
+	ShareID       uuid.UUID  `json:"share_id" db:"share_id"`
+	FileUUID      *uuid.UUID `json:"file_uuid,omitempty" db:"file_uuid"` // nil, если файл удален навсегда
+	FileName      string     `json:"file_name" db:"file_name"`
+	Size          int64      `json:"size" db:"size"`
+	UploaderID    *string    `json:"uploader_id,omitempty" db:"uploader_id"`
+	UploaderName  string     `json:"uploader_name" db:"uploader_name"`
+	UploaderEmail string     `json:"uploader_email" db:"uploader_email"`
+	UploadedAt    time.Time  `json:"uploaded_at" db:"uploaded_at"`
+}
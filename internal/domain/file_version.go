@@ -12,6 +12,22 @@ type FileVersion struct {
 	VersionNumber int        `json:"version_number" db:"version_number"`
 	S3Key         string     `json:"s3_key" db:"s3_key"`
 	SizeBytes     int64      `json:"size_bytes" db:"size_bytes"`
+	SHA256        *string    `json:"sha256,omitempty" db:"sha256"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	DeletedAt     *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// ContentAvailable равен false для старых версий, содержимое которых было перезаписано
+	ContentAvailable bool           `json:"content_available" db:"content_available"`
+	UploadedBy       *string        `json:"uploaded_by,omitempty" db:"uploaded_by"` // Пользователь, загрузивший версию
+	Label            *string        `json:"label,omitempty" db:"label"`             // Метка версии, например "final"
+	Comment          *string        `json:"comment,omitempty" db:"comment"`         // Комментарий к изменению
+	Uploader         *VersionAuthor `json:"uploader,omitempty" db:"-"`
+}
+
+// VersionAuthor содержит данные пользователя, загрузившего версию
+type VersionAuthor struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Lastname string `json:"lastname"`
+	Photo    string `json:"photo"`
 }
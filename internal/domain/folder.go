@@ -34,11 +34,14 @@ type Folder struct {
 	RestorePath     *string        `json:"restore_path,omitempty" db:"restore_path"`
 	RestoreParentID *int64         `json:"restore_parent_id,omitempty" db:"restore_parent_id"`
 	ShareInfo       *ShareInfo     `json:"share_info,omitempty"`
-	Metadata        types.JSONText `json:"metadata" db:"metadata"` // Добавляем это поле
+	Metadata        types.JSONText `json:"metadata" db:"metadata"`   // Добавляем это поле
+	Tags            []Tag          `json:"tags,omitempty" db:"-"`    // Метки текущего пользователя
+	Starred         bool           `json:"starred,omitempty" db:"-"` // Папка в избранном текущего пользователя
 }
 
 type FolderContent struct {
-	Folder  Folder   `json:"folder"`
-	Files   []File   `json:"files"`
-	Folders []Folder `json:"subfolders"`
+	Folder  Folder    `json:"folder"`
+	Files   []File    `json:"files"`
+	Folders []Folder  `json:"subfolders"`
+	Page    *PageInfo `json:"page,omitempty"`
 }
@@ -0,0 +1,51 @@
+package domain
+
+// ListSort - поле сортировки содержимого папки
+type ListSort string
+
+const (
+	ListSortName      ListSort = "name"
+	ListSortSize      ListSort = "size"
+	ListSortType      ListSort = "type"
+	ListSortCreatedAt ListSort = "created_at"
+	ListSortUpdatedAt ListSort = "updated_at"
+)
+
+const (
+	// DefaultListLimit - размер страницы содержимого папки по умолчанию
+	DefaultListLimit = 100
+	// MaxListLimit - максимальный размер страницы содержимого папки
+	MaxListLimit = 1000
+)
+
+// MIMECategories - категории файлов для фильтра по типу и соответствующие им шаблоны MIME-типов
+var MIMECategories = map[string][]string{
+	"image":        {"image/%"},
+	"video":        {"video/%"},
+	"audio":        {"audio/%"},
+	"text":         {"text/plain", "text/markdown", "text/html"},
+	"document":     {"application/pdf", "application/msword", "application/vnd.openxmlformats-officedocument.wordprocessingml.%", "application/vnd.oasis.opendocument.text", "application/rtf"},
+	"spreadsheet":  {"application/vnd.ms-excel", "application/vnd.openxmlformats-officedocument.spreadsheetml.%", "application/vnd.oasis.opendocument.spreadsheet", "text/csv"},
+	"presentation": {"application/vnd.ms-powerpoint", "application/vnd.openxmlformats-officedocument.presentationml.%", "application/vnd.oasis.opendocument.presentation"},
+	"archive":      {"application/zip", "application/x-zip-compressed", "application/x-rar-compressed", "application/vnd.rar", "application/x-7z-compressed", "application/x-tar", "application/gzip"},
+}
+
+// ListOptions - параметры постраничного получения содержимого папки.
+// Папки всегда идут перед файлами. Фильтры MIMECategory и ContextType относятся
+// к файлам: если хотя бы один из них задан, подпапки в выдачу не попадают
+type ListOptions struct {
+	Sort         ListSort
+	Descending   bool
+	Limit        int    // 0 - без ограничения
+	Cursor       string // Значение NextCursor предыдущей страницы
+	MIMECategory string
+	ContextType  string
+}
+
+// PageInfo - сведения о странице содержимого папки
+type PageInfo struct {
+	TotalFolders int    `json:"total_folders"`
+	TotalFiles   int    `json:"total_files"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	HasMore      bool   `json:"has_more"`
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+const (
+	// DefaultQuickAccessLimit - количество элементов на странице избранного и недавних по умолчанию
+	DefaultQuickAccessLimit = 50
+	// MaxQuickAccessLimit - максимальное количество элементов на странице
+	MaxQuickAccessLimit = 200
+)
+
+// ActivityAction - действие пользователя, которое попадает в список недавних
+type ActivityAction string
+
+const (
+	ActivityUpload   ActivityAction = "upload"
+	ActivityDownload ActivityAction = "download"
+	ActivityPreview  ActivityAction = "preview"
+	ActivityRename   ActivityAction = "rename"
+)
+
+// QuickAccessItem - элемент списка избранного, недавних или недавно измененных
+type QuickAccessItem struct {
+	ItemType string         `json:"item_type"` // file или folder
+	File     *File          `json:"file,omitempty"`
+	Folder   *Folder        `json:"folder,omitempty"`
+	Shared   bool           `json:"shared"`           // Элемент доступен через общий доступ
+	Action   ActivityAction `json:"action,omitempty"` // Последнее действие пользователя (только для недавних)
+	At       time.Time      `json:"at"`               // Время добавления в избранное, действия или изменения
+}
+
+// QuickAccessPage - страница списка избранного, недавних или недавно измененных
+type QuickAccessPage struct {
+	Total   int               `json:"total"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+	HasMore bool              `json:"has_more"`
+	Items   []QuickAccessItem `json:"items"`
+}
@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+const (
+	// DefaultSearchLimit - количество результатов поиска по умолчанию
+	DefaultSearchLimit = 50
+	// MaxSearchLimit - максимальное количество результатов поиска за один запрос
+	MaxSearchLimit = 200
+)
+
+// Маркеры начала и конца совпадения во фрагменте текста. В ответе API они
+// заменяются на <mark> и </mark> после экранирования HTML
+const (
+	SnippetStart = "\uE000"
+	SnippetStop  = "\uE001"
+)
+
+// SearchQuery - параметры поиска файлов и папок
+type SearchQuery struct {
+	Text        string
+	ItemType    string     // file, folder или пусто для обоих
+	MIMEType    string     // Точный MIME-тип или шаблон вида "image/*"; папки исключаются
+	MinSize     *int64     // Размер в байтах, включительно
+	MaxSize     *int64     // Размер в байтах, включительно
+	UpdatedFrom *time.Time // Дата изменения, включительно
+	UpdatedTo   *time.Time // Дата изменения, не включая
+	OwnerID     string
+	FolderID    *int64  // Искать только внутри этой папки и её подпапок
+	TagIDs      []int64 // Элемент должен быть отмечен всеми этими метками пользователя
+	Limit       int
+	Offset      int
+}
+
+// SearchHit - найденный файл или папка
+type SearchHit struct {
+	ItemType   string  `json:"item_type"` // file или folder
+	File       *File   `json:"file,omitempty"`
+	Folder     *Folder `json:"folder,omitempty"`
+	FolderPath string  `json:"folder_path"`       // Путь папки, в которой находится элемент
+	Snippet    string  `json:"snippet,omitempty"` // Фрагмент содержимого с подсветкой совпадений (HTML)
+	Shared     bool    `json:"shared"`            // Элемент доступен через общий доступ
+	Rank       float64 `json:"rank"`
+}
+
+// SearchResult - страница результатов поиска
+type SearchResult struct {
+	Query   string      `json:"query"`
+	Total   int         `json:"total"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+	HasMore bool        `json:"has_more"`
+	Hits    []SearchHit `json:"hits"`
+}
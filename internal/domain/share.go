@@ -18,13 +18,72 @@ const (
 )
 
 type Share struct {
-	ID           uuid.UUID    `json:"id" db:"id"`
-	ResourceID   string       `json:"resource_id" db:"resource_id"`
-	ResourceType ResourceType `json:"resource_type" db:"resource_type"`
-	OwnerID      string       `json:"owner_id" db:"owner_id"`
-	AccessType   AccessType   `json:"access_type" db:"access_type"`
-	Token        string       `json:"token" db:"token"`
-	ExpiresAt    *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
-	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
-	UserIDs      string       `json:"user_ids" db:"user_ids"` // Добавляем это поле
+	ID            uuid.UUID    `json:"id" db:"id"`
+	ResourceID    string       `json:"resource_id" db:"resource_id"`
+	ResourceType  ResourceType `json:"resource_type" db:"resource_type"`
+	OwnerID       string       `json:"owner_id" db:"owner_id"`
+	AccessType    AccessType   `json:"access_type" db:"access_type"`
+	Token         string       `json:"token" db:"token"`
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+	PasswordHash  string       `json:"-" db:"password_hash"` // bcrypt; пустая строка - ссылка без пароля
+	MaxDownloads  *int         `json:"max_downloads,omitempty" db:"max_downloads"`
+	DownloadCount int          `json:"download_count" db:"download_count"`
+	PreviewOnly   bool         `json:"preview_only" db:"preview_only"` // Скачивание запрещено, просмотр разрешен
+	UploadOnly    bool         `json:"upload_only" db:"upload_only"`   // Запрос файлов: только загрузка в папку
+}
+
+// HasPassword сообщает, защищена ли ссылка паролем
+func (s *Share) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// DownloadsLeft возвращает число оставшихся скачиваний или nil, если лимита нет
+func (s *Share) DownloadsLeft() *int {
+	if s.MaxDownloads == nil {
+		return nil
+	}
+	left := *s.MaxDownloads - s.DownloadCount
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
+
+// ShareGrant - доступ пользователя к ресурсу по одной из ссылок, в которых он указан получателем
+type ShareGrant struct {
+	ShareID       uuid.UUID  `db:"share_id"`
+	AccessType    AccessType `db:"access_type"`
+	PreviewOnly   bool       `db:"preview_only"`
+	MaxDownloads  *int       `db:"max_downloads"`
+	DownloadCount int        `db:"download_count"`
+}
+
+// LinkAccess - подписанный токен доступа к ссылке, выдаваемый после проверки пароля
+type LinkAccess struct {
+	ShareID     uuid.UUID `json:"share_id"`
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ShareRecipient - пользователь, которому открыт доступ по ссылке, со своим уровнем доступа
+type ShareRecipient struct {
+	ShareID    uuid.UUID  `json:"-" db:"share_id"`
+	ID         string     `json:"id" db:"user_id"`
+	AccessType AccessType `json:"access_type" db:"access_type"`
+	GrantedAt  time.Time  `json:"granted_at" db:"granted_at"`
+	GrantedBy  string     `json:"granted_by" db:"granted_by"`
+	Email      string     `json:"email,omitempty" db:"-"`
+	Name       string     `json:"name,omitempty" db:"-"`
+	Lastname   string     `json:"lastname,omitempty" db:"-"`
+	Photo      string     `json:"photo,omitempty" db:"-"`
+}
+
+// OwnedShare - ссылка в списке ссылок владельца
+type OwnedShare struct {
+	Share
+	ResourceName      string           `json:"resource_name" db:"resource_name"`
+	Expired           bool             `json:"expired" db:"expired"`
+	PasswordProtected bool             `json:"password_protected" db:"password_protected"`
+	Recipients        []ShareRecipient `json:"recipients" db:"-"`
 }
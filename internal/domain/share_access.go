@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// DefaultShareAccessLogLimit - количество записей журнала ссылки на странице по умолчанию
+	DefaultShareAccessLogLimit = 50
+	// MaxShareAccessLogLimit - максимальное количество записей на странице
+	MaxShareAccessLogLimit = 200
+)
+
+// ShareAccessAction - действие с ресурсом по ссылке, которое попадает в журнал
+type ShareAccessAction string
+
+const (
+	ShareAccessOpen     ShareAccessAction = "open"   // Открытие ссылки по токену
+	ShareAccessGrant    ShareAccessAction = "grant"  // Получение доступа по ссылке
+	ShareAccessBrowse   ShareAccessAction = "browse" // Просмотр содержимого папки
+	ShareAccessDownload ShareAccessAction = "download"
+	ShareAccessPreview  ShareAccessAction = "preview"
+	ShareAccessUpload   ShareAccessAction = "upload" // Загрузка по запросу файлов
+)
+
+// ShareAccessor - кто обратился к ссылке: пользователь или анонимный посетитель с IP
+type ShareAccessor struct {
+	UserID string
+	IP     string
+}
+
+// ShareAccessEntry - запись журнала обращений к ссылке
+type ShareAccessEntry struct {
+	ID         int64             `json:"id" db:"id"`
+	ShareID    uuid.UUID         `json:"share_id" db:"share_id"`
+	UserID     *string           `json:"user_id,omitempty" db:"user_id"`
+	IP         *string           `json:"ip,omitempty" db:"ip"` // Только для анонимных обращений
+	Action     ShareAccessAction `json:"action" db:"action"`
+	ResourceID *string           `json:"resource_id,omitempty" db:"resource_id"` // Файл или папка внутри ссылки
+	OccurredAt time.Time         `json:"occurred_at" db:"occurred_at"`
+	Email      string            `json:"email,omitempty" db:"-"`
+	Name       string            `json:"name,omitempty" db:"-"`
+	Lastname   string            `json:"lastname,omitempty" db:"-"`
+}
+
+// ShareAccessLogPage - страница журнала обращений к ссылке, последние записи первыми
+type ShareAccessLogPage struct {
+	Total   int                `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+	HasMore bool               `json:"has_more"`
+	Entries []ShareAccessEntry `json:"entries"`
+}
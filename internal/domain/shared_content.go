@@ -10,6 +10,7 @@ type SharedContent struct {
 	ParentFolders []Folder     `json:"parent_folders,omitempty"`
 	Files         []File       `json:"files,omitempty"`
 	Subfolders    []Folder     `json:"subfolders,omitempty"`
+	Page          *PageInfo    `json:"page,omitempty"`
 }
 
 // SharedBreadcrumb представляет элемент навигации для общего доступа
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// DefaultTagColor - цвет метки, если он не задан
+const DefaultTagColor = "#9e9e9e"
+
+// Tag - личная метка пользователя для группировки файлов и папок
+// независимо от их расположения. Метки видны только владельцу
+type Tag struct {
+	ID         int64     `json:"id" db:"id"`
+	OwnerID    string    `json:"owner_id" db:"owner_id"`
+	Name       string    `json:"name" db:"name"`
+	Color      string    `json:"color" db:"color"`                       // #rrggbb
+	ItemsCount int       `json:"items_count,omitempty" db:"items_count"` // Только в списке меток
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TaggedItems - файлы и папки, отмеченные меткой
+type TaggedItems struct {
+	Tag     Tag      `json:"tag"`
+	Files   []File   `json:"files"`
+	Folders []Folder `json:"folders"`
+}
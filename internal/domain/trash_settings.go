@@ -29,7 +29,8 @@ type TrashItem struct {
 
 // DeleteInfo содержит информацию об удаляемом файле
 type DeleteInfo struct {
-	UUID    string `db:"uuid"`
-	OwnerID string `db:"owner_id"`
-	Name    string `db:"name"`
+	UUID        string   `db:"uuid"`
+	OwnerID     string   `db:"owner_id"`
+	Name        string   `db:"name"`
+	VersionKeys []string `db:"-"` // Ключи объектов всех версий файла в хранилище
 }
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Статусы сессии загрузки
+const (
+	UploadSessionActive     = "active"
+	UploadSessionCompleting = "completing"
+	UploadSessionCompleted  = "completed"
+	UploadSessionAborted    = "aborted"
+)
+
+// Протоколы загрузки
+const (
+	UploadProtocolChunked = "chunked"
+	UploadProtocolTus     = "tus"
+)
+
+// UploadSession представляет возобновляемую загрузку файла по частям
+type UploadSession struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       string    `json:"user_id" db:"user_id"`
+	OwnerID      string    `json:"owner_id" db:"owner_id"`
+	FolderID     int64     `json:"folder_id" db:"folder_id"`
+	FileUUID     uuid.UUID `json:"file_uuid" db:"file_uuid"`
+	FileName     string    `json:"file_name" db:"file_name"`
+	MIMEType     string    `json:"mime_type" db:"mime_type"`
+	TotalSize    int64     `json:"total_size" db:"total_size"`
+	ChunkSize    int64     `json:"chunk_size" db:"chunk_size"`
+	S3Key        string    `json:"-" db:"s3_key"`
+	S3UploadID   string    `json:"-" db:"s3_upload_id"`
+	IsNewVersion bool      `json:"is_new_version" db:"is_new_version"`
+	Status       string    `json:"status" db:"status"`
+	Protocol     string    `json:"protocol" db:"protocol"`
+	UploadOffset int64     `json:"upload_offset" db:"upload_offset"`
+	Metadata     string    `json:"-" db:"upload_metadata"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// UploadSessionPart представляет сохраненную часть загрузки
+type UploadSessionPart struct {
+	SessionID  uuid.UUID `json:"-" db:"session_id"`
+	PartNumber int       `json:"part_number" db:"part_number"`
+	ETag       string    `json:"etag" db:"etag"`
+	SizeBytes  int64     `json:"size_bytes" db:"size_bytes"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// UploadSessionState представляет сессию вместе с уже загруженными частями
+type UploadSessionState struct {
+	Session       *UploadSession      `json:"session"`
+	Parts         []UploadSessionPart `json:"parts"`
+	TotalParts    int                 `json:"total_parts"`
+	UploadedBytes int64               `json:"uploaded_bytes"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// VersionRetentionSettings задает, какие старые версии файлов нужно хранить.
+// Настройки без FolderID действуют для всех файлов пользователя, настройки
+// папки полностью заменяют их для этой папки и ее подпапок
+type VersionRetentionSettings struct {
+	ID       int64  `json:"id" db:"id"`
+	OwnerID  string `json:"owner_id" db:"owner_id"`
+	FolderID *int64 `json:"folder_id,omitempty" db:"folder_id"`
+	KeepLast *int   `json:"keep_last" db:"keep_last"` // nil - без ограничения по количеству
+	KeepDays *int   `json:"keep_days" db:"keep_days"` // nil - без ограничения по возрасту
+	// CountInQuota включает учет хранимых старых версий в квоте (только для настроек пользователя)
+	CountInQuota bool      `json:"count_in_quota" db:"count_in_quota"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ExpiredVersion описывает версию файла, вышедшую за пределы политики хранения
+type ExpiredVersion struct {
+	ID            int64     `db:"id"`
+	FileUUID      uuid.UUID `db:"file_uuid"`
+	OwnerID       string    `db:"owner_id"`
+	VersionNumber int       `db:"version_number"`
+}
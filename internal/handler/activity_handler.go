@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type ActivityHandler struct {
+	activityService *service.ActivityService
+}
+
+func NewActivityHandler(activityService *service.ActivityService) *ActivityHandler {
+	return &ActivityHandler{activityService: activityService}
+}
+
+// StarFile добавляет файл в избранное
+func (h *ActivityHandler) StarFile(w http.ResponseWriter, r *http.Request) {
+	h.setStarred(w, r, domain.ResourceTypeFile, chi.URLParam(r, "uuid"), true)
+}
+
+// UnstarFile убирает файл из избранного
+func (h *ActivityHandler) UnstarFile(w http.ResponseWriter, r *http.Request) {
+	h.setStarred(w, r, domain.ResourceTypeFile, chi.URLParam(r, "uuid"), false)
+}
+
+// StarFolder добавляет папку в избранное
+func (h *ActivityHandler) StarFolder(w http.ResponseWriter, r *http.Request) {
+	h.setStarred(w, r, domain.ResourceTypeFolder, chi.URLParam(r, "id"), true)
+}
+
+// UnstarFolder убирает папку из избранного
+func (h *ActivityHandler) UnstarFolder(w http.ResponseWriter, r *http.Request) {
+	h.setStarred(w, r, domain.ResourceTypeFolder, chi.URLParam(r, "id"), false)
+}
+
+func (h *ActivityHandler) setStarred(w http.ResponseWriter, r *http.Request, itemType domain.ResourceType, itemID string, starred bool) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.activityService.SetStarred(r.Context(), itemType, itemID, starred, userID); err != nil {
+		log.Printf("[Activity] Failed to change star of %s %s: %v", itemType, itemID, err)
+		writeActivityError(w, "Failed to update starred items", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStarred возвращает избранное пользователя. Параметры: limit, offset
+func (h *ActivityHandler) GetStarred(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, "starred items", h.activityService.GetStarred)
+}
+
+// GetRecent возвращает элементы, с которыми пользователь недавно работал. Параметры: limit, offset
+func (h *ActivityHandler) GetRecent(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, "recent items", h.activityService.GetRecent)
+}
+
+// GetRecentlyModified возвращает недавно измененные файлы. Параметры: limit, offset
+func (h *ActivityHandler) GetRecentlyModified(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, "recently modified items", h.activityService.GetRecentlyModified)
+}
+
+func (h *ActivityHandler) list(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	lister func(ctx context.Context, userID string, limit int, offset int) (*domain.QuickAccessPage, error),
+) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var limit, offset int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := lister(r.Context(), userID, limit, offset)
+	if err != nil {
+		log.Printf("[Activity] Failed to get %s for user %s: %v", name, userID, err)
+		writeActivityError(w, "Failed to get "+name, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// writeActivityError преобразует ошибку сервиса в HTTP ответ
+func writeActivityError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type ArchiveHandler struct {
+	archiveService *service.ArchiveService
+	shareAudit     *service.ShareAuditService
+}
+
+type createArchiveRequest struct {
+	FileUUIDs []uuid.UUID `json:"file_uuids"`
+	FolderIDs []int64     `json:"folder_ids"`
+	Format    string      `json:"format,omitempty"` // zip (по умолчанию) или tar.gz
+}
+
+func NewArchiveHandler(archiveService *service.ArchiveService, shareAudit *service.ShareAuditService) *ArchiveHandler {
+	return &ArchiveHandler{archiveService: archiveService, shareAudit: shareAudit}
+}
+
+// DownloadFolder отдает папку со всем содержимым в виде архива (ZIP по умолчанию)
+func (h *ArchiveHandler) DownloadFolder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := h.archiveService.PrepareFolderArchive(r.Context(), folderID, userID)
+	if err != nil {
+		log.Printf("[Archive] Failed to prepare folder %d: %v", folderID, err)
+		writeArchiveError(w, "Failed to prepare archive", err)
+		return
+	}
+
+	h.writeArchive(w, r, archive, r.URL.Query().Get("format"), userID)
+}
+
+// DownloadSharedFolder отдает в виде архива папку, доступную по ссылке
+func (h *ArchiveHandler) DownloadSharedFolder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := h.archiveService.PrepareSharedFolderArchive(r.Context(), token, r.URL.Query().Get("folder_id"), userID, linkAccessTokens(r))
+	if err != nil {
+		log.Printf("[Archive] Failed to prepare shared folder: %v", err)
+		writeArchiveError(w, "Failed to prepare archive", err)
+		return
+	}
+	h.shareAudit.RecordToken(r.Context(), token, shareAccessor(r, userID), domain.ShareAccessDownload, r.URL.Query().Get("folder_id"))
+
+	h.writeArchive(w, r, archive, r.URL.Query().Get("format"), userID)
+}
+
+// CreateArchive отдает архив из выбранных пользователем файлов и папок
+func (h *ArchiveHandler) CreateArchive(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createArchiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = r.URL.Query().Get("format")
+	}
+
+	archive, err := h.archiveService.PrepareSelectionArchive(r.Context(), req.FileUUIDs, req.FolderIDs, userID)
+	if err != nil {
+		log.Printf("[Archive] Failed to prepare selection archive: %v", err)
+		writeArchiveError(w, "Failed to prepare archive", err)
+		return
+	}
+
+	h.writeArchive(w, r, archive, format, userID)
+}
+
+// writeArchive передает архив клиенту по мере его формирования
+func (h *ArchiveHandler) writeArchive(w http.ResponseWriter, r *http.Request, archive *service.Archive, format string, userID string) {
+	var contentType, fileName string
+	switch format {
+	case "", service.ArchiveFormatZip:
+		contentType, fileName = "application/zip", archive.Name+".zip"
+	case service.ArchiveFormatTarGz:
+		contentType, fileName = "application/gzip", archive.Name+".tar.gz"
+	default:
+		http.Error(w, "Unsupported archive format", http.StatusBadRequest)
+		return
+	}
+
+	asciiName := strings.ReplaceAll(fileName, `"`, `\"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, asciiName, url.QueryEscape(fileName)))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	// Размер архива заранее неизвестен, ответ передается частями.
+	// После начала передачи сообщить об ошибке кодом ответа уже нельзя,
+	// поэтому клиент получит оборванный архив
+	if err := h.archiveService.WriteArchive(r.Context(), w, archive, format, userID); err != nil {
+		log.Printf("[Archive] Failed to stream archive %s: %v", archive.Name, err)
+	}
+}
+
+// writeArchiveError преобразует ошибку сервиса в HTTP ответ
+func writeArchiveError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "password required"):
+		writePasswordChallenge(w)
+	case strings.Contains(err.Error(), "download limit reached"):
+		http.Error(w, "Download limit reached", http.StatusForbidden)
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
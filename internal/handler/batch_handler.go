@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type BatchHandler struct {
+	batchService *service.BatchService
+}
+
+// batchRequest - тело пакетного запроса
+type batchRequest struct {
+	Atomic     bool                    `json:"atomic"` // true - всё или ничего
+	Operations []domain.BatchOperation `json:"operations"`
+}
+
+func NewBatchHandler(batchService *service.BatchService) *BatchHandler {
+	return &BatchHandler{batchService: batchService}
+}
+
+// Execute выполняет пакет операций над файлами и папками.
+// Результат каждой операции возвращается в ответе; если в режиме atomic
+// пакет отменен, код ответа соответствует ошибке операции
+func (h *BatchHandler) Execute(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.batchService.Execute(r.Context(), req.Operations, req.Atomic, userID)
+	if err != nil {
+		log.Printf("[Batch] Failed to execute batch: %v", err)
+		if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to execute batch: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Atomic && result.Failed > 0 {
+		for _, item := range result.Results {
+			if item.Status == domain.BatchStatusFailed {
+				status = batchErrorStatus(item.Error)
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// batchErrorStatus подбирает код ответа по тексту ошибки операции
+func batchErrorStatus(message string) int {
+	switch {
+	case strings.Contains(message, "access denied"):
+		return http.StatusForbidden
+	case strings.Contains(message, "already exists"):
+		return http.StatusConflict
+	case strings.Contains(message, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(message, "invalid"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
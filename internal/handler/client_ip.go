@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPResolver определяет IP клиента. Заголовкам X-Forwarded-For и X-Real-IP
+// верит только для запросов от доверенных прокси, иначе клиент мог бы подменить
+// свой адрес в журнале обращений к ссылкам
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver создает определитель IP. trustedProxies - список адресов
+// или подсетей в нотации CIDR через запятую; пустой список означает, что
+// заголовкам прокси не верим и используем адрес соединения
+func NewClientIPResolver(trustedProxies string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	for _, value := range strings.Split(trustedProxies, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", value)
+		}
+		resolver.trusted = append(resolver.trusted, network)
+	}
+	return resolver, nil
+}
+
+// Middleware сохраняет IP клиента в контексте запроса
+func (c *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, c.resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resolve возвращает адрес соединения, а если оно пришло от доверенного прокси -
+// ближайший к серверу недоверенный адрес из X-Forwarded-For или X-Real-IP
+func (c *ClientIPResolver) resolve(r *http.Request) string {
+	peer := remoteIP(r)
+	if !c.isTrusted(peer) {
+		return peer
+	}
+
+	// Каждый прокси дописывает адрес в конец, поэтому идем справа налево
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		if !c.isTrusted(ip) {
+			return ip
+		}
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return peer
+}
+
+func (c *ClientIPResolver) isTrusted(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP возвращает IP клиента, определенный ClientIPResolver, или адрес соединения
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
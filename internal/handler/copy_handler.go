@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type CopyHandler struct {
+	copyService *service.CopyService
+}
+
+// copyRequest - тело запроса на копирование файла или папки
+type copyRequest struct {
+	TargetFolderID int64  `json:"target_folder_id"`          // 0 - корневая папка пользователя
+	ConflictPolicy string `json:"conflict_policy,omitempty"` // fail (по умолчанию), rename или version
+}
+
+func NewCopyHandler(copyService *service.CopyService) *CopyHandler {
+	return &CopyHandler{copyService: copyService}
+}
+
+// CopyFile копирует файл в указанную папку
+func (h *CopyHandler) CopyFile(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid file UUID", http.StatusBadRequest)
+		return
+	}
+
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.copyService.CopyFile(r.Context(), fileUUID, req.TargetFolderID, policy, userID)
+	if err != nil {
+		log.Printf("[Copy] Failed to copy file %s: %v", fileUUID, err)
+		writeCopyError(w, "Failed to copy file", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(file)
+}
+
+// CopyFolder копирует папку со всем содержимым в указанную папку
+func (h *CopyHandler) CopyFolder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.copyService.CopyFolder(r.Context(), folderID, req.TargetFolderID, policy, userID)
+	if err != nil {
+		log.Printf("[Copy] Failed to copy folder %d: %v", folderID, err)
+		writeCopyError(w, "Failed to copy folder", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// writeCopyError преобразует ошибку сервиса в HTTP ответ
+func writeCopyError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "already exists"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusConflict)
+	case strings.Contains(err.Error(), "not enough storage space"):
+		http.Error(w, "Not enough storage space", http.StatusInsufficientStorage)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -62,10 +63,12 @@ type MultiUploadResponse struct {
 }
 
 type FileHandler struct {
-	fileService   *service.FileService
-	folderService *service.FolderService
-	trashService  *service.TrashService
-	videoService  *service.VideoService
+	fileService     *service.FileService
+	folderService   *service.FolderService
+	trashService    *service.TrashService
+	videoService    *service.VideoService
+	activityService *service.ActivityService
+	shareAudit      *service.ShareAuditService
 }
 
 type fileWrapper struct {
@@ -85,12 +88,16 @@ func NewFileHandler(
 	folderService *service.FolderService,
 	trashService *service.TrashService,
 	videoService *service.VideoService,
+	activityService *service.ActivityService,
+	shareAudit *service.ShareAuditService,
 ) *FileHandler {
 	return &FileHandler{
-		fileService:   fileService,
-		folderService: folderService,
-		trashService:  trashService,
-		videoService:  videoService,
+		fileService:     fileService,
+		folderService:   folderService,
+		trashService:    trashService,
+		videoService:    videoService,
+		activityService: activityService,
+		shareAudit:      shareAudit,
 	}
 }
 
@@ -153,88 +160,84 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := r.ParseMultipartForm(100 << 20); err != nil {
+	// Считаем прочитанные байты тела, чтобы оценивать размер очередного файла
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+
+	// Читаем multipart поток по частям, не сохраняя файлы в памяти или на диске.
+	// Поля folder_id, version_label, version_comment и conflict_policy должны идти в форме до файлов
+	reader, err := r.MultipartReader()
+	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
-	defer r.MultipartForm.RemoveAll()
 
-	folderIDStr := r.FormValue("folder_id")
 	var folderID int64
-	if folderIDStr != "" {
-		folderID, err = strconv.ParseInt(folderIDStr, 10, 64)
-		if err != nil {
-			http.Error(w, "Invalid folder ID", http.StatusBadRequest)
-			return
+	var note service.VersionNote
+	policy := domain.ConflictPolicyVersion
+	results := []UploadResult{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
 		}
-	}
-
-	files := r.MultipartForm.File["files"]
-	if len(files) == 0 {
-		http.Error(w, "No files uploaded", http.StatusBadRequest)
-		return
-	}
-
-	results := make([]UploadResult, len(files))
-	for i, fileHeader := range files {
-		progressID := fmt.Sprintf("%s_%s", userID, fileHeader.Filename)
-
-		// Начало загрузки - 0%
-		setProgress(progressID, 0, "uploading", "", 0)
-
-		file, err := fileHeader.Open()
 		if err != nil {
-			setProgress(progressID, 0, "error", err.Error(), 0)
-			results[i] = UploadResult{Error: err.Error()}
-			continue
-		}
-		defer file.Close()
-
-		// Проверка существования файла - 30%
-		setProgress(progressID, 30, "uploading", "", 0)
-		existingFile, err := h.fileService.CheckFileExists(r.Context(), folderID, fileHeader.Filename)
-		if err != nil {
-			setProgress(progressID, 0, "error", err.Error(), 0)
-			results[i] = UploadResult{Error: err.Error()}
-			continue
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
 		}
 
-		if existingFile != nil {
-			// Загрузка новой версии - 60%
-			setProgress(progressID, 60, "uploading", "", existingFile.CurrentVersion)
-			err = h.fileService.UploadFileVersion(r.Context(), file, fileHeader, existingFile, userID)
+		switch part.FormName() {
+		case "folder_id":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			part.Close()
 			if err != nil {
-				setProgress(progressID, 0, "error", err.Error(), 0)
-				results[i] = UploadResult{Error: err.Error()}
-				continue
+				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				return
 			}
-
-			// Успешное завершение загрузки новой версии - 100%
-			results[i] = UploadResult{
-				File:         existingFile,
-				IsNewVersion: true,
-				Version:      existingFile.CurrentVersion + 1,
+			if folderIDStr := strings.TrimSpace(string(value)); folderIDStr != "" {
+				folderID, err = strconv.ParseInt(folderIDStr, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+					return
+				}
 			}
-			setProgress(progressID, 100, "completed", "", existingFile.CurrentVersion+1)
-		} else {
-			// Загрузка нового файла - 60%
-			setProgress(progressID, 60, "uploading", "", 0)
-			uploadedFile, err := h.fileService.UploadFile(r.Context(), fileHeader, file, folderID, userID)
+		case "version_label", "version_comment":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			part.Close()
 			if err != nil {
-				setProgress(progressID, 0, "error", err.Error(), 0)
-				results[i] = UploadResult{Error: err.Error()}
-				continue
+				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				return
 			}
-
-			// Успешное завершение загрузки нового файла - 100%
-			results[i] = UploadResult{
-				File:    uploadedFile,
-				Version: 1,
+			if part.FormName() == "version_label" {
+				note.Label = strings.TrimSpace(string(value))
+			} else {
+				note.Comment = strings.TrimSpace(string(value))
+			}
+		case "conflict_policy":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			part.Close()
+			if err != nil {
+				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				return
+			}
+			policy, err = service.ParseConflictPolicy(strings.TrimSpace(string(value)), domain.ConflictPolicyVersion)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
-			setProgress(progressID, 100, "completed", fmt.Sprintf("Файл %s успешно загружен", fileHeader.Filename), 1)
+		case "files":
+			results = append(results, h.uploadFilePart(r, part, h.uploadSizeHint(r, part, body), folderID, userID, note, policy))
+			part.Close()
+		default:
+			part.Close()
 		}
 	}
 
+	if len(results) == 0 {
+		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+
 	// Отправляем финальный ответ
 	response := MultiUploadResponse{
 		Results: results,
@@ -243,6 +246,82 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// countingBody считает байты, прочитанные из тела запроса
+type countingBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// uploadSizeHint оценивает размер файла до его передачи, чтобы квота проверялась
+// до записи в хранилище: по Content-Length части, а без него - по непрочитанному
+// остатку запроса. Если размер неизвестен, возвращается 1 байт, чтобы пользователь
+// без свободного места получил отказ сразу. Точный размер проверяется после чтения
+func (h *FileHandler) uploadSizeHint(r *http.Request, part *multipart.Part, body *countingBody) int64 {
+	if value := part.Header.Get("Content-Length"); value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size >= 0 {
+			return size
+		}
+	}
+	if r.ContentLength > 0 {
+		if remaining := r.ContentLength - body.read; remaining > 0 {
+			return min(remaining, h.fileService.MaxFileSize())
+		}
+	}
+	return 1
+}
+
+// uploadFilePart загружает один файл из multipart потока
+func (h *FileHandler) uploadFilePart(
+	r *http.Request,
+	part *multipart.Part,
+	sizeHint int64,
+	folderID int64,
+	userID string,
+	note service.VersionNote,
+	policy domain.ConflictPolicy,
+) UploadResult {
+	fileName := part.FileName()
+	progressID := fmt.Sprintf("%s_%s", userID, fileName)
+
+	// Начало загрузки - 0%
+	setProgress(progressID, 0, "uploading", "", 0)
+
+	if fileName == "" {
+		setProgress(progressID, 0, "error", "missing file name", 0)
+		return UploadResult{Error: "missing file name"}
+	}
+
+	uploadedFile, err := h.fileService.UploadStream(
+		r.Context(),
+		fileName,
+		part.Header.Get("Content-Type"),
+		part,
+		sizeHint,
+		folderID,
+		userID,
+		note,
+		policy,
+	)
+	if err != nil {
+		setProgress(progressID, 0, "error", err.Error(), 0)
+		return UploadResult{Error: err.Error()}
+	}
+
+	// Успешное завершение загрузки - 100%
+	setProgress(progressID, 100, "completed", fmt.Sprintf("Файл %s успешно загружен", fileName), uploadedFile.CurrentVersion)
+	return UploadResult{
+		File:         uploadedFile,
+		IsNewVersion: uploadedFile.CurrentVersion > 1,
+		Version:      uploadedFile.CurrentVersion,
+	}
+}
+
 // GetUploadProgress отдает SSE события о прогрессе загрузки
 func (h *FileHandler) GetUploadProgress(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
@@ -393,8 +472,29 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[Download] Информация о файле: ID=%s, Name=%s, Size=%d, MimeType=%s",
-		fileUUID, file.Name, file.SizeBytes, file.MIMEType)
+	// Проверяем право на скачивание: ссылка может разрешать только просмотр или
+	// ограничивать число скачиваний
+	if err := h.fileService.AuthorizeDownload(r.Context(), file, userID); err != nil {
+		log.Printf("[Download] Скачивание запрещено: %v", err)
+		if strings.Contains(err.Error(), "access denied") {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Ошибка проверки доступа", http.StatusInternalServerError)
+		return
+	}
+
+	// Определяем запрошенную версию и ее размер
+	rangeHeader := r.Header.Get("Range")
+	versionNumber, fileSize, err := h.resolveFileVersion(r, file)
+	if err != nil {
+		log.Printf("[Download] Ошибка получения версии файла: %v", err)
+		writeFileVersionError(w, err)
+		return
+	}
+
+	log.Printf("[Download] Информация о файле: ID=%s, Name=%s, Version=%d, Size=%d, MimeType=%s",
+		fileUUID, file.Name, versionNumber, fileSize, file.MIMEType)
 
 	// Логируем метаданные, если они есть
 	if file.Metadata != nil {
@@ -415,14 +515,13 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Expires", "0")
 
 	// Получаем размер файла
-	w.Header().Set("Content-Length", strconv.FormatInt(file.SizeBytes, 10))
+	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
 
 	// Обработка Range запроса
 	var start, end int64
-	rangeHeader := r.Header.Get("Range")
 	if rangeHeader != "" {
 		log.Printf("[Download] Получен Range запрос: %s", rangeHeader)
-		ranges, err := parseRange(rangeHeader, file.SizeBytes)
+		ranges, err := parseRange(rangeHeader, fileSize)
 		if err != nil {
 			log.Printf("[Download] Ошибка парсинга Range: %v", err)
 			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
@@ -437,19 +536,19 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		end = ranges[0][1]
 
 		// Устанавливаем заголовок Content-Range
-		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, file.SizeBytes))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
 		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
-		log.Printf("[Download] Отдаем частичный контент: %d-%d/%d", start, end, file.SizeBytes)
+		log.Printf("[Download] Отдаем частичный контент: %d-%d/%d", start, end, fileSize)
 		w.WriteHeader(http.StatusPartialContent)
 	} else {
 		start = 0
-		end = file.SizeBytes - 1
-		log.Printf("[Download] Отдаем полный файл: %d байт", file.SizeBytes)
+		end = fileSize - 1
+		log.Printf("[Download] Отдаем полный файл: %d байт", fileSize)
 		w.WriteHeader(http.StatusOK)
 	}
 
 	// Получаем данные из S3 с использованием Range
-	reader, err := h.fileService.GetFileDataRange(r.Context(), fileUUID, userID, start, end)
+	reader, err := h.fileService.GetFileVersionDataRange(r.Context(), fileUUID, userID, versionNumber, start, end)
 	if err != nil {
 		log.Printf("[Download] Ошибка получения данных файла: %v", err)
 		http.Error(w, "Failed to get file data", http.StatusInternalServerError)
@@ -457,6 +556,12 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer reader.Close()
 
+	// Докачку по Range не считаем повторным открытием файла
+	if start == 0 {
+		h.activityService.RecordFile(r.Context(), userID, fileUUID, domain.ActivityDownload)
+		h.shareAudit.RecordFileAccess(r.Context(), file, userID, domain.ShareAccessDownload)
+	}
+
 	// Настраиваем буфер для оптимальной производительности
 	buf := make([]byte, 32*1024) // 32KB буфер
 
@@ -471,7 +576,7 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 
 				// Периодически сообщаем о прогрессе для больших файлов
 				if written%(1024*1024) == 0 { // Каждый мегабайт
-					log.Printf("[Download] Отправлено %d MB / %d MB", written/(1024*1024), file.SizeBytes/(1024*1024))
+					log.Printf("[Download] Отправлено %d MB / %d MB", written/(1024*1024), fileSize/(1024*1024))
 				}
 			}
 			if ew != nil {
@@ -563,6 +668,45 @@ func parseRange(rangeHeader string, fileSize int64) ([][2]int64, error) {
 	return ranges, nil
 }
 
+// resolveFileVersion определяет версию файла из параметра ?version=N и ее размер.
+// Для текущей версии возвращается номер 0, чтобы данные читались обычным путем
+func (h *FileHandler) resolveFileVersion(r *http.Request, file *domain.File) (int, int64, error) {
+	param := r.URL.Query().Get("version")
+	if param == "" {
+		return 0, file.SizeBytes, nil
+	}
+
+	versionNumber, err := strconv.Atoi(param)
+	if err != nil || versionNumber < 1 {
+		return 0, 0, fmt.Errorf("invalid version number: %s", param)
+	}
+
+	if versionNumber == file.CurrentVersion {
+		return 0, file.SizeBytes, nil
+	}
+
+	version, err := h.fileService.GetAvailableVersion(r.Context(), file, versionNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return versionNumber, version.SizeBytes, nil
+}
+
+// writeFileVersionError преобразует ошибку получения версии в HTTP ответ
+func writeFileVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, "Version not found", http.StatusNotFound)
+	case strings.Contains(err.Error(), "no longer available"):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		http.Error(w, "Failed to get file version", http.StatusInternalServerError)
+	}
+}
+
 // DeleteFile теперь перемещает файл в корзину вместо непосредственного удаления
 func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	// Проверяем авторизацию
@@ -648,6 +792,102 @@ func (h *FileHandler) GetFileVersions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(versions)
 }
 
+// RestoreFileVersion делает указанную версию файла текущей
+func (h *FileHandler) RestoreFileVersion(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid UUID format", http.StatusBadRequest)
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || versionNumber < 1 {
+		http.Error(w, "Invalid version number", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.fileService.RestoreVersion(r.Context(), fileUUID, versionNumber, userID)
+	if err != nil {
+		log.Printf("Failed to restore version %d of file %s: %v", versionNumber, fileUUID, err)
+		switch {
+		case strings.Contains(err.Error(), "access denied"):
+			http.Error(w, "Access denied", http.StatusForbidden)
+		case strings.Contains(err.Error(), "not found"):
+			http.Error(w, fmt.Sprintf("Failed to restore version: %v", err), http.StatusNotFound)
+		case strings.Contains(err.Error(), "no longer available"),
+			strings.Contains(err.Error(), "already current"):
+			http.Error(w, fmt.Sprintf("Failed to restore version: %v", err), http.StatusConflict)
+		case strings.Contains(err.Error(), "not enough storage space"):
+			http.Error(w, "Not enough storage space", http.StatusInsufficientStorage)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to restore version: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UploadResult{
+		File:         file,
+		IsNewVersion: true,
+		Version:      file.CurrentVersion,
+	})
+}
+
+// UpdateFileVersion изменяет метку и комментарий версии файла
+func (h *FileHandler) UpdateFileVersion(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid UUID format", http.StatusBadRequest)
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || versionNumber < 1 {
+		http.Error(w, "Invalid version number", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Label   *string `json:"label"`
+		Comment *string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	version, err := h.fileService.UpdateVersionNote(r.Context(), fileUUID, versionNumber, req.Label, req.Comment, userID)
+	if err != nil {
+		log.Printf("Failed to update version %d of file %s: %v", versionNumber, fileUUID, err)
+		switch {
+		case strings.Contains(err.Error(), "access denied"):
+			http.Error(w, "Access denied", http.StatusForbidden)
+		case strings.Contains(err.Error(), "not found"):
+			http.Error(w, "Version not found", http.StatusNotFound)
+		case strings.Contains(err.Error(), "invalid"):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update version", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
+
 func (h *FileHandler) CheckFileExists(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.VerifyToken(r)
 	if err != nil {
@@ -664,7 +904,7 @@ func (h *FileHandler) CheckFileExists(w http.ResponseWriter, r *http.Request) {
 
 	// Проверяем доступ к папке - этой проверки достаточно, так как GetFolderContent
 	// уже включает в себя проверку shared доступа
-	_, err = h.folderService.GetFolderContent(r.Context(), folderID, userID)
+	_, err = h.folderService.GetFolderContent(r.Context(), folderID, userID, domain.ListOptions{Limit: 1})
 	if err != nil {
 		if strings.Contains(err.Error(), "access denied") {
 			http.Error(w, "Access denied", http.StatusForbidden)
@@ -794,6 +1034,24 @@ func (h *FileHandler) StreamVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Стриминг отдает содержимое файла, поэтому проверяется так же, как скачивание
+	if err := h.fileService.AuthorizeDownload(r.Context(), file, userID); err != nil {
+		log.Printf("[StreamVideo] Стриминг запрещен: %v", err)
+		if strings.Contains(err.Error(), "access denied") {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Failed to check access", http.StatusInternalServerError)
+		return
+	}
+
+	versionNumber, fileSize, err := h.resolveFileVersion(r, file)
+	if err != nil {
+		log.Printf("[StreamVideo] Ошибка получения версии файла: %v", err)
+		writeFileVersionError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", file.MIMEType)
 	w.Header().Set("Accept-Ranges", "bytes")
 
@@ -802,11 +1060,11 @@ func (h *FileHandler) StreamVideo(w http.ResponseWriter, r *http.Request) {
 
 	if rangeHeader == "" {
 		start = 0
-		end = file.SizeBytes - 1
-		w.Header().Set("Content-Length", strconv.FormatInt(file.SizeBytes, 10))
+		end = fileSize - 1
+		w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
 		w.WriteHeader(http.StatusOK)
 	} else {
-		ranges, err := parseRange(rangeHeader, file.SizeBytes)
+		ranges, err := parseRange(rangeHeader, fileSize)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
 			return
@@ -820,11 +1078,11 @@ func (h *FileHandler) StreamVideo(w http.ResponseWriter, r *http.Request) {
 
 		size := end - start + 1
 		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
-		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, file.SizeBytes))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
 		w.WriteHeader(http.StatusPartialContent)
 	}
 
-	reader, err := h.fileService.GetFileDataRange(r.Context(), fileUUID, userID, start, end)
+	reader, err := h.fileService.GetFileVersionDataRange(r.Context(), fileUUID, userID, versionNumber, start, end)
 	if err != nil {
 		log.Printf("[StreamVideo] Ошибка получения данных: %v", err)
 		http.Error(w, "Failed to get file data", http.StatusInternalServerError)
@@ -939,19 +1197,30 @@ func (h *FileHandler) MoveFile(w http.ResponseWriter, r *http.Request) {
 
 	// Читаем JSON из тела запроса
 	var req struct {
-		NewFolderID int64 `json:"new_folder_id"`
+		NewFolderID    int64  `json:"new_folder_id"`
+		ConflictPolicy string `json:"conflict_policy"` // fail, rename, version или replace
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Перемещаем файл
-	if err := h.fileService.MoveFile(r.Context(), fileUUID, req.NewFolderID, userID); err != nil {
+	if err := h.fileService.MoveFile(r.Context(), fileUUID, req.NewFolderID, policy, userID); err != nil {
 		if err.Error() == "access denied" {
 			http.Error(w, "Access denied", http.StatusForbidden)
 			return
 		}
+		if strings.Contains(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to move file: %v", err), http.StatusInternalServerError)
 		return
 	}
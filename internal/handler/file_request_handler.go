@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+	"time"
+)
+
+const (
+	// fileRequestMemory - часть формы загрузки, которая держится в памяти; остальное пишется во временные файлы
+	fileRequestMemory = 32 << 20
+	// maxFileRequestBody ограничивает размер запроса на загрузку по запросу файлов
+	maxFileRequestBody = 5<<30 + 1<<20
+)
+
+type FileRequestHandler struct {
+	fileRequestService *service.FileRequestService
+	shareAudit         *service.ShareAuditService
+}
+
+func NewFileRequestHandler(fileRequestService *service.FileRequestService, shareAudit *service.ShareAuditService) *FileRequestHandler {
+	return &FileRequestHandler{fileRequestService: fileRequestService, shareAudit: shareAudit}
+}
+
+type createFileRequestRequest struct {
+	FolderID          int64      `json:"folder_id"`
+	MaxFileSize       *int64     `json:"max_file_size,omitempty"`
+	AllowedExtensions []string   `json:"allowed_extensions,omitempty"`
+	Deadline          *time.Time `json:"deadline,omitempty"`
+	Password          string     `json:"password,omitempty"`
+}
+
+// fileRequestUploadResult - результат загрузки одного файла. Загружающему
+// не показываются данные папки владельца, только имя и размер сохраненного файла
+type fileRequestUploadResult struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// CreateFileRequest создает ссылку для загрузки файлов в папку без доступа к ее содержимому
+func (h *FileRequestHandler) CreateFileRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createFileRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	request, err := h.fileRequestService.CreateFileRequest(r.Context(), req.FolderID, userID, service.FileRequestOptions{
+		MaxFileSize:       req.MaxFileSize,
+		AllowedExtensions: req.AllowedExtensions,
+		Deadline:          req.Deadline,
+		Password:          req.Password,
+	})
+	if err != nil {
+		log.Printf("[FileRequest] Failed to create file request: %v", err)
+		writeFileRequestError(w, "Failed to create file request", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(request)
+}
+
+// GetFileRequest возвращает условия запроса файлов. Доступно без авторизации
+func (h *FileRequestHandler) GetFileRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := optionalUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	request, err := h.fileRequestService.GetFileRequest(r.Context(), token, userID, linkAccessTokens(r))
+	if err != nil {
+		writeFileRequestError(w, "Failed to get file request", err)
+		return
+	}
+	h.shareAudit.RecordToken(r.Context(), token, shareAccessor(r, userID), domain.ShareAccessOpen, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// VerifyPassword проверяет пароль запроса файлов и выдает токен доступа. Доступно без авторизации
+func (h *FileRequestHandler) VerifyPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	access, err := h.fileRequestService.VerifyPassword(r.Context(), chi.URLParam(r, "token"), req.Password)
+	if err != nil {
+		log.Printf("[FileRequest] Password check failed: %v", err)
+		writeFileRequestError(w, "Failed to verify password", err)
+		return
+	}
+
+	writeLinkAccess(w, r, access)
+}
+
+// Upload принимает файлы по запросу. Доступно без авторизации.
+// Форма: uploader_name, uploader_email и один или несколько файлов в поле files
+func (h *FileRequestHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID, err := optionalUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileRequestBody)
+	if err := r.ParseMultipartForm(fileRequestMemory); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["files"]
+	if len(headers) == 0 {
+		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	accessTokens := linkAccessTokens(r)
+	uploader := domain.Uploader{
+		UserID: userID,
+		Name:   r.FormValue("uploader_name"),
+		Email:  r.FormValue("uploader_email"),
+	}
+
+	results := make([]fileRequestUploadResult, 0, len(headers))
+	uploaded := 0
+	for _, header := range headers {
+		result := fileRequestUploadResult{Name: header.Filename}
+		file, err := header.Open()
+		if err != nil {
+			result.Error = "failed to read file"
+			results = append(results, result)
+			continue
+		}
+
+		stored, err := h.fileRequestService.Upload(r.Context(), token, accessTokens, uploader, header, file)
+		file.Close()
+		if err != nil {
+			// Ошибки самой ссылки относятся ко всем файлам запроса
+			if isFileRequestLinkError(err) {
+				writeFileRequestError(w, "Failed to upload file", err)
+				return
+			}
+			log.Printf("[FileRequest] Failed to upload %s: %v", header.Filename, err)
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		h.shareAudit.RecordToken(r.Context(), token, shareAccessor(r, userID), domain.ShareAccessUpload, stored.UUID.String())
+		result.Name = stored.Name
+		result.Size = stored.SizeBytes
+		results = append(results, result)
+		uploaded++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if uploaded == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Results []fileRequestUploadResult `json:"results"`
+	}{Results: results})
+}
+
+// ListUploads возвращает владельцу файлы, загруженные по его запросу файлов
+func (h *FileRequestHandler) ListUploads(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uploads, err := h.fileRequestService.ListUploads(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		log.Printf("[FileRequest] Failed to list uploads: %v", err)
+		writeFileRequestError(w, "Failed to get uploads", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploads)
+}
+
+// optionalUserID возвращает пользователя, если запрос авторизован, и пустую строку для анонимного запроса
+func optionalUserID(r *http.Request) (string, error) {
+	if r.Header.Get("Authorization") == "" {
+		return "", nil
+	}
+	return auth.VerifyToken(r)
+}
+
+func isFileRequestLinkError(err error) bool {
+	return strings.Contains(err.Error(), "file request not found") ||
+		strings.Contains(err.Error(), "password required")
+}
+
+// writeFileRequestError преобразует ошибку сервиса в HTTP ответ
+func writeFileRequestError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "password required"):
+		writePasswordChallenge(w)
+	case strings.Contains(err.Error(), "wrong password"):
+		http.Error(w, "Wrong password", http.StatusForbidden)
+	case strings.Contains(err.Error(), "too many password attempts"):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "not enough storage space"):
+		http.Error(w, "Not enough storage space", http.StatusInsufficientStorage)
+	case strings.Contains(err.Error(), "invalid"),
+		strings.Contains(err.Error(), "exceeds maximum"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
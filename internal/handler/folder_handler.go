@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"synxrondrive/internal/auth"
 	"synxrondrive/internal/domain"
 	"synxrondrive/internal/service"
@@ -84,9 +85,23 @@ func (h *FolderHandler) GetFolderContent(w http.ResponseWriter, r *http.Request)
 		log.Printf("Getting content for folder ID: %d", folderID)
 	}
 
-	content, err := h.folderService.GetFolderContent(r.Context(), folderID, userID)
+	opts, err := parseListOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	content, err := h.folderService.GetFolderContent(r.Context(), folderID, userID, opts)
 	if err != nil {
 		log.Printf("Error getting folder content: %v", err)
+		if strings.Contains(err.Error(), "access denied") {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to get folder content: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -95,15 +110,17 @@ func (h *FolderHandler) GetFolderContent(w http.ResponseWriter, r *http.Request)
 
 	// Изменённая структура ответа
 	response := struct {
-		FolderID int64           `json:"folder_id"`
-		Folder   *domain.Folder  `json:"folder,omitempty"` // Добавляем информацию о текущей папке
-		Files    []domain.File   `json:"files"`
-		Folders  []domain.Folder `json:"folders"`
+		FolderID int64            `json:"folder_id"`
+		Folder   *domain.Folder   `json:"folder,omitempty"` // Добавляем информацию о текущей папке
+		Files    []domain.File    `json:"files"`
+		Folders  []domain.Folder  `json:"folders"`
+		Page     *domain.PageInfo `json:"page"`
 	}{
 		FolderID: folderID,
 		Folder:   &content.Folder, // Включаем информацию о текущей папке
 		Files:    content.Files,
 		Folders:  content.Folders,
+		Page:     content.Page,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -217,22 +234,76 @@ func (h *FolderHandler) MoveFolder(w http.ResponseWriter, r *http.Request) {
 
 	// Читаем JSON из тела запроса
 	var req struct {
-		NewParentID int64 `json:"new_parent_id"`
+		NewParentID    int64  `json:"new_parent_id"`
+		ConflictPolicy string `json:"conflict_policy"` // fail, rename, version или replace
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Перемещаем папку
-	if err := h.folderService.MoveFolder(r.Context(), folderID, req.NewParentID, userID); err != nil {
+	if err := h.folderService.MoveFolder(r.Context(), folderID, req.NewParentID, policy, userID); err != nil {
 		if err.Error() == "access denied" {
 			http.Error(w, "Access denied", http.StatusForbidden)
 			return
 		}
+		if strings.Contains(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to move folder: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// parseListOptions разбирает параметры постраничного вывода содержимого папки:
+// sort, order, limit, cursor, category и context_type
+func parseListOptions(r *http.Request) (domain.ListOptions, error) {
+	query := r.URL.Query()
+	opts := domain.ListOptions{
+		Sort:         domain.ListSort(query.Get("sort")),
+		Limit:        domain.DefaultListLimit,
+		Cursor:       query.Get("cursor"),
+		MIMECategory: query.Get("category"),
+		ContextType:  query.Get("context_type"),
+	}
+
+	switch opts.Sort {
+	case "":
+		opts.Sort = domain.ListSortName
+	case domain.ListSortName, domain.ListSortSize, domain.ListSortType, domain.ListSortCreatedAt, domain.ListSortUpdatedAt:
+	default:
+		return opts, fmt.Errorf("invalid sort: %s", opts.Sort)
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("invalid order: must be 'asc' or 'desc'")
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > domain.MaxListLimit {
+			return opts, fmt.Errorf("invalid limit: must be between 1 and %d", domain.MaxListLimit)
+		}
+		opts.Limit = limit
+	}
+
+	if _, ok := domain.MIMECategories[opts.MIMECategory]; opts.MIMECategory != "" && !ok {
+		return opts, fmt.Errorf("invalid category: %s", opts.MIMECategory)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+	"time"
+)
+
+type SearchHandler struct {
+	searchService *service.SearchService
+}
+
+func NewSearchHandler(searchService *service.SearchService) *SearchHandler {
+	return &SearchHandler{searchService: searchService}
+}
+
+// Search ищет файлы и папки по имени и содержимому документов.
+// Параметры: q, type, mime_type, min_size, max_size, updated_from, updated_to,
+// owner_id ("me" - только свои), folder_id, tag_id (можно указать несколько), limit, offset
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query, err := parseSearchQuery(r.URL.Query(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.searchService.Search(r.Context(), query, userID)
+	if err != nil {
+		log.Printf("[Search] Failed to search for user %s: %v", userID, err)
+		if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to search", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseSearchQuery разбирает параметры поискового запроса
+func parseSearchQuery(values url.Values, userID string) (domain.SearchQuery, error) {
+	query := domain.SearchQuery{
+		Text:     values.Get("q"),
+		ItemType: values.Get("type"),
+		MIMEType: values.Get("mime_type"),
+		OwnerID:  values.Get("owner_id"),
+	}
+	if query.OwnerID == "me" {
+		query.OwnerID = userID
+	}
+
+	var err error
+	if query.MinSize, err = parseOptionalInt(values, "min_size"); err != nil {
+		return query, err
+	}
+	if query.MaxSize, err = parseOptionalInt(values, "max_size"); err != nil {
+		return query, err
+	}
+	if query.FolderID, err = parseOptionalInt(values, "folder_id"); err != nil {
+		return query, err
+	}
+	if query.UpdatedFrom, err = parseOptionalDate(values, "updated_from", false); err != nil {
+		return query, err
+	}
+	if query.UpdatedTo, err = parseOptionalDate(values, "updated_to", true); err != nil {
+		return query, err
+	}
+	for _, value := range values["tag_id"] {
+		for _, part := range strings.Split(value, ",") {
+			tagID, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid tag_id")
+			}
+			query.TagIDs = append(query.TagIDs, tagID)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			return query, fmt.Errorf("invalid limit")
+		}
+	}
+	if offset := values.Get("offset"); offset != "" {
+		if query.Offset, err = strconv.Atoi(offset); err != nil || query.Offset < 0 {
+			return query, fmt.Errorf("invalid offset")
+		}
+	}
+	return query, nil
+}
+
+func parseOptionalInt(values url.Values, name string) (*int64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number < 0 {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &number, nil
+}
+
+// parseOptionalDate принимает дату в формате RFC 3339 или YYYY-MM-DD.
+// Для конца диапазона дата без времени включает весь день
+func parseOptionalDate(values url.Values, name string, endOfRange bool) (*time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected RFC 3339 or YYYY-MM-DD", name)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"synxrondrive/internal/auth"
 	"synxrondrive/internal/domain"
 	"synxrondrive/internal/service"
@@ -16,6 +17,7 @@ import (
 
 type ShareHandler struct {
 	shareService *service.ShareService
+	shareAudit   *service.ShareAuditService
 }
 
 type createShareRequest struct {
@@ -23,10 +25,19 @@ type createShareRequest struct {
 	ResourceType domain.ResourceType `json:"resource_type"`
 	AccessType   domain.AccessType   `json:"access_type"`
 	ExpiresIn    *int64              `json:"expires_in,omitempty"`
+	Password     string              `json:"password,omitempty"`
+	MaxDownloads *int                `json:"max_downloads,omitempty"`
+	PreviewOnly  bool                `json:"preview_only,omitempty"`
 }
 
-func NewShareHandler(shareService *service.ShareService) *ShareHandler {
-	return &ShareHandler{shareService: shareService}
+// linkAccessHeader - заголовок с токеном доступа к ссылке с паролем
+const linkAccessHeader = "X-Share-Access"
+
+// linkAccessCookiePrefix - префикс cookie с токеном доступа, к нему добавляется ID ссылки
+const linkAccessCookiePrefix = "share_access_"
+
+func NewShareHandler(shareService *service.ShareService, shareAudit *service.ShareAuditService) *ShareHandler {
+	return &ShareHandler{shareService: shareService, shareAudit: shareAudit}
 }
 
 // handler/share_handler.go
@@ -64,10 +75,15 @@ func (h *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
 		req.AccessType,
 		expiresIn,
 		userID,
+		service.ShareLinkOptions{
+			Password:     req.Password,
+			MaxDownloads: req.MaxDownloads,
+			PreviewOnly:  req.PreviewOnly,
+		},
 	)
 	if err != nil {
 		log.Printf("[CreateShare] Failed to create share: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create share: %v", err), http.StatusInternalServerError)
+		writeShareError(w, "Failed to create share", err)
 		return
 	}
 
@@ -80,6 +96,9 @@ func (h *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
 		Token        string              `json:"token"`
 		ExpiresAt    *time.Time          `json:"expires_at,omitempty"`
 		CreatedAt    time.Time           `json:"created_at"`
+		Password     bool                `json:"password_protected"`
+		MaxDownloads *int                `json:"max_downloads,omitempty"`
+		PreviewOnly  bool                `json:"preview_only"`
 	}{
 		ID:           share.ID.String(),
 		ResourceID:   share.ResourceID,
@@ -88,6 +107,9 @@ func (h *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
 		Token:        share.Token,
 		ExpiresAt:    share.ExpiresAt,
 		CreatedAt:    share.CreatedAt,
+		Password:     share.HasPassword(),
+		MaxDownloads: share.MaxDownloads,
+		PreviewOnly:  share.PreviewOnly,
 	}
 
 	log.Printf("[CreateShare] Successfully created share with ID: %s", share.ID)
@@ -120,10 +142,10 @@ func (h *ShareHandler) GetSharedResource(w http.ResponseWriter, r *http.Request)
 	}
 	log.Printf("[GetSharedResource] Path parameter: %s", path)
 
-	content, err := h.shareService.GetSharedContent(r.Context(), shareID, path, userID)
+	content, err := h.shareService.GetSharedContent(r.Context(), shareID, path, userID, linkAccessTokens(r))
 	if err != nil {
 		log.Printf("[GetSharedResource] Error getting content: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeShareError(w, "Failed to get shared content", err)
 		return
 	}
 
@@ -131,6 +153,11 @@ func (h *ShareHandler) GetSharedResource(w http.ResponseWriter, r *http.Request)
 		log.Printf("[GetSharedResource] Error adding user to share: %v", err)
 		// Не возвращаем ошибку, так как доступ уже получен
 	}
+	var folderID string
+	if strings.HasPrefix(path, "/folders/") {
+		folderID = strings.TrimPrefix(path, "/folders/")
+	}
+	h.shareAudit.RecordShare(r.Context(), shareID, shareAccessor(r, userID), domain.ShareAccessBrowse, folderID)
 
 	log.Printf("[GetSharedResource] Successfully retrieved content for share %s", shareID)
 	w.Header().Set("Content-Type", "application/json")
@@ -188,13 +215,14 @@ func (h *ShareHandler) GrantAccess(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[GrantAccess] Requested folder ID: %s", requestBody.FolderID)
 
 	// Получаем share и проверяем доступ
-	share, resource, err := h.shareService.GrantAccess(r.Context(), token, userID)
+	share, resource, err := h.shareService.GrantAccess(r.Context(), token, userID, linkAccessTokens(r))
 	if err != nil {
 		log.Printf("[GrantAccess] Error granting access: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeShareError(w, "Failed to grant access", err)
 		return
 	}
 	log.Printf("[GrantAccess] Access granted for share: %s", share.ID)
+	h.shareAudit.RecordShare(r.Context(), share.ID.String(), shareAccessor(r, userID), domain.ShareAccessGrant, requestBody.FolderID)
 
 	if requestBody.FolderID != "" {
 		log.Printf("[GrantAccess] Retrieving content for folder: %s", requestBody.FolderID)
@@ -203,6 +231,7 @@ func (h *ShareHandler) GrantAccess(w http.ResponseWriter, r *http.Request) {
 			share.ID.String(),
 			fmt.Sprintf("/folders/%s", requestBody.FolderID),
 			userID,
+			linkAccessTokens(r),
 		)
 		if err != nil {
 			log.Printf("[GrantAccess] Error getting folder content: %v", err)
@@ -267,15 +296,34 @@ func (h *ShareHandler) GetSharedFolderContent(w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	opts, err := parseListOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Получаем содержимое через ShareRepository
-	content, err := h.shareService.GetSharedFolderContent(r.Context(), token, folderID, userID)
+	content, err := h.shareService.GetSharedFolderContent(r.Context(), token, folderID, userID, linkAccessTokens(r), opts)
 	if err != nil {
 		log.Printf("[GetSharedFolderContent] Failed to get folder content: %v", err)
+		if strings.Contains(err.Error(), "password required") {
+			writePasswordChallenge(w)
+			return
+		}
+		if strings.Contains(err.Error(), "access denied") {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to get folder content: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	log.Printf("[GetSharedFolderContent] Successfully retrieved folder content")
+	h.shareAudit.RecordToken(r.Context(), token, shareAccessor(r, userID), domain.ShareAccessBrowse, folderID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(content)
 }
@@ -296,8 +344,12 @@ func (h *ShareHandler) GetSharedFolderStructure(w http.ResponseWriter, r *http.R
 	}
 
 	// Получаем структуру папок
-	folders, err := h.shareService.GetSharedFolderStructure(r.Context(), shareID, userID)
+	folders, err := h.shareService.GetSharedFolderStructure(r.Context(), shareID, userID, linkAccessTokens(r))
 	if err != nil {
+		if strings.Contains(err.Error(), "password required") {
+			writePasswordChallenge(w)
+			return
+		}
 		if err.Error() == "access denied" {
 			http.Error(w, "Access denied", http.StatusForbidden)
 			return
@@ -305,8 +357,247 @@ func (h *ShareHandler) GetSharedFolderStructure(w http.ResponseWriter, r *http.R
 		http.Error(w, fmt.Sprintf("Failed to get folder structure: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.shareAudit.RecordShare(r.Context(), shareID, shareAccessor(r, userID), domain.ShareAccessBrowse, "")
 
 	// Отправляем ответ
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(folders)
 }
+
+// updateShareRequest - изменения ссылки. expires_in задается в секундах, 0 снимает ограничение срока.
+// recipients заменяет список получателей: [{"id": "...", "access_type": "view"}]
+type updateShareRequest struct {
+	AccessType   *domain.AccessType       `json:"access_type,omitempty"`
+	ExpiresIn    *int64                   `json:"expires_in,omitempty"`
+	Recipients   *[]domain.ShareRecipient `json:"recipients,omitempty"`
+	Password     *string                  `json:"password,omitempty"`      // "" снимает пароль
+	MaxDownloads *int                     `json:"max_downloads,omitempty"` // 0 снимает лимит
+	PreviewOnly  *bool                    `json:"preview_only,omitempty"`
+}
+
+// ListMyShares возвращает все ссылки текущего пользователя
+func (h *ShareHandler) ListMyShares(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shares, err := h.shareService.ListMyShares(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ListMyShares] Failed to get shares of user %s: %v", userID, err)
+		writeShareError(w, "Failed to get shares", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// UpdateShare изменяет уровень доступа, срок действия и получателей ссылки
+func (h *ShareHandler) UpdateShare(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req updateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	update := service.ShareUpdate{
+		AccessType:   req.AccessType,
+		Recipients:   req.Recipients,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		PreviewOnly:  req.PreviewOnly,
+	}
+	if req.ExpiresIn != nil {
+		duration := time.Duration(*req.ExpiresIn) * time.Second
+		update.ExpiresIn = &duration
+	}
+
+	shareID := chi.URLParam(r, "id")
+	share, err := h.shareService.UpdateShare(r.Context(), shareID, userID, update)
+	if err != nil {
+		log.Printf("[UpdateShare] Failed to update share %s: %v", shareID, err)
+		writeShareError(w, "Failed to update share", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(share)
+}
+
+// DeleteShare отзывает ссылку
+func (h *ShareHandler) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shareID := chi.URLParam(r, "id")
+	if err := h.shareService.RevokeShare(r.Context(), shareID, userID); err != nil {
+		log.Printf("[DeleteShare] Failed to revoke share %s: %v", shareID, err)
+		writeShareError(w, "Failed to revoke share", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedByToken возвращает ресурс, открытый по ссылке. Для ссылки с паролем
+// возвращается запрос пароля, пока он не проверен через POST /password
+func (h *ShareHandler) GetSharedByToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	resource, err := h.shareService.OpenLink(r.Context(), token, userID, linkAccessTokens(r))
+	if err != nil {
+		log.Printf("[GetSharedByToken] Failed to open link: %v", err)
+		writeShareError(w, "Failed to open link", err)
+		return
+	}
+	h.shareAudit.RecordToken(r.Context(), token, shareAccessor(r, userID), domain.ShareAccessOpen, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
+
+// VerifyLinkPassword проверяет пароль ссылки и выдает токен доступа. Токен
+// возвращается в ответе и в cookie; его также можно передать в заголовке X-Share-Access
+func (h *ShareHandler) VerifyLinkPassword(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.VerifyToken(r); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	access, err := h.shareService.VerifyLinkPassword(r.Context(), chi.URLParam(r, "token"), req.Password)
+	if err != nil {
+		log.Printf("[VerifyLinkPassword] Password check failed: %v", err)
+		writeShareError(w, "Failed to verify password", err)
+		return
+	}
+
+	writeLinkAccess(w, r, access)
+}
+
+// writeLinkAccess отдает токен доступа к ссылке в ответе и в cookie
+func writeLinkAccess(w http.ResponseWriter, r *http.Request, access *domain.LinkAccess) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkAccessCookiePrefix + access.ShareID.String(),
+		Value:    access.AccessToken,
+		Path:     "/",
+		Expires:  access.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(access)
+}
+
+// GetAccessLog возвращает владельцу журнал обращений к ссылке. Параметры: limit, offset
+func (h *ShareHandler) GetAccessLog(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var limit, offset int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.shareAudit.GetAccessLog(r.Context(), chi.URLParam(r, "id"), userID, limit, offset)
+	if err != nil {
+		log.Printf("[ShareAudit] Failed to get access log: %v", err)
+		writeShareError(w, "Failed to get access log", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// shareAccessor описывает обратившегося к ссылке: пользователя или, если запрос
+// анонимный, его IP
+func shareAccessor(r *http.Request, userID string) domain.ShareAccessor {
+	if userID != "" {
+		return domain.ShareAccessor{UserID: userID}
+	}
+	return domain.ShareAccessor{IP: ClientIP(r)}
+}
+
+// linkAccessTokens собирает токены доступа к ссылкам из заголовка и cookie запроса
+func linkAccessTokens(r *http.Request) []string {
+	var tokens []string
+	if token := r.Header.Get(linkAccessHeader); token != "" {
+		tokens = append(tokens, token)
+	}
+	for _, cookie := range r.Cookies() {
+		if strings.HasPrefix(cookie.Name, linkAccessCookiePrefix) && cookie.Value != "" {
+			tokens = append(tokens, cookie.Value)
+		}
+	}
+	return tokens
+}
+
+// writePasswordChallenge сообщает клиенту, что ссылка защищена паролем
+func writePasswordChallenge(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":             "password required",
+		"password_required": true,
+	})
+}
+
+// writeShareError преобразует ошибку сервиса в HTTP ответ
+func writeShareError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "password required"):
+		writePasswordChallenge(w)
+	case strings.Contains(err.Error(), "wrong password"):
+		http.Error(w, "Wrong password", http.StatusForbidden)
+	case strings.Contains(err.Error(), "too many password attempts"):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case strings.Contains(err.Error(), "download limit reached"):
+		http.Error(w, "Download limit reached", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type TagHandler struct {
+	tagService *service.TagService
+}
+
+// tagRequest - тело запроса на создание или изменение метки
+type tagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// tagItemRequest - элемент, который нужно отметить меткой
+type tagItemRequest struct {
+	ItemType domain.ResourceType `json:"item_type"`
+	ItemID   string              `json:"item_id"`
+}
+
+func NewTagHandler(tagService *service.TagService) *TagHandler {
+	return &TagHandler{tagService: tagService}
+}
+
+// ListTags возвращает метки пользователя
+func (h *TagHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tags, err := h.tagService.ListTags(r.Context(), userID)
+	if err != nil {
+		log.Printf("[Tags] Failed to list tags for user %s: %v", userID, err)
+		writeTagError(w, "Failed to list tags", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// CreateTag создает метку
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag := &domain.Tag{OwnerID: userID, Name: *req.Name}
+	if req.Color != nil {
+		tag.Color = *req.Color
+	}
+
+	if err := h.tagService.CreateTag(r.Context(), tag); err != nil {
+		log.Printf("[Tags] Failed to create tag: %v", err)
+		writeTagError(w, "Failed to create tag", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag переименовывает метку или меняет ее цвет
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.tagService.UpdateTag(r.Context(), tagID, req.Name, req.Color, userID)
+	if err != nil {
+		log.Printf("[Tags] Failed to update tag %d: %v", tagID, err)
+		writeTagError(w, "Failed to update tag", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag удаляет метку
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.tagService.DeleteTag(r.Context(), tagID, userID); err != nil {
+		log.Printf("[Tags] Failed to delete tag %d: %v", tagID, err)
+		writeTagError(w, "Failed to delete tag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTaggedItems возвращает все файлы и папки с меткой
+func (h *TagHandler) GetTaggedItems(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.tagService.GetTaggedItems(r.Context(), tagID, userID)
+	if err != nil {
+		log.Printf("[Tags] Failed to get items of tag %d: %v", tagID, err)
+		writeTagError(w, "Failed to get tagged items", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// TagItem отмечает файл или папку меткой
+func (h *TagHandler) TagItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req tagItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.tagService.TagItem(r.Context(), tagID, req.ItemType, req.ItemID, userID); err != nil {
+		log.Printf("[Tags] Failed to tag %s %s with tag %d: %v", req.ItemType, req.ItemID, tagID, err)
+		writeTagError(w, "Failed to tag item", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UntagItem снимает метку с файла или папки
+func (h *TagHandler) UntagItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	itemType := domain.ResourceType(chi.URLParam(r, "type"))
+	itemID := chi.URLParam(r, "itemID")
+	if err := h.tagService.UntagItem(r.Context(), tagID, itemType, itemID, userID); err != nil {
+		log.Printf("[Tags] Failed to untag %s %s from tag %d: %v", itemType, itemID, tagID, err)
+		writeTagError(w, "Failed to untag item", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTagError преобразует ошибку сервиса в HTTP ответ
+func writeTagError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"), strings.Contains(err.Error(), "not tagged"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	case strings.Contains(err.Error(), "already exists"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
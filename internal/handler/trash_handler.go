@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
 	"synxrondrive/internal/service"
 )
 
@@ -71,8 +73,9 @@ func (h *TrashHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
 
 	// Получаем данные из запроса
 	var req struct {
-		ItemID   string `json:"item_id"`
-		ItemType string `json:"item_type"`
+		ItemID         string `json:"item_id"`
+		ItemType       string `json:"item_type"`
+		ConflictPolicy string `json:"conflict_policy"` // fail, rename, version или replace
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -81,9 +84,19 @@ func (h *TrashHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Восстанавливаем элемент
-	if err := h.trashService.RestoreFromTrash(r.Context(), req.ItemID, req.ItemType, userID); err != nil {
+	if err := h.trashService.RestoreFromTrash(r.Context(), req.ItemID, req.ItemType, policy, userID); err != nil {
 		log.Printf("Failed to restore item: %v", err)
+		if strings.Contains(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to restore item", http.StatusInternalServerError)
 		return
 	}
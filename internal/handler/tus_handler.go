@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+// statusChecksumMismatch - код ответа tus при несовпадении контрольной суммы
+const statusChecksumMismatch = 460
+
+// TusHandler реализует сервер протокола tus 1.0 (https://tus.io/protocols/resumable-upload)
+type TusHandler struct {
+	tusService *service.TusService
+}
+
+func NewTusHandler(tusService *service.TusService) *TusHandler {
+	return &TusHandler{tusService: tusService}
+}
+
+// Middleware проверяет версию протокола и добавляет обязательные заголовки tus
+func (h *TusHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", service.TusVersion)
+
+		// Поддержка окружений, где недоступны методы PATCH и DELETE
+		if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+			r.Method = strings.ToUpper(override)
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				rctx.RouteMethod = r.Method
+			}
+		}
+
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != service.TusVersion {
+			w.Header().Set("Tus-Version", service.TusVersion)
+			http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Options возвращает возможности сервера
+func (h *TusHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", service.TusVersion)
+	w.Header().Set("Tus-Extension", service.TusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.tusService.MaxSize(), 10))
+	w.Header().Set("Tus-Checksum-Algorithm", service.TusChecksumAlgorithms)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload создает новую загрузку (расширение creation)
+func (h *TusHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Deferred upload length is not supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length header", http.StatusBadRequest)
+		return
+	}
+	if length > h.tusService.MaxSize() {
+		http.Error(w, "Upload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	session, err := h.tusService.CreateUpload(r.Context(), userID, length, r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		log.Printf("[Tus] Failed to create upload: %v", err)
+		writeTusError(w, "Failed to create upload", err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+session.ID.String())
+	setTusExpires(w, session)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUpload возвращает текущее смещение загрузки
+func (h *TusHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	session, err := h.tusService.GetUpload(r.Context(), id, userID)
+	if err != nil {
+		writeTusError(w, "Failed to get upload", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.TotalSize, 10))
+	if session.Metadata != "" {
+		w.Header().Set("Upload-Metadata", session.Metadata)
+	}
+	setTusExpires(w, session)
+	w.WriteHeader(http.StatusOK)
+}
+
+// WriteChunk принимает очередную порцию данных загрузки
+func (h *TusHandler) WriteChunk(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	session, err := h.tusService.WriteChunk(r.Context(), id, userID, offset, r.Body, r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		log.Printf("[Tus] Failed to write to upload %s at offset %d: %v", id, offset, err)
+		writeTusError(w, "Failed to write upload data", err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	setTusExpires(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Terminate отменяет загрузку (расширение termination)
+func (h *TusHandler) Terminate(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.tusService.Terminate(r.Context(), id, userID); err != nil {
+		log.Printf("[Tus] Failed to terminate upload %s: %v", id, err)
+		writeTusError(w, "Failed to terminate upload", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setTusExpires добавляет заголовок Upload-Expires для незавершенных загрузок (расширение expiration)
+func setTusExpires(w http.ResponseWriter, session *domain.UploadSession) {
+	if session.Status == domain.UploadSessionActive {
+		w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeTusError преобразует ошибку сервиса в ответ с кодом, принятым в протоколе tus
+func writeTusError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "not active"):
+		http.Error(w, "Upload expired or terminated", http.StatusGone)
+	case strings.Contains(err.Error(), "offset mismatch"):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(err.Error(), "checksum mismatch"):
+		http.Error(w, "Checksum mismatch", statusChecksumMismatch)
+	case strings.Contains(err.Error(), "not enough storage space"),
+		strings.Contains(err.Error(), "exceeds"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusRequestEntityTooLarge)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/service"
+)
+
+type UploadSessionHandler struct {
+	sessionService *service.UploadSessionService
+}
+
+func NewUploadSessionHandler(sessionService *service.UploadSessionService) *UploadSessionHandler {
+	return &UploadSessionHandler{sessionService: sessionService}
+}
+
+type createUploadSessionRequest struct {
+	FolderID  int64  `json:"folder_id"`
+	FileName  string `json:"file_name"`
+	MIMEType  string `json:"mime_type"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+}
+
+// CreateSession обрабатывает запрос на создание сессии загрузки
+func (h *UploadSessionHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createUploadSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.FileName == "" {
+		http.Error(w, "File name is required", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(
+		r.Context(),
+		userID,
+		req.FolderID,
+		req.FileName,
+		req.MIMEType,
+		req.Size,
+		req.ChunkSize,
+	)
+	if err != nil {
+		log.Printf("[UploadSession] Failed to create session: %v", err)
+		writeUploadSessionError(w, "Failed to create upload session", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// GetSession возвращает состояние сессии и список загруженных частей
+func (h *UploadSessionHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	state, err := h.sessionService.GetSessionState(r.Context(), sessionID, userID)
+	if err != nil {
+		log.Printf("[UploadSession] Failed to get session %s: %v", sessionID, err)
+		writeUploadSessionError(w, "Failed to get upload session", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// UploadPart обрабатывает загрузку части файла. Тело запроса - байты части
+func (h *UploadSessionHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil {
+		http.Error(w, "Invalid part number", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	part, err := h.sessionService.UploadPart(r.Context(), sessionID, userID, partNumber, r.Body)
+	if err != nil {
+		log.Printf("[UploadSession] Failed to upload part %d of session %s: %v", partNumber, sessionID, err)
+		writeUploadSessionError(w, "Failed to upload part", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(part)
+}
+
+// CompleteSession завершает загрузку и возвращает созданный файл
+func (h *UploadSessionHandler) CompleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.sessionService.CompleteSession(r.Context(), sessionID, userID)
+	if err != nil {
+		log.Printf("[UploadSession] Failed to complete session %s: %v", sessionID, err)
+		writeUploadSessionError(w, "Failed to complete upload", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UploadResult{
+		File:         file,
+		IsNewVersion: file.CurrentVersion > 1,
+		Version:      file.CurrentVersion,
+	})
+}
+
+// AbortSession отменяет загрузку
+func (h *UploadSessionHandler) AbortSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sessionService.AbortSession(r.Context(), sessionID, userID); err != nil {
+		log.Printf("[UploadSession] Failed to abort session %s: %v", sessionID, err)
+		writeUploadSessionError(w, "Failed to abort upload", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadSessionError преобразует ошибку сервиса в HTTP-ответ
+func writeUploadSessionError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "not active"):
+		http.Error(w, "Upload session is not active", http.StatusConflict)
+	case strings.Contains(err.Error(), "not enough storage space"):
+		http.Error(w, "Not enough storage space", http.StatusInsufficientStorage)
+	case strings.Contains(err.Error(), "invalid"),
+		strings.Contains(err.Error(), "exceeds maximum"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
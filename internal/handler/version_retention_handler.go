@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service"
+)
+
+type VersionRetentionHandler struct {
+	retentionService *service.VersionRetentionService
+}
+
+// versionRetentionRequest - тело запроса на изменение политики хранения версий.
+// null в keep_last/keep_days снимает соответствующее ограничение
+type versionRetentionRequest struct {
+	KeepLast     *int `json:"keep_last"`
+	KeepDays     *int `json:"keep_days"`
+	CountInQuota bool `json:"count_in_quota"`
+}
+
+func NewVersionRetentionHandler(retentionService *service.VersionRetentionService) *VersionRetentionHandler {
+	return &VersionRetentionHandler{retentionService: retentionService}
+}
+
+// GetSettings возвращает настройки хранения версий пользователя
+func (h *VersionRetentionHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.retentionService.GetUserSettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("[VersionRetention] Failed to get settings: %v", err)
+		writeRetentionError(w, "Failed to get settings", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings изменяет настройки хранения версий пользователя
+func (h *VersionRetentionHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req versionRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings := &domain.VersionRetentionSettings{
+		OwnerID:      userID,
+		KeepLast:     req.KeepLast,
+		KeepDays:     req.KeepDays,
+		CountInQuota: req.CountInQuota,
+	}
+
+	if err := h.retentionService.UpdateUserSettings(r.Context(), settings); err != nil {
+		log.Printf("[VersionRetention] Failed to update settings: %v", err)
+		writeRetentionError(w, "Failed to update settings", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// GetFolderSettings возвращает переопределенные настройки папки
+func (h *VersionRetentionHandler) GetFolderSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.retentionService.GetFolderSettings(r.Context(), folderID, userID)
+	if err != nil {
+		writeRetentionError(w, "Failed to get folder settings", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateFolderSettings переопределяет настройки хранения версий для папки
+func (h *VersionRetentionHandler) UpdateFolderSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	var req versionRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings := &domain.VersionRetentionSettings{
+		OwnerID:  userID,
+		FolderID: &folderID,
+		KeepLast: req.KeepLast,
+		KeepDays: req.KeepDays,
+	}
+
+	if err := h.retentionService.UpdateFolderSettings(r.Context(), settings); err != nil {
+		log.Printf("[VersionRetention] Failed to update folder %d settings: %v", folderID, err)
+		writeRetentionError(w, "Failed to update folder settings", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// DeleteFolderSettings удаляет переопределение настроек папки
+func (h *VersionRetentionHandler) DeleteFolderSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.retentionService.DeleteFolderSettings(r.Context(), folderID, userID); err != nil {
+		writeRetentionError(w, "Failed to delete folder settings", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRetentionError преобразует ошибку сервиса в HTTP ответ
+func writeRetentionError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case strings.Contains(err.Error(), "access denied"):
+		http.Error(w, "Access denied", http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusNotFound)
+	case strings.Contains(err.Error(), "invalid"):
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,157 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log"
+	"synxrondrive/internal/service"
+	"time"
+)
+
+const (
+	indexInterval      = time.Minute      // Период проверки очереди индексации
+	indexBatchSize     = 20               // Количество файлов, обрабатываемых за один проход
+	maxIndexedFileSize = 50 * 1024 * 1024 // Файлы большего размера не индексируются
+	indexClaimTimeout  = 30 * time.Minute // Через это время незавершенная индексация начинается заново
+)
+
+// Indexer извлекает текст из документов в фоне и сохраняет его в file_contents
+// для полнотекстового поиска по содержимому. Файлы попадают в очередь триггером
+// при загрузке и при смене текущей версии
+type Indexer struct {
+	db          *sqlx.DB
+	fileService *service.FileService
+}
+
+// NewIndexer создает фоновый индексатор содержимого файлов
+func NewIndexer(db *sqlx.DB, fileService *service.FileService) *Indexer {
+	return &Indexer{
+		db:          db,
+		fileService: fileService,
+	}
+}
+
+// indexTask - файл, ожидающий индексации
+type indexTask struct {
+	FileUUID      uuid.UUID `db:"file_uuid"`
+	VersionNumber int       `db:"version_number"`
+}
+
+// Start запускает периодическую обработку очереди индексации
+func (i *Indexer) Start() {
+	go func() {
+		ticker := time.NewTicker(indexInterval)
+		for range ticker.C {
+			if err := i.ProcessQueue(context.Background()); err != nil {
+				log.Printf("[Indexer] Failed to process queue: %v", err)
+			}
+		}
+	}()
+}
+
+// ProcessQueue индексирует очередную порцию файлов из очереди
+func (i *Indexer) ProcessQueue(ctx context.Context) error {
+	for {
+		var tasks []indexTask
+		err := i.db.SelectContext(ctx, &tasks, `
+            UPDATE file_contents fc
+            SET status = 'processing',
+                updated_at = CURRENT_TIMESTAMP
+            WHERE fc.file_uuid IN (
+                SELECT file_uuid FROM file_contents
+                WHERE status = 'pending'
+                OR (status = 'processing' AND updated_at < $2)
+                ORDER BY updated_at
+                LIMIT $1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING fc.file_uuid, fc.version_number`,
+			indexBatchSize, time.Now().Add(-indexClaimTimeout))
+		if err != nil {
+			return fmt.Errorf("failed to claim files for indexing: %w", err)
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		for _, task := range tasks {
+			i.index(ctx, task)
+		}
+	}
+}
+
+// index извлекает текст одной версии файла и сохраняет результат. Если за время
+// индексации текущая версия сменилась, результат отбрасывается: триггер уже
+// вернул файл в очередь с новой версией
+func (i *Indexer) index(ctx context.Context, task indexTask) {
+	file, err := i.fileService.GetBasicFileInfo(ctx, task.FileUUID)
+	if err != nil {
+		i.finish(ctx, task, "failed", "", fmt.Sprintf("file not found: %v", err))
+		return
+	}
+
+	format := textFormat(file.MIMEType, file.Name)
+	switch {
+	case format == "":
+		i.finish(ctx, task, "unsupported", "", "")
+		return
+	case file.SizeBytes > maxIndexedFileSize:
+		i.finish(ctx, task, "unsupported", "", "file is too large for indexing")
+		return
+	}
+
+	data, err := i.fileService.GetFileVersionDataDirect(ctx, task.FileUUID, task.VersionNumber)
+	if err != nil {
+		i.finish(ctx, task, "failed", "", err.Error())
+		return
+	}
+	if closer, ok := data.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, err := io.ReadAll(io.LimitReader(data, maxIndexedFileSize+1))
+	if err != nil {
+		i.finish(ctx, task, "failed", "", fmt.Sprintf("failed to read file: %v", err))
+		return
+	}
+
+	text, err := extractText(ctx, format, file.Name, content)
+	if err != nil {
+		log.Printf("[Indexer] Failed to extract text from file %s: %v", task.FileUUID, err)
+		i.finish(ctx, task, "failed", "", err.Error())
+		return
+	}
+
+	i.finish(ctx, task, "indexed", text, "")
+	log.Printf("[Indexer] Indexed file %s version %d (%d bytes of text)", task.FileUUID, task.VersionNumber, len(text))
+}
+
+// finish сохраняет результат индексации, если файл все еще ожидает эту версию
+func (i *Indexer) finish(ctx context.Context, task indexTask, status string, text string, errorMessage string) {
+	var content, message *string
+	if status == "indexed" {
+		content = &text
+	}
+	if errorMessage != "" {
+		message = &errorMessage
+	}
+
+	_, err := i.db.ExecContext(ctx, `
+        UPDATE file_contents
+        SET status = $3,
+            content = $4,
+            content_tsv = to_tsvector('simple', COALESCE($4, '')),
+            error = $5,
+            indexed_at = CURRENT_TIMESTAMP,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE file_uuid = $1
+        AND version_number = $2
+        AND status = 'processing'`,
+		task.FileUUID, task.VersionNumber, status, content, message)
+	if err != nil {
+		log.Printf("[Indexer] Failed to save index of file %s: %v", task.FileUUID, err)
+	}
+}
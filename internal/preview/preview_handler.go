@@ -6,18 +6,32 @@ import (
 	"github.com/google/uuid"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/handler"
 	"synxrondrive/internal/service"
 )
 
 type Handler struct {
-	service     *Service
-	fileService *service.FileService
+	service         *Service
+	fileService     *service.FileService
+	activityService *service.ActivityService
+	shareAudit      *service.ShareAuditService
 }
 
-func NewHandler(service *Service, fileService *service.FileService) *Handler {
+func NewHandler(
+	service *Service,
+	fileService *service.FileService,
+	activityService *service.ActivityService,
+	shareAudit *service.ShareAuditService,
+) *Handler {
 	return &Handler{
-		service:     service,
-		fileService: fileService,
+		service:         service,
+		fileService:     fileService,
+		activityService: activityService,
+		shareAudit:      shareAudit,
 	}
 }
 
@@ -38,19 +52,37 @@ func (h *Handler) GetPreview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Номер версии из параметра ?version=N, по умолчанию текущая
+	version := 0
+	if param := r.URL.Query().Get("version"); param != "" {
+		version, err = strconv.Atoi(param)
+		if err != nil || version < 1 {
+			http.Error(w, "Invalid version number", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Получаем данные файла напрямую из S3 без проверки прав доступа
-	fileData, err := h.fileService.GetFileDataDirect(r.Context(), fileUUID)
+	fileData, err := h.fileService.GetFileVersionDataDirect(r.Context(), fileUUID, version)
 	if err != nil {
 		log.Printf("Failed to get file data: %v", err)
-		http.Error(w, "Failed to get file data", http.StatusInternalServerError)
+		switch {
+		case strings.Contains(err.Error(), "version not found"):
+			http.Error(w, "Version not found", http.StatusNotFound)
+		case strings.Contains(err.Error(), "no longer available"):
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			http.Error(w, "Failed to get file data", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	// Получаем или генерируем превью
-	previewData, err := h.service.GetOrGeneratePreview(
+	previewData, err := h.service.GetOrGenerateVersionPreview(
 		r.Context(),
 		fileUUID.String(),
 		file.MIMEType,
+		version,
 		fileData,
 	)
 	if err != nil {
@@ -59,6 +91,25 @@ func (h *Handler) GetPreview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Просмотр по ссылке (?share_token=) попадает в ее журнал, в том числе без авторизации.
+	// Авторизованный просмотр попадает в недавние и в журналы ссылок, открытых пользователю
+	userID, err := auth.VerifyToken(r)
+	if err != nil {
+		userID = ""
+	}
+	if token := r.URL.Query().Get("share_token"); token != "" {
+		accessor := domain.ShareAccessor{UserID: userID}
+		if userID == "" {
+			accessor.IP = handler.ClientIP(r)
+		}
+		h.shareAudit.RecordTokenFileAccess(r.Context(), token, accessor, file, domain.ShareAccessPreview)
+	} else if userID != "" {
+		h.shareAudit.RecordFileAccess(r.Context(), file, userID, domain.ShareAccessPreview)
+	}
+	if userID != "" {
+		h.activityService.RecordFile(r.Context(), userID, fileUUID, domain.ActivityPreview)
+	}
+
 	// Устанавливаем заголовки
 	w.Header().Set("Content-Type", "image/jpeg")
 	w.Header().Set("Cache-Control", "public, max-age=86400") // кешируем на 24 часа
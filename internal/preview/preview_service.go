@@ -107,7 +107,13 @@ func (s *Service) cleanupOldPreviews(ctx context.Context) {
 
 // GetOrGeneratePreview получает или генерирует превью файла
 func (s *Service) GetOrGeneratePreview(ctx context.Context, fileUUID string, fileType string, data io.Reader) ([]byte, error) {
-	log.Printf("[Preview] Запрос превью для файла: %s (тип: %s)", fileUUID, fileType)
+	return s.GetOrGenerateVersionPreview(ctx, fileUUID, fileType, 0, data)
+}
+
+// GetOrGenerateVersionPreview получает или генерирует превью указанной версии файла.
+// Нулевой номер версии означает текущую версию
+func (s *Service) GetOrGenerateVersionPreview(ctx context.Context, fileUUID string, fileType string, requestedVersion int, data io.Reader) ([]byte, error) {
+	log.Printf("[Preview] Запрос превью для файла: %s (тип: %s, версия: %d)", fileUUID, fileType, requestedVersion)
 
 	// Получаем информацию о файле
 	var ownerID string
@@ -121,6 +127,12 @@ func (s *Service) GetOrGeneratePreview(ctx context.Context, fileUUID string, fil
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	// Записи видеоконференций хранятся отдельно и бывают только в текущей версии
+	isCurrentVersion := requestedVersion == 0 || requestedVersion == version
+	if !isCurrentVersion {
+		version = requestedVersion
+	}
+
 	// Формируем ключ для превью в S3 с учетом версии и owner_id
 	previewKey := fmt.Sprintf("personal_drive_files/%s/%s%s_v%d", ownerID, previewPrefix, fileUUID, version)
 
@@ -135,7 +147,7 @@ func (s *Service) GetOrGeneratePreview(ctx context.Context, fileUUID string, fil
 	log.Printf("[Preview] Превью не найдено, генерируем новое")
 
 	// Пробуем определить альтернативный путь для записей видеоконференций
-	if fileType == "video/mp4" {
+	if fileType == "video/mp4" && isCurrentVersion {
 		// Пробуем путь для записей LiveKit
 		alternativePath := fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, fileName)
 		log.Printf("[Preview] Пробуем альтернативный путь для записи: %s", alternativePath)
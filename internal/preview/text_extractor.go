@@ -0,0 +1,131 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"synxrondrive/internal/domain"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxIndexedTextBytes = 512 * 1024      // tsvector не может превышать 1 МБ
+	extractTimeout      = 2 * time.Minute // Таймаут извлечения текста из одного файла
+	officeProfileDir    = "/tmp/.indexer" // Отдельный профиль LibreOffice, чтобы не мешать генерации превью
+	officeProfileURL    = "file://" + officeProfileDir
+)
+
+// Форматы, из которых извлекается текст
+const (
+	textFormatPlain  = "plain"
+	textFormatPDF    = "pdf"
+	textFormatOffice = "office"
+)
+
+// textFormats - MIME-типы индексируемых файлов
+var textFormats = map[string]string{
+	"text/plain":      textFormatPlain,
+	"text/markdown":   textFormatPlain,
+	"text/x-markdown": textFormatPlain,
+	"application/pdf": textFormatPDF,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   textFormatOffice,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         textFormatOffice,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": textFormatOffice,
+	"application/vnd.oasis.opendocument.text":                                   textFormatOffice,
+}
+
+// textExtensions - расширения индексируемых файлов на случай неточного MIME-типа
+var textExtensions = map[string]string{
+	".txt":      textFormatPlain,
+	".md":       textFormatPlain,
+	".markdown": textFormatPlain,
+	".pdf":      textFormatPDF,
+	".docx":     textFormatOffice,
+	".xlsx":     textFormatOffice,
+	".pptx":     textFormatOffice,
+	".odt":      textFormatOffice,
+}
+
+// textFormat определяет формат файла для извлечения текста; пустая строка - формат не поддерживается
+func textFormat(mimeType string, fileName string) string {
+	if format, ok := textFormats[strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))]; ok {
+		return format
+	}
+	return textExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// extractText извлекает простой текст из файла. PDF обрабатывается утилитой pdftotext
+// из poppler, офисные документы предварительно конвертируются в PDF через LibreOffice
+func extractText(ctx context.Context, format string, fileName string, data []byte) (string, error) {
+	if format == textFormatPlain {
+		// Пробелы схлопываются при нормализации, поэтому берем текст с запасом
+		if len(data) > 2*maxIndexedTextBytes {
+			data = data[:2*maxIndexedTextBytes]
+		}
+		return normalizeText(string(data)), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, extractTimeout)
+	defer cancel()
+
+	tmpPath := filepath.Join(tmpDir, fmt.Sprintf("index_%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(tmpPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	inputPath := filepath.Join(tmpPath, "input"+strings.ToLower(filepath.Ext(fileName)))
+	if format == textFormatPDF {
+		inputPath = filepath.Join(tmpPath, "input.pdf")
+	}
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write input file: %w", err)
+	}
+
+	pdfPath := inputPath
+	if format == textFormatOffice {
+		cmd := exec.CommandContext(ctx, "soffice",
+			"-env:UserInstallation="+officeProfileURL,
+			"--headless",
+			"--convert-to", "pdf",
+			"--outdir", tmpPath,
+			inputPath,
+		)
+		cmd.Env = append(os.Environ(),
+			"HOME=/tmp",
+			"TMPDIR=/tmp",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to convert document to PDF: %w (output: %s)", err, string(out))
+		}
+		pdfPath = strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".pdf"
+	}
+
+	out, err := exec.CommandContext(ctx, "pdftotext", "-enc", "UTF-8", "-nopgbrk", pdfPath, "-").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract text from PDF: %w", err)
+	}
+
+	return normalizeText(string(out)), nil
+}
+
+// normalizeText приводит текст к виду, пригодному для хранения в PostgreSQL:
+// убирает недопустимые символы и маркеры подсветки, схлопывает пробелы и ограничивает размер
+func normalizeText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.NewReplacer("\x00", "", domain.SnippetStart, "", domain.SnippetStop, "").Replace(text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len(text) > maxIndexedTextBytes {
+		cut := maxIndexedTextBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	return text
+}
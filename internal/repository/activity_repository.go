@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"synxrondrive/internal/domain"
+	"time"
+)
+
+// activityThrottle - повторное то же действие с элементом за этот период не обновляет запись
+const activityThrottle = time.Minute
+
+type ActivityRepository struct {
+	db *sqlx.DB
+}
+
+func NewActivityRepository(db *sqlx.DB) *ActivityRepository {
+	return &ActivityRepository{db: db}
+}
+
+// quickAccessRow - строка списка быстрого доступа до загрузки файла или папки
+type quickAccessRow struct {
+	ItemType string                `db:"item_type"`
+	ItemID   string                `db:"item_id"`
+	Shared   bool                  `db:"shared"`
+	Action   domain.ActivityAction `db:"action"`
+	At       time.Time             `db:"at"`
+	Total    int                   `db:"total"`
+}
+
+// StarFile добавляет файл в избранное пользователя
+func (r *ActivityRepository) StarFile(ctx context.Context, userID string, fileUUID uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO stars (user_id, file_uuid)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id, file_uuid) WHERE file_uuid IS NOT NULL DO NOTHING`,
+		userID, fileUUID)
+	if err != nil {
+		return fmt.Errorf("failed to star file: %w", err)
+	}
+	return nil
+}
+
+// StarFolder добавляет папку в избранное пользователя
+func (r *ActivityRepository) StarFolder(ctx context.Context, userID string, folderID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO stars (user_id, folder_id)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id, folder_id) WHERE folder_id IS NOT NULL DO NOTHING`,
+		userID, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to star folder: %w", err)
+	}
+	return nil
+}
+
+// UnstarFile убирает файл из избранного
+func (r *ActivityRepository) UnstarFile(ctx context.Context, userID string, fileUUID uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM stars WHERE user_id = $1 AND file_uuid = $2`, userID, fileUUID)
+	if err != nil {
+		return fmt.Errorf("failed to unstar file: %w", err)
+	}
+	return nil
+}
+
+// UnstarFolder убирает папку из избранного
+func (r *ActivityRepository) UnstarFolder(ctx context.Context, userID string, folderID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM stars WHERE user_id = $1 AND folder_id = $2`, userID, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to unstar folder: %w", err)
+	}
+	return nil
+}
+
+// RecordFile запоминает последнее действие пользователя с файлом. Запись выполняется
+// вне общей транзакции, чтобы ошибка не прерывала основную операцию
+func (r *ActivityRepository) RecordFile(ctx context.Context, userID string, fileUUID uuid.UUID, action domain.ActivityAction) error {
+	return r.record(ctx, "file_uuid", userID, fileUUID, action)
+}
+
+// RecordFolder запоминает последнее действие пользователя с папкой
+func (r *ActivityRepository) RecordFolder(ctx context.Context, userID string, folderID int64, action domain.ActivityAction) error {
+	return r.record(ctx, "folder_id", userID, folderID, action)
+}
+
+func (r *ActivityRepository) record(ctx context.Context, column string, userID string, itemID interface{}, action domain.ActivityAction) error {
+	query := fmt.Sprintf(`
+        INSERT INTO item_activity (user_id, %[1]s, action)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, %[1]s) WHERE %[1]s IS NOT NULL
+        DO UPDATE SET action = EXCLUDED.action, occurred_at = CURRENT_TIMESTAMP
+        WHERE item_activity.action <> EXCLUDED.action
+        OR item_activity.occurred_at < $4`, column)
+
+	_, err := r.db.ExecContext(ctx, query, userID, itemID, action, time.Now().Add(-activityThrottle))
+	if err != nil {
+		return fmt.Errorf("failed to record activity: %w", err)
+	}
+	return nil
+}
+
+// GetStarred возвращает страницу избранного пользователя, последние добавленные первыми.
+// Элементы в корзине и элементы, доступ к которым отозван, не возвращаются
+func (r *ActivityRepository) GetStarred(ctx context.Context, userID string, limit int, offset int) ([]domain.QuickAccessItem, int, error) {
+	return r.listItems(ctx, userID, `
+            SELECT 'file' AS item_type, fl.uuid::text AS item_id, fl.owner_id <> $1 AS shared,
+                   '' AS action, st.created_at AS at
+            FROM stars st
+            JOIN files fl ON fl.uuid = st.file_uuid
+            JOIN folders fo ON fo.id = fl.folder_id
+            WHERE st.user_id = $1 AND fl.deleted_at IS NULL
+            AND `+visibleFile("fl", "fo")+`
+
+            UNION ALL
+
+            SELECT 'folder', f.id::text, f.owner_id <> $1, '', st.created_at
+            FROM stars st
+            JOIN folders f ON f.id = st.folder_id
+            WHERE st.user_id = $1 AND f.deleted_at IS NULL
+            AND `+visibleFolder("f"), limit, offset)
+}
+
+// GetRecent возвращает элементы, с которыми пользователь недавно работал
+func (r *ActivityRepository) GetRecent(ctx context.Context, userID string, limit int, offset int) ([]domain.QuickAccessItem, int, error) {
+	return r.listItems(ctx, userID, `
+            SELECT 'file' AS item_type, fl.uuid::text AS item_id, fl.owner_id <> $1 AS shared,
+                   a.action, a.occurred_at AS at
+            FROM item_activity a
+            JOIN files fl ON fl.uuid = a.file_uuid
+            JOIN folders fo ON fo.id = fl.folder_id
+            WHERE a.user_id = $1 AND fl.deleted_at IS NULL
+            AND `+visibleFile("fl", "fo")+`
+
+            UNION ALL
+
+            SELECT 'folder', f.id::text, f.owner_id <> $1, a.action, a.occurred_at
+            FROM item_activity a
+            JOIN folders f ON f.id = a.folder_id
+            WHERE a.user_id = $1 AND f.deleted_at IS NULL
+            AND `+visibleFolder("f"), limit, offset)
+}
+
+// GetRecentlyModified возвращает недавно измененные файлы пользователя и файлы,
+// открытые ему через общий доступ, независимо от того, кто их изменил
+func (r *ActivityRepository) GetRecentlyModified(ctx context.Context, userID string, limit int, offset int) ([]domain.QuickAccessItem, int, error) {
+	return r.listItems(ctx, userID, `
+            SELECT 'file' AS item_type, fl.uuid::text AS item_id, fl.owner_id <> $1 AS shared,
+                   '' AS action, fl.updated_at AS at
+            FROM files fl
+            JOIN folders fo ON fo.id = fl.folder_id
+            WHERE fl.deleted_at IS NULL
+            AND `+visibleFile("fl", "fo"), limit, offset)
+}
+
+// listItems выбирает страницу элементов из запроса items, сортируя их по времени at
+func (r *ActivityRepository) listItems(ctx context.Context, userID string, items string, limit int, offset int) ([]domain.QuickAccessItem, int, error) {
+	query := `
+        WITH` + sharedWithUserCTE + `,
+        items AS (` + items + `
+        )
+        SELECT item_type, item_id, shared, action, at, COUNT(*) OVER() AS total
+        FROM items
+        ORDER BY at DESC, item_id
+        LIMIT $2 OFFSET $3`
+
+	var rows []quickAccessRow
+	if err := r.db.SelectContext(ctx, &rows, query, userID, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("failed to list items: %w", err)
+	}
+	if len(rows) == 0 {
+		return []domain.QuickAccessItem{}, 0, nil
+	}
+
+	var fileIDs, folderIDs []string
+	for _, row := range rows {
+		if row.ItemType == "file" {
+			fileIDs = append(fileIDs, row.ItemID)
+		} else {
+			folderIDs = append(folderIDs, row.ItemID)
+		}
+	}
+	files, folders, err := loadItems(ctx, r.db, fileIDs, folderIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]domain.QuickAccessItem, 0, len(rows))
+	for _, row := range rows {
+		item := domain.QuickAccessItem{
+			ItemType: row.ItemType,
+			Shared:   row.Shared,
+			Action:   row.Action,
+			At:       row.At,
+		}
+		if row.ItemType == "file" {
+			if item.File = files[row.ItemID]; item.File == nil {
+				continue
+			}
+		} else if item.Folder = folders[row.ItemID]; item.Folder == nil {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result, rows[0].Total, nil
+}
+
+// LoadContentStars отмечает избранные пользователем элементы папки
+func (r *ActivityRepository) LoadContentStars(ctx context.Context, userID string, content *domain.FolderContent) error {
+	fileUUIDs := make([]string, 0, len(content.Files))
+	for _, file := range content.Files {
+		fileUUIDs = append(fileUUIDs, file.UUID.String())
+	}
+	folderIDs := []int64{content.Folder.ID}
+	for _, folder := range content.Folders {
+		folderIDs = append(folderIDs, folder.ID)
+	}
+
+	var rows []struct {
+		FileUUID *string `db:"file_uuid"`
+		FolderID *int64  `db:"folder_id"`
+	}
+	err := conn(ctx, r.db).SelectContext(ctx, &rows, `
+        SELECT file_uuid::text AS file_uuid, folder_id
+        FROM stars
+        WHERE user_id = $1
+        AND (file_uuid = ANY($2::uuid[]) OR folder_id = ANY($3))`,
+		userID, pq.Array(fileUUIDs), pq.Array(folderIDs))
+	if err != nil {
+		return fmt.Errorf("failed to get stars: %w", err)
+	}
+
+	starredFiles := make(map[string]bool)
+	starredFolders := make(map[int64]bool)
+	for _, row := range rows {
+		if row.FileUUID != nil {
+			starredFiles[*row.FileUUID] = true
+		} else if row.FolderID != nil {
+			starredFolders[*row.FolderID] = true
+		}
+	}
+
+	content.Folder.Starred = starredFolders[content.Folder.ID]
+	for i := range content.Folders {
+		content.Folders[i].Starred = starredFolders[content.Folders[i].ID]
+	}
+	for i := range content.Files {
+		content.Files[i].Starred = starredFiles[content.Files[i].UUID.String()]
+	}
+	return nil
+}
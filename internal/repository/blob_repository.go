@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"synxrondrive/internal/domain"
+)
+
+type BlobRepository struct {
+	db *sqlx.DB
+}
+
+func NewBlobRepository(db *sqlx.DB) *BlobRepository {
+	return &BlobRepository{db: db}
+}
+
+func (r *BlobRepository) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
+	return r.db.BeginTxx(ctx, nil)
+}
+
+// LockOrCreate блокирует запись объекта владельца с указанной контрольной суммой до конца
+// транзакции, создавая ее при необходимости. Возвращает true, если содержимое
+// нужно записать в хранилище: объект новый или уже ожидает удаления сборщиком
+func (r *BlobRepository) LockOrCreate(ctx context.Context, tx *sqlx.Tx, blob *domain.Blob) (bool, error) {
+	query := `
+        INSERT INTO blobs (owner_id, sha256, s3_key, size_bytes)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (owner_id, sha256) DO UPDATE SET sha256 = EXCLUDED.sha256
+        RETURNING s3_key, ref_count, created_at, updated_at, (xmax = 0) AS inserted`
+
+	var inserted bool
+	err := tx.QueryRowContext(ctx, query, blob.OwnerID, blob.SHA256, blob.S3Key, blob.SizeBytes).
+		Scan(&blob.S3Key, &blob.RefCount, &blob.CreatedAt, &blob.UpdatedAt, &inserted)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock blob: %w", err)
+	}
+
+	return inserted || blob.RefCount <= 0, nil
+}
+
+// LockByKey блокирует запись объекта по ключу. Возвращает nil, если ключ
+// не принадлежит общим объектам
+func (r *BlobRepository) LockByKey(ctx context.Context, tx *sqlx.Tx, s3Key string) (*domain.Blob, error) {
+	var blob domain.Blob
+	err := tx.GetContext(ctx, &blob, `SELECT * FROM blobs WHERE s3_key = $1 FOR UPDATE`, s3Key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock blob: %w", err)
+	}
+	return &blob, nil
+}
+
+// GetUnreferenced блокирует и возвращает объекты, на которые не осталось ссылок.
+// Записи, заблокированные загрузками, пропускаются
+func (r *BlobRepository) GetUnreferenced(ctx context.Context, tx *sqlx.Tx, limit int) ([]domain.Blob, error) {
+	var blobs []domain.Blob
+	query := `
+        SELECT * FROM blobs
+        WHERE ref_count <= 0
+        ORDER BY updated_at
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED`
+
+	if err := tx.SelectContext(ctx, &blobs, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to get unreferenced blobs: %w", err)
+	}
+	return blobs, nil
+}
+
+// Delete удаляет запись объекта, если на него по-прежнему нет ссылок
+func (r *BlobRepository) Delete(ctx context.Context, tx *sqlx.Tx, s3Key string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM blobs WHERE s3_key = $1 AND ref_count <= 0`, s3Key)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
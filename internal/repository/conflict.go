@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"synxrondrive/internal/domain"
+	"time"
+)
+
+// folderColumns - столбцы папки; metadata может отсутствовать у старых записей
+const folderColumns = `
+            id, name, owner_id, parent_id, path, level,
+            size_bytes, files_count, created_at, updated_at,
+            deleted_at, restore_path, restore_parent_id,
+            COALESCE(metadata, '{}'::jsonb) as metadata`
+
+// lockFolderNames блокирует имена элементов папки до конца транзакции, чтобы
+// параллельные операции не выбрали одно и то же свободное имя
+func lockFolderNames(ctx context.Context, q queryer, folderID int64) error {
+	if !inTx(ctx) {
+		return fmt.Errorf("name conflicts must be resolved inside a transaction")
+	}
+	// ID папки - bigint, а ключ блокировки с пространством имен - два int4, поэтому
+	// ID хешируется; совпадение хешей лишь изредка упорядочит операции в разных папках
+	if _, err := q.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('folder_names'), hashtext($1::text))`, strconv.FormatInt(folderID, 10)); err != nil {
+		return fmt.Errorf("failed to lock folder names: %w", err)
+	}
+	return nil
+}
+
+// resolveFileConflict разрешает конфликт имени файла в папке по политике policy.
+// Возвращает имя, под которым файл нужно разместить, и, для ConflictPolicyVersion,
+// существующий файл, новой версией которого он станет
+func resolveFileConflict(
+	ctx context.Context,
+	q queryer,
+	folderID int64,
+	name string,
+	exclude uuid.UUID,
+	policy domain.ConflictPolicy,
+) (string, *domain.File, error) {
+	if err := lockFolderNames(ctx, q, folderID); err != nil {
+		return "", nil, err
+	}
+
+	existing, err := findActiveFile(ctx, q, folderID, name, exclude)
+	if err != nil || existing == nil {
+		return name, nil, err
+	}
+
+	switch policy {
+	case domain.ConflictPolicyRename:
+		free, err := freeFileName(ctx, q, folderID, name)
+		return free, nil, err
+	case domain.ConflictPolicyReplace:
+		if err := trashFile(ctx, q, existing.UUID.String(), existing.OwnerID, time.Now()); err != nil {
+			return "", nil, fmt.Errorf("failed to replace file %s: %w", name, err)
+		}
+		return name, nil, nil
+	case domain.ConflictPolicyVersion:
+		return name, existing, nil
+	default:
+		return "", nil, fmt.Errorf("file with name %s already exists in target folder", name)
+	}
+}
+
+// resolveFolderConflict разрешает конфликт имени подпапки по политике policy.
+// Для ConflictPolicyVersion возвращает существующую папку для объединения
+func resolveFolderConflict(
+	ctx context.Context,
+	q queryer,
+	parentID int64,
+	name string,
+	exclude int64,
+	policy domain.ConflictPolicy,
+) (string, *domain.Folder, error) {
+	if err := lockFolderNames(ctx, q, parentID); err != nil {
+		return "", nil, err
+	}
+
+	existing, err := findActiveFolder(ctx, q, parentID, name, exclude)
+	if err != nil || existing == nil {
+		return name, nil, err
+	}
+
+	switch policy {
+	case domain.ConflictPolicyRename:
+		free, err := freeFolderName(ctx, q, parentID, name)
+		return free, nil, err
+	case domain.ConflictPolicyReplace:
+		if err := trashFolder(ctx, q, strconv.FormatInt(existing.ID, 10), existing.OwnerID, time.Now()); err != nil {
+			return "", nil, fmt.Errorf("failed to replace folder %s: %w", name, err)
+		}
+		if err := recalculateFolderSizes(ctx, q, parentID); err != nil {
+			return "", nil, err
+		}
+		return name, nil, nil
+	case domain.ConflictPolicyVersion:
+		return name, existing, nil
+	default:
+		return "", nil, fmt.Errorf("folder with name %s already exists in target folder", name)
+	}
+}
+
+// findActiveFile возвращает неудаленный файл с указанным именем или nil
+func findActiveFile(ctx context.Context, q queryer, folderID int64, name string, exclude uuid.UUID) (*domain.File, error) {
+	var file domain.File
+	query := `
+        SELECT * FROM files
+        WHERE folder_id = $1 AND name = $2 AND uuid <> $3 AND deleted_at IS NULL
+        LIMIT 1`
+
+	err := q.GetContext(ctx, &file, query, folderID, name, exclude)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking file existence: %w", err)
+	}
+	return &file, nil
+}
+
+// findActiveFolder возвращает неудаленную подпапку с указанным именем или nil
+func findActiveFolder(ctx context.Context, q queryer, parentID int64, name string, exclude int64) (*domain.Folder, error) {
+	var folder domain.Folder
+	query := `SELECT` + folderColumns + `
+        FROM folders
+        WHERE parent_id = $1 AND name = $2 AND id <> $3 AND deleted_at IS NULL`
+
+	err := q.GetContext(ctx, &folder, query, parentID, name, exclude)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check folder existence: %w", err)
+	}
+	return &folder, nil
+}
+
+// freeFileName подбирает свободное в папке имя файла вида "name (n).ext"
+func freeFileName(ctx context.Context, q queryer, folderID int64, name string) (string, error) {
+	for n := 1; n <= domain.MaxNameAttempts; n++ {
+		candidate := domain.NumberedName(name, n, true)
+		var exists bool
+		err := q.GetContext(ctx, &exists, `
+            SELECT EXISTS(
+                SELECT 1 FROM files
+                WHERE folder_id = $1 AND name = $2 AND deleted_at IS NULL
+            )`, folderID, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check file existence: %w", err)
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find free name for %s", name)
+}
+
+// freeFolderName подбирает свободное имя подпапки вида "name (n)"
+func freeFolderName(ctx context.Context, q queryer, parentID int64, name string) (string, error) {
+	for n := 1; n <= domain.MaxNameAttempts; n++ {
+		candidate := domain.NumberedName(name, n, false)
+		var exists bool
+		err := q.GetContext(ctx, &exists, `
+            SELECT EXISTS(
+                SELECT 1 FROM folders
+                WHERE parent_id = $1 AND name = $2 AND deleted_at IS NULL
+            )`, parentID, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check folder existence: %w", err)
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find free name for %s", name)
+}
+
+// mergeFile делает версии файла src новыми версиями файла dst: история src
+// добавляется после истории dst, текущая версия src становится текущей версией dst.
+// Файл src удаляется. Размеры папок пересчитывает вызывающий код
+func mergeFile(ctx context.Context, q queryer, src *domain.File, dst *domain.File) error {
+	// Содержимое записей конференций хранится вне версий файла
+	var isRecording bool
+	err := q.GetContext(ctx, &isRecording, `SELECT EXISTS(SELECT 1 FROM recordings WHERE file_uuid = $1)`, src.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to check recording: %w", err)
+	}
+	if isRecording {
+		return fmt.Errorf("invalid conflict policy: recording %s cannot become a version of another file", src.Name)
+	}
+
+	var offset int
+	err = q.GetContext(ctx, &offset, `SELECT COALESCE(MAX(version_number), 0) FROM file_versions WHERE file_uuid = $1`, dst.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to get file versions: %w", err)
+	}
+
+	_, err = q.ExecContext(ctx, `
+        UPDATE file_versions
+        SET file_uuid = $1,
+            version_number = version_number + $2
+        WHERE file_uuid = $3`, dst.UUID, offset, src.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to move file versions: %w", err)
+	}
+
+	dst.CurrentVersion = offset + src.CurrentVersion
+	dst.SizeBytes = src.SizeBytes
+	dst.MIMEType = src.MIMEType
+	_, err = q.ExecContext(ctx, `
+        UPDATE files
+        SET current_version = $1,
+            size_bytes = $2,
+            mime_type = $3,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE uuid = $4`, dst.CurrentVersion, dst.SizeBytes, dst.MIMEType, dst.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to update file: %w", err)
+	}
+
+	// Превью обоих файлов больше не соответствуют текущему содержимому
+	_, err = q.ExecContext(ctx, `DELETE FROM file_previews WHERE file_uuid IN ($1, $2)`, src.UUID, dst.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to delete file previews: %w", err)
+	}
+
+	if _, err := q.ExecContext(ctx, `DELETE FROM files WHERE uuid = $1`, src.UUID); err != nil {
+		return fmt.Errorf("failed to delete merged file: %w", err)
+	}
+	return nil
+}
+
+// mergeFolder переносит содержимое папки src в папку dst. Конфликтующие файлы
+// становятся новыми версиями существующих, конфликтующие подпапки объединяются.
+// Опустевшая папка src перемещается в корзину. Размеры родителей dst и src
+// пересчитывает вызывающий код
+func mergeFolder(ctx context.Context, q queryer, src *domain.Folder, dst *domain.Folder) error {
+	if err := lockFolderNames(ctx, q, dst.ID); err != nil {
+		return err
+	}
+
+	var files []domain.File
+	err := q.SelectContext(ctx, &files, `SELECT * FROM files WHERE folder_id = $1 AND deleted_at IS NULL`, src.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get folder files: %w", err)
+	}
+	for i := range files {
+		file := &files[i]
+		existing, err := findActiveFile(ctx, q, dst.ID, file.Name, file.UUID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if err := mergeFile(ctx, q, file, existing); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = q.ExecContext(ctx, `
+            UPDATE files
+            SET folder_id = $1,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE uuid = $2`, dst.ID, file.UUID)
+		if err != nil {
+			return fmt.Errorf("failed to move file %s: %w", file.Name, err)
+		}
+	}
+
+	var folders []domain.Folder
+	err = q.SelectContext(ctx, &folders, `SELECT`+folderColumns+`
+        FROM folders
+        WHERE parent_id = $1 AND deleted_at IS NULL`, src.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get subfolders: %w", err)
+	}
+	for i := range folders {
+		folder := &folders[i]
+		existing, err := findActiveFolder(ctx, q, dst.ID, folder.Name, folder.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if err := mergeFolder(ctx, q, folder, existing); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := reparentFolder(ctx, q, folder.ID, dst.ID, folder.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := trashFolder(ctx, q, strconv.FormatInt(src.ID, 10), src.OwnerID, time.Now()); err != nil {
+		return fmt.Errorf("failed to move merged folder to trash: %w", err)
+	}
+
+	return recalculateFolderSizes(ctx, q, dst.ID)
+}
+
+// reparentFolder переносит папку в родительскую папку parentID под именем name
+// и обновляет пути и уровни всех её подпапок
+func reparentFolder(ctx context.Context, q queryer, folderID int64, parentID int64, name string) error {
+	var folder, parent struct {
+		Path  string `db:"path"`
+		Level int    `db:"level"`
+	}
+	if err := q.GetContext(ctx, &folder, `SELECT path, level FROM folders WHERE id = $1`, folderID); err != nil {
+		return fmt.Errorf("failed to get folder info: %w", err)
+	}
+	if err := q.GetContext(ctx, &parent, `SELECT path, level FROM folders WHERE id = $1`, parentID); err != nil {
+		return fmt.Errorf("failed to get new parent path: %w", err)
+	}
+
+	newPath := fmt.Sprintf("%s/%s", parent.Path, name)
+	if parent.Path == "/" {
+		newPath = fmt.Sprintf("/%s", name)
+	}
+	levelDelta := parent.Level + 1 - folder.Level
+
+	_, err := q.ExecContext(ctx, `
+        UPDATE folders
+        SET parent_id = $1,
+            name = $2,
+            path = $3,
+            level = $4,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $5`, parentID, name, newPath, parent.Level+1, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to update folder parent: %w", err)
+	}
+
+	_, err = q.ExecContext(ctx, `
+        WITH RECURSIVE subfolder AS (
+            SELECT id FROM folders WHERE parent_id = $1
+            UNION ALL
+            SELECT f.id
+            FROM folders f
+            INNER JOIN subfolder s ON f.parent_id = s.id
+        )
+        UPDATE folders f
+        SET path = $3 || substr(f.path, length($2) + 1),
+            level = f.level + $4
+        WHERE f.id IN (SELECT id FROM subfolder)`, folderID, folder.Path, newPath, levelDelta)
+	if err != nil {
+		return fmt.Errorf("failed to update subfolders paths: %w", err)
+	}
+	return nil
+}
+
+// recalculateFolderSizes пересчитывает размер и количество файлов папки и всех
+// её родителей по неудаленному содержимому, начиная с самой вложенной
+func recalculateFolderSizes(ctx context.Context, q queryer, folderID int64) error {
+	var chain []int64
+	err := q.SelectContext(ctx, &chain, `
+        WITH RECURSIVE folder_tree AS (
+            SELECT id, parent_id, 0 AS depth FROM folders WHERE id = $1
+            UNION ALL
+            SELECT f.id, f.parent_id, ft.depth + 1
+            FROM folders f
+            INNER JOIN folder_tree ft ON f.id = ft.parent_id
+        )
+        SELECT id FROM folder_tree ORDER BY depth`, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to get folder hierarchy: %w", err)
+	}
+
+	for _, id := range chain {
+		_, err := q.ExecContext(ctx, `
+            UPDATE folders f
+            SET size_bytes =
+                    COALESCE((SELECT SUM(size_bytes) FROM files WHERE folder_id = f.id AND deleted_at IS NULL), 0) +
+                    COALESCE((SELECT SUM(size_bytes) FROM folders c WHERE c.parent_id = f.id AND c.deleted_at IS NULL), 0),
+                files_count =
+                    (SELECT COUNT(*) FROM files WHERE folder_id = f.id AND deleted_at IS NULL) +
+                    COALESCE((SELECT SUM(files_count) FROM folders c WHERE c.parent_id = f.id AND c.deleted_at IS NULL), 0),
+                updated_at = CURRENT_TIMESTAMP
+            WHERE f.id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("failed to update folder metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -18,7 +18,7 @@ func NewFileRepository(db *sqlx.DB) *FileRepository {
 }
 
 func (r *FileRepository) Create(ctx context.Context, file *domain.File) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -78,7 +78,7 @@ func (r *FileRepository) GetByUUID(ctx context.Context, uuid uuid.UUID) (*domain
 	var file domain.File
 	query := `SELECT * FROM files WHERE uuid = $1`
 
-	err := r.db.GetContext(ctx, &file, query, uuid)
+	err := conn(ctx, r.db).GetContext(ctx, &file, query, uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +90,7 @@ func (r *FileRepository) GetByFolder(ctx context.Context, folderID int64) ([]dom
 	var files []domain.File
 	query := `SELECT * FROM files WHERE folder_id = $1 ORDER BY name`
 
-	err := r.db.SelectContext(ctx, &files, query, folderID)
+	err := conn(ctx, r.db).SelectContext(ctx, &files, query, folderID)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +107,7 @@ func (r *FileRepository) Update(ctx context.Context, file *domain.File) error {
             updated_at = CURRENT_TIMESTAMP
         WHERE uuid = $3
     `
-	_, err := r.db.ExecContext(ctx, query, file.SizeBytes, file.CurrentVersion, file.UUID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, file.SizeBytes, file.CurrentVersion, file.UUID)
 	if err != nil {
 		return fmt.Errorf("error updating file: %w", err)
 	}
@@ -116,7 +116,7 @@ func (r *FileRepository) Update(ctx context.Context, file *domain.File) error {
 
 // Delete для FileRepository
 func (r *FileRepository) Delete(ctx context.Context, uuid uuid.UUID) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return err
 	}
@@ -177,7 +177,7 @@ func (r *FileRepository) GetRootFolder(ctx context.Context, ownerID string) (*do
 	var folder domain.Folder
 	query := `SELECT * FROM folders WHERE owner_id = $1 AND name = 'Root' LIMIT 1`
 
-	err := r.db.GetContext(ctx, &folder, query, ownerID)
+	err := conn(ctx, r.db).GetContext(ctx, &folder, query, ownerID)
 	if err != nil {
 		return nil, err
 	}
@@ -193,17 +193,35 @@ func (r *FileRepository) GetFileVersions(ctx context.Context, fileUUID uuid.UUID
         WHERE file_uuid = $1 AND deleted_at IS NULL 
         ORDER BY version_number DESC
     `
-	err := r.db.SelectContext(ctx, &versions, query, fileUUID)
+	err := conn(ctx, r.db).SelectContext(ctx, &versions, query, fileUUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file versions: %w", err)
 	}
 	return versions, nil
 }
 
+// GetVersion получает неудаленную версию файла по номеру
+func (r *FileRepository) GetVersion(ctx context.Context, fileUUID uuid.UUID, versionNumber int) (*domain.FileVersion, error) {
+	var version domain.FileVersion
+	query := `
+        SELECT * FROM file_versions
+        WHERE file_uuid = $1 AND version_number = $2 AND deleted_at IS NULL`
+
+	err := conn(ctx, r.db).GetContext(ctx, &version, query, fileUUID, versionNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("version not found")
+		}
+		return nil, fmt.Errorf("failed to get file version: %w", err)
+	}
+
+	return &version, nil
+}
+
 // UpdateFileVersion обновляет версию файла
 func (r *FileRepository) UpdateFileVersion(ctx context.Context, fileUUID uuid.UUID, version int) error {
 	query := `UPDATE files SET current_version = $1 WHERE uuid = $2`
-	_, err := r.db.ExecContext(ctx, query, version, fileUUID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, version, fileUUID)
 	if err != nil {
 		return fmt.Errorf("failed to update file version: %w", err)
 	}
@@ -243,7 +261,7 @@ func (r *FileRepository) CheckFileExists(ctx context.Context, folderID int64, fi
         AND deleted_at IS NULL
         LIMIT 1
     `
-	err := r.db.GetContext(ctx, &file, query, folderID, fileName)
+	err := conn(ctx, r.db).GetContext(ctx, &file, query, folderID, fileName)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -255,16 +273,43 @@ func (r *FileRepository) CheckFileExists(ctx context.Context, folderID int64, fi
 
 func (r *FileRepository) CreateFileVersion(ctx context.Context, tx *sqlx.Tx, version *domain.FileVersion) error {
 	query := `
-        INSERT INTO file_versions (file_uuid, version_number, s3_key, size_bytes)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at`
+        INSERT INTO file_versions (file_uuid, version_number, s3_key, size_bytes, sha256, uploaded_by, label, comment)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at, content_available`
 
 	return tx.QueryRowContext(ctx, query,
 		version.FileUUID,
 		version.VersionNumber,
 		version.S3Key,
 		version.SizeBytes,
-	).Scan(&version.ID, &version.CreatedAt)
+		version.SHA256,
+		version.UploadedBy,
+		version.Label,
+		version.Comment,
+	).Scan(&version.ID, &version.CreatedAt, &version.ContentAvailable)
+}
+
+// UpdateVersionNote обновляет метку и комментарий версии
+func (r *FileRepository) UpdateVersionNote(ctx context.Context, version *domain.FileVersion) error {
+	query := `
+        UPDATE file_versions
+        SET label = $1, comment = $2
+        WHERE file_uuid = $3 AND version_number = $4 AND deleted_at IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, version.Label, version.Comment, version.FileUUID, version.VersionNumber)
+	if err != nil {
+		return fmt.Errorf("failed to update version note: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("version not found")
+	}
+
+	return nil
 }
 
 func (r *FileRepository) UpdateFileSize(ctx context.Context, tx *sqlx.Tx, fileUUID uuid.UUID, size int64) error {
@@ -277,8 +322,8 @@ func (r *FileRepository) UpdateFileSize(ctx context.Context, tx *sqlx.Tx, fileUU
 	return err
 }
 
-func (r *FileRepository) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
-	return r.db.BeginTxx(ctx, nil)
+func (r *FileRepository) BeginTx(ctx context.Context) (*Tx, error) {
+	return beginTx(ctx, r.db)
 }
 
 func (r *FileRepository) GetCurrentVersion(ctx context.Context, tx *sqlx.Tx, fileUUID uuid.UUID) (int, error) {
@@ -288,6 +333,16 @@ func (r *FileRepository) GetCurrentVersion(ctx context.Context, tx *sqlx.Tx, fil
 	return version, err
 }
 
+// IsVersionS3Key проверяет, ссылается ли какая-либо версия файла на объект s3Key
+func (r *FileRepository) IsVersionS3Key(ctx context.Context, s3Key string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM file_versions WHERE s3_key = $1)`, s3Key)
+	if err != nil {
+		return false, fmt.Errorf("failed to check version object: %w", err)
+	}
+	return exists, nil
+}
+
 func (r *FileRepository) DeletePreview(ctx context.Context, tx *sqlx.Tx, fileUUID uuid.UUID) error {
 	query := `DELETE FROM file_previews WHERE file_uuid = $1`
 
@@ -301,7 +356,7 @@ func (r *FileRepository) DeletePreview(ctx context.Context, tx *sqlx.Tx, fileUUI
 	}
 
 	// Если транзакция не передана, используем обычное соединение
-	_, err := r.db.ExecContext(ctx, query, fileUUID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, fileUUID)
 	if err != nil {
 		return fmt.Errorf("failed to delete preview: %w", err)
 	}
@@ -324,7 +379,7 @@ func (r *FileRepository) CreateContextFile(ctx context.Context, file *domain.Fil
         RETURNING created_at, updated_at
     `
 
-	err := r.db.QueryRowContext(
+	err := conn(ctx, r.db).QueryRowContext(
 		ctx,
 		query,
 		file.UUID,
@@ -351,7 +406,7 @@ func (r *FileRepository) UpdateFileName(ctx context.Context, fileUUID uuid.UUID,
             updated_at = CURRENT_TIMESTAMP
         WHERE uuid = $2
     `
-	result, err := r.db.ExecContext(ctx, query, newName, fileUUID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, newName, fileUUID)
 	if err != nil {
 		return fmt.Errorf("failed to update file name: %w", err)
 	}
@@ -368,6 +423,67 @@ func (r *FileRepository) UpdateFileName(ctx context.Context, fileUUID uuid.UUID,
 	return nil
 }
 
+// ResolveNameConflict разрешает конфликт имени нового файла в папке по политике policy
+// и блокирует имена в папке до конца транзакции. Вызывается внутри RunInTx, чтобы
+// выбранное имя не занял параллельный запрос до создания файла. Для ConflictPolicyVersion
+// возвращает существующий файл, новой версией которого станет загружаемый
+func (r *FileRepository) ResolveNameConflict(ctx context.Context, folderID int64, name string, policy domain.ConflictPolicy) (string, *domain.File, error) {
+	return resolveFileConflict(ctx, conn(ctx, r.db), folderID, name, uuid.Nil, policy)
+}
+
+// MoveFile перемещает файл в другую папку. Конфликт имени в целевой папке
+// разрешается по политике policy; при ConflictPolicyVersion перемещаемый файл
+// становится новой версией существующего
+func (r *FileRepository) MoveFile(ctx context.Context, fileUUID uuid.UUID, newFolderID int64, policy domain.ConflictPolicy) error {
+	return RunInTx(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db)
+
+		var file domain.File
+		err := q.GetContext(ctx, &file, `SELECT * FROM files WHERE uuid = $1 AND deleted_at IS NULL`, fileUUID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("file not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get file: %w", err)
+		}
+		if file.FolderID == newFolderID {
+			return nil
+		}
+
+		name, existing, err := resolveFileConflict(ctx, q, newFolderID, file.Name, file.UUID, policy)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			if err := mergeFile(ctx, q, &file, existing); err != nil {
+				return err
+			}
+			if err := recalculateFolderSizes(ctx, q, file.FolderID); err != nil {
+				return err
+			}
+			return recalculateFolderSizes(ctx, q, newFolderID)
+		}
+
+		if name != file.Name {
+			if err := r.UpdateFileName(ctx, fileUUID, name); err != nil {
+				return err
+			}
+		}
+
+		tx, err := beginTx(ctx, r.db)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := r.UpdateFileFolder(ctx, tx.Tx, fileUUID, newFolderID, file.FolderID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
 // UpdateFileFolder обновляет ID папки файла
 func (r *FileRepository) UpdateFileFolder(ctx context.Context, tx *sqlx.Tx, fileUUID uuid.UUID, newFolderID int64, oldFolderID int64) error {
 	// Обновляем ID папки файла
@@ -455,7 +571,7 @@ func (r *FileRepository) GetDeletedFileInfo(ctx context.Context, uuid uuid.UUID)
 	var file domain.File
 	query := `SELECT * FROM files WHERE uuid = $1`
 
-	err := r.db.GetContext(ctx, &file, query, uuid)
+	err := conn(ctx, r.db).GetContext(ctx, &file, query, uuid)
 	if err != nil {
 		return nil, err
 	}
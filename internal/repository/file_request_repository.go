@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"synxrondrive/internal/domain"
+)
+
+type FileRequestRepository struct {
+	db *sqlx.DB
+}
+
+func NewFileRequestRepository(db *sqlx.DB) *FileRequestRepository {
+	return &FileRequestRepository{db: db}
+}
+
+func (r *FileRequestRepository) GetDB() *sqlx.DB {
+	return r.db
+}
+
+// Create сохраняет настройки запроса файлов для созданной ссылки
+func (r *FileRequestRepository) Create(ctx context.Context, shareID uuid.UUID, maxFileSize *int64, allowedExtensions []string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO file_requests (share_id, max_file_size, allowed_extensions)
+        VALUES ($1, $2, $3)`,
+		shareID, maxFileSize, pq.Array(allowedExtensions))
+	if err != nil {
+		return fmt.Errorf("failed to create file request: %w", err)
+	}
+	return nil
+}
+
+// Get возвращает запрос файлов вместе с данными ссылки и папки назначения
+func (r *FileRequestRepository) Get(ctx context.Context, shareID uuid.UUID) (*domain.FileRequest, error) {
+	var request domain.FileRequest
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+        SELECT s.id, s.token, f.id, f.name, fr.max_file_size, fr.allowed_extensions,
+               s.expires_at, s.password_hash <> '', s.created_at
+        FROM file_requests fr
+        JOIN shares s ON s.id = fr.share_id
+        JOIN folders f ON f.id::text = s.resource_id
+        WHERE fr.share_id = $1`, shareID).Scan(
+		&request.ShareID,
+		&request.Token,
+		&request.FolderID,
+		&request.FolderName,
+		&request.MaxFileSize,
+		pq.Array(&request.AllowedExtensions),
+		&request.Deadline,
+		&request.PasswordProtected,
+		&request.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file request: %w", err)
+	}
+	if request.AllowedExtensions == nil {
+		request.AllowedExtensions = []string{}
+	}
+	return &request, nil
+}
+
+// RecordUpload запоминает загруженный по запросу файл и данные загрузившего
+func (r *FileRequestRepository) RecordUpload(ctx context.Context, upload *domain.FileRequestUpload) error {
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+        INSERT INTO file_request_uploads (
+            share_id, file_uuid, file_name, size, uploader_id, uploader_name, uploader_email
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, uploaded_at`,
+		upload.ShareID, upload.FileUUID, upload.FileName, upload.Size,
+		upload.UploaderID, upload.UploaderName, upload.UploaderEmail,
+	).Scan(&upload.ID, &upload.UploadedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record file request upload: %w", err)
+	}
+	return nil
+}
+
+// ListUploads возвращает загрузки по запросу, последние первыми
+func (r *FileRequestRepository) ListUploads(ctx context.Context, shareID uuid.UUID) ([]domain.FileRequestUpload, error) {
+	uploads := []domain.FileRequestUpload{}
+	err := conn(ctx, r.db).SelectContext(ctx, &uploads, `
+        SELECT * FROM file_request_uploads
+        WHERE share_id = $1
+        ORDER BY uploaded_at DESC, id DESC`, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file request uploads: %w", err)
+	}
+	return uploads, nil
+}
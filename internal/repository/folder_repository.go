@@ -3,9 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"log"
 	"strconv"
 	"strings"
@@ -24,7 +24,7 @@ func NewFolderRepository(db *sqlx.DB) *FolderRepository {
 
 // Исправленная версия
 func (r *FolderRepository) Create(ctx context.Context, folder *domain.Folder) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -94,7 +94,7 @@ func (r *FolderRepository) GetByID(ctx context.Context, id int64) (*domain.Folde
         WHERE id = $1 AND deleted_at IS NULL`
 
 	var folder domain.Folder
-	err := r.db.GetContext(ctx, &folder, query, id)
+	err := conn(ctx, r.db).GetContext(ctx, &folder, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get folder: %w", err)
 	}
@@ -109,7 +109,7 @@ func (r *FolderRepository) Update(ctx context.Context, folder *domain.Folder) er
         WHERE id = $2 AND owner_id = $3
         RETURNING updated_at`
 
-	return r.db.QueryRowContext(
+	return conn(ctx, r.db).QueryRowContext(
 		ctx,
 		query,
 		folder.Name,
@@ -119,7 +119,7 @@ func (r *FolderRepository) Update(ctx context.Context, folder *domain.Folder) er
 }
 
 func (r *FolderRepository) Delete(ctx context.Context, id int64) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return err
 	}
@@ -192,7 +192,8 @@ func (r *FolderRepository) Delete(ctx context.Context, id int64) error {
 	return tx.Commit()
 }
 
-func (r *FolderRepository) GetContent(ctx context.Context, folderID int64, userID string) (*domain.FolderContent, error) {
+// GetContent возвращает страницу содержимого папки с учетом сортировки, фильтров и курсора
+func (r *FolderRepository) GetContent(ctx context.Context, folderID int64, userID string, opts domain.ListOptions) (*domain.FolderContent, error) {
 	log.Printf("[GetContent] Started. FolderID: %d, UserID: %s", folderID, userID)
 
 	// Сначала получаем информацию о папке
@@ -206,51 +207,36 @@ func (r *FolderRepository) GetContent(ctx context.Context, folderID int64, userI
 	// Проверяем, является ли пользователь владельцем
 	if folder.OwnerID == userID {
 		log.Printf("[GetContent] User %s is the owner of folder %d, getting content directly", userID, folderID)
-		return r.getContentInternal(ctx, folder)
+		return r.getContentInternal(ctx, folder, opts)
 	}
 
 	log.Printf("[GetContent] User %s is not the owner of folder %d, checking shared access", userID, folderID)
 
-	// Модифицированный запрос для проверки доступа
+	// Ищем ссылку на папку или ее родителя, в которой пользователь указан получателем
 	query := `
         WITH RECURSIVE folder_hierarchy AS (
-            -- Начальная папка и все её родители
-            WITH RECURSIVE parent_folders AS (
-                -- Начальная папка
-                SELECT id, parent_id, path, owner_id
-                FROM folders 
-                WHERE id = $1
-                UNION ALL
-                -- Все родительские папки
-                SELECT f.id, f.parent_id, f.path, f.owner_id
-                FROM folders f
-                INNER JOIN parent_folders pf ON f.id = pf.parent_id
-            )
-            SELECT id, parent_id, path, owner_id FROM parent_folders
+            SELECT id, parent_id
+            FROM folders
+            WHERE id = $1
+            UNION ALL
+            SELECT f.id, f.parent_id
+            FROM folders f
+            INNER JOIN folder_hierarchy fh ON f.id = fh.parent_id
         )
-         SELECT s.access_type, s.resource_id, s.user_ids, fh.owner_id
+        SELECT sr.access_type, s.resource_id
         FROM folder_hierarchy fh
         JOIN shares s ON (
-            fh.id::text = s.resource_id 
+            fh.id::text = s.resource_id
             AND s.resource_type = 'folder'
             AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
-            AND (
-                s.owner_id = fh.owner_id
-                OR s.user_ids LIKE '%' || $2 || '%'
-            )
         )
+        JOIN share_recipients sr ON sr.share_id = s.id AND sr.user_id = $2
         LIMIT 1;`
 
-	log.Printf("[GetContent] Executing modified share check query for folder %d", folderID)
-
-	var (
-		accessType string
-		resourceID string
-		userIDs    string
-		ownerID    string
-	)
+	log.Printf("[GetContent] Executing share check query for folder %d", folderID)
 
-	err = r.db.QueryRowContext(ctx, query, folderID, userID).Scan(&accessType, &resourceID, &userIDs, &ownerID)
+	var accessType, resourceID string
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, folderID, userID).Scan(&accessType, &resourceID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("[GetContent] No share access found for user %s to folder %d", userID, folderID)
@@ -260,39 +246,24 @@ func (r *FolderRepository) GetContent(ctx context.Context, folderID int64, userI
 		return nil, fmt.Errorf("failed to check access: %w", err)
 	}
 
-	log.Printf("[GetContent] Found share access. Type: %s, ResourceID: %s, OwnerID: %s",
-		accessType, resourceID, ownerID)
+	log.Printf("[GetContent] Found share access. Type: %s, ResourceID: %s", accessType, resourceID)
 
 	// Добавляем информацию о шаринге к папке
-	if userIDs != "" {
-		userIDsList := strings.Split(userIDs, ",")
-		users, err := auth.GetUsersByIds(ctx, userIDsList)
-		if err != nil {
-			log.Printf("[GetContent] Error getting users info: %v", err)
-			return nil, fmt.Errorf("failed to get users info: %w", err)
-		}
-
-		sharedUsers := make([]domain.SharedUser, 0, len(users))
-		for _, user := range users {
-			sharedUsers = append(sharedUsers, domain.SharedUser{
-				ID:       user.ID,
-				Email:    user.Email,
-				Name:     user.Name,
-				Lastname: user.Lastname,
-				Photo:    user.Photo,
-			})
-		}
-
+	sharedUsers, err := r.loadSharedUsers(ctx, []string{resourceID})
+	if err != nil {
+		log.Printf("[GetContent] Error getting users info: %v", err)
+		return nil, fmt.Errorf("failed to get users info: %w", err)
+	}
+	if users := sharedUsers[resourceID]; len(users) > 0 {
 		folder.ShareInfo = &domain.ShareInfo{
 			IsShared:    true,
-			SharedUsers: sharedUsers,
+			SharedUsers: users,
 		}
-
-		log.Printf("[GetContent] Added share info with %d users", len(sharedUsers))
+		log.Printf("[GetContent] Added share info with %d users", len(users))
 	}
 
 	// Получаем содержимое папки
-	content, err := r.getContentInternal(ctx, folder)
+	content, err := r.getContentInternal(ctx, folder, opts)
 	if err != nil {
 		log.Printf("[GetContent] Error getting folder content: %v", err)
 		return nil, fmt.Errorf("failed to get folder content: %w", err)
@@ -305,196 +276,83 @@ func (r *FolderRepository) GetContent(ctx context.Context, folderID int64, userI
 }
 
 // getContentInternal получает содержимое папки без проверки прав доступа
-func (r *FolderRepository) getContentInternal(ctx context.Context, folder *domain.Folder) (*domain.FolderContent, error) {
+func (r *FolderRepository) getContentInternal(ctx context.Context, folder *domain.Folder, opts domain.ListOptions) (*domain.FolderContent, error) {
 	log.Printf("[getContentInternal] Getting content for folder %d", folder.ID)
 
-	// 1. Получаем подпапки с информацией о шаринге
+	// Выбираем элементы текущей страницы
+	page, err := listFolderPage(ctx, conn(ctx, r.db), folder.ID, opts)
+	if err != nil {
+		log.Printf("[getContentInternal] Error listing folder content: %v", err)
+		return nil, err
+	}
+
+	// 1. Получаем подпапки страницы
 	var subfolders []domain.Folder
 	subfoldersQuery := `
-        WITH folder_shares AS (
-            SELECT 
-                s.resource_id,
-                array_to_json(array_agg(json_build_object(
-                    'access_type', s.access_type,
-                    'user_ids', s.user_ids
-                ))) as shares_info
-            FROM shares s
-            WHERE s.resource_type = 'folder'
-            AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
-            GROUP BY s.resource_id
-        )
-        SELECT 
-            f.*,
-            fs.shares_info
+        SELECT f.*
         FROM folders f
-        LEFT JOIN folder_shares fs ON f.id::text = fs.resource_id
         WHERE f.parent_id = $1 
         AND f.deleted_at IS NULL 
-        ORDER BY f.name
+        AND f.id::text = ANY($2)
     `
 
-	// Структура для сканирования результатов
-	type shareInfoJSON struct {
-		AccessType string `json:"access_type"`
-		UserIds    string `json:"user_ids"`
+	if len(page.FolderIDs) > 0 {
+		err = conn(ctx, r.db).SelectContext(ctx, &subfolders, subfoldersQuery, folder.ID, pq.Array(page.FolderIDs))
 	}
-
-	type folderWithShares struct {
-		domain.Folder
-		SharesInfo *string `db:"shares_info"`
-	}
-
-	var foldersWithShares []folderWithShares
-	err := r.db.SelectContext(ctx, &foldersWithShares, subfoldersQuery, folder.ID)
 	if err != nil {
 		log.Printf("[getContentInternal] Error getting subfolders: %v", err)
 		return nil, fmt.Errorf("failed to get subfolders: %w", err)
 	}
 
-	// 2. Обрабатываем результаты и добавляем информацию о шаринге
-	subfolders = make([]domain.Folder, len(foldersWithShares))
-	for i, f := range foldersWithShares {
-		subfolders[i] = f.Folder
-
-		if f.SharesInfo != nil {
-			var sharesInfo []shareInfoJSON
-			if err := json.Unmarshal([]byte(*f.SharesInfo), &sharesInfo); err != nil {
-				log.Printf("[getContentInternal] Error unmarshal shares info for folder %d: %v", f.ID, err)
-				continue
-			}
-
-			// Собираем информацию о правах доступа
-			userAccessMap := make(map[string]string)
-			allUserIDs := make([]string, 0)
-
-			for _, shareInfo := range sharesInfo {
-				userIDs := strings.Split(shareInfo.UserIds, ",")
-				for _, userID := range userIDs {
-					userID = strings.TrimSpace(userID)
-					if userID != "" {
-						userAccessMap[userID] = shareInfo.AccessType
-						allUserIDs = append(allUserIDs, userID)
-					}
-				}
-			}
-
-			if len(allUserIDs) > 0 {
-				users, err := auth.GetUsersByIds(ctx, allUserIDs)
-				if err != nil {
-					log.Printf("[getContentInternal] Error getting users for folder %d: %v", f.ID, err)
-					continue
-				}
-
-				sharedUsers := make([]domain.SharedUser, 0, len(users))
-				for _, user := range users {
-					if accessType, ok := userAccessMap[user.ID]; ok {
-						sharedUsers = append(sharedUsers, domain.SharedUser{
-							ID:         user.ID,
-							Email:      user.Email,
-							Name:       user.Name,
-							Lastname:   user.Lastname,
-							Photo:      user.Photo,
-							AccessType: accessType,
-						})
-					}
-				}
-
-				subfolders[i].ShareInfo = &domain.ShareInfo{
-					IsShared:    true,
-					SharedUsers: sharedUsers,
-				}
+	// 2. Добавляем информацию о шаринге подпапок и текущей папки
+	folderIDs := append([]string{strconv.FormatInt(folder.ID, 10)}, page.FolderIDs...)
+	sharedUsers, err := r.loadSharedUsers(ctx, folderIDs)
+	if err != nil {
+		log.Printf("[getContentInternal] Error getting share info: %v", err)
+	}
+	for i := range subfolders {
+		if users := sharedUsers[strconv.FormatInt(subfolders[i].ID, 10)]; len(users) > 0 {
+			subfolders[i].ShareInfo = &domain.ShareInfo{
+				IsShared:    true,
+				SharedUsers: users,
 			}
 		}
 	}
+	if users := sharedUsers[strconv.FormatInt(folder.ID, 10)]; len(users) > 0 {
+		folder.ShareInfo = &domain.ShareInfo{
+			IsShared:    true,
+			SharedUsers: users,
+		}
+	}
 
+	subfolders = orderFolders(subfolders, page.FolderIDs)
 	log.Printf("[getContentInternal] Found %d subfolders", len(subfolders))
 
-	// 3. Получаем файлы
+	// 3. Получаем файлы страницы
 	var files []domain.File
 	filesQuery := `
         SELECT * FROM files 
         WHERE folder_id = $1 
         AND deleted_at IS NULL 
-        ORDER BY name
+        AND uuid::text = ANY($2)
     `
 
-	err = r.db.SelectContext(ctx, &files, filesQuery, folder.ID)
+	if len(page.FileUUIDs) > 0 {
+		err = conn(ctx, r.db).SelectContext(ctx, &files, filesQuery, folder.ID, pq.Array(page.FileUUIDs))
+	}
 	if err != nil {
 		log.Printf("[getContentInternal] Error getting files: %v", err)
 		return nil, fmt.Errorf("failed to get files: %w", err)
 	}
+	files = orderFiles(files, page.FileUUIDs)
 	log.Printf("[getContentInternal] Found %d files", len(files))
 
-	// 4. Получаем информацию о шаринге для текущей папки
-	sharesQuery := `
-        SELECT 
-            array_to_json(array_agg(json_build_object(
-                'access_type', s.access_type,
-                'user_ids', s.user_ids
-            ))) as shares_info
-        FROM shares s
-        WHERE s.resource_id = $1::text 
-        AND s.resource_type = 'folder'
-        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
-    `
-
-	var sharesInfoJSON *string
-	err = r.db.QueryRowContext(ctx, sharesQuery, folder.ID).Scan(&sharesInfoJSON)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("[getContentInternal] Error getting shares for current folder: %v", err)
-		return nil, fmt.Errorf("failed to get shares: %w", err)
-	}
-
-	if sharesInfoJSON != nil {
-		var sharesInfo []shareInfoJSON
-		if err := json.Unmarshal([]byte(*sharesInfoJSON), &sharesInfo); err != nil {
-			log.Printf("[getContentInternal] Error unmarshal shares info for current folder: %v", err)
-		} else {
-			userAccessMap := make(map[string]string)
-			allUserIDs := make([]string, 0)
-
-			for _, shareInfo := range sharesInfo {
-				userIDs := strings.Split(shareInfo.UserIds, ",")
-				for _, userID := range userIDs {
-					userID = strings.TrimSpace(userID)
-					if userID != "" {
-						userAccessMap[userID] = shareInfo.AccessType
-						allUserIDs = append(allUserIDs, userID)
-					}
-				}
-			}
-
-			if len(allUserIDs) > 0 {
-				users, err := auth.GetUsersByIds(ctx, allUserIDs)
-				if err == nil {
-					sharedUsers := make([]domain.SharedUser, 0, len(users))
-					for _, user := range users {
-						if accessType, ok := userAccessMap[user.ID]; ok {
-							sharedUsers = append(sharedUsers, domain.SharedUser{
-								ID:         user.ID,
-								Email:      user.Email,
-								Name:       user.Name,
-								Lastname:   user.Lastname,
-								Photo:      user.Photo,
-								AccessType: accessType,
-							})
-						}
-					}
-
-					folder.ShareInfo = &domain.ShareInfo{
-						IsShared:    true,
-						SharedUsers: sharedUsers,
-					}
-				}
-			}
-		}
-	}
-
-	// 5. Возвращаем результат
+	// 4. Возвращаем результат
 	return &domain.FolderContent{
 		Folder:  *folder,
 		Files:   files,
 		Folders: subfolders,
+		Page:    &page.Info,
 	}, nil
 }
 
@@ -505,7 +363,7 @@ func (r *FolderRepository) GetRootFolder(ctx context.Context, ownerID string) (*
         WHERE owner_id = $1 AND parent_id IS NULL 
         LIMIT 1`
 
-	err := r.db.GetContext(ctx, &folder, query, ownerID)
+	err := conn(ctx, r.db).GetContext(ctx, &folder, query, ownerID)
 	if err != nil {
 		return nil, err
 	}
@@ -528,7 +386,7 @@ func (r *FolderRepository) GetUserFolders(ctx context.Context, userID string) ([
         ORDER BY path
     `
 
-	err := r.db.SelectContext(ctx, &folders, query, userID)
+	err := conn(ctx, r.db).SelectContext(ctx, &folders, query, userID)
 	if err != nil {
 		log.Printf("[GetUserFolders] Ошибка получения папок: %v", err)
 		return nil, fmt.Errorf("failed to get user folders: %w", err)
@@ -549,7 +407,7 @@ func (r *FolderRepository) IsInHierarchy(ctx context.Context, folderID int64, ro
 
 	// Сначала получаем пути обеих папок
 	var rootPath, folderPath string
-	err = r.db.QueryRowContext(ctx,
+	err = conn(ctx, r.db).QueryRowContext(ctx,
 		"SELECT path FROM folders WHERE id = $1",
 		rootID,
 	).Scan(&rootPath)
@@ -558,7 +416,7 @@ func (r *FolderRepository) IsInHierarchy(ctx context.Context, folderID int64, ro
 		return false, fmt.Errorf("failed to get root folder path: %w", err)
 	}
 
-	err = r.db.QueryRowContext(ctx,
+	err = conn(ctx, r.db).QueryRowContext(ctx,
 		"SELECT path FROM folders WHERE id = $1",
 		folderID,
 	).Scan(&folderPath)
@@ -577,50 +435,93 @@ func (r *FolderRepository) IsInHierarchy(ctx context.Context, folderID int64, ro
 }
 
 func (r *FolderRepository) addShareInfo(ctx context.Context, folder *domain.Folder) error {
-	query := `
-        SELECT s.access_type, s.user_ids
+	folderID := strconv.FormatInt(folder.ID, 10)
+	sharedUsers, err := r.loadSharedUsers(ctx, []string{folderID})
+	if err != nil {
+		return err
+	}
+
+	if users := sharedUsers[folderID]; len(users) > 0 {
+		folder.ShareInfo = &domain.ShareInfo{
+			IsShared:    true,
+			SharedUsers: users,
+		}
+	}
+
+	return nil
+}
+
+// loadSharedUsers возвращает получателей действующих ссылок на папки с их уровнем доступа,
+// сгруппированных по ID папки. Если папка открыта пользователю несколькими ссылками,
+// берется последний выданный доступ
+func (r *FolderRepository) loadSharedUsers(ctx context.Context, folderIDs []string) (map[string][]domain.SharedUser, error) {
+	var rows []struct {
+		ResourceID string `db:"resource_id"`
+		UserID     string `db:"user_id"`
+		AccessType string `db:"access_type"`
+	}
+	err := conn(ctx, r.db).SelectContext(ctx, &rows, `
+        SELECT s.resource_id, sr.user_id, sr.access_type
         FROM shares s
-        WHERE s.resource_id = $1::text 
-        AND s.resource_type = 'folder'
+        JOIN share_recipients sr ON sr.share_id = s.id
+        WHERE s.resource_type = 'folder'
+        AND s.resource_id = ANY($1)
         AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
-    `
-
-	var accessType string
-	var userIDs string
-	err := r.db.QueryRowContext(ctx, query, folder.ID).Scan(&accessType, &userIDs)
+        ORDER BY sr.granted_at`,
+		pq.Array(folderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share recipients: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
 
+	userIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		userIDs = append(userIDs, row.UserID)
+	}
+	users, err := auth.GetUsersByIds(ctx, userIDs)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return err
+		return nil, err
+	}
+	usersByID := make(map[string]auth.UserInfo, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
 	}
 
-	if userIDs != "" {
-		userIDsList := strings.Split(userIDs, ",")
-		users, err := auth.GetUsersByIds(ctx, userIDsList)
-		if err != nil {
-			return err
+	// Уровень доступа каждого получателя по папкам
+	access := make(map[string]map[string]string)
+	order := make(map[string][]string)
+	for _, row := range rows {
+		if _, ok := usersByID[row.UserID]; !ok {
+			continue
+		}
+		if access[row.ResourceID] == nil {
+			access[row.ResourceID] = make(map[string]string)
+		}
+		if _, ok := access[row.ResourceID][row.UserID]; !ok {
+			order[row.ResourceID] = append(order[row.ResourceID], row.UserID)
 		}
+		access[row.ResourceID][row.UserID] = row.AccessType
+	}
 
-		sharedUsers := make([]domain.SharedUser, 0, len(users))
-		for _, user := range users {
+	result := make(map[string][]domain.SharedUser, len(order))
+	for resourceID, ids := range order {
+		sharedUsers := make([]domain.SharedUser, 0, len(ids))
+		for _, id := range ids {
+			user := usersByID[id]
 			sharedUsers = append(sharedUsers, domain.SharedUser{
-				ID:       user.ID,
-				Email:    user.Email,
-				Name:     user.Name,
-				Lastname: user.Lastname,
-				Photo:    user.Photo,
+				ID:         user.ID,
+				Email:      user.Email,
+				Name:       user.Name,
+				Lastname:   user.Lastname,
+				Photo:      user.Photo,
+				AccessType: access[resourceID][id],
 			})
 		}
-
-		folder.ShareInfo = &domain.ShareInfo{
-			IsShared:    true,
-			SharedUsers: sharedUsers,
-		}
+		result[resourceID] = sharedUsers
 	}
-
-	return nil
+	return result, nil
 }
 
 // UpdateFolderName обновляет имя папки
@@ -628,7 +529,7 @@ func (r *FolderRepository) UpdateFolderName(ctx context.Context, folderID int64,
 	// Получаем текущий путь папки
 	var currentPath string
 	var parentID *int64
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		"SELECT path, parent_id FROM folders WHERE id = $1",
 		folderID,
 	).Scan(&currentPath, &parentID)
@@ -660,7 +561,7 @@ func (r *FolderRepository) UpdateFolderName(ctx context.Context, folderID int64,
             updated_at = CURRENT_TIMESTAMP
         WHERE id = $3
     `
-	result, err := r.db.ExecContext(ctx, query, newName, newPath, folderID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, newName, newPath, folderID)
 	if err != nil {
 		return fmt.Errorf("failed to update folder name: %w", err)
 	}
@@ -687,7 +588,7 @@ func (r *FolderRepository) UpdateFolderName(ctx context.Context, folderID int64,
         SET path = replace(f.path, $2, $3)
         WHERE f.id IN (SELECT id FROM subfolder)
     `
-	_, err = r.db.ExecContext(ctx, updateSubfoldersQuery, folderID, currentPath, newPath)
+	_, err = conn(ctx, r.db).ExecContext(ctx, updateSubfoldersQuery, folderID, currentPath, newPath)
 	if err != nil {
 		return fmt.Errorf("failed to update subfolders paths: %w", err)
 	}
@@ -695,78 +596,54 @@ func (r *FolderRepository) UpdateFolderName(ctx context.Context, folderID int64,
 	return nil
 }
 
-// UpdateFolderParent обновляет родительскую папку
-func (r *FolderRepository) UpdateFolderParent(ctx context.Context, folderID int64, newParentID int64) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Получаем информацию о перемещаемой папке
-	var folder domain.Folder
-	err = tx.QueryRowContext(ctx,
-		"SELECT * FROM folders WHERE id = $1",
-		folderID,
-	).Scan(&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID, &folder.Path,
-		&folder.Level, &folder.SizeBytes, &folder.FilesCount, &folder.CreatedAt,
-		&folder.UpdatedAt, &folder.DeletedAt, &folder.RestorePath, &folder.RestoreParentID, &folder.Metadata)
-	if err != nil {
-		return fmt.Errorf("failed to get folder info: %w", err)
-	}
+// UpdateFolderParent перемещает папку в другую родительскую папку. Конфликт имени
+// разрешается по политике policy; при ConflictPolicyVersion папка объединяется
+// с существующей
+func (r *FolderRepository) UpdateFolderParent(ctx context.Context, folderID int64, newParentID int64, policy domain.ConflictPolicy) error {
+	return RunInTx(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db)
 
-	// Получаем путь новой родительской папки
-	var newParentPath string
-	err = tx.QueryRowContext(ctx,
-		"SELECT path FROM folders WHERE id = $1",
-		newParentID,
-	).Scan(&newParentPath)
-	if err != nil {
-		return fmt.Errorf("failed to get new parent path: %w", err)
-	}
+		// Получаем информацию о перемещаемой папке
+		var folder domain.Folder
+		err := q.GetContext(ctx, &folder, `SELECT`+folderColumns+`
+            FROM folders
+            WHERE id = $1 AND deleted_at IS NULL`, folderID)
+		if err != nil {
+			return fmt.Errorf("failed to get folder info: %w", err)
+		}
+		if folder.ParentID != nil && *folder.ParentID == newParentID {
+			return nil
+		}
 
-	// Исправление: формируем новый путь с учетом корневой папки
-	var newPath string
-	if newParentPath == "/" {
-		// Если новый родитель - корневая папка
-		newPath = fmt.Sprintf("/%s", folder.Name)
-	} else {
-		// Для остальных случаев
-		newPath = fmt.Sprintf("%s/%s", newParentPath, folder.Name)
-	}
+		name, existing, err := resolveFolderConflict(ctx, q, newParentID, folder.Name, folder.ID, policy)
+		if err != nil {
+			return err
+		}
 
-	// Обновляем родителя и путь папки
-	updateQuery := `
-        UPDATE folders 
-        SET parent_id = $1,
-            path = $2,
-            updated_at = CURRENT_TIMESTAMP
-        WHERE id = $3
-    `
-	_, err = tx.ExecContext(ctx, updateQuery, newParentID, newPath, folderID)
-	if err != nil {
-		return fmt.Errorf("failed to update folder parent: %w", err)
-	}
+		if existing != nil {
+			err = mergeFolder(ctx, q, &folder, existing)
+		} else {
+			err = reparentFolder(ctx, q, folder.ID, newParentID, name)
+		}
+		if err != nil {
+			return err
+		}
 
-	// Обновляем пути всех подпапок
-	updateSubfoldersQuery := `
-        WITH RECURSIVE subfolder AS (
-            SELECT id, path FROM folders WHERE parent_id = $1
-            UNION ALL
-            SELECT f.id, f.path
-            FROM folders f
-            INNER JOIN subfolder s ON f.parent_id = s.id
-        )
-        UPDATE folders f
-        SET path = replace(f.path, $2, $3)
-        WHERE f.id IN (SELECT id FROM subfolder)
-    `
-	_, err = tx.ExecContext(ctx, updateSubfoldersQuery, folderID, folder.Path, newPath)
-	if err != nil {
-		return fmt.Errorf("failed to update subfolders paths: %w", err)
-	}
+		// Пересчитываем размеры старой и новой родительских папок
+		if folder.ParentID != nil {
+			if err := recalculateFolderSizes(ctx, q, *folder.ParentID); err != nil {
+				return err
+			}
+		}
+		return recalculateFolderSizes(ctx, q, newParentID)
+	})
+}
 
-	return tx.Commit()
+// ResolveNameConflict разрешает конфликт имени новой подпапки по политике policy и
+// блокирует имена в папке до конца транзакции. Вызывается внутри RunInTx.
+// Для ConflictPolicyVersion возвращает существующую папку для объединения
+func (r *FolderRepository) ResolveNameConflict(ctx context.Context, parentID int64, name string, policy domain.ConflictPolicy) (string, *domain.Folder, error) {
+	return resolveFolderConflict(ctx, conn(ctx, r.db), parentID, name, 0, policy)
 }
 
 // CheckFolderExists проверяет существование папки с таким именем на том же уровне
@@ -778,7 +655,7 @@ func (r *FolderRepository) CheckFolderExists(ctx context.Context, parentID *int6
             WHERE parent_id = $1 AND name = $2 AND id != $3 AND deleted_at IS NULL
         )`
 
-	err := r.db.GetContext(ctx, &exists, query, parentID, name, excludeID)
+	err := conn(ctx, r.db).GetContext(ctx, &exists, query, parentID, name, excludeID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check folder existence: %w", err)
 	}
@@ -795,10 +672,99 @@ func (r *FolderRepository) CheckFolderExistsInParent(ctx context.Context, parent
             WHERE parent_id = $1 AND name = $2 AND deleted_at IS NULL
         )`
 
-	err := r.db.GetContext(ctx, &exists, query, parentID, name)
+	err := conn(ctx, r.db).GetContext(ctx, &exists, query, parentID, name)
 	if err != nil {
 		return false, fmt.Errorf("failed to check folder existence: %w", err)
 	}
 
 	return exists, nil
 }
+
+// GetChildByName возвращает неудаленную подпапку с указанным именем или nil, если ее нет
+func (r *FolderRepository) GetChildByName(ctx context.Context, parentID int64, name string) (*domain.Folder, error) {
+	query := `
+        SELECT
+            id, name, owner_id, parent_id, path, level,
+            size_bytes, files_count, created_at, updated_at,
+            deleted_at, restore_path, restore_parent_id,
+            COALESCE(metadata, '{}'::jsonb) as metadata
+        FROM folders
+        WHERE parent_id = $1 AND name = $2 AND deleted_at IS NULL`
+
+	var folder domain.Folder
+	err := conn(ctx, r.db).GetContext(ctx, &folder, query, parentID, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder by name: %w", err)
+	}
+
+	return &folder, nil
+}
+
+// GetFolderTree возвращает папку и все её неудаленные подпапки.
+// Родительские папки всегда идут раньше дочерних
+func (r *FolderRepository) GetFolderTree(ctx context.Context, folderID int64) ([]domain.Folder, error) {
+	query := `
+        WITH RECURSIVE subfolder AS (
+            SELECT id, 0 AS depth
+            FROM folders
+            WHERE id = $1 AND deleted_at IS NULL
+
+            UNION ALL
+
+            SELECT f.id, s.depth + 1
+            FROM folders f
+            INNER JOIN subfolder s ON f.parent_id = s.id
+            WHERE f.deleted_at IS NULL
+        )
+        SELECT
+            f.id, f.name, f.owner_id, f.parent_id, f.path, f.level,
+            f.size_bytes, f.files_count, f.created_at, f.updated_at,
+            f.deleted_at, f.restore_path, f.restore_parent_id,
+            COALESCE(f.metadata, '{}'::jsonb) as metadata
+        FROM folders f
+        INNER JOIN subfolder s ON f.id = s.id
+        ORDER BY s.depth, f.name`
+
+	var folders []domain.Folder
+	if err := conn(ctx, r.db).SelectContext(ctx, &folders, query, folderID); err != nil {
+		return nil, fmt.Errorf("failed to get folder tree: %w", err)
+	}
+
+	if len(folders) == 0 {
+		return nil, fmt.Errorf("folder not found")
+	}
+
+	return folders, nil
+}
+
+// GetTreeFiles возвращает неудаленные файлы из папки и всех её подпапок
+func (r *FolderRepository) GetTreeFiles(ctx context.Context, folderID int64) ([]domain.File, error) {
+	query := `
+        WITH RECURSIVE subfolder AS (
+            SELECT id
+            FROM folders
+            WHERE id = $1 AND deleted_at IS NULL
+
+            UNION ALL
+
+            SELECT f.id
+            FROM folders f
+            INNER JOIN subfolder s ON f.parent_id = s.id
+            WHERE f.deleted_at IS NULL
+        )
+        SELECT files.*
+        FROM files
+        INNER JOIN subfolder s ON files.folder_id = s.id
+        WHERE files.deleted_at IS NULL
+        ORDER BY files.folder_id, files.name`
+
+	var files []domain.File
+	if err := conn(ctx, r.db).SelectContext(ctx, &files, query, folderID); err != nil {
+		return nil, fmt.Errorf("failed to get folder tree files: %w", err)
+	}
+
+	return files, nil
+}
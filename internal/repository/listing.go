@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"synxrondrive/internal/domain"
+)
+
+// listSortColumn - выражения сортировки для папок и файлов и тип значения в курсоре
+type listSortColumn struct {
+	folder string
+	file   string
+	cast   string
+}
+
+var listSortColumns = map[domain.ListSort]listSortColumn{
+	domain.ListSortName:      {folder: "f.name", file: "fl.name", cast: "text"},
+	domain.ListSortSize:      {folder: "COALESCE(f.size_bytes, 0)", file: "fl.size_bytes", cast: "bigint"},
+	domain.ListSortType:      {folder: "f.name", file: "fl.mime_type", cast: "text"},
+	domain.ListSortCreatedAt: {folder: "f.created_at", file: "fl.created_at", cast: "timestamptz"},
+	domain.ListSortUpdatedAt: {folder: "f.updated_at", file: "fl.updated_at", cast: "timestamptz"},
+}
+
+// Виды элементов в выдаче: папки всегда идут перед файлами
+const (
+	listKindFolder = 0
+	listKindFile   = 1
+)
+
+// listCursor - позиция последнего элемента страницы. Сортировка сохраняется в курсоре,
+// чтобы курсор нельзя было применить к выдаче с другим порядком
+type listCursor struct {
+	Sort       domain.ListSort `json:"s"`
+	Descending bool            `json:"d"`
+	Kind       int             `json:"k"`
+	Value      string          `json:"v"`
+	ID         string          `json:"id"`
+}
+
+// listItem - элемент страницы до загрузки полных данных папки или файла
+type listItem struct {
+	Kind  int    `db:"kind"`
+	ID    string `db:"item_id"`
+	Value string `db:"sort_value"`
+}
+
+// folderPage - страница содержимого папки: идентификаторы элементов в порядке выдачи
+type folderPage struct {
+	FolderIDs []string
+	FileUUIDs []string
+	Info      domain.PageInfo
+}
+
+// listFolderPage выбирает страницу содержимого папки по курсору и считает
+// общее количество подпапок и файлов, подходящих под фильтры
+func listFolderPage(ctx context.Context, q queryer, folderID int64, opts domain.ListOptions) (*folderPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = domain.ListSortName
+	}
+	column, ok := listSortColumns[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort: %s", opts.Sort)
+	}
+
+	args := []interface{}{folderID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// Фильтры относятся к файлам, поэтому при их наличии подпапки не выводятся
+	foldersFilter := ""
+	filesFilter := ""
+	if opts.MIMECategory != "" {
+		patterns, ok := domain.MIMECategories[opts.MIMECategory]
+		if !ok {
+			return nil, fmt.Errorf("invalid mime category: %s", opts.MIMECategory)
+		}
+		foldersFilter = " AND false"
+		filesFilter += " AND fl.mime_type LIKE ANY(" + arg(pq.Array(patterns)) + ")"
+	}
+	if opts.ContextType != "" {
+		foldersFilter = " AND false"
+		filesFilter += " AND fl.context_type = " + arg(opts.ContextType)
+	}
+
+	itemsQuery := `
+        SELECT ` + fmt.Sprint(listKindFolder) + ` AS kind, f.id::text AS item_id, ` + column.folder + ` AS sort_key
+        FROM folders f
+        WHERE f.parent_id = $1 AND f.deleted_at IS NULL` + foldersFilter + `
+        UNION ALL
+        SELECT ` + fmt.Sprint(listKindFile) + `, fl.uuid::text, ` + column.file + `
+        FROM files fl
+        WHERE fl.folder_id = $1 AND fl.deleted_at IS NULL` + filesFilter
+
+	info := domain.PageInfo{}
+	err := q.QueryRowContext(ctx, `
+        SELECT
+            COUNT(*) FILTER (WHERE kind = `+fmt.Sprint(listKindFolder)+`),
+            COUNT(*) FILTER (WHERE kind = `+fmt.Sprint(listKindFile)+`)
+        FROM (`+itemsQuery+`) items`, args...).Scan(&info.TotalFolders, &info.TotalFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count folder content: %w", err)
+	}
+
+	direction := "ASC"
+	if opts.Descending {
+		direction = "DESC"
+	}
+
+	where := ""
+	if opts.Cursor != "" {
+		condition, err := listCursorCondition(opts, column, arg)
+		if err != nil {
+			return nil, err
+		}
+		where = "\n        WHERE " + condition
+	}
+
+	// Лимит на единицу больше размера страницы, чтобы узнать, есть ли следующая
+	var limit interface{}
+	if opts.Limit > 0 {
+		limit = opts.Limit + 1
+	}
+	pageQuery := `
+        SELECT kind, item_id, sort_key::text AS sort_value
+        FROM (` + itemsQuery + `) items` + where + `
+        ORDER BY kind, sort_key ` + direction + `, item_id ` + direction + `
+        LIMIT ` + arg(limit)
+
+	var items []listItem
+	if err := q.SelectContext(ctx, &items, pageQuery, args...); err != nil {
+		return nil, fmt.Errorf("failed to list folder content: %w", err)
+	}
+
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		items = items[:opts.Limit]
+		last := items[len(items)-1]
+		info.HasMore = true
+		info.NextCursor = encodeListCursor(listCursor{
+			Sort:       opts.Sort,
+			Descending: opts.Descending,
+			Kind:       last.Kind,
+			Value:      last.Value,
+			ID:         last.ID,
+		})
+	}
+
+	page := &folderPage{Info: info}
+	for _, item := range items {
+		if item.Kind == listKindFolder {
+			page.FolderIDs = append(page.FolderIDs, item.ID)
+		} else {
+			page.FileUUIDs = append(page.FileUUIDs, item.ID)
+		}
+	}
+	return page, nil
+}
+
+// orderFolders расставляет папки в порядке страницы
+func orderFolders(folders []domain.Folder, ids []string) []domain.Folder {
+	byID := make(map[string]domain.Folder, len(folders))
+	for _, folder := range folders {
+		byID[fmt.Sprint(folder.ID)] = folder
+	}
+	ordered := make([]domain.Folder, 0, len(ids))
+	for _, id := range ids {
+		if folder, ok := byID[id]; ok {
+			ordered = append(ordered, folder)
+		}
+	}
+	return ordered
+}
+
+// orderFiles расставляет файлы в порядке страницы
+func orderFiles(files []domain.File, uuids []string) []domain.File {
+	byUUID := make(map[string]domain.File, len(files))
+	for _, file := range files {
+		byUUID[file.UUID.String()] = file
+	}
+	ordered := make([]domain.File, 0, len(uuids))
+	for _, id := range uuids {
+		if file, ok := byUUID[id]; ok {
+			ordered = append(ordered, file)
+		}
+	}
+	return ordered
+}
+
+// listCursorCondition возвращает условие на элементы после курсора opts.Cursor.
+// Папки всегда идут перед файлами, поэтому вид элемента сравнивается по возрастанию
+// при любом направлении сортировки. Курсор другой сортировки отклоняется
+func listCursorCondition(opts domain.ListOptions, column listSortColumn, arg func(interface{}) string) (string, error) {
+	cursor, err := decodeListCursor(opts.Cursor)
+	if err != nil || cursor.Sort != opts.Sort || cursor.Descending != opts.Descending {
+		return "", fmt.Errorf("invalid cursor")
+	}
+
+	compare := ">"
+	if opts.Descending {
+		compare = "<"
+	}
+	kind, value, id := arg(cursor.Kind), arg(cursor.Value)+"::"+column.cast, arg(cursor.ID)
+	return fmt.Sprintf(
+		"kind > %[1]s OR (kind = %[1]s AND (sort_key %[4]s %[2]s OR (sort_key = %[2]s AND item_id %[4]s %[3]s)))",
+		kind, value, id, compare), nil
+}
+
+func encodeListCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(value string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, err
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
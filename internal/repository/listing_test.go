@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"synxrondrive/internal/domain"
+	"testing"
+)
+
+func TestListCursorRoundTrip(t *testing.T) {
+	cursor := listCursor{Sort: domain.ListSortSize, Descending: true, Kind: listKindFile, Value: "1024", ID: "file-uuid"}
+
+	decoded, err := decodeListCursor(" " + encodeListCursor(cursor) + "\n")
+	if err != nil {
+		t.Fatalf("decodeListCursor: %v", err)
+	}
+	if *decoded != cursor {
+		t.Errorf("decoded cursor = %+v, want %+v", *decoded, cursor)
+	}
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24", ""} {
+		if _, err := decodeListCursor(value); err == nil {
+			t.Errorf("decodeListCursor(%q) accepted an invalid cursor", value)
+		}
+	}
+}
+
+func TestListCursorCondition(t *testing.T) {
+	name := listSortColumns[domain.ListSortName]
+	size := listSortColumns[domain.ListSortSize]
+	cursor := func(sort domain.ListSort, descending bool) string {
+		return encodeListCursor(listCursor{Sort: sort, Descending: descending, Kind: listKindFile, Value: "b", ID: "id-1"})
+	}
+
+	tests := []struct {
+		name     string
+		opts     domain.ListOptions
+		column   listSortColumn
+		want     string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "ascending",
+			opts:     domain.ListOptions{Sort: domain.ListSortName, Cursor: cursor(domain.ListSortName, false)},
+			column:   name,
+			want:     "kind > $2 OR (kind = $2 AND (sort_key > $3::text OR (sort_key = $3::text AND item_id > $4)))",
+			wantArgs: []interface{}{int64(1), listKindFile, "b", "id-1"},
+		},
+		{
+			name:     "descending keeps folders first",
+			opts:     domain.ListOptions{Sort: domain.ListSortSize, Descending: true, Cursor: cursor(domain.ListSortSize, true)},
+			column:   size,
+			want:     "kind > $2 OR (kind = $2 AND (sort_key < $3::bigint OR (sort_key = $3::bigint AND item_id < $4)))",
+			wantArgs: []interface{}{int64(1), listKindFile, "b", "id-1"},
+		},
+		{
+			name:    "other sort",
+			opts:    domain.ListOptions{Sort: domain.ListSortSize, Cursor: cursor(domain.ListSortName, false)},
+			column:  size,
+			wantErr: true,
+		},
+		{
+			name:    "other direction",
+			opts:    domain.ListOptions{Sort: domain.ListSortName, Descending: true, Cursor: cursor(domain.ListSortName, false)},
+			column:  name,
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			opts:    domain.ListOptions{Sort: domain.ListSortName, Cursor: "garbage"},
+			column:  name,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		args := []interface{}{int64(1)}
+		arg := func(value interface{}) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		}
+
+		got, err := listCursorCondition(tt.opts, tt.column, arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: cursor was accepted", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: condition = %q, want %q", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: args = %v, want %v", tt.name, args, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"strings"
+	"synxrondrive/internal/domain"
+)
+
+type SearchRepository struct {
+	db *sqlx.DB
+}
+
+func NewSearchRepository(db *sqlx.DB) *SearchRepository {
+	return &SearchRepository{db: db}
+}
+
+// searchRow - строка результата поиска до загрузки файла или папки
+type searchRow struct {
+	ItemType   string  `db:"item_type"`
+	ItemID     string  `db:"item_id"`
+	FolderPath string  `db:"folder_path"`
+	Shared     bool    `db:"shared"`
+	Rank       float64 `db:"rank"`
+	Total      int     `db:"total"`
+	Snippet    string  `db:"snippet"`
+}
+
+// snippetOptions - параметры фрагментов содержимого с подсветкой совпадений
+var snippetOptions = fmt.Sprintf(
+	`StartSel=%s, StopSel=%s, MinWords=15, MaxWords=35, MaxFragments=2, FragmentDelimiter=" … "`,
+	domain.SnippetStart, domain.SnippetStop,
+)
+
+// Search ищет по именам файлов и папок пользователя и ресурсов, к которым ему открыт доступ,
+// а также по извлеченному тексту документов. Используются триграммные и полнотекстовые индексы.
+// Возвращает страницу результатов, отсортированную по релевантности, и общее количество найденных элементов
+func (r *SearchRepository) Search(ctx context.Context, userID string, query domain.SearchQuery) ([]domain.SearchHit, int, error) {
+	args := []interface{}{userID, query.Text, "%" + escapeLike(query.Text) + "%"}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var fileFilters, folderFilters []string
+	switch query.ItemType {
+	case "file":
+		folderFilters = append(folderFilters, "false")
+	case "folder":
+		fileFilters = append(fileFilters, "false")
+	}
+	if query.MIMEType != "" {
+		pattern := escapeLike(query.MIMEType)
+		if strings.HasSuffix(query.MIMEType, "/*") {
+			pattern = escapeLike(strings.TrimSuffix(query.MIMEType, "*")) + "%"
+		}
+		fileFilters = append(fileFilters, "fl.mime_type LIKE "+arg(pattern))
+		folderFilters = append(folderFilters, "false")
+	}
+	if query.MinSize != nil {
+		p := arg(*query.MinSize)
+		fileFilters = append(fileFilters, "fl.size_bytes >= "+p)
+		folderFilters = append(folderFilters, "COALESCE(f.size_bytes, 0) >= "+p)
+	}
+	if query.MaxSize != nil {
+		p := arg(*query.MaxSize)
+		fileFilters = append(fileFilters, "fl.size_bytes <= "+p)
+		folderFilters = append(folderFilters, "COALESCE(f.size_bytes, 0) <= "+p)
+	}
+	if query.UpdatedFrom != nil {
+		p := arg(*query.UpdatedFrom)
+		fileFilters = append(fileFilters, "fl.updated_at >= "+p)
+		folderFilters = append(folderFilters, "f.updated_at >= "+p)
+	}
+	if query.UpdatedTo != nil {
+		p := arg(*query.UpdatedTo)
+		fileFilters = append(fileFilters, "fl.updated_at < "+p)
+		folderFilters = append(folderFilters, "f.updated_at < "+p)
+	}
+	if query.OwnerID != "" {
+		p := arg(query.OwnerID)
+		fileFilters = append(fileFilters, "fl.owner_id = "+p)
+		folderFilters = append(folderFilters, "f.owner_id = "+p)
+	}
+	if query.FolderID != nil {
+		p := arg(*query.FolderID)
+		// Файлы - в самой папке или её подпапках, папки - только вложенные
+		fileFilters = append(fileFilters, `EXISTS (
+                SELECT 1 FROM folders sub
+                WHERE sub.id = `+p+` AND sub.owner_id = fo.owner_id
+                AND (fo.id = sub.id OR `+pathUnder("fo.path", "sub.path")+`))`)
+		folderFilters = append(folderFilters, `EXISTS (
+                SELECT 1 FROM folders sub
+                WHERE sub.id = `+p+` AND sub.owner_id = f.owner_id
+                AND `+pathUnder("f.path", "sub.path")+`)`)
+	}
+
+	if len(query.TagIDs) > 0 {
+		// Учитываются только собственные метки пользователя
+		ids, count := arg(pq.Array(query.TagIDs)), arg(len(query.TagIDs))
+		fileFilters = append(fileFilters, `(
+                SELECT COUNT(*) FROM item_tags it
+                JOIN tags t ON t.id = it.tag_id
+                WHERE it.file_uuid = fl.uuid AND t.owner_id = $1 AND t.id = ANY(`+ids+`)) = `+count)
+		folderFilters = append(folderFilters, `(
+                SELECT COUNT(*) FROM item_tags it
+                JOIN tags t ON t.id = it.tag_id
+                WHERE it.folder_id = f.id AND t.owner_id = $1 AND t.id = ANY(`+ids+`)) = `+count)
+	}
+
+	limit, offset, options := arg(query.Limit), arg(query.Offset), arg(snippetOptions)
+	sqlQuery := `
+        WITH` + sharedWithUserCTE + `,
+        hits AS (
+            SELECT 'file' AS item_type, fl.uuid::text AS item_id, fo.path AS folder_path,
+                   fl.owner_id <> $1 AS shared,
+                   GREATEST(` + searchRank("fl.name") + `,
+                            COALESCE(ts_rank(fc.content_tsv, plainto_tsquery('simple', $2)), 0)) AS rank,
+                   COALESCE(fc.content_tsv @@ plainto_tsquery('simple', $2), false) AS content_match,
+                   fl.updated_at
+            FROM files fl
+            JOIN folders fo ON fo.id = fl.folder_id
+            LEFT JOIN file_contents fc ON fc.file_uuid = fl.uuid AND fc.status = 'indexed'
+            WHERE fl.deleted_at IS NULL
+            AND (` + searchMatch("fl.name") + `
+                OR fc.content_tsv @@ plainto_tsquery('simple', $2))
+            AND ` + visibleFile("fl", "fo") + andAll(fileFilters) + `
+
+            UNION ALL
+
+            SELECT 'folder', f.id::text, COALESCE(p.path, '/'),
+                   f.owner_id <> $1, ` + searchRank("f.name") + `, false, f.updated_at
+            FROM folders f
+            LEFT JOIN folders p ON p.id = f.parent_id
+            WHERE f.deleted_at IS NULL
+            AND f.parent_id IS NOT NULL
+            AND ` + searchMatch("f.name") + `
+            AND ` + visibleFolder("f") + andAll(folderFilters) + `
+        ),
+        page AS (
+            SELECT *, COUNT(*) OVER() AS total
+            FROM hits
+            ORDER BY rank DESC, updated_at DESC, item_id
+            LIMIT ` + limit + ` OFFSET ` + offset + `
+        )
+        -- Фрагменты с подсветкой строятся только для строк текущей страницы
+        SELECT p.item_type, p.item_id, p.folder_path, p.shared, p.rank, p.total,
+               CASE WHEN p.content_match
+                    THEN ts_headline('simple', fc.content, plainto_tsquery('simple', $2), ` + options + `)
+                    ELSE ''
+               END AS snippet
+        FROM page p
+        LEFT JOIN file_contents fc ON p.item_type = 'file' AND fc.file_uuid::text = p.item_id
+        ORDER BY p.rank DESC, p.updated_at DESC, p.item_id`
+
+	var rows []searchRow
+	if err := r.db.SelectContext(ctx, &rows, sqlQuery, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
+	if len(rows) == 0 {
+		return []domain.SearchHit{}, 0, nil
+	}
+
+	hits, err := r.loadHits(ctx, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hits, rows[0].Total, nil
+}
+
+// loadHits загружает найденные файлы и папки, сохраняя порядок результатов
+func (r *SearchRepository) loadHits(ctx context.Context, rows []searchRow) ([]domain.SearchHit, error) {
+	var fileIDs, folderIDs []string
+	for _, row := range rows {
+		if row.ItemType == "file" {
+			fileIDs = append(fileIDs, row.ItemID)
+		} else {
+			folderIDs = append(folderIDs, row.ItemID)
+		}
+	}
+
+	files, folders, err := loadItems(ctx, r.db, fileIDs, folderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load search results: %w", err)
+	}
+
+	hits := make([]domain.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := domain.SearchHit{
+			ItemType:   row.ItemType,
+			FolderPath: row.FolderPath,
+			Snippet:    row.Snippet,
+			Shared:     row.Shared,
+			Rank:       row.Rank,
+		}
+		if row.ItemType == "file" {
+			if hit.File = files[row.ItemID]; hit.File == nil {
+				continue
+			}
+		} else if hit.Folder = folders[row.ItemID]; hit.Folder == nil {
+			continue
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// searchMatch - условие совпадения имени с поисковым запросом ($2 - запрос, $3 - шаблон ILIKE)
+func searchMatch(column string) string {
+	return fmt.Sprintf(`(%[1]s ILIKE $3
+                OR to_tsvector('simple', %[1]s) @@ plainto_tsquery('simple', $2)
+                OR %[1]s %% $2)`, column)
+}
+
+// searchRank - релевантность имени: наибольшее из триграммного сходства и полнотекстового ранга
+func searchRank(column string) string {
+	return fmt.Sprintf(`GREATEST(similarity(%[1]s, $2), ts_rank(to_tsvector('simple', %[1]s), plainto_tsquery('simple', $2)))`, column)
+}
+
+// pathUnder - условие, что путь path лежит строго внутри пути parent
+func pathUnder(path string, parent string) string {
+	return fmt.Sprintf(`left(%[1]s, length(rtrim(%[2]s, '/')) + 1) = rtrim(%[2]s, '/') || '/'`, path, parent)
+}
+
+func andAll(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "\n            AND " + strings.Join(conditions, "\n            AND ")
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"synxrondrive/internal/domain"
+	"time"
+)
+
+type ShareAuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewShareAuditRepository(db *sqlx.DB) *ShareAuditRepository {
+	return &ShareAuditRepository{db: db}
+}
+
+// shareAccessRow - запись журнала вместе с общим числом записей ссылки
+type shareAccessRow struct {
+	domain.ShareAccessEntry
+	Total int `db:"total"`
+}
+
+// RecordByToken записывает обращение к ссылке с токеном token.
+// Обращения владельца к собственной ссылке не записываются
+func (r *ShareAuditRepository) RecordByToken(ctx context.Context, token string, accessor domain.ShareAccessor, action domain.ShareAccessAction, resourceID *string) error {
+	return r.record(ctx, "token = $1", token, accessor, action, resourceID)
+}
+
+// RecordByID записывает обращение к ссылке по ее ID
+func (r *ShareAuditRepository) RecordByID(ctx context.Context, shareID uuid.UUID, accessor domain.ShareAccessor, action domain.ShareAccessAction, resourceID *string) error {
+	return r.record(ctx, "id = $1", shareID, accessor, action, resourceID)
+}
+
+func (r *ShareAuditRepository) record(
+	ctx context.Context,
+	condition string,
+	key interface{},
+	accessor domain.ShareAccessor,
+	action domain.ShareAccessAction,
+	resourceID *string,
+) error {
+	userID, ip := accessorColumns(accessor)
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO share_access_log (share_id, user_id, ip, action, resource_id)
+        SELECT id, $2, $3, $4, $5
+        FROM shares
+        WHERE `+condition+`
+        AND ($2::text IS NULL OR owner_id <> $2)`,
+		key, userID, ip, action, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to record share access: %w", err)
+	}
+	return nil
+}
+
+// RecordFileAccess записывает обращение пользователя к чужому файлу во все ссылки,
+// через которые файл ему открыт: ссылку на сам файл или на одну из его папок
+func (r *ShareAuditRepository) RecordFileAccess(ctx context.Context, userID string, file *domain.File, action domain.ShareAccessAction) error {
+	_, err := r.db.ExecContext(ctx, `
+        WITH RECURSIVE ancestors AS (
+            SELECT id, parent_id FROM folders WHERE id = $4
+            UNION ALL
+            SELECT f.id, f.parent_id
+            FROM folders f
+            JOIN ancestors a ON f.id = a.parent_id
+        )
+        INSERT INTO share_access_log (share_id, user_id, action, resource_id)
+        SELECT s.id, $1, $2, $3
+        FROM shares s
+        JOIN share_recipients sr ON sr.share_id = s.id AND sr.user_id = $1
+        WHERE s.owner_id <> $1
+        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+        AND (
+            (s.resource_type = 'file' AND s.resource_id = $3)
+            OR (s.resource_type = 'folder' AND s.resource_id IN (SELECT id::text FROM ancestors))
+        )`,
+		userID, action, file.UUID.String(), file.FolderID)
+	if err != nil {
+		return fmt.Errorf("failed to record file access: %w", err)
+	}
+	return nil
+}
+
+// RecordFileAccessByToken записывает обращение к файлу по ссылке с токеном token,
+// если ссылка открывает этот файл: указывает на него или на одну из его папок.
+// Используется и для анонимных обращений, которые нельзя связать с получателем
+func (r *ShareAuditRepository) RecordFileAccessByToken(
+	ctx context.Context,
+	token string,
+	accessor domain.ShareAccessor,
+	file *domain.File,
+	action domain.ShareAccessAction,
+) error {
+	userID, ip := accessorColumns(accessor)
+	_, err := r.db.ExecContext(ctx, `
+        WITH RECURSIVE ancestors AS (
+            SELECT id, parent_id FROM folders WHERE id = $6
+            UNION ALL
+            SELECT f.id, f.parent_id
+            FROM folders f
+            JOIN ancestors a ON f.id = a.parent_id
+        )
+        INSERT INTO share_access_log (share_id, user_id, ip, action, resource_id)
+        SELECT s.id, $2, $3, $4, $5
+        FROM shares s
+        WHERE s.token = $1
+        AND ($2::text IS NULL OR s.owner_id <> $2)
+        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+        AND (
+            (s.resource_type = 'file' AND s.resource_id = $5)
+            OR (s.resource_type = 'folder' AND s.resource_id IN (SELECT id::text FROM ancestors))
+        )`,
+		token, userID, ip, action, file.UUID.String(), file.FolderID)
+	if err != nil {
+		return fmt.Errorf("failed to record file access: %w", err)
+	}
+	return nil
+}
+
+// List возвращает страницу журнала ссылки, последние записи первыми
+func (r *ShareAuditRepository) List(ctx context.Context, shareID uuid.UUID, limit int, offset int) ([]domain.ShareAccessEntry, int, error) {
+	var rows []shareAccessRow
+	err := r.db.SelectContext(ctx, &rows, `
+        SELECT id, share_id, user_id, ip, action, resource_id, occurred_at,
+               COUNT(*) OVER() AS total
+        FROM share_access_log
+        WHERE share_id = $1
+        ORDER BY occurred_at DESC, id DESC
+        LIMIT $2 OFFSET $3`, shareID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get share access log: %w", err)
+	}
+
+	entries := make([]domain.ShareAccessEntry, 0, len(rows))
+	total := 0
+	for _, row := range rows {
+		entries = append(entries, row.ShareAccessEntry)
+		total = row.Total
+	}
+	// За пределами последней страницы оконная функция не возвращает строк
+	if len(rows) == 0 && offset > 0 {
+		if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM share_access_log WHERE share_id = $1`, shareID); err != nil {
+			return nil, 0, fmt.Errorf("failed to count share access log: %w", err)
+		}
+	}
+	return entries, total, nil
+}
+
+// DeleteOlderThan удаляет записи журнала старше before
+func (r *ShareAuditRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM share_access_log WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune share access log: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// accessorColumns возвращает пользователя, а для анонимного обращения - IP
+func accessorColumns(accessor domain.ShareAccessor) (*string, *string) {
+	if accessor.UserID != "" {
+		return &accessor.UserID, nil
+	}
+	if accessor.IP != "" {
+		return nil, &accessor.IP
+	}
+	return nil, nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"strconv"
 	"strings"
 	"synxrondrive/internal/domain"
@@ -23,12 +25,13 @@ func (r *ShareRepository) Create(ctx context.Context, share *domain.Share) error
 	query := `
         INSERT INTO shares (
             id, resource_id, resource_type, owner_id, 
-            access_type, token, expires_at, created_at
+            access_type, token, expires_at, created_at,
+            password_hash, max_downloads, preview_only, upload_only
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP
+            $1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, $8, $9, $10, $11
         ) RETURNING created_at`
 
-	return r.db.QueryRowContext(
+	return conn(ctx, r.db).QueryRowContext(
 		ctx,
 		query,
 		share.ID,
@@ -38,6 +41,10 @@ func (r *ShareRepository) Create(ctx context.Context, share *domain.Share) error
 		share.AccessType,
 		share.Token,
 		share.ExpiresAt,
+		share.PasswordHash,
+		share.MaxDownloads,
+		share.PreviewOnly,
+		share.UploadOnly,
 	).Scan(&share.CreatedAt)
 }
 
@@ -64,27 +71,96 @@ func (r *ShareRepository) DeleteExpired(ctx context.Context) error {
 	return err
 }
 
-func (r *ShareRepository) UpdateExpiration(ctx context.Context, shareID string, expiresAt *time.Time) error {
-	query := `
-        UPDATE shares 
-        SET expires_at = $1, updated_at = CURRENT_TIMESTAMP
-        WHERE id = $2`
+// Update сохраняет настройки ссылки. Если recipients не nil,
+// список получателей заменяется: лишние удаляются, у оставшихся обновляется уровень доступа
+func (r *ShareRepository) Update(ctx context.Context, share *domain.Share, recipients []domain.ShareRecipient) error {
+	return RunInTx(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db)
+		result, err := q.ExecContext(ctx, `
+            UPDATE shares
+            SET access_type = $1, expires_at = $2,
+                password_hash = $3, max_downloads = $4, preview_only = $5
+            WHERE id = $6 AND owner_id = $7`,
+			share.AccessType, share.ExpiresAt,
+			share.PasswordHash, share.MaxDownloads, share.PreviewOnly,
+			share.ID, share.OwnerID)
+		if err != nil {
+			return fmt.Errorf("failed to update share: %w", err)
+		}
 
-	result, err := r.db.ExecContext(ctx, query, expiresAt, shareID)
-	if err != nil {
-		return err
-	}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("share not found")
+		}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+		if recipients == nil {
+			return nil
+		}
 
-	if rows == 0 {
-		return fmt.Errorf("share not found")
+		userIDs := make([]string, 0, len(recipients))
+		for _, recipient := range recipients {
+			userIDs = append(userIDs, recipient.ID)
+		}
+		_, err = q.ExecContext(ctx,
+			`DELETE FROM share_recipients WHERE share_id = $1 AND NOT (user_id = ANY($2))`,
+			share.ID, pq.Array(userIDs))
+		if err != nil {
+			return fmt.Errorf("failed to remove share recipients: %w", err)
+		}
+
+		for _, recipient := range recipients {
+			_, err = q.ExecContext(ctx, `
+                INSERT INTO share_recipients (share_id, user_id, access_type, granted_by)
+                VALUES ($1, $2, $3, $4)
+                ON CONFLICT (share_id, user_id) DO UPDATE SET access_type = EXCLUDED.access_type`,
+				share.ID, recipient.ID, recipient.AccessType, share.OwnerID)
+			if err != nil {
+				return fmt.Errorf("failed to save share recipient: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ownedSharesQuery выбирает ссылки вместе с именем ресурса
+const ownedSharesQuery = `
+        SELECT s.*,
+               COALESCE(fl.name, fo.name, '') AS resource_name,
+               COALESCE(s.expires_at <= CURRENT_TIMESTAMP, false) AS expired,
+               s.password_hash <> '' AS password_protected
+        FROM shares s
+        LEFT JOIN files fl ON s.resource_type = 'file' AND fl.uuid::text = s.resource_id
+        LEFT JOIN folders fo ON s.resource_type = 'folder' AND fo.id::text = s.resource_id`
+
+// GetOwnerShares возвращает все ссылки владельца, включая истекшие
+func (r *ShareRepository) GetOwnerShares(ctx context.Context, ownerID string) ([]domain.OwnedShare, error) {
+	query := ownedSharesQuery + `
+        WHERE s.owner_id = $1
+        ORDER BY s.created_at DESC`
+
+	shares := []domain.OwnedShare{}
+	if err := r.db.SelectContext(ctx, &shares, query, ownerID); err != nil {
+		return nil, fmt.Errorf("failed to get owner shares: %w", err)
 	}
+	return shares, nil
+}
 
-	return nil
+// GetOwnedShare возвращает ссылку владельца по ID
+func (r *ShareRepository) GetOwnedShare(ctx context.Context, shareID string, ownerID string) (*domain.OwnedShare, error) {
+	query := ownedSharesQuery + `
+        WHERE s.id = $1 AND s.owner_id = $2`
+
+	var share domain.OwnedShare
+	if err := r.db.GetContext(ctx, &share, query, shareID, ownerID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("share not found")
+		}
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return &share, nil
 }
 
 func (r *ShareRepository) GetSharesByResource(ctx context.Context, resourceID string, resourceType domain.ResourceType) ([]domain.Share, error) {
@@ -123,42 +199,179 @@ func (r *ShareRepository) DeleteShare(ctx context.Context, shareID string, owner
 	return nil
 }
 
-// AddUserToShare добавляет пользователя к общему ресурсу
-func (r *ShareRepository) AddUserToShare(ctx context.Context, shareID string, userID string) error {
-	query := `
-        UPDATE shares 
-        SET user_ids = 
-            CASE 
-                WHEN user_ids = '' THEN $2
-                WHEN position($2 IN user_ids) = 0 THEN user_ids || ',' || $2
-                ELSE user_ids 
-            END
-        WHERE id = $1
-    `
-	result, err := r.db.ExecContext(ctx, query, shareID, userID)
+// AddRecipient добавляет пользователя в получатели ссылки. Уже добавленный
+// получатель сохраняет свой уровень доступа
+func (r *ShareRepository) AddRecipient(ctx context.Context, share *domain.Share, userID string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO share_recipients (share_id, user_id, access_type, granted_by)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (share_id, user_id) DO NOTHING`,
+		share.ID, userID, share.AccessType, share.OwnerID)
 	if err != nil {
 		return fmt.Errorf("failed to add user to share: %w", err)
 	}
+	return nil
+}
 
-	rows, err := result.RowsAffected()
+// GetRecipients возвращает получателей ссылок в порядке выдачи доступа
+func (r *ShareRepository) GetRecipients(ctx context.Context, shareIDs []string) ([]domain.ShareRecipient, error) {
+	recipients := []domain.ShareRecipient{}
+	if len(shareIDs) == 0 {
+		return recipients, nil
+	}
+
+	err := conn(ctx, r.db).SelectContext(ctx, &recipients, `
+        SELECT share_id, user_id, access_type, granted_at, granted_by
+        FROM share_recipients
+        WHERE share_id = ANY($1::uuid[])
+        ORDER BY granted_at, user_id`,
+		pq.Array(shareIDs))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to get share recipients: %w", err)
 	}
+	return recipients, nil
+}
 
-	if rows == 0 {
-		return fmt.Errorf("share not found")
+// grantColumns - поля ссылки, определяющие доступ получателя
+const grantColumns = `
+        SELECT s.id AS share_id, sr.access_type, s.preview_only, s.max_downloads, s.download_count`
+
+// GetRecipientGrants возвращает доступы пользователя к ресурсу
+// по действующим ссылкам, в которых он указан получателем
+func (r *ShareRepository) GetRecipientGrants(ctx context.Context, userID string, resourceID string, resourceType domain.ResourceType) ([]domain.ShareGrant, error) {
+	var grants []domain.ShareGrant
+	err := conn(ctx, r.db).SelectContext(ctx, &grants, grantColumns+`
+        FROM shares s
+        JOIN share_recipients sr ON sr.share_id = s.id AND sr.user_id = $1
+        WHERE s.resource_id = $2 AND s.resource_type = $3
+        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)`,
+		userID, resourceID, resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient access: %w", err)
 	}
+	return grants, nil
+}
 
-	return nil
+// GetFolderRecipientGrants возвращает доступы пользователя к папке
+// по действующим ссылкам на нее саму и на ее родительские папки
+func (r *ShareRepository) GetFolderRecipientGrants(ctx context.Context, userID string, folderID int64) ([]domain.ShareGrant, error) {
+	var grants []domain.ShareGrant
+	err := conn(ctx, r.db).SelectContext(ctx, &grants, `
+        WITH RECURSIVE ancestors AS (
+            SELECT id, parent_id FROM folders WHERE id = $2
+            UNION ALL
+            SELECT f.id, f.parent_id
+            FROM folders f
+            JOIN ancestors a ON f.id = a.parent_id
+        )`+grantColumns+`
+        FROM ancestors a
+        JOIN shares s ON s.resource_id = a.id::text AND s.resource_type = 'folder'
+        JOIN share_recipients sr ON sr.share_id = s.id AND sr.user_id = $1
+        WHERE s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP`,
+		userID, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient access: %w", err)
+	}
+	return grants, nil
+}
+
+// ConsumeDownload учитывает скачивание по ссылке. Возвращает false,
+// если лимит скачиваний ссылки уже исчерпан
+func (r *ShareRepository) ConsumeDownload(ctx context.Context, shareID uuid.UUID) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+        UPDATE shares
+        SET download_count = download_count + 1
+        WHERE id = $1
+        AND (max_downloads IS NULL OR download_count < max_downloads)`,
+		shareID)
+	if err != nil {
+		return false, fmt.Errorf("failed to count download: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ConsumeDownloadWindow учитывает скачивание ресурса пользователем по ссылке.
+// Скачивание засчитывается один раз за окно window: повторные запросы того же
+// пользователя к тому же ресурсу в течение окна лимит не расходуют. Возвращает
+// false, если открытого окна нет, а лимит скачиваний уже исчерпан
+func (r *ShareRepository) ConsumeDownloadWindow(
+	ctx context.Context,
+	shareID uuid.UUID,
+	userID string,
+	resourceID string,
+	window time.Duration,
+) (bool, error) {
+	allowed := false
+	err := RunInTx(ctx, r.db, func(ctx context.Context) error {
+		db := conn(ctx, r.db)
+
+		// Блокировка ссылки не дает одновременным первым запросам засчитать скачивание дважды
+		var locked uuid.UUID
+		if err := db.QueryRowContext(ctx, `SELECT id FROM shares WHERE id = $1 FOR UPDATE`, shareID).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to lock share: %w", err)
+		}
+
+		if _, err := db.ExecContext(ctx, `
+            DELETE FROM share_download_windows
+            WHERE share_id = $1 AND expires_at <= CURRENT_TIMESTAMP`, shareID); err != nil {
+			return fmt.Errorf("failed to delete expired download windows: %w", err)
+		}
+
+		var open bool
+		if err := db.QueryRowContext(ctx, `
+            SELECT EXISTS (
+                SELECT 1 FROM share_download_windows
+                WHERE share_id = $1 AND user_id = $2 AND resource_id = $3
+            )`, shareID, userID, resourceID).Scan(&open); err != nil {
+			return fmt.Errorf("failed to check download window: %w", err)
+		}
+		if open {
+			allowed = true
+			return nil
+		}
+
+		consumed, err := r.ConsumeDownload(ctx, shareID)
+		if err != nil || !consumed {
+			return err
+		}
+
+		if _, err := db.ExecContext(ctx, `
+            INSERT INTO share_download_windows (share_id, user_id, resource_id, expires_at)
+            VALUES ($1, $2, $3, $4)`,
+			shareID, userID, resourceID, time.Now().Add(window)); err != nil {
+			return fmt.Errorf("failed to open download window: %w", err)
+		}
+		allowed = true
+		return nil
+	})
+	return allowed, err
+}
+
+// IsRecipient проверяет, указан ли пользователь получателем ссылки
+func (r *ShareRepository) IsRecipient(ctx context.Context, shareID uuid.UUID, userID string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).GetContext(ctx, &exists,
+		`SELECT EXISTS (SELECT 1 FROM share_recipients WHERE share_id = $1 AND user_id = $2)`,
+		shareID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check share recipient: %w", err)
+	}
+	return exists, nil
 }
 
-// GetUserShares возвращает все активные ссылки пользователя
+// GetUserShares возвращает действующие чужие ссылки, в которых пользователь указан получателем
 func (r *ShareRepository) GetUserShares(ctx context.Context, userID string) ([]domain.Share, error) {
 	query := `
-        SELECT * FROM shares 
-        WHERE (user_ids LIKE '%' || $1 || '%' AND owner_id != $1)  -- Добавляем проверку owner_id != userID
-        AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
-        ORDER BY created_at DESC
+        SELECT s.* FROM shares s
+        JOIN share_recipients sr ON sr.share_id = s.id AND sr.user_id = $1
+        WHERE s.owner_id <> $1
+        AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+        ORDER BY s.created_at DESC
     `
 
 	var shares []domain.Share
@@ -170,8 +383,9 @@ func (r *ShareRepository) GetUserShares(ctx context.Context, userID string) ([]d
 	return shares, nil
 }
 
-// GetShareContent получает содержимое общего ресурса с учетом пути
-func (r *ShareRepository) GetShareContent(ctx context.Context, shareID string, path string) (*domain.SharedContent, error) {
+// GetShareContent получает содержимое общего ресурса с учетом пути.
+// Для папок возвращается страница содержимого согласно opts
+func (r *ShareRepository) GetShareContent(ctx context.Context, shareID string, path string, opts domain.ListOptions) (*domain.SharedContent, error) {
 	// Получаем информацию о share
 	share := &domain.Share{}
 	err := r.db.GetContext(ctx, share, "SELECT * FROM shares WHERE id = $1", shareID)
@@ -189,7 +403,7 @@ func (r *ShareRepository) GetShareContent(ctx context.Context, shareID string, p
 	// В зависимости от типа ресурса получаем содержимое
 	switch share.ResourceType {
 	case domain.ResourceTypeFolder:
-		return r.getFolderContent(ctx, share, path, content)
+		return r.getFolderContent(ctx, share, path, content, opts)
 	case domain.ResourceTypeFile:
 		return r.getFileContent(ctx, share, content)
 	default:
@@ -198,7 +412,13 @@ func (r *ShareRepository) GetShareContent(ctx context.Context, shareID string, p
 }
 
 // Вспомогательные методы для получения содержимого
-func (r *ShareRepository) getFolderContent(ctx context.Context, share *domain.Share, path string, content *domain.SharedContent) (*domain.SharedContent, error) {
+func (r *ShareRepository) getFolderContent(
+	ctx context.Context,
+	share *domain.Share,
+	path string,
+	content *domain.SharedContent,
+	opts domain.ListOptions,
+) (*domain.SharedContent, error) {
 	// Извлекаем ID папки из пути
 	var folderID int64
 	if path == "/" {
@@ -240,7 +460,14 @@ func (r *ShareRepository) getFolderContent(ctx context.Context, share *domain.Sh
 	}
 	content.ParentFolders = parentFolders
 
-	// Получаем подпапки с рекурсивным подсчетом размера и количества файлов
+	// Выбираем элементы текущей страницы
+	page, err := listFolderPage(ctx, r.db, folderID, opts)
+	if err != nil {
+		return nil, err
+	}
+	content.Page = &page.Info
+
+	// Получаем подпапки страницы с рекурсивным подсчетом размера и количества файлов
 	query := `
         WITH RECURSIVE folder_tree AS (
             -- Базовые папки
@@ -249,6 +476,7 @@ func (r *ShareRepository) getFolderContent(ctx context.Context, share *domain.Sh
                 f.size_bytes, f.files_count, f.created_at, f.updated_at, f.deleted_at
             FROM folders f
             WHERE f.parent_id = $1 AND f.deleted_at IS NULL
+            AND f.id::text = ANY($2)
 
             UNION ALL
 
@@ -278,20 +506,26 @@ func (r *ShareRepository) getFolderContent(ctx context.Context, share *domain.Sh
         ORDER BY id, path;
     `
 
-	err = r.db.SelectContext(ctx, &content.Subfolders, query, folderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get subfolders: %w", err)
+	if len(page.FolderIDs) > 0 {
+		err = r.db.SelectContext(ctx, &content.Subfolders, query, folderID, pq.Array(page.FolderIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subfolders: %w", err)
+		}
+		content.Subfolders = orderFolders(content.Subfolders, page.FolderIDs)
 	}
 
-	// Получаем файлы
-	err = r.db.SelectContext(ctx, &content.Files,
-		`SELECT * FROM files 
-         WHERE folder_id = $1
-         AND deleted_at IS NULL 
-         ORDER BY name`,
-		folderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get files: %w", err)
+	// Получаем файлы страницы
+	if len(page.FileUUIDs) > 0 {
+		err = r.db.SelectContext(ctx, &content.Files,
+			`SELECT * FROM files 
+             WHERE folder_id = $1
+             AND deleted_at IS NULL 
+             AND uuid::text = ANY($2)`,
+			folderID, pq.Array(page.FileUUIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files: %w", err)
+		}
+		content.Files = orderFiles(content.Files, page.FileUUIDs)
 	}
 
 	return content, nil
@@ -314,6 +548,9 @@ func (r *ShareRepository) GetByID(ctx context.Context, shareID string) (*domain.
 	var share domain.Share
 	query := `SELECT * FROM shares WHERE id = $1`
 	err := r.db.GetContext(ctx, &share, query, shareID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share not found")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get share by id: %w", err)
 	}
@@ -369,6 +606,7 @@ func (r *ShareRepository) GetExistingShare(
             ($5 IS NOT NULL AND expires_at = $5)
         )
         AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+        AND password_hash = '' AND max_downloads IS NULL AND NOT preview_only AND NOT upload_only
         ORDER BY created_at DESC 
         LIMIT 1
     `
@@ -131,14 +131,19 @@ func (r *StorageQuotaRepository) CalculateAndUpdateUsedSpace(ctx context.Context
         GROUP BY f.owner_id
     )
     UPDATE storage_quotas sq
-    SET used_bytes = afs.total_size,
+    SET used_bytes = afs.total_size + $2,
         updated_at = CURRENT_TIMESTAMP
     FROM all_file_sizes afs 
     WHERE sq.owner_id = afs.owner_id`
 
 	log.Printf("[QuotaRepository] Выполняем расчет используемого пространства для пользователя %s", ownerID)
 
-	result, err := r.db.ExecContext(ctx, query, ownerID)
+	retainedBytes, err := r.retainedVersionsSize(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, query, ownerID, retainedBytes)
 	if err != nil {
 		log.Printf("[QuotaRepository] Ошибка при обновлении используемого пространства: %v", err)
 		return fmt.Errorf("failed to update used space: %w", err)
@@ -191,7 +196,7 @@ func (r *StorageQuotaRepository) CalculateAndUpdateUsedSpace(ctx context.Context
 		log.Printf("[QuotaRepository] Рассчитано использованное пространство: %d байт", usedBytes)
 
 		// Обновляем использованное пространство
-		quota.UsedBytes = usedBytes
+		quota.UsedBytes = usedBytes + retainedBytes
 		err = r.Update(ctx, quota)
 		if err != nil {
 			return fmt.Errorf("failed to update quota: %w", err)
@@ -204,6 +209,41 @@ func (r *StorageQuotaRepository) CalculateAndUpdateUsedSpace(ctx context.Context
 	return nil
 }
 
+// retainedVersionsSize возвращает размер хранимых старых версий файлов,
+// если пользователь включил их учет в квоте
+func (r *StorageQuotaRepository) retainedVersionsSize(ctx context.Context, ownerID string) (int64, error) {
+	// Объект, на который ссылается несколько версий, учитывается один раз,
+	// объект текущей версии уже учтен в основном расчете
+	query := `
+        SELECT COALESCE(SUM(size_bytes), 0) FROM (
+            SELECT DISTINCT ON (fv.s3_key) fv.s3_key, fv.size_bytes
+            FROM file_versions fv
+            JOIN files f ON f.uuid = fv.file_uuid
+            WHERE f.owner_id = $1
+              AND f.deleted_at IS NULL
+              AND fv.deleted_at IS NULL
+              AND fv.content_available
+              AND fv.version_number <> f.current_version
+              AND NOT EXISTS (
+                  SELECT 1 FROM file_versions cv
+                  WHERE cv.file_uuid = f.uuid
+                    AND cv.version_number = f.current_version
+                    AND cv.s3_key = fv.s3_key
+              )
+        ) retained
+        WHERE EXISTS (
+            SELECT 1 FROM version_retention_settings
+            WHERE owner_id = $1 AND folder_id IS NULL AND count_in_quota
+        )`
+
+	var size int64
+	if err := r.db.QueryRowContext(ctx, query, ownerID).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to calculate retained versions size: %w", err)
+	}
+
+	return size, nil
+}
+
 func (r *StorageQuotaRepository) Update(ctx context.Context, quota *domain.StorageQuota) error {
 	query := `
         UPDATE storage_quotas
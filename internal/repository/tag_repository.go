@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"synxrondrive/internal/domain"
+)
+
+type TagRepository struct {
+	db *sqlx.DB
+}
+
+func NewTagRepository(db *sqlx.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// tagColumns - поля метки вместе с количеством отмеченных элементов, не находящихся в корзине
+const tagColumns = `
+            t.id, t.owner_id, t.name, t.color, t.created_at, t.updated_at,
+            (SELECT COUNT(*) FROM item_tags it
+             LEFT JOIN files fl ON fl.uuid = it.file_uuid
+             LEFT JOIN folders f ON f.id = it.folder_id
+             WHERE it.tag_id = t.id
+             AND COALESCE(fl.deleted_at, f.deleted_at) IS NULL) AS items_count`
+
+// List возвращает метки пользователя, отсортированные по имени
+func (r *TagRepository) List(ctx context.Context, ownerID string) ([]domain.Tag, error) {
+	tags := []domain.Tag{}
+	query := `SELECT` + tagColumns + ` FROM tags t WHERE t.owner_id = $1 ORDER BY lower(t.name)`
+
+	if err := conn(ctx, r.db).SelectContext(ctx, &tags, query, ownerID); err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return tags, nil
+}
+
+// GetByID возвращает метку по идентификатору
+func (r *TagRepository) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
+	var tag domain.Tag
+	query := `SELECT` + tagColumns + ` FROM tags t WHERE t.id = $1`
+
+	err := conn(ctx, r.db).GetContext(ctx, &tag, query, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("tag not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+	return &tag, nil
+}
+
+// Create создает метку. Имена меток пользователя уникальны без учета регистра
+func (r *TagRepository) Create(ctx context.Context, tag *domain.Tag) error {
+	query := `
+        INSERT INTO tags (owner_id, name, color)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tag.OwnerID, tag.Name, tag.Color).
+		Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("tag with name %q already exists", tag.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create tag: %w", err)
+	}
+	return nil
+}
+
+// Update изменяет имя и цвет метки
+func (r *TagRepository) Update(ctx context.Context, tag *domain.Tag) error {
+	query := `
+        UPDATE tags SET name = $2, color = $3
+        WHERE id = $1
+        RETURNING updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tag.ID, tag.Name, tag.Color).Scan(&tag.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("tag not found")
+	}
+	if isUniqueViolation(err) {
+		return fmt.Errorf("tag with name %q already exists", tag.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update tag: %w", err)
+	}
+	return nil
+}
+
+// Delete удаляет метку вместе со всеми ее привязками
+func (r *TagRepository) Delete(ctx context.Context, id int64) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("tag not found")
+	}
+	return nil
+}
+
+// TagFile отмечает файл меткой; повторная отметка ничего не меняет
+func (r *TagRepository) TagFile(ctx context.Context, tagID int64, fileUUID uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO item_tags (tag_id, file_uuid)
+        VALUES ($1, $2)
+        ON CONFLICT (file_uuid, tag_id) WHERE file_uuid IS NOT NULL DO NOTHING`,
+		tagID, fileUUID)
+	if err != nil {
+		return fmt.Errorf("failed to tag file: %w", err)
+	}
+	return nil
+}
+
+// TagFolder отмечает папку меткой; повторная отметка ничего не меняет
+func (r *TagRepository) TagFolder(ctx context.Context, tagID int64, folderID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+        INSERT INTO item_tags (tag_id, folder_id)
+        VALUES ($1, $2)
+        ON CONFLICT (folder_id, tag_id) WHERE folder_id IS NOT NULL DO NOTHING`,
+		tagID, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to tag folder: %w", err)
+	}
+	return nil
+}
+
+// UntagFile снимает метку с файла
+func (r *TagRepository) UntagFile(ctx context.Context, tagID int64, fileUUID uuid.UUID) error {
+	return r.untag(ctx, `DELETE FROM item_tags WHERE tag_id = $1 AND file_uuid = $2`, tagID, fileUUID)
+}
+
+// UntagFolder снимает метку с папки
+func (r *TagRepository) UntagFolder(ctx context.Context, tagID int64, folderID int64) error {
+	return r.untag(ctx, `DELETE FROM item_tags WHERE tag_id = $1 AND folder_id = $2`, tagID, folderID)
+}
+
+func (r *TagRepository) untag(ctx context.Context, query string, args ...interface{}) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to remove tag: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("item is not tagged with this tag")
+	}
+	return nil
+}
+
+// GetTaggedItems возвращает отмеченные меткой файлы и папки, не находящиеся в корзине
+func (r *TagRepository) GetTaggedItems(ctx context.Context, tagID int64) ([]domain.File, []domain.Folder, error) {
+	files := []domain.File{}
+	err := conn(ctx, r.db).SelectContext(ctx, &files, `
+        SELECT * FROM files
+        WHERE uuid IN (SELECT file_uuid FROM item_tags WHERE tag_id = $1)
+        AND deleted_at IS NULL
+        ORDER BY lower(name), uuid`, tagID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tagged files: %w", err)
+	}
+
+	folders := []domain.Folder{}
+	err = conn(ctx, r.db).SelectContext(ctx, &folders, `
+        SELECT`+folderColumns+` FROM folders
+        WHERE id IN (SELECT folder_id FROM item_tags WHERE tag_id = $1)
+        AND deleted_at IS NULL
+        ORDER BY lower(name), id`, tagID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tagged folders: %w", err)
+	}
+
+	return files, folders, nil
+}
+
+// LoadContentTags заполняет метки пользователя у папки и ее содержимого
+func (r *TagRepository) LoadContentTags(ctx context.Context, ownerID string, content *domain.FolderContent) error {
+	fileUUIDs := make([]string, 0, len(content.Files))
+	for _, file := range content.Files {
+		fileUUIDs = append(fileUUIDs, file.UUID.String())
+	}
+	folderIDs := []int64{content.Folder.ID}
+	for _, folder := range content.Folders {
+		folderIDs = append(folderIDs, folder.ID)
+	}
+
+	var rows []struct {
+		domain.Tag
+		FileUUID *string `db:"file_uuid"`
+		FolderID *int64  `db:"folder_id"`
+	}
+	err := conn(ctx, r.db).SelectContext(ctx, &rows, `
+        SELECT t.id, t.owner_id, t.name, t.color, t.created_at, t.updated_at,
+               it.file_uuid::text AS file_uuid, it.folder_id
+        FROM item_tags it
+        JOIN tags t ON t.id = it.tag_id
+        WHERE t.owner_id = $1
+        AND (it.file_uuid = ANY($2::uuid[]) OR it.folder_id = ANY($3))
+        ORDER BY lower(t.name)`,
+		ownerID, pq.Array(fileUUIDs), pq.Array(folderIDs))
+	if err != nil {
+		return fmt.Errorf("failed to get item tags: %w", err)
+	}
+
+	fileTags := make(map[string][]domain.Tag)
+	folderTags := make(map[int64][]domain.Tag)
+	for _, row := range rows {
+		if row.FileUUID != nil {
+			fileTags[*row.FileUUID] = append(fileTags[*row.FileUUID], row.Tag)
+		} else if row.FolderID != nil {
+			folderTags[*row.FolderID] = append(folderTags[*row.FolderID], row.Tag)
+		}
+	}
+
+	content.Folder.Tags = folderTags[content.Folder.ID]
+	for i := range content.Folders {
+		content.Folders[i].Tags = folderTags[content.Folders[i].ID]
+	}
+	for i := range content.Files {
+		content.Files[i].Tags = fileTags[content.Files[i].UUID.String()]
+	}
+	return nil
+}
+
+// isUniqueViolation проверяет, что ошибка вызвана нарушением уникальности
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
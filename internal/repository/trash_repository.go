@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"log"
 	"strconv"
 	"strings"
@@ -25,7 +26,7 @@ func (r *TrashRepository) GetSettings(ctx context.Context, ownerID string) (*dom
 	var settings domain.TrashSettings
 	query := `SELECT * FROM trash_settings WHERE owner_id = $1`
 
-	err := r.db.GetContext(ctx, &settings, query, ownerID)
+	err := conn(ctx, r.db).GetContext(ctx, &settings, query, ownerID)
 	if err != nil {
 		// Если настройки не найдены, создаем настройки по умолчанию
 		if err := r.CreateDefaultSettings(ctx, ownerID); err != nil {
@@ -65,7 +66,7 @@ func (r *TrashRepository) CreateDefaultSettings(ctx context.Context, ownerID str
         VALUES ($1, '01:00:00'::interval)
         ON CONFLICT (owner_id) DO NOTHING
     `
-	_, err := r.db.ExecContext(ctx, query, ownerID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, ownerID)
 	return err
 }
 
@@ -96,7 +97,7 @@ func (r *TrashRepository) UpdateSettings(ctx context.Context, settings *domain.T
         WHERE owner_id = $2
         RETURNING updated_at
     `
-	return r.db.QueryRowContext(ctx, query, intervalStr, settings.OwnerID).Scan(&settings.UpdatedAt)
+	return conn(ctx, r.db).QueryRowContext(ctx, query, intervalStr, settings.OwnerID).Scan(&settings.UpdatedAt)
 }
 
 // GetTrashItems получает все элементы в корзине пользователя
@@ -167,7 +168,7 @@ func (r *TrashRepository) GetTrashItems(ctx context.Context, ownerID string) ([]
         FROM deleted_files
         ORDER BY deleted_at DESC`
 
-	err := r.db.SelectContext(ctx, &items, query, ownerID)
+	err := conn(ctx, r.db).SelectContext(ctx, &items, query, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get trash items: %w", err)
 	}
@@ -226,7 +227,7 @@ func (r *TrashRepository) GetTrashItems(ctx context.Context, ownerID string) ([]
 
 // EmptyTrash полностью очищает корзину пользователя
 func (r *TrashRepository) EmptyTrash(ctx context.Context, ownerID string) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -244,6 +245,18 @@ func (r *TrashRepository) EmptyTrash(ctx context.Context, ownerID string) error
 		return fmt.Errorf("failed to delete file previews: %w", err)
 	}
 
+	// Удаляем извлеченный для поиска текст
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM file_contents 
+        WHERE file_uuid IN (
+            SELECT uuid FROM files 
+            WHERE owner_id = $1 AND deleted_at IS NOT NULL
+        )
+    `, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete file contents: %w", err)
+	}
+
 	// Затем удаляем версии файлов
 	_, err = tx.ExecContext(ctx, `
         DELETE FROM file_versions 
@@ -277,24 +290,52 @@ func (r *TrashRepository) EmptyTrash(ctx context.Context, ownerID string) error
 	return tx.Commit()
 }
 
-// RestoreItem восстанавливает элемент из корзины
-func (r *TrashRepository) RestoreItem(ctx context.Context, itemID string, itemType string, ownerID string) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+// RestoreItem восстанавливает элемент из корзины. Если на прежнем месте уже есть
+// элемент с таким именем, конфликт разрешается по политике policy
+func (r *TrashRepository) RestoreItem(ctx context.Context, itemID string, itemType string, ownerID string, policy domain.ConflictPolicy) error {
+	return RunInTx(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db)
+		if itemType == "file" {
+			return restoreFile(ctx, q, itemID, ownerID, policy)
+		}
+		return restoreFolder(ctx, q, itemID, ownerID, policy)
+	})
+}
+
+// restoreFile восстанавливает файл в папку, из которой он был удален
+func restoreFile(ctx context.Context, q queryer, itemID string, ownerID string, policy domain.ConflictPolicy) error {
+	// Сначала получаем информацию о файле
+	var file domain.File
+	err := q.GetContext(ctx, &file,
+		"SELECT * FROM files WHERE uuid = $1 AND owner_id = $2 AND deleted_at IS NOT NULL",
+		itemID, ownerID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("file not found or already restored")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to get file info: %w", err)
 	}
-	defer tx.Rollback()
 
-	if itemType == "file" {
-		// Сначала получаем информацию о файле
-		var file domain.File
-		err = tx.GetContext(ctx, &file, "SELECT * FROM files WHERE uuid = $1", itemID)
-		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
+	folderID := file.FolderID
+	if file.RestoreFolderID != nil {
+		folderID = *file.RestoreFolderID
+	}
+
+	name, existing, err := resolveFileConflict(ctx, q, folderID, file.Name, file.UUID, policy)
+	if err != nil {
+		return err
+	}
+
+	// Восстанавливаемый файл становится новой версией существующего
+	if existing != nil {
+		if err := mergeFile(ctx, q, &file, existing); err != nil {
+			return err
 		}
+		return recalculateFolderSizes(ctx, q, existing.FolderID)
+	}
 
-		// Обновляем метаданные папок (увеличиваем размер и количество файлов)
-		updateFoldersQuery := `
+	// Обновляем метаданные папок (увеличиваем размер и количество файлов)
+	updateFoldersQuery := `
             WITH RECURSIVE folder_tree AS (
                 -- Получаем папку, в которую восстанавливаем файл
                 SELECT id, parent_id
@@ -321,37 +362,73 @@ func (r *TrashRepository) RestoreItem(ctx context.Context, itemID string, itemTy
             WHERE f.id = ft.id
         `
 
-		_, err = tx.ExecContext(ctx, updateFoldersQuery, itemID, file.SizeBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update folder metadata: %w", err)
-		}
+	_, err = q.ExecContext(ctx, updateFoldersQuery, itemID, file.SizeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update folder metadata: %w", err)
+	}
 
-		// Восстанавливаем файл
-		restoreFileQuery := `
+	// Восстанавливаем файл
+	restoreFileQuery := `
             UPDATE files
             SET 
                 deleted_at = NULL,
                 folder_id = restore_folder_id,
                 restore_folder_id = NULL,
-                restore_path = NULL
+                restore_path = NULL,
+                name = $3
             WHERE uuid = $1 
             AND owner_id = $2 
             AND deleted_at IS NOT NULL
             RETURNING uuid
         `
 
-		var restoredUUID string
-		err = tx.QueryRowContext(ctx, restoreFileQuery, itemID, ownerID).Scan(&restoredUUID)
+	var restoredUUID string
+	err = q.QueryRowContext(ctx, restoreFileQuery, itemID, ownerID, name).Scan(&restoredUUID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("file not found or already restored")
+		}
+		return fmt.Errorf("failed to restore file: %w", err)
+	}
+
+	return nil
+}
+
+// restoreFolder восстанавливает папку со всеми подпапками
+func restoreFolder(ctx context.Context, q queryer, itemID string, ownerID string, policy domain.ConflictPolicy) error {
+	var folder domain.Folder
+	err := q.GetContext(ctx, &folder, `SELECT`+folderColumns+`
+        FROM folders
+        WHERE id = $1::bigint AND owner_id = $2 AND deleted_at IS NOT NULL`, itemID, ownerID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("folder not found or already restored")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get folder info: %w", err)
+	}
+
+	parentID := folder.RestoreParentID
+	if parentID == nil {
+		parentID = folder.ParentID
+	}
+
+	name := folder.Name
+	var existing *domain.Folder
+	if parentID != nil {
+		name, existing, err = resolveFolderConflict(ctx, q, *parentID, folder.Name, folder.ID, policy)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("file not found or already restored")
+			return err
+		}
+		// Папка восстанавливается под свободным именем и затем объединяется с существующей
+		if existing != nil {
+			if name, err = freeFolderName(ctx, q, *parentID, folder.Name); err != nil {
+				return err
 			}
-			return fmt.Errorf("failed to restore file: %w", err)
 		}
+	}
 
-	} else {
-		// Восстанавливаем папку и все её подпапки
-		restoreFolderQuery := `
+	// Восстанавливаем папку и все её подпапки
+	restoreFolderQuery := `
             WITH RECURSIVE subfolder AS (
                 -- Базовая папка
                 SELECT 
@@ -396,92 +473,52 @@ func (r *TrashRepository) RestoreItem(ctx context.Context, itemID string, itemTy
             RETURNING f.id
         `
 
-		rows, err := tx.QueryContext(ctx, restoreFolderQuery, itemID, ownerID)
-		if err != nil {
-			return fmt.Errorf("failed to restore folder: %w", err)
-		}
-		defer rows.Close()
-
-		// Проверяем, была ли восстановлена хотя бы одна папка
-		restoredAny := false
-		for rows.Next() {
-			restoredAny = true
-			var id int64
-			if err := rows.Scan(&id); err != nil {
-				return fmt.Errorf("failed to scan restored folder id: %w", err)
-			}
-		}
-		if err = rows.Err(); err != nil {
-			return fmt.Errorf("error iterating over restored folders: %w", err)
-		}
+	rows, err := q.QueryContext(ctx, restoreFolderQuery, itemID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to restore folder: %w", err)
+	}
+	defer rows.Close()
 
-		if !restoredAny {
-			return fmt.Errorf("folder not found or already restored")
+	// Проверяем, была ли восстановлена хотя бы одна папка
+	restoredAny := false
+	for rows.Next() {
+		restoredAny = true
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan restored folder id: %w", err)
 		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over restored folders: %w", err)
+	}
 
-		// Обновляем метаданные родительских папок
-		updateParentFoldersQuery := `
-            WITH RECURSIVE parent_folders AS (
-                -- Получаем родительскую папку
-                SELECT 
-                    id, 
-                    parent_id,
-                    (
-                        SELECT COALESCE(SUM(size_bytes), 0)
-                        FROM folders
-                        WHERE parent_id = f.id AND deleted_at IS NULL
-                    ) as children_size,
-                    (
-                        SELECT COALESCE(SUM(files_count), 0)
-                        FROM folders
-                        WHERE parent_id = f.id AND deleted_at IS NULL
-                    ) as children_files
-                FROM folders f
-                WHERE id = (
-                    SELECT restore_parent_id
-                    FROM folders
-                    WHERE id = $1::bigint
-                )
+	if !restoredAny {
+		return fmt.Errorf("folder not found or already restored")
+	}
 
-                UNION ALL
+	if parentID == nil {
+		return nil
+	}
 
-                SELECT 
-                    f.id, 
-                    f.parent_id,
-                    (
-                        SELECT COALESCE(SUM(size_bytes), 0)
-                        FROM folders
-                        WHERE parent_id = f.id AND deleted_at IS NULL
-                    ) as children_size,
-                    (
-                        SELECT COALESCE(SUM(files_count), 0)
-                        FROM folders
-                        WHERE parent_id = f.id AND deleted_at IS NULL
-                    ) as children_files
-                FROM folders f
-                INNER JOIN parent_folders pf ON f.id = pf.parent_id
-            )
-            UPDATE folders f
-            SET 
-                size_bytes = pf.children_size,
-                files_count = pf.children_files,
-                updated_at = CURRENT_TIMESTAMP
-            FROM parent_folders pf
-            WHERE f.id = pf.id
-        `
+	if name != folder.Name {
+		if err := reparentFolder(ctx, q, folder.ID, *parentID, name); err != nil {
+			return err
+		}
+	}
 
-		_, err = tx.ExecContext(ctx, updateParentFoldersQuery, itemID)
-		if err != nil {
-			return fmt.Errorf("failed to update parent folders metadata: %w", err)
+	if existing != nil {
+		if err := mergeFolder(ctx, q, &folder, existing); err != nil {
+			return err
 		}
 	}
 
-	return tx.Commit()
+	// Обновляем метаданные родительских папок
+	return recalculateFolderSizes(ctx, q, *parentID)
 }
 
 // DeleteItemPermanently окончательно удаляет элемент из корзины
 func (r *TrashRepository) DeleteItemPermanently(ctx context.Context, itemID string, itemType string, ownerID string) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -506,6 +543,15 @@ func (r *TrashRepository) DeleteItemPermanently(ctx context.Context, itemID stri
 			return fmt.Errorf("failed to delete file preview: %w", err)
 		}
 
+		// Удаляем извлеченный для поиска текст
+		_, err = tx.ExecContext(ctx, `
+            DELETE FROM file_contents 
+            WHERE file_uuid = $1
+        `, itemID)
+		if err != nil {
+			return fmt.Errorf("failed to delete file contents: %w", err)
+		}
+
 		// Затем удаляем версии файла
 		_, err = tx.ExecContext(ctx, `
             DELETE FROM file_versions 
@@ -553,7 +599,7 @@ func (r *TrashRepository) DeleteItemPermanently(ctx context.Context, itemID stri
 
 		// Удаляем файлы и связанные записи
 		if len(fileUUIDs) > 0 {
-			if err := r.deleteFileRelatedRecords(ctx, tx, fileUUIDs, 1000); err != nil {
+			if err := r.deleteFileRelatedRecords(ctx, tx.Tx, fileUUIDs, 1000); err != nil {
 				return fmt.Errorf("failed to delete files and related records in folder: %w", err)
 			}
 		}
@@ -590,7 +636,7 @@ func (r *TrashRepository) DeleteItemPermanently(ctx context.Context, itemID stri
 
 // MoveToTrash перемещает элемент в корзину
 func (r *TrashRepository) MoveToTrash(ctx context.Context, itemID string, itemType string, ownerID string) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -599,20 +645,33 @@ func (r *TrashRepository) MoveToTrash(ctx context.Context, itemID string, itemTy
 	now := time.Now()
 
 	if itemType == "file" {
-		// Сначала получаем информацию о файле для обновления метаданных папки
-		var file struct {
-			FolderID  int64 `db:"folder_id"`
-			SizeBytes int64 `db:"size_bytes"`
-		}
-		err := tx.GetContext(ctx, &file,
-			`SELECT folder_id, size_bytes FROM files WHERE uuid = $1 AND owner_id = $2`,
-			itemID, ownerID)
-		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
-		}
+		err = trashFile(ctx, tx, itemID, ownerID, now)
+	} else {
+		err = trashFolder(ctx, tx, itemID, ownerID, now)
+	}
+	if err != nil {
+		return err
+	}
 
-		// Обновляем метаданные папок (уменьшаем размер и количество файлов)
-		updateFoldersQuery := `
+	return tx.Commit()
+}
+
+// trashFile перемещает файл в корзину и уменьшает размеры папок, в которых он лежал
+func trashFile(ctx context.Context, q queryer, itemID string, ownerID string, now time.Time) error {
+	// Сначала получаем информацию о файле для обновления метаданных папки
+	var file struct {
+		FolderID  int64 `db:"folder_id"`
+		SizeBytes int64 `db:"size_bytes"`
+	}
+	err := q.GetContext(ctx, &file,
+		`SELECT folder_id, size_bytes FROM files WHERE uuid = $1 AND owner_id = $2`,
+		itemID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	// Обновляем метаданные папок (уменьшаем размер и количество файлов)
+	updateFoldersQuery := `
             WITH RECURSIVE folder_tree AS (
                 -- Начальная папка
                 SELECT id, parent_id
@@ -640,13 +699,13 @@ func (r *TrashRepository) MoveToTrash(ctx context.Context, itemID string, itemTy
             FROM folder_tree ft
             WHERE f.id = ft.id`
 
-		_, err = tx.ExecContext(ctx, updateFoldersQuery, file.FolderID, file.SizeBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update folder metadata: %w", err)
-		}
+	_, err = q.ExecContext(ctx, updateFoldersQuery, file.FolderID, file.SizeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update folder metadata: %w", err)
+	}
 
-		// Перемещаем файл в корзину
-		query := `
+	// Перемещаем файл в корзину
+	query := `
             UPDATE files
             SET deleted_at = $3,
                 restore_folder_id = folder_id,
@@ -656,19 +715,22 @@ func (r *TrashRepository) MoveToTrash(ctx context.Context, itemID string, itemTy
             WHERE uuid = $1 AND owner_id = $2 AND deleted_at IS NULL
             RETURNING uuid`
 
-		result, err := tx.ExecContext(ctx, query, itemID, ownerID, now)
-		if err != nil {
-			return fmt.Errorf("failed to move file to trash: %w", err)
-		}
+	result, err := q.ExecContext(ctx, query, itemID, ownerID, now)
+	if err != nil {
+		return fmt.Errorf("failed to move file to trash: %w", err)
+	}
 
-		rows, err := result.RowsAffected()
-		if err != nil || rows == 0 {
-			return fmt.Errorf("file not found or already in trash")
-		}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return fmt.Errorf("file not found or already in trash")
+	}
 
-	} else {
-		// Для папок оставляем текущую логику
-		query := `
+	return nil
+}
+
+// trashFolder перемещает папку со всеми подпапками в корзину
+func trashFolder(ctx context.Context, q queryer, itemID string, ownerID string, now time.Time) error {
+	query := `
             WITH RECURSIVE subfolder AS (
                 SELECT id, parent_id, path
                 FROM folders
@@ -687,18 +749,19 @@ func (r *TrashRepository) MoveToTrash(ctx context.Context, itemID string, itemTy
             WHERE f.id = s.id
             RETURNING f.id`
 
-		rows, err := tx.QueryContext(ctx, query, itemID, ownerID, now)
-		if err != nil {
-			return fmt.Errorf("failed to move folder to trash: %w", err)
-		}
-		defer rows.Close()
+	rows, err := q.QueryContext(ctx, query, itemID, ownerID, now)
+	if err != nil {
+		return fmt.Errorf("failed to move folder to trash: %w", err)
+	}
+	// Курсор закрываем до фиксации: внутри общей транзакции соединение используется дальше
+	found := rows.Next()
+	rows.Close()
 
-		if !rows.Next() {
-			return fmt.Errorf("folder not found or already in trash")
-		}
+	if !found {
+		return fmt.Errorf("folder not found or already in trash")
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 // formatDuration форматирует продолжительность в человекочитаемый формат
@@ -719,7 +782,7 @@ func formatDuration(d time.Duration) string {
 // RunCleanup запускает процедуру очистки корзины в базе данных
 func (r *TrashRepository) RunCleanup(ctx context.Context) ([]domain.DeleteInfo, error) {
 	// Начинаем транзакцию для атомарного удаления данных
-	tx, err := r.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, r.db)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -764,8 +827,27 @@ func (r *TrashRepository) RunCleanup(ctx context.Context) ([]domain.DeleteInfo,
 		fileUUIDs = append(fileUUIDs, file.UUID)
 	}
 
+	// Запоминаем ключи объектов всех версий до удаления записей о них
+	var versionKeys []struct {
+		FileUUID string `db:"file_uuid"`
+		S3Key    string `db:"s3_key"`
+	}
+	err = tx.SelectContext(ctx, &versionKeys, `
+        SELECT DISTINCT file_uuid::text AS file_uuid, s3_key
+        FROM file_versions
+        WHERE file_uuid::text = ANY($1)
+    `, pq.Array(fileUUIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file version keys: %w", err)
+	}
+
+	keysByFile := make(map[string][]string)
+	for _, key := range versionKeys {
+		keysByFile[key.FileUUID] = append(keysByFile[key.FileUUID], key.S3Key)
+	}
+
 	// Удаляем связанные записи
-	if err := r.deleteFileRelatedRecords(ctx, tx, fileUUIDs, 1000); err != nil {
+	if err := r.deleteFileRelatedRecords(ctx, tx.Tx, fileUUIDs, 1000); err != nil {
 		return nil, fmt.Errorf("failed to run database cleanup: %w", err)
 	}
 
@@ -778,17 +860,46 @@ func (r *TrashRepository) RunCleanup(ctx context.Context) ([]domain.DeleteInfo,
 	result := make([]domain.DeleteInfo, len(extendedInfo))
 	for i, info := range extendedInfo {
 		result[i] = domain.DeleteInfo{
-			UUID:    info.UUID,
-			OwnerID: info.OwnerID,
-			Name:    info.Name,
+			UUID:        info.UUID,
+			OwnerID:     info.OwnerID,
+			Name:        info.Name,
+			VersionKeys: keysByFile[info.UUID],
 		}
 	}
 
 	return result, nil
 }
 
-func (r *TrashRepository) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
-	return r.db.BeginTxx(ctx, nil)
+// GetFileVersionKeys возвращает ключи объектов всех версий указанных файлов
+func (r *TrashRepository) GetFileVersionKeys(ctx context.Context, fileUUIDs []string) ([]string, error) {
+	var keys []string
+	query := `
+        SELECT DISTINCT s3_key FROM file_versions
+        WHERE file_uuid::text = ANY($1)
+    `
+	if err := conn(ctx, r.db).SelectContext(ctx, &keys, query, pq.Array(fileUUIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get file version keys: %w", err)
+	}
+	return keys, nil
+}
+
+// GetTrashedVersionKeys возвращает ключи объектов всех версий файлов в корзине пользователя
+func (r *TrashRepository) GetTrashedVersionKeys(ctx context.Context, ownerID string) ([]string, error) {
+	var keys []string
+	query := `
+        SELECT DISTINCT fv.s3_key
+        FROM file_versions fv
+        JOIN files f ON f.uuid = fv.file_uuid
+        WHERE f.owner_id = $1 AND f.deleted_at IS NOT NULL
+    `
+	if err := conn(ctx, r.db).SelectContext(ctx, &keys, query, ownerID); err != nil {
+		return nil, fmt.Errorf("failed to get trashed version keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *TrashRepository) BeginTx(ctx context.Context) (*Tx, error) {
+	return beginTx(ctx, r.db)
 }
 
 // deleteFileRelatedRecords удаляет записи, связанные с файлами
@@ -839,6 +950,16 @@ func (r *TrashRepository) deleteFileRelatedRecords(ctx context.Context, tx *sqlx
 			return fmt.Errorf("failed to delete file previews: %w", err)
 		}
 
+		// Удаляем извлеченный для поиска текст
+		deleteContentsQuery := fmt.Sprintf(`
+            DELETE FROM file_contents 
+            WHERE file_uuid::text IN (%s)
+        `, uuidList)
+		_, err = tx.ExecContext(ctx, deleteContentsQuery, uuidArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to delete file contents: %w", err)
+		}
+
 		// 3. Затем удаляем версии файлов
 		deleteVersionsQuery := fmt.Sprintf(`
             DELETE FROM file_versions 
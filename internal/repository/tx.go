@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"sync"
+)
+
+// queryer - общие методы *sqlx.DB и *sqlx.Tx, которые используют репозитории
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type txKey struct{}
+
+// txState - общая транзакция, в которой выполняются все вызовы репозиториев с данным контекстом
+type txState struct {
+	tx          *sqlx.Tx
+	mu          sync.Mutex
+	savepoints  int
+	afterCommit []func()
+}
+
+// Tx - транзакция репозитория. Если контекст уже содержит общую транзакцию,
+// вложенная транзакция выполняется как точка сохранения внутри неё
+type Tx struct {
+	*sqlx.Tx
+	savepoint string
+	done      bool
+}
+
+// RunInTx выполняет fn в одной транзакции: все репозитории, получившие переданный
+// в fn контекст, работают в ней. Транзакция фиксируется, если fn не вернула ошибку,
+// после чего выполняются действия, отложенные через AfterCommit
+func RunInTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, action := range state.afterCommit {
+		action()
+	}
+	return nil
+}
+
+// AfterCommit откладывает действие до фиксации общей транзакции.
+// Вне транзакции действие выполняется сразу
+func AfterCommit(ctx context.Context, action func()) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		action()
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.afterCommit = append(state.afterCommit, action)
+}
+
+// beginTx начинает транзакцию или точку сохранения внутри общей транзакции контекста
+func beginTx(ctx context.Context, db *sqlx.DB) (*Tx, error) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Tx{Tx: tx}, nil
+	}
+
+	state.mu.Lock()
+	state.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", state.savepoints)
+	state.mu.Unlock()
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: state.tx, savepoint: savepoint}, nil
+}
+
+// inTx проверяет, что контекст содержит общую транзакцию
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// conn возвращает общую транзакцию контекста или подключение к базе
+func conn(ctx context.Context, db *sqlx.DB) queryer {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db
+}
+
+// Commit фиксирует транзакцию или освобождает точку сохранения
+func (t *Tx) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	_, err := t.Tx.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// Rollback откатывает транзакцию или изменения после точки сохранения
+func (t *Tx) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	if _, err := t.Tx.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+		log.Printf("[Repository] Failed to roll back to savepoint %s: %v", t.savepoint, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"synxrondrive/internal/domain"
+	"time"
+)
+
+type UploadSessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewUploadSessionRepository(db *sqlx.DB) *UploadSessionRepository {
+	return &UploadSessionRepository{db: db}
+}
+
+// Create сохраняет новую сессию загрузки
+func (r *UploadSessionRepository) Create(ctx context.Context, session *domain.UploadSession) error {
+	query := `
+        INSERT INTO upload_sessions (
+            user_id, owner_id, folder_id, file_uuid, file_name, mime_type,
+            total_size, chunk_size, s3_key, s3_upload_id, is_new_version, status, expires_at,
+            protocol, upload_offset, upload_metadata
+        )
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+        RETURNING id, created_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		session.UserID,
+		session.OwnerID,
+		session.FolderID,
+		session.FileUUID,
+		session.FileName,
+		session.MIMEType,
+		session.TotalSize,
+		session.ChunkSize,
+		session.S3Key,
+		session.S3UploadID,
+		session.IsNewVersion,
+		session.Status,
+		session.ExpiresAt,
+		session.Protocol,
+		session.UploadOffset,
+		session.Metadata,
+	).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID получает сессию загрузки по ID
+func (r *UploadSessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.UploadSession, error) {
+	var session domain.UploadSession
+	query := `SELECT * FROM upload_sessions WHERE id = $1`
+
+	err := r.db.GetContext(ctx, &session, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("upload session not found")
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// GetParts возвращает загруженные части сессии по возрастанию номера
+func (r *UploadSessionRepository) GetParts(ctx context.Context, sessionID uuid.UUID) ([]domain.UploadSessionPart, error) {
+	parts := []domain.UploadSessionPart{}
+	query := `
+        SELECT session_id, part_number, etag, size_bytes, created_at
+        FROM upload_session_parts
+        WHERE session_id = $1
+        ORDER BY part_number`
+
+	if err := r.db.SelectContext(ctx, &parts, query, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get upload parts: %w", err)
+	}
+
+	return parts, nil
+}
+
+// SavePart сохраняет часть загрузки. Повторная загрузка части перезаписывает её ETag
+func (r *UploadSessionRepository) SavePart(ctx context.Context, part *domain.UploadSessionPart) error {
+	query := `
+        INSERT INTO upload_session_parts (session_id, part_number, etag, size_bytes)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (session_id, part_number)
+        DO UPDATE SET etag = EXCLUDED.etag,
+                      size_bytes = EXCLUDED.size_bytes,
+                      created_at = CURRENT_TIMESTAMP
+        RETURNING created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		part.SessionID, part.PartNumber, part.ETag, part.SizeBytes,
+	).Scan(&part.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save upload part: %w", err)
+	}
+
+	return nil
+}
+
+// Touch продлевает срок жизни активной сессии
+func (r *UploadSessionRepository) Touch(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	query := `
+        UPDATE upload_sessions
+        SET expires_at = $2
+        WHERE id = $1 AND status = 'active'`
+
+	if _, err := r.db.ExecContext(ctx, query, id, expiresAt); err != nil {
+		return fmt.Errorf("failed to extend upload session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateOffset атомарно сдвигает смещение загрузки и продлевает срок жизни сессии.
+// Возвращает false, если смещение уже было изменено другим запросом
+func (r *UploadSessionRepository) UpdateOffset(ctx context.Context, id uuid.UUID, oldOffset, newOffset int64, expiresAt time.Time) (bool, error) {
+	query := `
+        UPDATE upload_sessions
+        SET upload_offset = $3, expires_at = $4
+        WHERE id = $1 AND upload_offset = $2 AND status = 'active'`
+
+	result, err := r.db.ExecContext(ctx, query, id, oldOffset, newOffset, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to update upload offset: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// UpdateStatus атомарно переводит сессию из одного статуса в другой.
+// Возвращает false, если сессия уже находится в другом статусе
+func (r *UploadSessionRepository) UpdateStatus(ctx context.Context, id uuid.UUID, from, to string) (bool, error) {
+	query := `
+        UPDATE upload_sessions
+        SET status = $3
+        WHERE id = $1 AND status = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, from, to)
+	if err != nil {
+		return false, fmt.Errorf("failed to update upload session status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// RenewLease продлевает аренду сессии, которая находится в статусе status
+func (r *UploadSessionRepository) RenewLease(ctx context.Context, id uuid.UUID, status string) error {
+	query := `
+        UPDATE upload_sessions
+        SET updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND status = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, id, status); err != nil {
+		return fmt.Errorf("failed to renew upload session lease: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteParts удаляет информацию о загруженных частях сессии
+func (r *UploadSessionRepository) DeleteParts(ctx context.Context, sessionID uuid.UUID) error {
+	query := `DELETE FROM upload_session_parts WHERE session_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("failed to delete upload parts: %w", err)
+	}
+
+	return nil
+}
+
+// GetExpired возвращает активные сессии, срок жизни которых истек, и сессии,
+// завершение которых прервалось: их аренда в статусе completing не продлевалась с staleBefore
+func (r *UploadSessionRepository) GetExpired(ctx context.Context, staleBefore time.Time, limit int) ([]domain.UploadSession, error) {
+	var sessions []domain.UploadSession
+	query := `
+        SELECT * FROM upload_sessions
+        WHERE (status = 'active' AND expires_at < CURRENT_TIMESTAMP)
+        OR (status = 'completing' AND updated_at < $2)
+        ORDER BY updated_at
+        LIMIT $1`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, limit, staleBefore); err != nil {
+		return nil, fmt.Errorf("failed to get expired upload sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteFinished удаляет завершенные и отмененные сессии старше указанного времени
+func (r *UploadSessionRepository) DeleteFinished(ctx context.Context, olderThan time.Time) (int64, error) {
+	query := `
+        DELETE FROM upload_sessions
+        WHERE status IN ('completed', 'aborted') AND updated_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished upload sessions: %w", err)
+	}
+
+	return result.RowsAffected()
+}
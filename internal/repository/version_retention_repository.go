@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"synxrondrive/internal/domain"
+)
+
+type VersionRetentionRepository struct {
+	db *sqlx.DB
+}
+
+func NewVersionRetentionRepository(db *sqlx.DB) *VersionRetentionRepository {
+	return &VersionRetentionRepository{db: db}
+}
+
+// GetUserSettings получает настройки хранения версий пользователя.
+// Если настройки не заданы, возвращаются настройки без ограничений
+func (r *VersionRetentionRepository) GetUserSettings(ctx context.Context, ownerID string) (*domain.VersionRetentionSettings, error) {
+	var settings domain.VersionRetentionSettings
+	query := `
+        SELECT * FROM version_retention_settings
+        WHERE owner_id = $1 AND folder_id IS NULL`
+
+	err := r.db.GetContext(ctx, &settings, query, ownerID)
+	if err == sql.ErrNoRows {
+		return &domain.VersionRetentionSettings{OwnerID: ownerID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version retention settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SaveUserSettings создает или обновляет настройки хранения версий пользователя
+func (r *VersionRetentionRepository) SaveUserSettings(ctx context.Context, settings *domain.VersionRetentionSettings) error {
+	query := `
+        INSERT INTO version_retention_settings (owner_id, keep_last, keep_days, count_in_quota)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (owner_id) WHERE folder_id IS NULL
+        DO UPDATE SET keep_last = EXCLUDED.keep_last,
+                      keep_days = EXCLUDED.keep_days,
+                      count_in_quota = EXCLUDED.count_in_quota
+        RETURNING id, created_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		settings.OwnerID,
+		settings.KeepLast,
+		settings.KeepDays,
+		settings.CountInQuota,
+	).Scan(&settings.ID, &settings.CreatedAt, &settings.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save version retention settings: %w", err)
+	}
+
+	return nil
+}
+
+// GetFolderSettings получает переопределенные настройки хранения версий папки
+func (r *VersionRetentionRepository) GetFolderSettings(ctx context.Context, folderID int64) (*domain.VersionRetentionSettings, error) {
+	var settings domain.VersionRetentionSettings
+	query := `SELECT * FROM version_retention_settings WHERE folder_id = $1`
+
+	err := r.db.GetContext(ctx, &settings, query, folderID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("version retention settings not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder version retention settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SaveFolderSettings создает или обновляет настройки хранения версий папки
+func (r *VersionRetentionRepository) SaveFolderSettings(ctx context.Context, settings *domain.VersionRetentionSettings) error {
+	query := `
+        INSERT INTO version_retention_settings (owner_id, folder_id, keep_last, keep_days)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (folder_id) WHERE folder_id IS NOT NULL
+        DO UPDATE SET keep_last = EXCLUDED.keep_last,
+                      keep_days = EXCLUDED.keep_days
+        RETURNING id, created_at, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		settings.OwnerID,
+		settings.FolderID,
+		settings.KeepLast,
+		settings.KeepDays,
+	).Scan(&settings.ID, &settings.CreatedAt, &settings.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save folder version retention settings: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFolderSettings удаляет переопределение настроек папки
+func (r *VersionRetentionRepository) DeleteFolderSettings(ctx context.Context, folderID int64) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM version_retention_settings WHERE folder_id = $1`, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to delete folder version retention settings: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("version retention settings not found")
+	}
+
+	return nil
+}
+
+// GetOwnersWithPolicies возвращает пользователей, у которых задано хотя бы одно ограничение
+func (r *VersionRetentionRepository) GetOwnersWithPolicies(ctx context.Context) ([]string, error) {
+	var owners []string
+	query := `
+        SELECT DISTINCT owner_id FROM version_retention_settings
+        WHERE keep_last IS NOT NULL OR keep_days IS NOT NULL`
+
+	if err := r.db.SelectContext(ctx, &owners, query); err != nil {
+		return nil, fmt.Errorf("failed to get owners with retention policies: %w", err)
+	}
+
+	return owners, nil
+}
+
+// GetExpiredVersions возвращает старые версии файлов пользователя, которые не
+// попадают под действующую политику хранения. Текущая версия не удаляется никогда
+func (r *VersionRetentionRepository) GetExpiredVersions(ctx context.Context, ownerID string, limit int) ([]domain.ExpiredVersion, error) {
+	var versions []domain.ExpiredVersion
+	query := `
+        WITH RECURSIVE folder_policy AS (
+            -- Папки с собственными настройками
+            SELECT fo.id AS folder_id, s.keep_last, s.keep_days
+            FROM folders fo
+            JOIN version_retention_settings s ON s.folder_id = fo.id
+            WHERE fo.owner_id = $1
+
+            UNION ALL
+
+            -- Подпапки наследуют настройки родителя, если не задали свои
+            SELECT child.id, fp.keep_last, fp.keep_days
+            FROM folders child
+            JOIN folder_policy fp ON child.parent_id = fp.folder_id
+            WHERE NOT EXISTS (
+                SELECT 1 FROM version_retention_settings s WHERE s.folder_id = child.id
+            )
+        ),
+        user_policy AS (
+            SELECT keep_last, keep_days FROM version_retention_settings
+            WHERE owner_id = $1 AND folder_id IS NULL
+        ),
+        ranked AS (
+            SELECT fv.id, fv.file_uuid, f.owner_id, fv.version_number, fv.created_at,
+                   f.current_version,
+                   ROW_NUMBER() OVER (PARTITION BY fv.file_uuid ORDER BY fv.version_number DESC) AS position,
+                   CASE WHEN fp.folder_id IS NOT NULL THEN fp.keep_last ELSE up.keep_last END AS keep_last,
+                   CASE WHEN fp.folder_id IS NOT NULL THEN fp.keep_days ELSE up.keep_days END AS keep_days
+            FROM file_versions fv
+            JOIN files f ON f.uuid = fv.file_uuid
+            LEFT JOIN folder_policy fp ON fp.folder_id = f.folder_id
+            LEFT JOIN user_policy up ON TRUE
+            WHERE f.owner_id = $1
+              AND f.deleted_at IS NULL
+              AND fv.deleted_at IS NULL
+        )
+        SELECT id, file_uuid, owner_id, version_number
+        FROM ranked
+        WHERE version_number <> current_version
+          AND ((keep_last IS NOT NULL AND position > keep_last)
+            OR (keep_days IS NOT NULL AND created_at < CURRENT_TIMESTAMP - keep_days * INTERVAL '1 day'))
+        ORDER BY file_uuid, version_number
+        LIMIT $2`
+
+	if err := r.db.SelectContext(ctx, &versions, query, ownerID, limit); err != nil {
+		return nil, fmt.Errorf("failed to get expired versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// MarkVersionsDeleted помечает версии удаленными и возвращает ключи объектов,
+// на которые больше не ссылается ни одна действующая версия
+func (r *VersionRetentionRepository) MarkVersionsDeleted(ctx context.Context, ids []int64) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Повторно исключаем текущие версии на случай, если файл успел измениться
+	var keys []string
+	err = tx.SelectContext(ctx, &keys, `
+        UPDATE file_versions fv
+        SET deleted_at = CURRENT_TIMESTAMP
+        FROM files f
+        WHERE f.uuid = fv.file_uuid
+          AND fv.id = ANY($1)
+          AND fv.deleted_at IS NULL
+          AND fv.version_number <> f.current_version
+        RETURNING fv.s3_key`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark versions deleted: %w", err)
+	}
+
+	// После восстановления версии несколько строк могут ссылаться на один объект.
+	// Общие объекты из таблицы blobs удаляет сборщик по счетчику ссылок
+	var orphaned []string
+	err = tx.SelectContext(ctx, &orphaned, `
+        SELECT DISTINCT k.key
+        FROM unnest($1::text[]) AS k(key)
+        WHERE NOT EXISTS (
+            SELECT 1 FROM file_versions fv
+            WHERE fv.s3_key = k.key AND fv.deleted_at IS NULL
+        )
+        AND NOT EXISTS (SELECT 1 FROM blobs b WHERE b.s3_key = k.key)`, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check version references: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return orphaned, nil
+}
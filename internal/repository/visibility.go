@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"synxrondrive/internal/domain"
+)
+
+// sharedWithUserCTE - общие папки и файлы, открытые пользователю $1 другими пользователями.
+// Используется вместе с visibleFile и visibleFolder
+const sharedWithUserCTE = `
+        shared_folders AS (
+            SELECT f.owner_id, f.path
+            FROM share_recipients sr
+            JOIN shares s ON s.id = sr.share_id
+            JOIN folders f ON f.id::text = s.resource_id
+            WHERE sr.user_id = $1
+            AND s.resource_type = 'folder'
+            AND s.owner_id <> $1
+            AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+            AND f.deleted_at IS NULL
+        ),
+        shared_files AS (
+            SELECT s.resource_id
+            FROM share_recipients sr
+            JOIN shares s ON s.id = sr.share_id
+            WHERE sr.user_id = $1
+            AND s.resource_type = 'file'
+            AND s.owner_id <> $1
+            AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+        )`
+
+// visibleFile - условие, что файл file из папки folder принадлежит пользователю $1
+// или открыт ему напрямую либо через одну из родительских папок
+func visibleFile(file string, folder string) string {
+	return fmt.Sprintf(`(
+                %[1]s.owner_id = $1
+                OR %[1]s.uuid::text IN (SELECT resource_id FROM shared_files)
+                OR EXISTS (
+                    SELECT 1 FROM shared_folders sf
+                    WHERE sf.owner_id = %[2]s.owner_id
+                    AND (%[2]s.path = sf.path OR %[3]s)
+                )
+            )`, file, folder, pathUnder(folder+".path", "sf.path"))
+}
+
+// visibleFolder - условие, что папка принадлежит пользователю $1 или лежит в открытой ему папке
+func visibleFolder(folder string) string {
+	return fmt.Sprintf(`(
+                %[1]s.owner_id = $1
+                OR EXISTS (
+                    SELECT 1 FROM shared_folders sf
+                    WHERE sf.owner_id = %[1]s.owner_id
+                    AND (%[1]s.path = sf.path OR %[2]s)
+                )
+            )`, folder, pathUnder(folder+".path", "sf.path"))
+}
+
+// loadItems загружает файлы и папки по идентификаторам. Результат индексируется
+// строковым представлением UUID файла и ID папки
+func loadItems(ctx context.Context, q queryer, fileIDs []string, folderIDs []string) (map[string]*domain.File, map[string]*domain.Folder, error) {
+	files := make(map[string]*domain.File, len(fileIDs))
+	if len(fileIDs) > 0 {
+		var list []domain.File
+		err := q.SelectContext(ctx, &list, `SELECT * FROM files WHERE uuid::text = ANY($1)`, pq.Array(fileIDs))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get files: %w", err)
+		}
+		for i := range list {
+			files[list[i].UUID.String()] = &list[i]
+		}
+	}
+
+	folders := make(map[string]*domain.Folder, len(folderIDs))
+	if len(folderIDs) > 0 {
+		var list []domain.Folder
+		err := q.SelectContext(ctx, &list, `SELECT`+folderColumns+` FROM folders WHERE id::text = ANY($1)`, pq.Array(folderIDs))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get folders: %w", err)
+		}
+		for i := range list {
+			folders[fmt.Sprint(list[i].ID)] = &list[i]
+		}
+	}
+
+	return files, folders, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+)
+
+// ActivityService ведет избранное и журнал недавних действий пользователя
+type ActivityService struct {
+	activityRepo      *repository.ActivityRepository
+	permissionService *PermissionService
+}
+
+func NewActivityService(activityRepo *repository.ActivityRepository, permissionService *PermissionService) *ActivityService {
+	return &ActivityService{
+		activityRepo:      activityRepo,
+		permissionService: permissionService,
+	}
+}
+
+// RecordFile запоминает действие пользователя с файлом. Внутри общей транзакции
+// запись откладывается до ее фиксации; ошибки только логируются
+func (s *ActivityService) RecordFile(ctx context.Context, userID string, fileUUID uuid.UUID, action domain.ActivityAction) {
+	repository.AfterCommit(ctx, func() {
+		if err := s.activityRepo.RecordFile(ctx, userID, fileUUID, action); err != nil {
+			log.Printf("[Activity] Failed to record %s of file %s by %s: %v", action, fileUUID, userID, err)
+		}
+	})
+}
+
+// RecordFolder запоминает действие пользователя с папкой
+func (s *ActivityService) RecordFolder(ctx context.Context, userID string, folderID int64, action domain.ActivityAction) {
+	repository.AfterCommit(ctx, func() {
+		if err := s.activityRepo.RecordFolder(ctx, userID, folderID, action); err != nil {
+			log.Printf("[Activity] Failed to record %s of folder %d by %s: %v", action, folderID, userID, err)
+		}
+	})
+}
+
+// SetStarred добавляет элемент в избранное или убирает из него.
+// В избранное можно добавить любой элемент, доступный пользователю для просмотра
+func (s *ActivityService) SetStarred(ctx context.Context, itemType domain.ResourceType, itemID string, starred bool, userID string) error {
+	if !starred {
+		return s.unstar(ctx, itemType, itemID, userID)
+	}
+
+	switch itemType {
+	case domain.ResourceTypeFile:
+		file, err := s.permissionService.GetViewableFile(ctx, userID, itemID)
+		if err != nil {
+			return err
+		}
+		return s.activityRepo.StarFile(ctx, userID, file.UUID)
+	case domain.ResourceTypeFolder:
+		folder, err := s.permissionService.GetViewableFolder(ctx, userID, itemID)
+		if err != nil {
+			return err
+		}
+		return s.activityRepo.StarFolder(ctx, userID, folder.ID)
+	default:
+		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+}
+
+// unstar убирает элемент из избранного. Права не проверяются: пользователь
+// может убрать и элемент, доступ к которому у него уже отозван
+func (s *ActivityService) unstar(ctx context.Context, itemType domain.ResourceType, itemID string, userID string) error {
+	switch itemType {
+	case domain.ResourceTypeFile:
+		fileUUID, err := uuid.Parse(itemID)
+		if err != nil {
+			return fmt.Errorf("invalid file UUID")
+		}
+		return s.activityRepo.UnstarFile(ctx, userID, fileUUID)
+	case domain.ResourceTypeFolder:
+		folderID, err := strconv.ParseInt(itemID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid folder ID")
+		}
+		return s.activityRepo.UnstarFolder(ctx, userID, folderID)
+	default:
+		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+}
+
+// GetStarred возвращает страницу избранного пользователя
+func (s *ActivityService) GetStarred(ctx context.Context, userID string, limit int, offset int) (*domain.QuickAccessPage, error) {
+	return s.list(ctx, userID, limit, offset, s.activityRepo.GetStarred)
+}
+
+// GetRecent возвращает элементы, которые пользователь недавно загружал, открывал или переименовывал
+func (s *ActivityService) GetRecent(ctx context.Context, userID string, limit int, offset int) (*domain.QuickAccessPage, error) {
+	return s.list(ctx, userID, limit, offset, s.activityRepo.GetRecent)
+}
+
+// GetRecentlyModified возвращает недавно измененные файлы пользователя и открытые ему файлы
+func (s *ActivityService) GetRecentlyModified(ctx context.Context, userID string, limit int, offset int) (*domain.QuickAccessPage, error) {
+	return s.list(ctx, userID, limit, offset, s.activityRepo.GetRecentlyModified)
+}
+
+type quickAccessLister func(ctx context.Context, userID string, limit int, offset int) ([]domain.QuickAccessItem, int, error)
+
+// list выбирает страницу элементов. Доступ к чужим элементам дополнительно
+// проверяется с учетом уровня доступа, как при открытии элемента
+func (s *ActivityService) list(ctx context.Context, userID string, limit int, offset int, lister quickAccessLister) (*domain.QuickAccessPage, error) {
+	if limit <= 0 {
+		limit = domain.DefaultQuickAccessLimit
+	}
+	if limit > domain.MaxQuickAccessLimit {
+		limit = domain.MaxQuickAccessLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, total, err := lister(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]domain.QuickAccessItem, 0, len(items))
+	for _, item := range items {
+		if item.Shared && !s.canView(ctx, item, userID) {
+			continue
+		}
+		visible = append(visible, item)
+	}
+
+	return &domain.QuickAccessPage{
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: offset+len(items) < total,
+		Items:   visible,
+	}, nil
+}
+
+func (s *ActivityService) canView(ctx context.Context, item domain.QuickAccessItem, userID string) bool {
+	var (
+		allowed bool
+		err     error
+	)
+	if item.File != nil {
+		allowed, err = s.permissionService.CheckFileViewPermission(ctx, userID, item.File)
+	} else {
+		allowed, err = s.permissionService.CheckSharedFolderPermission(ctx, userID, item.Folder.ID, OperationView)
+	}
+	if err != nil {
+		log.Printf("[Activity] Failed to check access to %s: %v", item.ItemType, err)
+		return false
+	}
+	return allowed
+}
+
+// LoadContentStars отмечает избранные пользователем элементы содержимого папки
+func (s *ActivityService) LoadContentStars(ctx context.Context, userID string, content *domain.FolderContent) error {
+	return s.activityRepo.LoadContentStars(ctx, userID, content)
+}
@@ -0,0 +1,635 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"time"
+)
+
+// Поддерживаемые форматы архивов
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+const (
+	defaultArchiveName  = "archive"      // Имя архива, если его не удалось определить
+	archiveManifestName = "MANIFEST.txt" // Файл со списком пропущенных элементов
+	maxArchiveItems     = 1000           // Максимальное количество выбранных элементов
+)
+
+// ArchiveService формирует архивы из файлов и папок на лету,
+// без сохранения во временные файлы
+type ArchiveService struct {
+	folderRepo        *repository.FolderRepository
+	shareRepo         *repository.ShareRepository
+	fileService       *FileService
+	shareService      *ShareService
+	permissionService *PermissionService
+}
+
+// ArchiveEntry описывает один элемент архива
+type ArchiveEntry struct {
+	Path string       // Относительный путь внутри архива
+	File *domain.File // nil для каталогов
+}
+
+// ArchiveSkipped описывает элемент, не попавший в архив
+type ArchiveSkipped struct {
+	Name   string
+	Reason string
+}
+
+// Archive содержит подготовленный к записи список элементов архива
+type Archive struct {
+	Name    string
+	Entries []ArchiveEntry
+	Skipped []ArchiveSkipped
+
+	// Доступ ко всем элементам уже проверен при подготовке архива (архив по ссылке),
+	// поэтому при записи файлы читаются без проверки прав пользователя
+	preauthorized bool
+
+	names *archiveNames
+}
+
+func NewArchiveService(
+	folderRepo *repository.FolderRepository,
+	shareRepo *repository.ShareRepository,
+	fileService *FileService,
+	shareService *ShareService,
+	permissionService *PermissionService,
+) *ArchiveService {
+	return &ArchiveService{
+		folderRepo:        folderRepo,
+		shareRepo:         shareRepo,
+		fileService:       fileService,
+		shareService:      shareService,
+		permissionService: permissionService,
+	}
+}
+
+// PrepareFolderArchive проверяет доступ к папке и собирает список её содержимого
+func (s *ArchiveService) PrepareFolderArchive(ctx context.Context, folderID int64, userID string) (*Archive, error) {
+	folder, err := s.getDownloadableFolder(ctx, folderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := newArchive(folder.Name)
+	if err := s.addFolderTree(ctx, archive, folder, "", newDownloadAccessChecker(s.permissionService, userID)); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// PrepareSharedFolderArchive собирает архив папки, доступной по ссылке.
+// folderID может указывать на вложенную папку внутри shared папки.
+// Для ссылки с лимитом скачиваний архив засчитывается как одно скачивание
+func (s *ArchiveService) PrepareSharedFolderArchive(ctx context.Context, token string, folderID string, userID string, accessTokens []string) (*Archive, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("share not found or expired: %w", err)
+	}
+
+	if share.ResourceType != domain.ResourceTypeFolder {
+		return nil, fmt.Errorf("invalid share: resource is not a folder")
+	}
+
+	if !s.shareService.hasAccess(share, userID) || !s.permissionService.checkAccessLevel(share.AccessType, OperationDownload) {
+		return nil, errAccessDenied
+	}
+	if err := s.shareService.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
+	if share.PreviewOnly && share.OwnerID != userID {
+		return nil, fmt.Errorf("access denied: downloads are disabled for this link")
+	}
+
+	if folderID == "" {
+		folderID = share.ResourceID
+	}
+
+	id, err := strconv.ParseInt(folderID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID: %w", err)
+	}
+
+	if folderID != share.ResourceID {
+		inHierarchy, err := s.folderRepo.IsInHierarchy(ctx, id, share.ResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check hierarchy: %w", err)
+		}
+		if !inHierarchy {
+			return nil, errAccessDenied
+		}
+	}
+
+	folder, err := s.folderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("folder not found: %w", err)
+	}
+
+	if share.MaxDownloads != nil && share.OwnerID != userID {
+		consumed, err := s.shareRepo.ConsumeDownload(ctx, share.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !consumed {
+			return nil, fmt.Errorf("access denied: download limit reached")
+		}
+	}
+
+	// Ссылка уже дает право скачать все дерево папки, поэтому файлы внутри не проверяются
+	archive := newArchive(folder.Name)
+	archive.preauthorized = true
+	if err := s.addFolderTree(ctx, archive, folder, "", newShareDownloadAccessChecker()); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// PrepareSelectionArchive собирает архив из произвольного набора файлов и папок.
+// Недоступные пользователю элементы пропускаются и попадают в манифест архива
+func (s *ArchiveService) PrepareSelectionArchive(
+	ctx context.Context,
+	fileUUIDs []uuid.UUID,
+	folderIDs []int64,
+	userID string,
+) (*Archive, error) {
+	total := len(fileUUIDs) + len(folderIDs)
+	if total == 0 {
+		return nil, fmt.Errorf("invalid request: no files or folders selected")
+	}
+	if total > maxArchiveItems {
+		return nil, fmt.Errorf("invalid request: too many items selected, max is %d", maxArchiveItems)
+	}
+
+	archive := newArchive(defaultArchiveName)
+	access := newDownloadAccessChecker(s.permissionService, userID)
+
+	seenFolders := make(map[int64]bool, len(folderIDs))
+	for _, folderID := range folderIDs {
+		if seenFolders[folderID] {
+			continue
+		}
+		seenFolders[folderID] = true
+
+		folder, err := s.getDownloadableFolder(ctx, folderID, userID)
+		if err != nil {
+			archive.skip(fmt.Sprintf("folder %d", folderID), err)
+			continue
+		}
+
+		// Единственную выбранную папку используем как имя архива
+		if len(folderIDs) == 1 && len(fileUUIDs) == 0 {
+			archive.Name = archiveName(folder.Name)
+		}
+
+		dirPath := archive.names.reserve(sanitizeArchiveName(folder.Name))
+		archive.Entries = append(archive.Entries, ArchiveEntry{Path: dirPath + "/"})
+		if err := s.addFolderTree(ctx, archive, folder, dirPath, access); err != nil {
+			return nil, err
+		}
+	}
+
+	seenFiles := make(map[uuid.UUID]bool, len(fileUUIDs))
+	for _, fileUUID := range fileUUIDs {
+		if seenFiles[fileUUID] {
+			continue
+		}
+		seenFiles[fileUUID] = true
+
+		file, err := s.fileService.GetFileInfo(ctx, fileUUID, userID)
+		if err == nil && file.DeletedAt != nil {
+			err = errFileNotFound
+		}
+		// Файл в архиве скачивается, поэтому ссылки только для просмотра его не дают,
+		// а ссылки с лимитом засчитывают скачивание
+		if err == nil {
+			err = s.permissionService.AuthorizeFileDownload(ctx, userID, file)
+		}
+		if err != nil {
+			archive.skip(fmt.Sprintf("file %s", fileUUID), err)
+			continue
+		}
+
+		archive.Entries = append(archive.Entries, ArchiveEntry{
+			Path: archive.names.reserve(sanitizeArchiveName(file.Name)),
+			File: file,
+		})
+	}
+
+	return archive, nil
+}
+
+// getDownloadableFolder получает папку и проверяет право на её скачивание
+func (s *ArchiveService) getDownloadableFolder(ctx context.Context, folderID int64, userID string) (*domain.Folder, error) {
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("folder not found: %w", err)
+	}
+
+	if folder.OwnerID != userID {
+		hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, folderID, OperationDownload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check permissions: %w", err)
+		}
+		if !hasPermission {
+			return nil, errAccessDenied
+		}
+	}
+
+	return folder, nil
+}
+
+// addFolderTree обходит дерево папки и добавляет в архив под путем basePath
+// вложенные папки и файлы, которые пользователь имеет право скачать
+func (s *ArchiveService) addFolderTree(
+	ctx context.Context,
+	archive *Archive,
+	root *domain.Folder,
+	basePath string,
+	access *downloadAccessChecker,
+) error {
+	folders, err := s.folderRepo.GetFolderTree(ctx, root.ID)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.folderRepo.GetTreeFiles(ctx, root.ID)
+	if err != nil {
+		return err
+	}
+
+	// Относительные пути папок строим от корня архива
+	folderPaths := make(map[int64]string, len(folders))
+	folderPaths[root.ID] = basePath
+	for _, folder := range folders {
+		if folder.ID == root.ID || folder.ParentID == nil {
+			continue
+		}
+		parentPath, ok := folderPaths[*folder.ParentID]
+		if !ok {
+			continue
+		}
+		dirPath := archive.names.reserve(path.Join(parentPath, sanitizeArchiveName(folder.Name)))
+		folderPaths[folder.ID] = dirPath
+		archive.Entries = append(archive.Entries, ArchiveEntry{Path: dirPath + "/"})
+	}
+
+	for i := range files {
+		file := &files[i]
+
+		dirPath, ok := folderPaths[file.FolderID]
+		if !ok {
+			continue
+		}
+		filePath := path.Join(dirPath, sanitizeArchiveName(file.Name))
+
+		allowed, err := access.canDownload(ctx, file)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			archive.skip(filePath, errAccessDenied)
+			continue
+		}
+
+		archive.Entries = append(archive.Entries, ArchiveEntry{
+			Path: archive.names.reserve(filePath),
+			File: file,
+		})
+	}
+
+	return nil
+}
+
+// WriteArchive записывает архив в w в указанном формате, читая файлы из хранилища
+// по одному. Файлы, доступ к которым пропал во время записи, попадают в манифест.
+// Для ZIP формат ZIP64 включается автоматически для файлов больше 4GB
+// и архивов с большим количеством элементов
+func (s *ArchiveService) WriteArchive(ctx context.Context, w io.Writer, archive *Archive, format string, userID string) error {
+	writer, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range archive.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.File == nil {
+			if err := writer.addDir(entry.Path, time.Now()); err != nil {
+				return fmt.Errorf("failed to write directory %s: %w", entry.Path, err)
+			}
+			continue
+		}
+
+		if err := s.writeArchiveFile(ctx, writer, archive, entry, userID); err != nil {
+			return err
+		}
+	}
+
+	if len(archive.Skipped) > 0 {
+		manifest := archive.manifest()
+		name := archive.names.reserve(archiveManifestName)
+		if err := writer.addFile(name, "text/plain", time.Now(), int64(len(manifest)), strings.NewReader(manifest)); err != nil {
+			return fmt.Errorf("failed to write archive manifest: %w", err)
+		}
+	}
+
+	if err := writer.close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	return nil
+}
+
+// writeArchiveFile копирует содержимое одного файла в архив
+func (s *ArchiveService) writeArchiveFile(ctx context.Context, writer archiveWriter, archive *Archive, entry ArchiveEntry, userID string) error {
+	var data io.Reader
+	var err error
+	if archive.preauthorized {
+		data, err = s.fileService.GetFileDataDirect(ctx, entry.File.UUID)
+	} else {
+		data, err = s.fileService.GetFileData(ctx, entry.File.UUID, userID)
+	}
+	if err != nil {
+		if errors.Is(err, errAccessDenied) || errors.Is(err, errFileNotFound) {
+			archive.skip(entry.Path, err)
+			return nil
+		}
+		return fmt.Errorf("failed to read file %s: %w", entry.File.UUID, err)
+	}
+	if closer, ok := data.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Для tar размер нужно знать до записи содержимого
+	size := entry.File.SizeBytes
+	if object, ok := data.(interface{ ContentLength() int64 }); ok && object.ContentLength() >= 0 {
+		size = object.ContentLength()
+	}
+
+	if err := writer.addFile(entry.Path, entry.File.MIMEType, entry.File.UpdatedAt, size, data); err != nil {
+		return fmt.Errorf("failed to write file %s to archive: %w", entry.File.UUID, err)
+	}
+
+	return nil
+}
+
+func newArchive(name string) *Archive {
+	return &Archive{
+		Name:  archiveName(name),
+		names: newArchiveNames(),
+	}
+}
+
+// skip добавляет элемент в список пропущенных
+func (a *Archive) skip(name string, err error) {
+	reason := "unavailable"
+	switch {
+	case errors.Is(err, errAccessDenied):
+		reason = "access denied"
+	case errors.Is(err, errFileNotFound), strings.Contains(err.Error(), "not found"):
+		reason = "not found"
+	default:
+		log.Printf("[Archive] Skipping %s: %v", name, err)
+	}
+	a.Skipped = append(a.Skipped, ArchiveSkipped{Name: name, Reason: reason})
+}
+
+// manifest формирует текст манифеста со списком пропущенных элементов
+func (a *Archive) manifest() string {
+	var b strings.Builder
+	b.WriteString("The following items were not included in the archive:\n\n")
+	for _, skipped := range a.Skipped {
+		fmt.Fprintf(&b, "%s\t%s\n", skipped.Name, skipped.Reason)
+	}
+	return b.String()
+}
+
+// archiveWriter абстрагирует запись элементов в архив конкретного формата
+type archiveWriter interface {
+	addDir(name string, modified time.Time) error
+	addFile(name string, mimeType string, modified time.Time, size int64, r io.Reader) error
+	close() error
+}
+
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case "", ArchiveFormatZip:
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+	case ArchiveFormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzArchiveWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	default:
+		return nil, fmt.Errorf("invalid archive format: %s", format)
+	}
+}
+
+// zipArchiveWriter записывает архив в формате ZIP
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchiveWriter) addDir(name string, modified time.Time) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modified}
+	header.SetMode(os.ModeDir | 0755)
+	_, err := z.zw.CreateHeader(header)
+	return err
+}
+
+func (z *zipArchiveWriter) addFile(name string, mimeType string, modified time.Time, size int64, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             archiveMethod(mimeType),
+		Modified:           modified,
+		UncompressedSize64: uint64(size),
+	}
+	header.SetMode(0644)
+
+	writer, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, r)
+	return err
+}
+
+func (z *zipArchiveWriter) close() error {
+	return z.zw.Close()
+}
+
+// tarGzArchiveWriter записывает архив в формате tar, сжатый gzip
+type tarGzArchiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzArchiveWriter) addDir(name string, modified time.Time) error {
+	return t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (t *tarGzArchiveWriter) addFile(name string, mimeType string, modified time.Time, size int64, r io.Reader) error {
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	written, err := io.CopyN(t.tw, r, size)
+	if err != nil {
+		return fmt.Errorf("copied %d of %d bytes: %w", written, size, err)
+	}
+	return nil
+}
+
+func (t *tarGzArchiveWriter) close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// downloadAccessChecker проверяет право на скачивание файлов,
+// запоминая результат проверки для каждой папки
+type downloadAccessChecker struct {
+	permissionService *PermissionService
+	userID            string
+	folders           map[int64]bool
+	allowAll          bool
+}
+
+func newDownloadAccessChecker(permissionService *PermissionService, userID string) *downloadAccessChecker {
+	return &downloadAccessChecker{
+		permissionService: permissionService,
+		userID:            userID,
+		folders:           make(map[int64]bool),
+	}
+}
+
+// newShareDownloadAccessChecker разрешает скачивание всех файлов дерева,
+// доступ к которому уже проверен по ссылке
+func newShareDownloadAccessChecker() *downloadAccessChecker {
+	return &downloadAccessChecker{allowAll: true}
+}
+
+// canDownload проверяет доступ к файлу через папку, а затем через share самого файла
+func (c *downloadAccessChecker) canDownload(ctx context.Context, file *domain.File) (bool, error) {
+	if c.allowAll || file.OwnerID == c.userID {
+		return true, nil
+	}
+
+	allowed, checked := c.folders[file.FolderID]
+	if !checked {
+		var err error
+		allowed, err = c.permissionService.CheckSharedFolderPermission(ctx, c.userID, file.FolderID, OperationDownload)
+		if err != nil {
+			return false, fmt.Errorf("failed to check permissions: %w", err)
+		}
+		c.folders[file.FolderID] = allowed
+	}
+	if allowed {
+		return true, nil
+	}
+
+	allowed, err := c.permissionService.CheckPermission(ctx, c.userID, file.UUID.String(), domain.ResourceTypeFile, OperationDownload)
+	if err != nil {
+		return false, fmt.Errorf("failed to check permissions: %w", err)
+	}
+
+	return allowed, nil
+}
+
+// archiveNames следит за уникальностью путей внутри архива
+type archiveNames struct {
+	used map[string]bool
+}
+
+func newArchiveNames() *archiveNames {
+	return &archiveNames{used: make(map[string]bool)}
+}
+
+// reserve возвращает свободный путь, добавляя к имени суффикс " (N)" при совпадении
+func (n *archiveNames) reserve(name string) string {
+	key := strings.ToLower(name)
+	if !n.used[key] {
+		n.used[key] = true
+		return name
+	}
+
+	dir, base := path.Split(name)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s%s (%d)%s", dir, stem, i, ext)
+		key = strings.ToLower(candidate)
+		if !n.used[key] {
+			n.used[key] = true
+			return candidate
+		}
+	}
+}
+
+// sanitizeArchiveName убирает из имени символы, недопустимые в пути архива
+func sanitizeArchiveName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// archiveName возвращает имя архива без расширения
+func archiveName(name string) string {
+	name = sanitizeArchiveName(name)
+	if name == "_" {
+		return defaultArchiveName
+	}
+	return name
+}
+
+// archiveMethod выбирает метод сжатия: уже сжатые форматы сохраняются как есть
+func archiveMethod(mimeType string) uint16 {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"),
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"),
+		strings.Contains(mimeType, "zip"),
+		strings.Contains(mimeType, "compressed"):
+		return zip.Store
+	default:
+		return zip.Deflate
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"strconv"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+)
+
+// maxBatchOperations ограничивает количество операций в одном пакетном запросе
+const maxBatchOperations = 1000
+
+type BatchService struct {
+	db            *sqlx.DB
+	fileService   *FileService
+	folderService *FolderService
+	trashService  *TrashService
+}
+
+func NewBatchService(
+	db *sqlx.DB,
+	fileService *FileService,
+	folderService *FolderService,
+	trashService *TrashService,
+) *BatchService {
+	return &BatchService{
+		db:            db,
+		fileService:   fileService,
+		folderService: folderService,
+		trashService:  trashService,
+	}
+}
+
+// Execute выполняет список операций над файлами и папками.
+// В режиме atomic все операции выполняются в одной транзакции: при первой ошибке
+// изменения отменяются, а оставшиеся операции не выполняются
+func (s *BatchService) Execute(ctx context.Context, operations []domain.BatchOperation, atomic bool, userID string) (*domain.BatchResult, error) {
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("invalid batch: no operations")
+	}
+	if len(operations) > maxBatchOperations {
+		return nil, fmt.Errorf("invalid batch: too many operations (max %d)", maxBatchOperations)
+	}
+	for i, op := range operations {
+		if err := validateBatchOperation(op); err != nil {
+			return nil, fmt.Errorf("invalid batch operation %d: %w", i, err)
+		}
+	}
+
+	result := &domain.BatchResult{
+		Atomic:  atomic,
+		Results: make([]domain.BatchItemResult, len(operations)),
+	}
+	for i, op := range operations {
+		result.Results[i] = domain.BatchItemResult{
+			Index:    i,
+			Action:   op.Action,
+			ItemID:   op.ItemID,
+			ItemType: op.ItemType,
+			Status:   domain.BatchStatusSkipped,
+		}
+	}
+
+	if !atomic {
+		for i, op := range operations {
+			s.setResult(result, i, s.apply(ctx, op, userID))
+		}
+		return result, nil
+	}
+
+	failed := -1
+	err := repository.RunInTx(ctx, s.db, func(ctx context.Context) error {
+		for i, op := range operations {
+			if err := s.apply(ctx, op, userID); err != nil {
+				failed = i
+				return err
+			}
+			result.Results[i].Status = domain.BatchStatusOK
+		}
+		return nil
+	})
+	if err != nil && failed < 0 {
+		return nil, fmt.Errorf("failed to execute batch: %w", err)
+	}
+
+	if failed >= 0 {
+		log.Printf("[Batch] Operation %d failed, rolling back batch of %d operations: %v", failed, len(operations), err)
+		for i := 0; i < failed; i++ {
+			result.Results[i].Status = domain.BatchStatusRolledBack
+		}
+		result.Results[failed].Status = domain.BatchStatusFailed
+		result.Results[failed].Error = err.Error()
+		result.Failed = 1
+		return result, nil
+	}
+
+	result.Succeeded = len(operations)
+	return result, nil
+}
+
+// setResult записывает результат операции в режиме независимого выполнения
+func (s *BatchService) setResult(result *domain.BatchResult, index int, err error) {
+	if err != nil {
+		result.Results[index].Status = domain.BatchStatusFailed
+		result.Results[index].Error = err.Error()
+		result.Failed++
+		return
+	}
+	result.Results[index].Status = domain.BatchStatusOK
+	result.Succeeded++
+}
+
+// apply выполняет одну операцию через соответствующий сервис
+func (s *BatchService) apply(ctx context.Context, op domain.BatchOperation, userID string) error {
+	policy, err := ParseConflictPolicy(op.ConflictPolicy, domain.ConflictPolicyFail)
+	if err != nil {
+		return err
+	}
+
+	if op.ItemType == "file" {
+		fileUUID, err := uuid.Parse(op.ItemID)
+		if err != nil {
+			return fmt.Errorf("invalid file id: %s", op.ItemID)
+		}
+
+		switch op.Action {
+		case domain.BatchActionMove:
+			return s.fileService.MoveFile(ctx, fileUUID, op.TargetFolderID, policy, userID)
+		case domain.BatchActionRename:
+			return s.fileService.RenameFile(ctx, fileUUID, op.Name, userID)
+		case domain.BatchActionTrash:
+			return s.trashService.MoveToTrash(ctx, op.ItemID, op.ItemType, userID)
+		case domain.BatchActionRestore:
+			return s.trashService.RestoreFromTrash(ctx, op.ItemID, op.ItemType, policy, userID)
+		case domain.BatchActionDeletePermanently:
+			return s.trashService.DeletePermanently(ctx, op.ItemID, op.ItemType, userID)
+		}
+		return fmt.Errorf("invalid action: %s", op.Action)
+	}
+
+	folderID, err := strconv.ParseInt(op.ItemID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid folder id: %s", op.ItemID)
+	}
+
+	switch op.Action {
+	case domain.BatchActionMove:
+		return s.folderService.MoveFolder(ctx, folderID, op.TargetFolderID, policy, userID)
+	case domain.BatchActionRename:
+		return s.folderService.RenameFolder(ctx, folderID, op.Name, userID)
+	case domain.BatchActionTrash:
+		return s.folderService.DeleteFolder(ctx, folderID, userID)
+	case domain.BatchActionRestore:
+		return s.trashService.RestoreFromTrash(ctx, op.ItemID, op.ItemType, policy, userID)
+	case domain.BatchActionDeletePermanently:
+		return s.trashService.DeletePermanently(ctx, op.ItemID, op.ItemType, userID)
+	}
+	return fmt.Errorf("invalid action: %s", op.Action)
+}
+
+// validateBatchOperation проверяет параметры операции до начала выполнения пакета
+func validateBatchOperation(op domain.BatchOperation) error {
+	if op.ItemID == "" {
+		return fmt.Errorf("item id is required")
+	}
+	if op.ItemType != "file" && op.ItemType != "folder" {
+		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+	if _, err := ParseConflictPolicy(op.ConflictPolicy, domain.ConflictPolicyFail); err != nil {
+		return err
+	}
+
+	switch op.Action {
+	case domain.BatchActionMove:
+		if op.TargetFolderID == 0 {
+			return fmt.Errorf("target folder id is required for move")
+		}
+	case domain.BatchActionRename:
+		if op.Name == "" {
+			return fmt.Errorf("name is required for rename")
+		}
+	case domain.BatchActionTrash, domain.BatchActionRestore, domain.BatchActionDeletePermanently:
+	default:
+		return fmt.Errorf("invalid action: %q", op.Action)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"strings"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"synxrondrive/internal/service/s3"
+)
+
+const (
+	// blobKeyPrefix - префикс ключей объектов, адресуемых по содержимому.
+	// Объекты владельца лежат в его каталоге, чтобы шифроваться его ключом
+	blobKeyPrefix = "blobs/"
+	// blobCollectBatch - сколько объектов без ссылок удаляется за одну транзакцию
+	blobCollectBatch = 200
+)
+
+// BlobService хранит содержимое версий в общих объектах по контрольной сумме SHA-256,
+// чтобы одинаковые файлы и версии одного владельца занимали место в хранилище один раз
+type BlobService struct {
+	blobRepo *repository.BlobRepository
+	s3Client s3.Storage
+}
+
+func NewBlobService(blobRepo *repository.BlobRepository, s3Client s3.Storage) *BlobService {
+	return &BlobService{
+		blobRepo: blobRepo,
+		s3Client: s3Client,
+	}
+}
+
+// blobS3Key возвращает ключ объекта владельца с указанной контрольной суммой
+func blobS3Key(ownerID, checksum string) string {
+	return fmt.Sprintf("personal_drive_files/%s/%s%s/%s", ownerID, blobKeyPrefix, checksum[:2], checksum)
+}
+
+// blobOwner возвращает владельца общего объекта по ключу. Для объектов,
+// созданных до разделения по владельцам, владелец пустой
+func blobOwner(key string) (string, bool) {
+	if strings.HasPrefix(key, blobKeyPrefix) {
+		return "", true
+	}
+	rest, ok := strings.CutPrefix(key, "personal_drive_files/")
+	if !ok {
+		return "", false
+	}
+	owner, rest, found := strings.Cut(rest, "/")
+	if !found || owner == "" || !strings.HasPrefix(rest, blobKeyPrefix) {
+		return "", false
+	}
+	return owner, true
+}
+
+// isBlobS3Key проверяет, что ключ принадлежит общему объекту.
+// Такие объекты удаляются только сборщиком, когда на них не остается ссылок
+func isBlobS3Key(key string) bool {
+	_, ok := blobOwner(key)
+	return ok
+}
+
+// isValidChecksum проверяет, что строка является SHA-256 в hex-формате
+func isValidChecksum(checksum string) bool {
+	if len(checksum) != 64 || strings.ToLower(checksum) != checksum {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
+
+// Attach переводит версию на общий объект с ее содержимым. Вызывается в транзакции,
+// в которой создается запись версии: блокировка записи объекта не дает сборщику
+// удалить его до фиксации. Возвращает ключ временного объекта, который нужно
+// удалить после фиксации, или пустую строку. Общие объекты не разделяются между
+// владельцами: каждый объект зашифрован ключом своего владельца
+func (s *BlobService) Attach(ctx context.Context, tx *sqlx.Tx, ownerID string, version *domain.FileVersion) (string, error) {
+	// Версия уже ссылается на общий объект, например при восстановлении
+	if owner, ok := blobOwner(version.S3Key); ok {
+		if owner != "" && owner != ownerID {
+			return "", fmt.Errorf("blob %s belongs to another owner", version.S3Key)
+		}
+		_, err := s.blobRepo.LockByKey(ctx, tx, version.S3Key)
+		return "", err
+	}
+
+	// Без контрольной суммы содержимое остается под собственным ключом версии
+	if version.SHA256 == nil || !isValidChecksum(*version.SHA256) {
+		return "", nil
+	}
+
+	blob := &domain.Blob{
+		OwnerID:   ownerID,
+		SHA256:    *version.SHA256,
+		S3Key:     blobS3Key(ownerID, *version.SHA256),
+		SizeBytes: version.SizeBytes,
+	}
+
+	needsUpload, err := s.blobRepo.LockOrCreate(ctx, tx, blob)
+	if err != nil {
+		return "", err
+	}
+
+	if needsUpload {
+		if err := s.s3Client.CopyObject(ctx, version.S3Key, blob.S3Key); err != nil {
+			return "", fmt.Errorf("failed to store blob: %w", err)
+		}
+	} else {
+		log.Printf("[Blob] Reusing stored content %s for file %s", blob.SHA256, version.FileUUID)
+	}
+
+	stagingKey := version.S3Key
+	version.S3Key = blob.S3Key
+	return stagingKey, nil
+}
+
+// CollectGarbage удаляет из хранилища объекты, на которые не осталось ссылок
+func (s *BlobService) CollectGarbage(ctx context.Context) error {
+	for {
+		deleted, total, err := s.collectBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			log.Printf("[Blob] Deleted %d unreferenced blobs", deleted)
+		}
+		// Если ни один объект не удалось удалить, повторим при следующей очистке
+		if total < blobCollectBatch || deleted == 0 {
+			return nil
+		}
+	}
+}
+
+// collectBatch удаляет одну порцию объектов без ссылок
+func (s *BlobService) collectBatch(ctx context.Context) (int, int, error) {
+	tx, err := s.blobRepo.BeginTx(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	blobs, err := s.blobRepo.GetUnreferenced(ctx, tx, blobCollectBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Записи заблокированы до фиксации, поэтому новая ссылка на объект
+	// не может появиться, пока он удаляется из хранилища
+	deleted := 0
+	for _, blob := range blobs {
+		if err := s.s3Client.DeleteObject(blob.S3Key); err != nil {
+			log.Printf("[Blob] Failed to delete blob %s from storage: %v", blob.S3Key, err)
+			continue
+		}
+		if err := s.blobRepo.Delete(ctx, tx, blob.S3Key); err != nil {
+			return 0, 0, err
+		}
+		deleted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deleted, len(blobs), nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"strings"
+	"synxrondrive/internal/service/s3"
+	"testing"
+)
+
+func TestBlobS3Key(t *testing.T) {
+	checksum := strings.Repeat("ab", 32)
+	key := blobS3Key("user-1", checksum)
+
+	if want := "personal_drive_files/user-1/blobs/ab/" + checksum; key != want {
+		t.Fatalf("blobS3Key = %q, want %q", key, want)
+	}
+	// Объект шифруется ключом владельца, а не системным
+	if keyID := s3.OwnerKeyID(key); keyID != "user-1" {
+		t.Errorf("OwnerKeyID(%q) = %q, want user-1", key, keyID)
+	}
+}
+
+func TestBlobOwner(t *testing.T) {
+	tests := []struct {
+		key       string
+		wantOwner string
+		wantBlob  bool
+	}{
+		{"personal_drive_files/user-1/blobs/ab/abcdef", "user-1", true},
+		{"blobs/ab/abcdef", "", true},
+		{"personal_drive_files/user-1/file-uuid", "", false},
+		{"personal_drive_files/user-1/versions/file-uuid_version", "", false},
+		{"personal_drive_files/user-1/previews/file-uuid_v1", "", false},
+		{"personal_drive_files//blobs/ab/abcdef", "", false},
+		{"recordings/personal_recordings/user-1/blobs/ab/abcdef", "", false},
+		{"previews/blobs/ab/abcdef", "", false},
+	}
+
+	for _, tt := range tests {
+		owner, ok := blobOwner(tt.key)
+		if owner != tt.wantOwner || ok != tt.wantBlob {
+			t.Errorf("blobOwner(%q) = %q, %v; want %q, %v", tt.key, owner, ok, tt.wantOwner, tt.wantBlob)
+		}
+		if isBlobS3Key(tt.key) != tt.wantBlob {
+			t.Errorf("isBlobS3Key(%q) = %v, want %v", tt.key, !tt.wantBlob, tt.wantBlob)
+		}
+	}
+}
+
+func TestIsValidChecksum(t *testing.T) {
+	tests := []struct {
+		checksum string
+		want     bool
+	}{
+		{strings.Repeat("0a", 32), true},
+		{strings.Repeat("0A", 32), false},
+		{strings.Repeat("0a", 31), false},
+		{strings.Repeat("zz", 32), false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidChecksum(tt.checksum); got != tt.want {
+			t.Errorf("isValidChecksum(%q) = %v, want %v", tt.checksum, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"synxrondrive/internal/service/s3"
+)
+
+// CopyService копирует файлы и папки. Содержимое копируется на стороне
+// хранилища, без передачи данных через сервер
+type CopyService struct {
+	fileRepo          *repository.FileRepository
+	folderRepo        *repository.FolderRepository
+	fileService       *FileService
+	permissionService *PermissionService
+	quotaService      *StorageQuotaService
+	s3Client          s3.Storage
+}
+
+func NewCopyService(
+	fileRepo *repository.FileRepository,
+	folderRepo *repository.FolderRepository,
+	fileService *FileService,
+	permissionService *PermissionService,
+	quotaService *StorageQuotaService,
+	s3Client s3.Storage,
+) *CopyService {
+	return &CopyService{
+		fileRepo:          fileRepo,
+		folderRepo:        folderRepo,
+		fileService:       fileService,
+		permissionService: permissionService,
+		quotaService:      quotaService,
+		s3Client:          s3Client,
+	}
+}
+
+// ParseConflictPolicy разбирает политику разрешения конфликтов имен.
+// Пустое значение означает политику по умолчанию fallback
+func ParseConflictPolicy(value string, fallback domain.ConflictPolicy) (domain.ConflictPolicy, error) {
+	switch policy := domain.ConflictPolicy(value); policy {
+	case "":
+		return fallback, nil
+	case domain.ConflictPolicyFail, domain.ConflictPolicyRename, domain.ConflictPolicyVersion, domain.ConflictPolicyReplace:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy: %s", value)
+	}
+}
+
+// CopyFile копирует файл в указанную папку. Копия принадлежит владельцу
+// целевой папки и учитывается в его квоте
+func (s *CopyService) CopyFile(
+	ctx context.Context,
+	fileUUID uuid.UUID,
+	targetFolderID int64,
+	policy domain.ConflictPolicy,
+	userID string,
+) (*domain.File, error) {
+	file, err := s.fileService.GetFileInfo(ctx, fileUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := newDownloadAccessChecker(s.permissionService, userID).canDownload(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errAccessDenied
+	}
+
+	target, err := s.getTargetFolder(ctx, targetFolderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkSpace(ctx, target.OwnerID, file.SizeBytes); err != nil {
+		return nil, err
+	}
+
+	return s.copyFile(ctx, file, target, policy, userID)
+}
+
+// CopyFolder копирует папку со всеми подпапками и файлами в указанную папку
+func (s *CopyService) CopyFolder(
+	ctx context.Context,
+	folderID int64,
+	targetFolderID int64,
+	policy domain.ConflictPolicy,
+	userID string,
+) (*domain.Folder, error) {
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("folder not found: %w", err)
+	}
+	if folder.ParentID == nil {
+		return nil, fmt.Errorf("invalid folder: root folder cannot be copied")
+	}
+
+	if err := s.checkFolderReadable(ctx, folder, userID); err != nil {
+		return nil, err
+	}
+
+	target, err := s.getTargetFolder(ctx, targetFolderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Копирование папки в саму себя никогда не закончится
+	if target.ID == folder.ID {
+		return nil, fmt.Errorf("invalid target: cannot copy folder into itself")
+	}
+	if target.ID == *folder.ParentID && policy == domain.ConflictPolicyReplace {
+		return nil, fmt.Errorf("invalid target: folder cannot replace itself")
+	}
+	inHierarchy, err := s.folderRepo.IsInHierarchy(ctx, target.ID, strconv.FormatInt(folder.ID, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check hierarchy: %w", err)
+	}
+	if inHierarchy {
+		return nil, fmt.Errorf("invalid target: cannot copy folder into its own subfolder")
+	}
+
+	tree, err := s.folderRepo.GetFolderTree(ctx, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.folderRepo.GetTreeFiles(ctx, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.SizeBytes
+	}
+	if err := s.checkSpace(ctx, target.OwnerID, totalSize); err != nil {
+		return nil, err
+	}
+
+	root, merged, err := s.resolveFolderConflict(ctx, folder.Name, target, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Соответствие исходных папок созданным. Дерево упорядочено так,
+	// что родитель всегда обрабатывается раньше дочерних папок
+	copies := map[int64]*domain.Folder{folder.ID: root}
+	mergedFolders := map[int64]bool{folder.ID: merged}
+	for _, src := range tree {
+		if src.ID == folder.ID || src.ParentID == nil {
+			continue
+		}
+		parent, ok := copies[*src.ParentID]
+		if !ok {
+			continue
+		}
+
+		var dst *domain.Folder
+		if mergedFolders[*src.ParentID] {
+			dst, err = s.folderRepo.GetChildByName(ctx, parent.ID, src.Name)
+			if err != nil {
+				return nil, err
+			}
+			mergedFolders[src.ID] = dst != nil
+		}
+		if dst == nil {
+			dst, err = s.createFolder(ctx, src.Name, parent)
+			if err != nil {
+				return nil, err
+			}
+		}
+		copies[src.ID] = dst
+	}
+
+	for i := range files {
+		file := &files[i]
+		dst, ok := copies[file.FolderID]
+		if !ok {
+			continue
+		}
+
+		// В новых папках конфликтов нет, в объединенных действует выбранная политика
+		filePolicy := domain.ConflictPolicyFail
+		if mergedFolders[file.FolderID] {
+			filePolicy = policy
+		}
+
+		if _, err := s.copyFile(ctx, file, dst, filePolicy, userID); err != nil {
+			return nil, fmt.Errorf("failed to copy file %s: %w", file.Name, err)
+		}
+	}
+
+	// Перечитываем папку, чтобы вернуть актуальные размер и количество файлов
+	return s.folderRepo.GetByID(ctx, root.ID)
+}
+
+// copyFile копирует содержимое текущей версии файла и регистрирует копию в целевой папке
+func (s *CopyService) copyFile(
+	ctx context.Context,
+	file *domain.File,
+	folder *domain.Folder,
+	policy domain.ConflictPolicy,
+	userID string,
+) (*domain.File, error) {
+	target := &UploadTarget{
+		FolderID: folder.ID,
+		OwnerID:  folder.OwnerID,
+		Policy:   policy,
+	}
+
+	name := file.Name
+	existing, err := s.fileRepo.CheckFileExists(ctx, folder.ID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check file existence: %w", err)
+	}
+
+	// Свободное имя для политики rename подбирается при регистрации копии,
+	// под блокировкой имен целевой папки
+	if existing != nil {
+		switch policy {
+		case domain.ConflictPolicyRename:
+		case domain.ConflictPolicyVersion, domain.ConflictPolicyReplace:
+			if existing.UUID == file.UUID {
+				return nil, fmt.Errorf("invalid target: file cannot be copied onto itself")
+			}
+			if existing.OwnerID != userID {
+				hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, folder.ID, OperationEdit)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check edit permissions: %w", err)
+				}
+				if !hasPermission {
+					return nil, errAccessDenied
+				}
+			}
+			if policy == domain.ConflictPolicyVersion {
+				target.ExistingFile = existing
+				target.FileUUID = existing.UUID
+				target.S3Key = versionS3Key(folder.OwnerID, existing.UUID)
+				target.Note = VersionNote{Comment: fmt.Sprintf("Скопировано из файла %s", file.Name)}
+			}
+		default:
+			return nil, fmt.Errorf("file with name %s already exists in target folder", name)
+		}
+	}
+
+	if target.ExistingFile == nil {
+		target.FileUUID = uuid.New()
+		target.S3Key = fileS3Key(folder.OwnerID, target.FileUUID)
+	}
+
+	sourceKey, checksum := s.sourceContent(ctx, file)
+	if owner, ok := blobOwner(sourceKey); ok && owner == folder.OwnerID {
+		// Содержимое уже лежит в общем объекте владельца, копия просто ссылается на него.
+		// Копия в папку другого владельца перешифровывается его ключом
+		target.S3Key = sourceKey
+	} else if err := s.s3Client.CopyObject(ctx, sourceKey, target.S3Key); err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	return s.fileService.CommitUpload(ctx, target, name, file.MIMEType, file.SizeBytes, checksum, userID)
+}
+
+// sourceContent возвращает ключ объекта и контрольную сумму текущего содержимого файла
+func (s *CopyService) sourceContent(ctx context.Context, file *domain.File) (string, string) {
+	// Записи конференций хранятся по пути из метаданных
+	if file.Metadata != nil {
+		if path, ok := file.Metadata["s3Path"].(string); ok && path != "" {
+			return path, ""
+		}
+	}
+
+	version, err := s.fileRepo.GetVersion(ctx, file.UUID, file.CurrentVersion)
+	if err != nil {
+		return fileS3Key(file.OwnerID, file.UUID), ""
+	}
+
+	checksum := ""
+	if version.SHA256 != nil {
+		checksum = *version.SHA256
+	}
+	return version.S3Key, checksum
+}
+
+// resolveFolderConflict создает корневую папку копии или, для политики
+// ConflictPolicyVersion, возвращает существующую папку для объединения
+func (s *CopyService) resolveFolderConflict(
+	ctx context.Context,
+	name string,
+	target *domain.Folder,
+	policy domain.ConflictPolicy,
+) (*domain.Folder, bool, error) {
+	var folder *domain.Folder
+	merged := false
+	err := repository.RunInTx(ctx, s.fileRepo.GetDB(), func(ctx context.Context) error {
+		name, existing, err := s.folderRepo.ResolveNameConflict(ctx, target.ID, name, policy)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			folder, merged = existing, true
+			return nil
+		}
+
+		folder, err = s.createFolder(ctx, name, target)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return folder, merged, nil
+}
+
+// createFolder создает подпапку. Путь и уровень вычисляются по родительской папке
+func (s *CopyService) createFolder(ctx context.Context, name string, parent *domain.Folder) (*domain.Folder, error) {
+	folder := &domain.Folder{
+		Name:     name,
+		OwnerID:  parent.OwnerID, // Владельцем всегда будет владелец родительской папки
+		ParentID: &parent.ID,
+	}
+	if err := s.folderRepo.Create(ctx, folder); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	return folder, nil
+}
+
+// getTargetFolder проверяет права на добавление содержимого в целевую папку.
+// Нулевой идентификатор означает корневую папку пользователя
+func (s *CopyService) getTargetFolder(ctx context.Context, folderID int64, userID string) (*domain.Folder, error) {
+	if folderID == 0 {
+		return s.fileService.getRootFolder(ctx, userID)
+	}
+
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("target folder not found: %w", err)
+	}
+
+	if folder.OwnerID != userID {
+		hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, folderID, OperationUpload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check target folder permissions: %w", err)
+		}
+		if !hasPermission {
+			return nil, errAccessDenied
+		}
+	}
+
+	return folder, nil
+}
+
+// checkFolderReadable проверяет право на скачивание содержимого папки
+func (s *CopyService) checkFolderReadable(ctx context.Context, folder *domain.Folder, userID string) error {
+	if folder.OwnerID == userID {
+		return nil
+	}
+
+	hasPermission, err := s.permissionService.CheckPermission(ctx, userID, strconv.FormatInt(folder.ID, 10), domain.ResourceTypeFolder, OperationDownload)
+	if err != nil {
+		return fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if hasPermission {
+		return nil
+	}
+
+	hasPermission, err = s.permissionService.CheckSharedFolderPermission(ctx, userID, folder.ID, OperationDownload)
+	if err != nil {
+		return fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !hasPermission {
+		return errAccessDenied
+	}
+	return nil
+}
+
+// checkSpace проверяет, что у владельца целевой папки хватит места для копии
+func (s *CopyService) checkSpace(ctx context.Context, ownerID string, size int64) error {
+	available, err := s.quotaService.CheckSpaceAvailable(ctx, ownerID, size)
+	if err != nil {
+		return fmt.Errorf("failed to check available space: %w", err)
+	}
+	if !available {
+		return fmt.Errorf("not enough storage space available")
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"mime/multipart"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxFileRequestExtensions ограничивает список разрешенных расширений
+	maxFileRequestExtensions = 50
+	maxUploaderFieldLength   = 255
+)
+
+var fileExtensionPattern = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+// FileRequestService ведет ссылки, по которым внешние пользователи загружают
+// файлы в папку владельца, не видя ее содержимого
+type FileRequestService struct {
+	fileRequestRepo *repository.FileRequestRepository
+	shareRepo       *repository.ShareRepository
+	shareService    *ShareService
+	fileService     *FileService
+}
+
+// FileRequestOptions - параметры нового запроса файлов
+type FileRequestOptions struct {
+	MaxFileSize       *int64
+	AllowedExtensions []string
+	Deadline          *time.Time
+	Password          string
+}
+
+func NewFileRequestService(
+	fileRequestRepo *repository.FileRequestRepository,
+	shareRepo *repository.ShareRepository,
+	shareService *ShareService,
+	fileService *FileService,
+) *FileRequestService {
+	return &FileRequestService{
+		fileRequestRepo: fileRequestRepo,
+		shareRepo:       shareRepo,
+		shareService:    shareService,
+		fileService:     fileService,
+	}
+}
+
+// CreateFileRequest создает ссылку для загрузки файлов в папку пользователя.
+// Срок приема файлов задается сроком действия ссылки
+func (s *FileRequestService) CreateFileRequest(ctx context.Context, folderID int64, userID string, opts FileRequestOptions) (*domain.FileRequest, error) {
+	if opts.MaxFileSize != nil && (*opts.MaxFileSize <= 0 || *opts.MaxFileSize > maxFileSize) {
+		return nil, fmt.Errorf("invalid max_file_size: must be between 1 and %d bytes", maxFileSize)
+	}
+	extensions, err := normalizeExtensions(opts.AllowedExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresIn *time.Duration
+	if opts.Deadline != nil {
+		d := time.Until(*opts.Deadline)
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid deadline: must be in the future")
+		}
+		expiresIn = &d
+	}
+
+	var request *domain.FileRequest
+	err = repository.RunInTx(ctx, s.fileRequestRepo.GetDB(), func(ctx context.Context) error {
+		share, err := s.shareService.CreateShare(
+			ctx,
+			strconv.FormatInt(folderID, 10),
+			domain.ResourceTypeFolder,
+			userID,
+			domain.AccessTypeEdit,
+			expiresIn,
+			userID,
+			ShareLinkOptions{Password: opts.Password, UploadOnly: true},
+		)
+		if err != nil {
+			return err
+		}
+		if err := s.fileRequestRepo.Create(ctx, share.ID, opts.MaxFileSize, extensions); err != nil {
+			return err
+		}
+		request, err = s.fileRequestRepo.Get(ctx, share.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[FileRequest] User %s created file request %s for folder %d", userID, request.ShareID, folderID)
+	return request, nil
+}
+
+// GetFileRequest возвращает условия запроса файлов для формы загрузки.
+// Пользователь может быть анонимным (пустой userID)
+func (s *FileRequestService) GetFileRequest(ctx context.Context, token string, userID string, accessTokens []string) (*domain.FileRequest, error) {
+	share, err := s.requestShare(ctx, token, userID, accessTokens)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileRequestRepo.Get(ctx, share.ID)
+}
+
+// VerifyPassword проверяет пароль запроса файлов. Проверка доступна без
+// авторизации, поэтому принимаются только токены ссылок запроса файлов
+func (s *FileRequestService) VerifyPassword(ctx context.Context, token string, password string) (*domain.LinkAccess, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil || !share.UploadOnly {
+		return nil, fmt.Errorf("file request not found or expired")
+	}
+	return s.shareService.VerifyLinkPassword(ctx, token, password)
+}
+
+// Upload загружает файл по запросу в папку владельца. Файл учитывается в квоте
+// владельца; при совпадении имени загруженному файлу подбирается свободное имя,
+// чтобы не перезаписать файлы владельца
+func (s *FileRequestService) Upload(
+	ctx context.Context,
+	token string,
+	accessTokens []string,
+	uploader domain.Uploader,
+	header *multipart.FileHeader,
+	file multipart.File,
+) (*domain.File, error) {
+	share, err := s.requestShare(ctx, token, uploader.UserID, accessTokens)
+	if err != nil {
+		return nil, err
+	}
+	request, err := s.fileRequestRepo.Get(ctx, share.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := normalizeUploader(&uploader); err != nil {
+		return nil, err
+	}
+	if header == nil || header.Filename == "" {
+		return nil, fmt.Errorf("%w: missing file name", errInvalidFile)
+	}
+	if !extensionAllowed(header.Filename, request.AllowedExtensions) {
+		return nil, fmt.Errorf("%w: allowed extensions are %s", errInvalidFile, strings.Join(request.AllowedExtensions, ", "))
+	}
+	if request.MaxFileSize != nil && header.Size > *request.MaxFileSize {
+		return nil, fmt.Errorf("%w: max size is %d bytes", errFileTooLarge, *request.MaxFileSize)
+	}
+
+	uploaded, err := s.fileService.UploadFile(ctx, header, file, request.FolderID, share.OwnerID, domain.ConflictPolicyRename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Файл уже сохранен, поэтому ошибка записи о загрузке только логируется
+	record := &domain.FileRequestUpload{
+		ShareID:       share.ID,
+		FileUUID:      &uploaded.UUID,
+		FileName:      uploaded.Name,
+		Size:          uploaded.SizeBytes,
+		UploaderName:  uploader.Name,
+		UploaderEmail: uploader.Email,
+	}
+	if uploader.UserID != "" {
+		record.UploaderID = &uploader.UserID
+	}
+	if err := s.fileRequestRepo.RecordUpload(ctx, record); err != nil {
+		log.Printf("[FileRequest] Failed to record upload of %s to request %s: %v", uploaded.UUID, share.ID, err)
+	}
+
+	log.Printf("[FileRequest] File %s uploaded to request %s", uploaded.UUID, share.ID)
+	return uploaded, nil
+}
+
+// ListUploads возвращает владельцу файлы, загруженные по его запросу
+func (s *FileRequestService) ListUploads(ctx context.Context, shareID string, ownerID string) ([]domain.FileRequestUpload, error) {
+	id, err := uuid.Parse(shareID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share ID")
+	}
+	owned, err := s.shareRepo.GetOwnedShare(ctx, id.String(), ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if !owned.UploadOnly {
+		return nil, fmt.Errorf("invalid request: share is not a file request")
+	}
+	return s.fileRequestRepo.ListUploads(ctx, id)
+}
+
+// requestShare находит действующую ссылку запроса файлов и проверяет ее пароль
+func (s *FileRequestService) requestShare(ctx context.Context, token string, userID string, accessTokens []string) (*domain.Share, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("file request not found or expired")
+	}
+	if !share.UploadOnly {
+		return nil, fmt.Errorf("file request not found or expired")
+	}
+	if err := s.shareService.checkLinkPassword(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// normalizeExtensions приводит расширения к виду "pdf": без точки, в нижнем регистре, без повторов
+func normalizeExtensions(extensions []string) ([]string, error) {
+	if len(extensions) > maxFileRequestExtensions {
+		return nil, fmt.Errorf("invalid allowed_extensions: at most %d extensions", maxFileRequestExtensions)
+	}
+	result := make([]string, 0, len(extensions))
+	seen := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if !fileExtensionPattern.MatchString(ext) {
+			return nil, fmt.Errorf("invalid allowed_extensions: %q is not a file extension", ext)
+		}
+		if !seen[ext] {
+			seen[ext] = true
+			result = append(result, ext)
+		}
+	}
+	return result, nil
+}
+
+func extensionAllowed(fileName string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	for _, a := range allowed {
+		if ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeUploader проверяет имя и email из формы загрузки; оба поля необязательны
+func normalizeUploader(uploader *domain.Uploader) error {
+	uploader.Name = strings.TrimSpace(uploader.Name)
+	uploader.Email = strings.TrimSpace(uploader.Email)
+	if utf8.RuneCountInString(uploader.Name) > maxUploaderFieldLength {
+		return fmt.Errorf("invalid uploader name: too long (max %d characters)", maxUploaderFieldLength)
+	}
+	if uploader.Email == "" {
+		return nil
+	}
+	if len(uploader.Email) > maxUploaderFieldLength {
+		return fmt.Errorf("invalid uploader email: too long")
+	}
+	address, err := mail.ParseAddress(uploader.Email)
+	if err != nil || address.Address != uploader.Email {
+		return fmt.Errorf("invalid uploader email")
+	}
+	return nil
+}
@@ -11,9 +11,9 @@ import (
 	"log"
 	"mime/multipart"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
+	"synxrondrive/internal/auth"
 	"synxrondrive/internal/domain"
 	"synxrondrive/internal/repository"
 	"synxrondrive/internal/service/s3"
@@ -22,8 +22,8 @@ import (
 
 // Определение констант для работы с файлами
 const (
-	maxFileSize    = 100 * 1024 * 1024 // 100MB максимальный размер файла
-	downloadBuffer = 1 * 1024 * 1024   // 1MB размер буфера для скачивания
+	maxFileSize    = 5 * 1024 * 1024 * 1024 // 5GB максимальный размер файла
+	downloadBuffer = 1 * 1024 * 1024        // 1MB размер буфера для скачивания
 )
 
 const (
@@ -49,6 +49,8 @@ type FileService struct {
 	s3Client          s3.Storage
 	permissionService *PermissionService
 	quotaService      *StorageQuotaService
+	blobService       *BlobService
+	activityService   *ActivityService
 }
 
 func NewFileService(
@@ -58,6 +60,8 @@ func NewFileService(
 	s3Client s3.Storage,
 	permissionService *PermissionService,
 	quotaService *StorageQuotaService,
+	blobService *BlobService,
+	activityService *ActivityService,
 ) *FileService {
 	return &FileService{
 		fileRepo:          fileRepo,
@@ -66,9 +70,34 @@ func NewFileService(
 		s3Client:          s3Client,
 		permissionService: permissionService,
 		quotaService:      quotaService,
+		blobService:       blobService,
+		activityService:   activityService,
 	}
 }
 
+// UploadTarget описывает, куда будет сохранен загружаемый файл
+type UploadTarget struct {
+	FolderID     int64
+	OwnerID      string // Владелец папки, он же владелец файла
+	FileUUID     uuid.UUID
+	S3Key        string
+	ExistingFile *domain.File          // Заполнено, если загрузка создаст новую версию файла
+	Note         VersionNote           // Метка и комментарий к загружаемой версии
+	Policy       domain.ConflictPolicy // Что делать, если в папке уже есть файл с таким именем
+}
+
+// VersionNote содержит необязательные метку и комментарий к версии файла
+type VersionNote struct {
+	Label   string
+	Comment string
+}
+
+// Ограничения на длину метки и комментария версии
+const (
+	maxVersionLabelLength   = 100
+	maxVersionCommentLength = 1000
+)
+
 // UploadFile загружает файл в хранилище
 func (s *FileService) UploadFile(
 	ctx context.Context,
@@ -76,25 +105,106 @@ func (s *FileService) UploadFile(
 	file multipart.File,
 	folderID int64,
 	userID string,
+	policy domain.ConflictPolicy,
 ) (*domain.File, error) {
+	// Проверяем входные параметры
+	if header == nil || file == nil || userID == "" {
+		return nil, fmt.Errorf("%w: missing required parameters", errInvalidFile)
+	}
 
-	// Проверяем наличие свободного места
-	spaceAvailable, err := s.quotaService.CheckSpaceAvailable(ctx, userID, header.Size)
+	return s.UploadStream(ctx, header.Filename, header.Header.Get("Content-Type"), file, header.Size, folderID, userID, VersionNote{}, policy)
+}
+
+// MaxFileSize возвращает максимальный размер загружаемого файла
+func (s *FileService) MaxFileSize() int64 {
+	return maxFileSize
+}
+
+// UploadStream загружает файл из потока, не буферизуя его целиком в памяти.
+// sizeHint - ожидаемый размер файла (0, если неизвестен); фактический размер
+// и контрольная сумма вычисляются по мере чтения потока
+func (s *FileService) UploadStream(
+	ctx context.Context,
+	fileName string,
+	contentType string,
+	body io.Reader,
+	sizeHint int64,
+	folderID int64,
+	userID string,
+	note VersionNote,
+	policy domain.ConflictPolicy,
+) (*domain.File, error) {
+	if body == nil {
+		return nil, fmt.Errorf("%w: missing required parameters", errInvalidFile)
+	}
+	if err := validateVersionNote(note); err != nil {
+		return nil, err
+	}
+
+	target, err := s.PrepareUpload(ctx, fileName, sizeHint, folderID, userID, policy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check available space: %w", err)
+		return nil, err
 	}
+	target.Note = note
 
-	if !spaceAvailable {
-		return nil, fmt.Errorf("not enough storage space available")
+	// Квоту повторно проверяем по фактическому размеру до завершения загрузки,
+	// чтобы не перезаписать существующую версию файлом, который не поместится
+	validate := func(result *s3.StreamResult) error {
+		if result.Size <= sizeHint {
+			return nil
+		}
+		spaceAvailable, err := s.quotaService.CheckSpaceAvailable(ctx, userID, result.Size)
+		if err != nil {
+			return fmt.Errorf("failed to check available space: %w", err)
+		}
+		if !spaceAvailable {
+			return fmt.Errorf("not enough storage space available")
+		}
+		return nil
 	}
 
+	result, err := s3.UploadStream(ctx, s.s3Client, target.S3Key, body, chunkSize, maxFileSize, validate)
+	if err != nil {
+		if errors.Is(err, s3.ErrStreamTooLarge) {
+			return nil, fmt.Errorf("%w: max size is %d bytes", errFileTooLarge, maxFileSize)
+		}
+		if strings.Contains(err.Error(), "storage space") {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	return s.CommitUpload(ctx, target, fileName, contentType, result.Size, result.SHA256, userID)
+}
+
+// PrepareUpload проверяет квоту и права на загрузку и определяет,
+// будет ли создан новый файл или новая версия существующего.
+// Окончательно конфликт имени разрешается при регистрации файла в CommitUpload
+func (s *FileService) PrepareUpload(
+	ctx context.Context,
+	fileName string,
+	size int64,
+	folderID int64,
+	userID string,
+	policy domain.ConflictPolicy,
+) (*UploadTarget, error) {
 	// Проверяем входные параметры
-	if header == nil || file == nil || userID == "" {
+	if fileName == "" || userID == "" {
 		return nil, fmt.Errorf("%w: missing required parameters", errInvalidFile)
 	}
 
+	// Проверяем наличие свободного места
+	spaceAvailable, err := s.quotaService.CheckSpaceAvailable(ctx, userID, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check available space: %w", err)
+	}
+
+	if !spaceAvailable {
+		return nil, fmt.Errorf("not enough storage space available")
+	}
+
 	// Проверяем размер файла
-	if header.Size > maxFileSize {
+	if size > maxFileSize {
 		return nil, fmt.Errorf("%w: max size is %d bytes", errFileTooLarge, maxFileSize)
 	}
 
@@ -130,14 +240,19 @@ func (s *FileService) UploadFile(
 	}
 
 	// Проверяем, существует ли файл с таким именем
-	existingFile, err := s.fileRepo.CheckFileExists(ctx, folderID, header.Filename)
+	existingFile, err := s.fileRepo.CheckFileExists(ctx, folderID, fileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check file existence: %w", err)
 	}
 
 	// Если файл существует и у пользователя есть права на редактирование,
-	// создаем новую версию
+	// будет создана новая версия или существующий файл будет заменен
 	if existingFile != nil {
+		if policy != domain.ConflictPolicyVersion && policy != domain.ConflictPolicyReplace && policy != domain.ConflictPolicyRename {
+			return nil, fmt.Errorf("file with name %s already exists in target folder", fileName)
+		}
+	}
+	if existingFile != nil && policy != domain.ConflictPolicyRename {
 		hasPermission, err := s.permissionService.CheckSharedFolderPermission(
 			ctx,
 			userID,
@@ -150,30 +265,119 @@ func (s *FileService) UploadFile(
 		if !hasPermission && existingFile.OwnerID != userID {
 			return nil, errAccessDenied
 		}
-		return s.createFileVersion(ctx, file, header, existingFile, folder.OwnerID)
+
+		if policy == domain.ConflictPolicyVersion {
+			return &UploadTarget{
+				FolderID:     folderID,
+				OwnerID:      folder.OwnerID,
+				FileUUID:     existingFile.UUID,
+				S3Key:        versionS3Key(folder.OwnerID, existingFile.UUID),
+				ExistingFile: existingFile,
+				Policy:       policy,
+			}, nil
+		}
 	}
 
 	// Создаем новый файл
 	fileUUID := uuid.New()
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", folder.OwnerID, fileUUID.String())
+	return &UploadTarget{
+		FolderID: folderID,
+		OwnerID:  folder.OwnerID,
+		FileUUID: fileUUID,
+		S3Key:    fileS3Key(folder.OwnerID, fileUUID),
+		Policy:   policy,
+	}, nil
+}
+
+// CommitUpload регистрирует в БД файл, содержимое которого уже сохранено
+// в хранилище по ключу target.S3Key. Конфликт имени разрешается по target.Policy
+// в той же транзакции, в которой создается файл
+func (s *FileService) CommitUpload(
+	ctx context.Context,
+	target *UploadTarget,
+	fileName string,
+	contentType string,
+	size int64,
+	checksum string,
+	userID string,
+) (*domain.File, error) {
+	var file *domain.File
+	err := repository.RunInTx(ctx, s.fileRepo.GetDB(), func(ctx context.Context) error {
+		var err error
+		file, err = s.commitUpload(ctx, target, fileName, contentType, size, checksum, userID)
+		return err
+	})
+	if err != nil {
+		// При ошибке удаляем загруженное содержимое. Общие объекты удаляет только сборщик
+		if !isBlobS3Key(target.S3Key) {
+			if deleteErr := s.s3Client.DeleteObject(target.S3Key); deleteErr != nil {
+				log.Printf("failed to delete file from s3 after db error: %v", deleteErr)
+			}
+		}
+		return nil, err
+	}
+
+	// Файл учитывается в квоте владельца папки, а не загрузившего его пользователя
+	if err := s.quotaService.UpdateUsedSpace(ctx, target.OwnerID); err != nil {
+		log.Printf("Failed to update used space: %v", err)
+	}
+
+	s.activityService.RecordFile(ctx, userID, file.UUID, domain.ActivityUpload)
+	return file, nil
+}
+
+// commitUpload создает файл или новую версию существующего внутри транзакции CommitUpload
+func (s *FileService) commitUpload(
+	ctx context.Context,
+	target *UploadTarget,
+	fileName string,
+	contentType string,
+	size int64,
+	checksum string,
+	userID string,
+) (*domain.File, error) {
+	name, existingFile, err := s.fileRepo.ResolveNameConflict(ctx, target.FolderID, filepath.Clean(fileName), target.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingFile != nil {
+		return s.createFileVersion(ctx, existingFile, &domain.FileVersion{
+			S3Key:      target.S3Key,
+			SizeBytes:  size,
+			SHA256:     optionalChecksum(checksum),
+			UploadedBy: optionalString(userID),
+			Label:      optionalString(target.Note.Label),
+			Comment:    optionalString(target.Note.Comment),
+		})
+	}
 
-	// Определяем тип контента
-	contentType := header.Header.Get("Content-Type")
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
+	// Файл, для которого готовилась новая версия, мог быть удален после начала загрузки
+	fileUUID := target.FileUUID
+	if target.ExistingFile != nil {
+		fileUUID = uuid.New()
+	}
+
 	// Создаем новую запись о файле
 	newFile := &domain.File{
 		UUID:           fileUUID,
-		Name:           filepath.Clean(header.Filename),
+		Name:           name,
 		MIMEType:       contentType,
-		SizeBytes:      header.Size,
-		FolderID:       folderID,
-		OwnerID:        folder.OwnerID, // Владельцем будет владелец папки
+		SizeBytes:      size,
+		FolderID:       target.FolderID,
+		OwnerID:        target.OwnerID, // Владельцем будет владелец папки
 		CurrentVersion: 1,
 	}
 
+	// Создаем запись в БД
+	if err := s.fileRepo.Create(ctx, newFile); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDatabaseError, err)
+	}
+
 	// Начинаем транзакцию
 	tx, err := s.fileRepo.BeginTx(ctx)
 	if err != nil {
@@ -181,30 +385,24 @@ func (s *FileService) UploadFile(
 	}
 	defer tx.Rollback()
 
-	// Загружаем файл в S3
-	filePtr := &file
-	if err := s.s3Client.UploadFile(s3Key, filePtr); err != nil {
-		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
-	}
-
-	// Создаем запись в БД
-	if err := s.fileRepo.Create(ctx, newFile); err != nil {
-		// При ошибке удаляем файл из S3
-		if deleteErr := s.s3Client.DeleteObject(s3Key); deleteErr != nil {
-			log.Printf("failed to delete file from s3 after db error: %v", deleteErr)
-		}
-		return nil, fmt.Errorf("%w: %v", errDatabaseError, err)
-	}
-
 	// Создаем версию файла
 	version := &domain.FileVersion{
 		FileUUID:      fileUUID,
 		VersionNumber: 1,
-		S3Key:         s3Key,
-		SizeBytes:     header.Size,
+		S3Key:         target.S3Key,
+		SizeBytes:     size,
+		SHA256:        optionalChecksum(checksum),
+		UploadedBy:    optionalString(userID),
+		Label:         optionalString(target.Note.Label),
+		Comment:       optionalString(target.Note.Comment),
+	}
+
+	stagingKey, err := s.blobService.Attach(ctx, tx.Tx, newFile.OwnerID, version)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.fileRepo.CreateFileVersion(ctx, tx, version); err != nil {
+	if err := s.fileRepo.CreateFileVersion(ctx, tx.Tx, version); err != nil {
 		return nil, fmt.Errorf("failed to create file version: %w", err)
 	}
 
@@ -213,11 +411,7 @@ func (s *FileService) UploadFile(
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// После успешной загрузки обновляем использованное пространство
-	if err := s.quotaService.UpdateUsedSpace(ctx, userID); err != nil {
-		log.Printf("Failed to update used space: %v", err)
-	}
-
+	repository.AfterCommit(ctx, func() { s.deleteStagingObject(stagingKey) })
 	return newFile, nil
 }
 
@@ -230,7 +424,7 @@ func (s *FileService) DownloadFile(ctx context.Context, fileUUID uuid.UUID, user
 	}
 
 	// Теперь, когда доступ проверен, скачиваем файл
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", file.OwnerID, fileUUID.String())
+	s3Key := s.currentS3Key(ctx, file)
 	body, err := s.s3Client.GetObject(ctx, s3Key)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
@@ -289,8 +483,12 @@ func (s *FileService) DeleteFile(ctx context.Context, fileUUID uuid.UUID, userID
 		return fmt.Errorf("failed to get file versions: %w", err)
 	}
 
-	// Удаляем все версии из S3
+	// Удаляем все версии из S3. Общие объекты удаляет сборщик,
+	// когда на них не остается ссылок
 	for _, version := range versions {
+		if isBlobS3Key(version.S3Key) {
+			continue
+		}
 		if err := s.s3Client.DeleteObject(version.S3Key); err != nil {
 			log.Printf("warning: failed to delete version %d from S3: %v", version.VersionNumber, err)
 		}
@@ -315,13 +513,13 @@ func (s *FileService) DeleteFile(ctx context.Context, fileUUID uuid.UUID, userID
 	return nil
 }
 
-// createFileVersion создает новую версию существующего файла
+// createFileVersion создает новую версию существующего файла, содержимое
+// которой уже загружено в хранилище. В newVersion заполняются содержимое
+// и описание версии, номер назначается автоматически
 func (s *FileService) createFileVersion(
 	ctx context.Context,
-	file multipart.File,
-	header *multipart.FileHeader,
 	existingFile *domain.File,
-	ownerID string,
+	newVersion *domain.FileVersion,
 ) (*domain.File, error) {
 	// Начинаем транзакцию
 	tx, err := s.fileRepo.BeginTx(ctx)
@@ -330,35 +528,24 @@ func (s *FileService) createFileVersion(
 	}
 	defer tx.Rollback()
 
-	// Формируем ключ для S3
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, existingFile.UUID)
-
 	// Создаем новую версию в БД
-	newVersion := &domain.FileVersion{
-		FileUUID:      existingFile.UUID,
-		VersionNumber: existingFile.CurrentVersion + 1,
-		S3Key:         s3Key,
-		SizeBytes:     header.Size,
-	}
+	newVersion.FileUUID = existingFile.UUID
+	newVersion.VersionNumber = existingFile.CurrentVersion + 1
 
-	// Загружаем файл в S3
-	filePtr := &file
-	if err := s.s3Client.UploadFile(s3Key, filePtr); err != nil {
-		return nil, fmt.Errorf("failed to upload file: %w", err)
+	// Одинаковое содержимое хранится в одном общем объекте
+	stagingKey, err := s.blobService.Attach(ctx, tx.Tx, existingFile.OwnerID, newVersion)
+	if err != nil {
+		return nil, err
 	}
 
 	// Создаем запись о версии
-	if err := s.fileRepo.CreateFileVersion(ctx, tx, newVersion); err != nil {
-		// При ошибке удаляем файл из S3
-		if deleteErr := s.s3Client.DeleteObject(s3Key); deleteErr != nil {
-			log.Printf("failed to delete file from s3 after version creation error: %v", deleteErr)
-		}
+	if err := s.fileRepo.CreateFileVersion(ctx, tx.Tx, newVersion); err != nil {
 		return nil, fmt.Errorf("failed to create file version: %w", err)
 	}
 
 	// Обновляем информацию о файле
 	existingFile.CurrentVersion++
-	existingFile.SizeBytes = header.Size
+	existingFile.SizeBytes = newVersion.SizeBytes
 	if err := s.fileRepo.Update(ctx, existingFile); err != nil {
 		return nil, fmt.Errorf("failed to update file: %w", err)
 	}
@@ -368,9 +555,74 @@ func (s *FileService) createFileVersion(
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	repository.AfterCommit(ctx, func() { s.deleteStagingObject(stagingKey) })
 	return existingFile, nil
 }
 
+// deleteStagingObject удаляет временный объект загрузки, содержимое
+// которого уже перенесено в общий объект
+func (s *FileService) deleteStagingObject(key string) {
+	if key == "" {
+		return
+	}
+	if err := s.s3Client.DeleteObject(key); err != nil {
+		log.Printf("Warning: failed to delete staging object %s: %v", key, err)
+	}
+}
+
+// fileS3Key возвращает ключ объекта первой версии файла.
+// Файлы, загруженные до хранения версий под отдельными ключами, целиком лежат по этому ключу
+func fileS3Key(ownerID string, fileUUID uuid.UUID) string {
+	return fmt.Sprintf("personal_drive_files/%s/%s", ownerID, fileUUID.String())
+}
+
+// versionS3Key возвращает уникальный ключ для содержимого новой версии файла,
+// чтобы загрузка не перезаписывала предыдущие версии
+func versionS3Key(ownerID string, fileUUID uuid.UUID) string {
+	return fmt.Sprintf("personal_drive_files/%s/versions/%s_%s", ownerID, fileUUID.String(), uuid.New().String())
+}
+
+// previewS3Key возвращает ключ закэшированного превью версии файла
+func previewS3Key(ownerID string, fileUUID uuid.UUID, version int) string {
+	return fmt.Sprintf("personal_drive_files/%s/previews/%s_v%d", ownerID, fileUUID.String(), version)
+}
+
+// currentS3Key возвращает ключ объекта с содержимым текущей версии файла
+func (s *FileService) currentS3Key(ctx context.Context, file *domain.File) string {
+	version, err := s.fileRepo.GetVersion(ctx, file.UUID, file.CurrentVersion)
+	if err != nil {
+		return fileS3Key(file.OwnerID, file.UUID)
+	}
+	return version.S3Key
+}
+
+// optionalChecksum возвращает nil для неизвестной контрольной суммы
+func optionalChecksum(checksum string) *string {
+	if checksum == "" {
+		return nil
+	}
+	return &checksum
+}
+
+// optionalString возвращает nil для пустой строки
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// validateVersionNote проверяет длину метки и комментария версии
+func validateVersionNote(note VersionNote) error {
+	if len([]rune(note.Label)) > maxVersionLabelLength {
+		return fmt.Errorf("invalid version label: longer than %d characters", maxVersionLabelLength)
+	}
+	if len([]rune(note.Comment)) > maxVersionCommentLength {
+		return fmt.Errorf("invalid version comment: longer than %d characters", maxVersionCommentLength)
+	}
+	return nil
+}
+
 // getRootFolder получает или создает корневую папку пользователя
 func (s *FileService) getRootFolder(ctx context.Context, ownerID string) (*domain.Folder, error) {
 	rootFolder, err := s.folderRepo.GetRootFolder(ctx, ownerID)
@@ -445,85 +697,30 @@ func (s *FileService) GetFileInfo(ctx context.Context, fileUUID uuid.UUID, userI
 		return file, nil
 	}
 
-	// Проверяем прямой shared доступ к файлу
-	shares, err := s.shareRepo.GetSharesByResource(ctx, fileUUID.String(), domain.ResourceTypeFile)
+	// Проверяем shared доступ к файлу напрямую или через одну из родительских папок
+	allowed, err := s.permissionService.CheckFileViewPermission(ctx, userID, file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check shared access: %w", err)
 	}
-
-	// Проверяем все shares файла
-	for _, share := range shares {
-		// Проверяем срок действия share
-		if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-			continue
-		}
-
-		if share.Token != "" || strings.Contains(share.UserIDs, userID) {
-			return file, nil
-		}
-	}
-
-	// Получаем всю иерархию папок от текущей до корневой
-	var currentFolderID = file.FolderID
-	for currentFolderID != 0 {
-		folder, err := s.folderRepo.GetByID(ctx, currentFolderID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get folder: %w", err)
-		}
-
-		// Получаем все shares для текущей папки и всех её родителей
-		folderShares, err := s.shareRepo.GetSharesByResource(ctx, strconv.FormatInt(currentFolderID, 10), domain.ResourceTypeFolder)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check folder shares: %w", err)
-		}
-
-		for _, share := range folderShares {
-			if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-				continue
-			}
-
-			// Проверяем доступ. Если у пользователя есть доступ к любой папке в иерархии,
-			// значит у него есть доступ и к файлу
-			if share.Token != "" || strings.Contains(share.UserIDs, userID) {
-				// Важно! Проверяем путь файла относительно shared папки
-				sharedFolder, err := s.folderRepo.GetByID(ctx, currentFolderID)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get shared folder: %w", err)
-				}
-
-				fileFolder, err := s.folderRepo.GetByID(ctx, file.FolderID)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get file folder: %w", err)
-				}
-
-				// Проверяем, что путь к файлу начинается с пути shared папки
-				if strings.HasPrefix(fileFolder.Path, sharedFolder.Path) {
-					return file, nil
-				}
-			}
-		}
-
-		// Если папка корневая (parent_id = nil), прерываем цикл
-		if folder.ParentID == nil {
-			break
-		}
-		currentFolderID = *folder.ParentID
+	if allowed {
+		return file, nil
 	}
 
 	return nil, errAccessDenied
 }
 
+// AuthorizeDownload проверяет, что пользователь может скачать файл, и учитывает
+// скачивание по ссылке с лимитом
+func (s *FileService) AuthorizeDownload(ctx context.Context, file *domain.File, userID string) error {
+	return s.permissionService.AuthorizeFileDownload(ctx, userID, file)
+}
+
 // GetFileData изменить для поддержки записей
 func (s *FileService) GetFileData(ctx context.Context, fileUUID uuid.UUID, userID string) (io.Reader, error) {
-	// Получаем информацию о файле
-	file, err := s.fileRepo.GetByUUID(ctx, fileUUID)
+	// Получаем информацию о файле с проверкой доступа владельца и shared доступа
+	file, err := s.GetFileInfo(ctx, fileUUID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errFileNotFound, err)
-	}
-
-	// Проверяем доступ
-	if file.OwnerID != userID {
-		// Код проверки shared доступа...
+		return nil, err
 	}
 
 	// Проверяем, является ли файл записью видеоконференции
@@ -554,7 +751,7 @@ func (s *FileService) GetFileData(ctx context.Context, fileUUID uuid.UUID, userI
 	}
 
 	// Обычная логика получения файла...
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", file.OwnerID, fileUUID.String())
+	s3Key := s.currentS3Key(ctx, file)
 	data, err := s.s3Client.GetObject(ctx, s3Key)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
@@ -575,48 +772,6 @@ func (s *FileService) CheckFileExists(ctx context.Context, folderID int64, fileN
 	return s.fileRepo.CheckFileExists(ctx, folderID, fileName)
 }
 
-// UploadFileVersion в file_service.go
-func (s *FileService) UploadFileVersion(ctx context.Context, file multipart.File, header *multipart.FileHeader,
-	existingFile *domain.File, ownerID string) error {
-
-	// Начинаем транзакцию
-	tx, err := s.fileRepo.BeginTx(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, existingFile.UUID)
-	filePtr := &file
-
-	// Удаляем старое превью с использованием транзакции
-	previewKey := fmt.Sprintf("previews/%s", existingFile.UUID.String())
-	if err := s.s3Client.DeleteObject(previewKey); err != nil {
-		log.Printf("Warning: failed to delete old preview from S3: %v", err)
-	}
-
-	if err := s.fileRepo.DeletePreview(ctx, tx, existingFile.UUID); err != nil {
-		log.Printf("Warning: failed to delete preview record: %v", err)
-	}
-
-	existingFile.SizeBytes = header.Size
-	existingFile.CurrentVersion++
-	if err := s.fileRepo.Update(ctx, existingFile); err != nil {
-		return fmt.Errorf("failed to update DB: %w", err)
-	}
-
-	if err := s.s3Client.UploadFile(s3Key, filePtr); err != nil {
-		return fmt.Errorf("failed to upload: %w", err)
-	}
-
-	// Фиксируем транзакцию
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
-}
-
 // uploadFileParallel реализует параллельную загрузку файла чанками
 func (s *FileService) uploadFileParallel(ctx context.Context, file multipart.File, s3Key string, totalSize int64) error {
 	// Рассчитываем количество чанков
@@ -686,7 +841,7 @@ func (s *FileService) DeleteVersion(ctx context.Context, fileUUID uuid.UUID, ver
 	defer tx.Rollback()
 
 	// Проверяем, не является ли это текущей версией
-	currentVersion, err := s.fileRepo.GetCurrentVersion(ctx, tx, fileUUID)
+	currentVersion, err := s.fileRepo.GetCurrentVersion(ctx, tx.Tx, fileUUID)
 	if err != nil {
 		return fmt.Errorf("failed to get current version: %w", err)
 	}
@@ -696,7 +851,7 @@ func (s *FileService) DeleteVersion(ctx context.Context, fileUUID uuid.UUID, ver
 	}
 
 	// Помечаем версию как удаленную
-	err = s.fileRepo.DeleteVersion(ctx, tx, fileUUID, versionNumber)
+	err = s.fileRepo.DeleteVersion(ctx, tx.Tx, fileUUID, versionNumber)
 	if err != nil {
 		return fmt.Errorf("failed to mark version as deleted: %w", err)
 	}
@@ -704,9 +859,153 @@ func (s *FileService) DeleteVersion(ctx context.Context, fileUUID uuid.UUID, ver
 	return tx.Commit()
 }
 
-// GetFileVersions возвращает все версии файла
+// GetFileVersions возвращает все версии файла вместе с данными их авторов
 func (s *FileService) GetFileVersions(ctx context.Context, fileUUID uuid.UUID) ([]domain.FileVersion, error) {
-	return s.fileRepo.GetFileVersions(ctx, fileUUID)
+	versions, err := s.fileRepo.GetFileVersions(ctx, fileUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if version.UploadedBy != nil {
+			userIDs = append(userIDs, *version.UploadedBy)
+		}
+	}
+
+	// История версий полезна и без имен, поэтому ошибку сервиса авторизации не возвращаем
+	users, err := auth.GetUsersByIds(ctx, userIDs)
+	if err != nil {
+		log.Printf("[FileService] Failed to get version authors: %v", err)
+		return versions, nil
+	}
+
+	authors := make(map[string]*domain.VersionAuthor, len(users))
+	for _, user := range users {
+		authors[user.ID] = &domain.VersionAuthor{
+			ID:       user.ID,
+			Email:    user.Email,
+			Name:     user.Name,
+			Lastname: user.Lastname,
+			Photo:    user.Photo,
+		}
+	}
+	for i := range versions {
+		if versions[i].UploadedBy != nil {
+			versions[i].Uploader = authors[*versions[i].UploadedBy]
+		}
+	}
+
+	return versions, nil
+}
+
+// UpdateVersionNote изменяет метку и комментарий версии файла.
+// nil оставляет поле без изменений, пустая строка очищает его
+func (s *FileService) UpdateVersionNote(ctx context.Context, fileUUID uuid.UUID, versionNumber int, label, comment *string, userID string) (*domain.FileVersion, error) {
+	file, err := s.GetFileInfo(ctx, fileUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.OwnerID != userID {
+		hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, file.FolderID, OperationEdit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check edit permissions: %w", err)
+		}
+		if !hasPermission {
+			return nil, errAccessDenied
+		}
+	}
+
+	version, err := s.fileRepo.GetVersion(ctx, fileUUID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if label != nil {
+		version.Label = optionalString(strings.TrimSpace(*label))
+	}
+	if comment != nil {
+		version.Comment = optionalString(strings.TrimSpace(*comment))
+	}
+
+	note := VersionNote{}
+	if version.Label != nil {
+		note.Label = *version.Label
+	}
+	if version.Comment != nil {
+		note.Comment = *version.Comment
+	}
+	if err := validateVersionNote(note); err != nil {
+		return nil, err
+	}
+
+	if err := s.fileRepo.UpdateVersionNote(ctx, version); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// RestoreVersion делает указанную версию файла текущей. История остается
+// только дописываемой: создается новая версия, ссылающаяся на содержимое старой
+func (s *FileService) RestoreVersion(ctx context.Context, fileUUID uuid.UUID, versionNumber int, userID string) (*domain.File, error) {
+	file, err := s.GetFileInfo(ctx, fileUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Восстановление версии меняет содержимое файла, поэтому нужны права на редактирование
+	if file.OwnerID != userID {
+		hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, file.FolderID, OperationEdit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check edit permissions: %w", err)
+		}
+		if !hasPermission {
+			return nil, errAccessDenied
+		}
+	}
+
+	if versionNumber == file.CurrentVersion {
+		return nil, fmt.Errorf("invalid version: version %d is already current", versionNumber)
+	}
+
+	version, err := s.GetAvailableVersion(ctx, file, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// Проверяем, хватит ли места, если восстановленная версия больше текущей
+	if delta := version.SizeBytes - file.SizeBytes; delta > 0 {
+		spaceAvailable, err := s.quotaService.CheckSpaceAvailable(ctx, file.OwnerID, delta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check available space: %w", err)
+		}
+		if !spaceAvailable {
+			return nil, fmt.Errorf("not enough storage space available")
+		}
+	}
+
+	restored, err := s.createFileVersion(ctx, file, &domain.FileVersion{
+		S3Key:      version.S3Key,
+		SizeBytes:  version.SizeBytes,
+		SHA256:     version.SHA256,
+		UploadedBy: optionalString(userID),
+		Comment:    optionalString(fmt.Sprintf("Восстановлено из версии %d", versionNumber)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Превью кэшируется по номеру версии: у восстановленной версии новый номер,
+	// а превью прежних версий остаются верными, поэтому сбрасывать кэш не нужно
+
+	if err := s.quotaService.UpdateUsedSpace(ctx, restored.OwnerID); err != nil {
+		log.Printf("Failed to update used space: %v", err)
+	}
+
+	log.Printf("[FileService] File %s: version %d restored as version %d", fileUUID, versionNumber, restored.CurrentVersion)
+	return restored, nil
 }
 
 // GetBasicFileInfo получает базовую информацию о файле без проверки прав доступа
@@ -718,6 +1017,50 @@ func (s *FileService) GetBasicFileInfo(ctx context.Context, fileUUID uuid.UUID)
 	return file, nil
 }
 
+// GetAvailableVersion возвращает версию файла, содержимое которой сохранилось в хранилище.
+// Доступ к самому файлу должен быть проверен вызывающей стороной
+func (s *FileService) GetAvailableVersion(ctx context.Context, file *domain.File, versionNumber int) (*domain.FileVersion, error) {
+	version, err := s.fileRepo.GetVersion(ctx, file.UUID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if !version.ContentAvailable {
+		return nil, fmt.Errorf("version %d content is no longer available", versionNumber)
+	}
+
+	return version, nil
+}
+
+// GetFileVersionDataDirect получает данные указанной версии файла без проверки прав доступа.
+// Нулевой номер версии означает текущую версию
+func (s *FileService) GetFileVersionDataDirect(ctx context.Context, fileUUID uuid.UUID, versionNumber int) (io.Reader, error) {
+	if versionNumber == 0 {
+		return s.GetFileDataDirect(ctx, fileUUID)
+	}
+
+	file, err := s.fileRepo.GetByUUID(ctx, fileUUID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFileNotFound, err)
+	}
+
+	if versionNumber == file.CurrentVersion {
+		return s.GetFileDataDirect(ctx, fileUUID)
+	}
+
+	version, err := s.GetAvailableVersion(ctx, file, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.s3Client.GetObject(ctx, version.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	return data, nil
+}
+
 // GetFileDataDirect получает данные файла напрямую из S3 без проверки прав доступа
 func (s *FileService) GetFileDataDirect(ctx context.Context, fileUUID uuid.UUID) (io.Reader, error) {
 	file, err := s.fileRepo.GetByUUID(ctx, fileUUID)
@@ -739,7 +1082,7 @@ func (s *FileService) GetFileDataDirect(ctx context.Context, fileUUID uuid.UUID)
 
 	// Если путь не найден в метаданных, используем стандартный путь
 	if s3Key == "" {
-		s3Key = fmt.Sprintf("personal_drive_files/%s/%s", file.OwnerID, fileUUID.String())
+		s3Key = s.currentS3Key(ctx, file)
 		log.Printf("[FileService] Используем стандартный путь для получения файла: %s", s3Key)
 	}
 
@@ -804,7 +1147,7 @@ func (s *FileService) CreateContextFile(ctx context.Context, file multipart.File
 	fileUUID := uuid.New()
 
 	// Формируем ключ для S3
-	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", userID, fileUUID.String())
+	s3Key := fileS3Key(userID, fileUUID)
 
 	// Определяем тип контента
 	contentType := header.Header.Get("Content-Type")
@@ -851,9 +1194,10 @@ func (s *FileService) CreateContextFile(ctx context.Context, file multipart.File
 		VersionNumber: 1,
 		S3Key:         s3Key,
 		SizeBytes:     header.Size,
+		UploadedBy:    optionalString(userID),
 	}
 
-	if err := s.fileRepo.CreateFileVersion(ctx, tx, version); err != nil {
+	if err := s.fileRepo.CreateFileVersion(ctx, tx.Tx, version); err != nil {
 		return nil, fmt.Errorf("failed to create file version: %w", err)
 	}
 
@@ -883,7 +1227,13 @@ func (r *readCloser) Close() error {
 
 // GetFileDataRange получает диапазон данных файла для потокового воспроизведения
 func (s *FileService) GetFileDataRange(ctx context.Context, fileUUID uuid.UUID, userID string, start, end int64) (io.ReadCloser, error) {
-	log.Printf("[FileService] Запрос диапазона для файла %s (диапазон: %d-%d)", fileUUID, start, end)
+	return s.GetFileVersionDataRange(ctx, fileUUID, userID, 0, start, end)
+}
+
+// GetFileVersionDataRange возвращает диапазон байт указанной версии файла.
+// Нулевой номер версии означает текущую версию
+func (s *FileService) GetFileVersionDataRange(ctx context.Context, fileUUID uuid.UUID, userID string, versionNumber int, start, end int64) (io.ReadCloser, error) {
+	log.Printf("[FileService] Запрос диапазона для файла %s (версия: %d, диапазон: %d-%d)", fileUUID, versionNumber, start, end)
 	startTime := time.Now()
 
 	// Получаем информацию о файле
@@ -895,15 +1245,36 @@ func (s *FileService) GetFileDataRange(ctx context.Context, fileUUID uuid.UUID,
 		return nil, fmt.Errorf("ошибка получения информации о файле: %w", err)
 	}
 
-	// Проверяем корректность диапазона
-	if start < 0 {
-		start = 0
+	// Данные файла отдаются только с правом на скачивание
+	if err := s.permissionService.AuthorizeFileDownload(ctx, userID, file); err != nil {
+		return nil, fmt.Errorf("доступ запрещен: %w", err)
 	}
-	if end >= file.SizeBytes {
-		end = file.SizeBytes - 1
+
+	if versionNumber != 0 && versionNumber != file.CurrentVersion {
+		version, err := s.GetAvailableVersion(ctx, file, versionNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		start, end, err = clampRange(start, end, version.SizeBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := s.s3Client.GetObjectRange(ctx, version.S3Key, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения данных из S3: %w", err)
+		}
+
+		log.Printf("[FileService] Диапазон версии %d успешно получен. Размер: %d байт. Время: %v",
+			versionNumber, end-start+1, time.Since(startTime))
+		return newBufferedReadCloser(data), nil
 	}
-	if start > end {
-		return nil, fmt.Errorf("некорректный диапазон: start=%d, end=%d", start, end)
+
+	// Проверяем корректность диапазона
+	start, end, err = clampRange(start, end, file.SizeBytes)
+	if err != nil {
+		return nil, err
 	}
 
 	// Проверяем метаданные файла для определения пути к файлу в S3
@@ -920,7 +1291,7 @@ func (s *FileService) GetFileDataRange(ctx context.Context, fileUUID uuid.UUID,
 
 	// Если путь не найден в метаданных, используем стандартный путь
 	if s3Key == "" {
-		s3Key = fmt.Sprintf("personal_drive_files/%s/%s", file.OwnerID, fileUUID.String())
+		s3Key = s.currentS3Key(ctx, file)
 		log.Printf("[FileService] Используем стандартный путь: %s", s3Key)
 	}
 
@@ -970,22 +1341,39 @@ func (s *FileService) GetFileDataRange(ctx context.Context, fileUUID uuid.UUID,
 		}
 	}
 
+	log.Printf("[FileService] Диапазон успешно получен. Размер: %d байт. Время: %v",
+		end-start+1, time.Since(startTime))
+
+	return newBufferedReadCloser(data), nil
+}
+
+// clampRange ограничивает диапазон размером содержимого
+func clampRange(start, end, size int64) (int64, int64, error) {
+	if start < 0 {
+		start = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("некорректный диапазон: start=%d, end=%d", start, end)
+	}
+	return start, end, nil
+}
+
+// newBufferedReadCloser оборачивает данные из S3 в буферизированный reader
+func newBufferedReadCloser(data io.ReadCloser) io.ReadCloser {
 	// Создаем буферизированный reader для оптимизации производительности
 	bufferedReader := bufio.NewReaderSize(data, 32*1024) // 32KB буфер
 
 	// Оборачиваем в ReadCloser для корректного закрытия
-	result := &struct {
+	return &struct {
 		*bufio.Reader
 		io.Closer
 	}{
 		Reader: bufferedReader,
 		Closer: data,
 	}
-
-	log.Printf("[FileService] Диапазон успешно получен. Размер: %d байт. Время: %v",
-		end-start+1, time.Since(startTime))
-
-	return result, nil
 }
 
 const (
@@ -1183,11 +1571,12 @@ func (s *FileService) RenameFile(ctx context.Context, fileUUID uuid.UUID, newNam
 		return fmt.Errorf("failed to update file name: %w", err)
 	}
 
+	s.activityService.RecordFile(ctx, userID, fileUUID, domain.ActivityRename)
 	return nil
 }
 
 // MoveFile перемещает файл в другую папку
-func (s *FileService) MoveFile(ctx context.Context, fileUUID uuid.UUID, newFolderID int64, userID string) error {
+func (s *FileService) MoveFile(ctx context.Context, fileUUID uuid.UUID, newFolderID int64, policy domain.ConflictPolicy, userID string) error {
 	// Получаем информацию о файле
 	file, err := s.GetFileInfo(ctx, fileUUID, userID)
 	if err != nil {
@@ -1239,26 +1628,27 @@ func (s *FileService) MoveFile(ctx context.Context, fileUUID uuid.UUID, newFolde
 		return fmt.Errorf("access denied for target folder")
 	}
 
-	// Проверяем, нет ли файла с таким именем в целевой папке
-	existingFile, err := s.fileRepo.CheckFileExists(ctx, newFolderID, file.Name)
-	if err != nil {
-		return fmt.Errorf("failed to check file existence: %w", err)
-	}
-	if existingFile != nil {
-		return fmt.Errorf("file with name %s already exists in target folder", file.Name)
-	}
-
-	// Начинаем транзакцию
-	tx, err := s.fileRepo.BeginTx(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	// Замена или новая версия существующего файла требуют прав на редактирование
+	if file.OwnerID != userID && (policy == domain.ConflictPolicyVersion || policy == domain.ConflictPolicyReplace) {
+		existingFile, err := s.fileRepo.CheckFileExists(ctx, newFolderID, file.Name)
+		if err != nil {
+			return fmt.Errorf("failed to check file existence: %w", err)
+		}
+		if existingFile != nil {
+			hasPermission, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, newFolderID, OperationEdit)
+			if err != nil {
+				return fmt.Errorf("failed to check edit permissions: %w", err)
+			}
+			if !hasPermission {
+				return fmt.Errorf("access denied for target folder")
+			}
+		}
 	}
-	defer tx.Rollback()
 
-	// Обновляем папку файла
-	if err := s.fileRepo.UpdateFileFolder(ctx, tx, fileUUID, newFolderID, file.FolderID); err != nil {
+	// Конфликт имени разрешается в репозитории под блокировкой имен целевой папки
+	if err := s.fileRepo.MoveFile(ctx, fileUUID, newFolderID, policy); err != nil {
 		return fmt.Errorf("failed to move file: %w", err)
 	}
 
-	return tx.Commit()
+	return nil
 }
@@ -13,18 +13,24 @@ import (
 type FolderService struct {
 	folderRepo        *repository.FolderRepository
 	fileRepo          *repository.FileRepository
+	tagRepo           *repository.TagRepository
 	permissionService *PermissionService
+	activityService   *ActivityService
 }
 
 func NewFolderService(
 	folderRepo *repository.FolderRepository,
 	fileRepo *repository.FileRepository,
+	tagRepo *repository.TagRepository,
 	permissionService *PermissionService,
+	activityService *ActivityService,
 ) *FolderService {
 	return &FolderService{
 		folderRepo:        folderRepo,
 		fileRepo:          fileRepo,
+		tagRepo:           tagRepo,
 		permissionService: permissionService,
+		activityService:   activityService,
 	}
 }
 
@@ -90,7 +96,8 @@ func (s *FolderService) CreateFolder(ctx context.Context, name string, parentID
 	return newFolder, nil
 }
 
-func (s *FolderService) GetFolderContent(ctx context.Context, folderID int64, userID string) (*domain.FolderContent, error) {
+// GetFolderContent возвращает страницу содержимого папки согласно opts
+func (s *FolderService) GetFolderContent(ctx context.Context, folderID int64, userID string, opts domain.ListOptions) (*domain.FolderContent, error) {
 	log.Printf("GetFolderContent called for folder: %d, user: %s", folderID, userID)
 
 	if userID == "" {
@@ -98,12 +105,20 @@ func (s *FolderService) GetFolderContent(ctx context.Context, folderID int64, us
 		return nil, fmt.Errorf("user ID is required")
 	}
 
-	content, err := s.folderRepo.GetContent(ctx, folderID, userID)
+	content, err := s.folderRepo.GetContent(ctx, folderID, userID, opts)
 	if err != nil {
 		log.Printf("Error getting folder content: %v", err)
 		return nil, fmt.Errorf("failed to get folder content: %w", err)
 	}
 
+	// Метки и избранное видны только самому пользователю, в том числе в чужих папках
+	if err := s.tagRepo.LoadContentTags(ctx, userID, content); err != nil {
+		log.Printf("Error getting tags for folder %d: %v", folderID, err)
+	}
+	if err := s.activityService.LoadContentStars(ctx, userID, content); err != nil {
+		log.Printf("Error getting stars for folder %d: %v", folderID, err)
+	}
+
 	log.Printf("Successfully got folder content. Files: %d, Subfolders: %d",
 		len(content.Files), len(content.Folders))
 	return content, nil
@@ -214,11 +229,12 @@ func (s *FolderService) RenameFolder(ctx context.Context, folderID int64, newNam
 		return fmt.Errorf("failed to update folder name: %w", err)
 	}
 
+	s.activityService.RecordFolder(ctx, userID, folderID, domain.ActivityRename)
 	return nil
 }
 
 // MoveFolder перемещает папку
-func (s *FolderService) MoveFolder(ctx context.Context, folderID int64, newParentID int64, userID string) error {
+func (s *FolderService) MoveFolder(ctx context.Context, folderID int64, newParentID int64, policy domain.ConflictPolicy, userID string) error {
 	// Получаем информацию о перемещаемой папке
 	folder, err := s.folderRepo.GetByID(ctx, folderID)
 	if err != nil {
@@ -291,17 +307,8 @@ func (s *FolderService) MoveFolder(ctx context.Context, folderID int64, newParen
 		return fmt.Errorf("cannot move folder into its own subfolder")
 	}
 
-	// Проверяем, нет ли папки с таким именем в целевой папке
-	exists, err := s.folderRepo.CheckFolderExistsInParent(ctx, newParentID, folder.Name)
-	if err != nil {
-		return fmt.Errorf("failed to check folder existence: %w", err)
-	}
-	if exists {
-		return fmt.Errorf("folder with name %s already exists in target folder", folder.Name)
-	}
-
-	// Обновляем родительскую папку
-	if err := s.folderRepo.UpdateFolderParent(ctx, folderID, newParentID); err != nil {
+	// Обновляем родительскую папку, разрешая конфликт имени по политике
+	if err := s.folderRepo.UpdateFolderParent(ctx, folderID, newParentID, policy); err != nil {
 		return fmt.Errorf("failed to move folder: %w", err)
 	}
 
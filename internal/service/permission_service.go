@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"strconv"
-	"strings"
 	"synxrondrive/internal/domain"
 	"synxrondrive/internal/repository"
 	"time"
@@ -31,6 +30,10 @@ func NewPermissionService(
 	}
 }
 
+// downloadWindow - сколько после засчитанного скачивания файла по ссылке с лимитом
+// повторные запросы того же пользователя к файлу не расходуют лимит
+const downloadWindow = 30 * time.Minute
+
 // OperationType определяет тип операции
 type OperationType string
 
@@ -124,29 +127,28 @@ func (s *PermissionService) CheckPermission(
 		return true, nil
 	}
 
-	// Получаем все активные shares для ресурса
-	shares, err := s.shareRepo.GetSharesByResource(ctx, resourceID, resourceType)
+	// Получаем доступы пользователя по действующим ссылкам на ресурс
+	grants, err := s.shareRepo.GetRecipientGrants(ctx, userID, resourceID, resourceType)
 	if err != nil {
 		return false, fmt.Errorf("failed to get shares: %w", err)
 	}
 
-	// Проверяем каждый share
-	for _, share := range shares {
-		// Проверяем срок действия
-		if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
+	return s.anyGrantAllows(grants, operation), nil
+}
+
+// anyGrantAllows проверяет, разрешает ли операцию хотя бы одна из ссылок.
+// Скачивание по ссылкам только для просмотра запрещено, а по ссылкам с лимитом
+// разрешается только через AuthorizeFileDownload, который учитывает скачивания
+func (s *PermissionService) anyGrantAllows(grants []domain.ShareGrant, operation OperationType) bool {
+	for _, grant := range grants {
+		if operation == OperationDownload && (grant.PreviewOnly || grant.MaxDownloads != nil) {
 			continue
 		}
-
-		// Проверяем доступ пользователя к share
-		if share.Token != "" || strings.Contains(share.UserIDs, userID) {
-			// Проверяем уровень доступа для операции
-			if s.checkAccessLevel(share.AccessType, operation) {
-				return true, nil
-			}
+		if s.checkAccessLevel(grant.AccessType, operation) {
+			return true
 		}
 	}
-
-	return false, nil
+	return false
 }
 
 // CheckFolderTreePermission проверяет права доступа ко всей иерархии папок
@@ -200,56 +202,119 @@ func (s *PermissionService) CheckFolderTreePermission(
 	return true, nil
 }
 
+// CheckSharedFolderPermission проверяет права пользователя на папку по ссылкам
+// на нее саму и на ее родительские папки
 func (s *PermissionService) CheckSharedFolderPermission(
 	ctx context.Context,
 	userID string,
 	folderID int64,
 	operation OperationType,
 ) (bool, error) {
-	// Получаем иерархию папок до корневой shared папки
-	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	grants, err := s.shareRepo.GetFolderRecipientGrants(ctx, userID, folderID)
 	if err != nil {
-		return false, fmt.Errorf("failed to get folder: %w", err)
+		return false, fmt.Errorf("failed to get shares: %w", err)
 	}
 
-	currentFolderID := folder.ID
-	for currentFolderID != 0 {
-		// Получаем все shares для текущей папки
-		shares, err := s.shareRepo.GetSharesByResource(
-			ctx,
-			strconv.FormatInt(currentFolderID, 10),
-			domain.ResourceTypeFolder,
-		)
-		if err != nil {
-			return false, fmt.Errorf("failed to get shares: %w", err)
-		}
+	return s.anyGrantAllows(grants, operation), nil
+}
 
-		// Проверяем права доступа для каждого share
-		for _, share := range shares {
-			// Пропускаем просроченные shares
-			if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-				continue
-			}
+// CheckFileViewPermission проверяет право на просмотр файла: файл может быть
+// открыт пользователю напрямую или через одну из родительских папок
+func (s *PermissionService) CheckFileViewPermission(ctx context.Context, userID string, file *domain.File) (bool, error) {
+	if file.OwnerID == userID {
+		return true, nil
+	}
+	allowed, err := s.CheckPermission(ctx, userID, file.UUID.String(), domain.ResourceTypeFile, OperationView)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	return s.CheckSharedFolderPermission(ctx, userID, file.FolderID, OperationView)
+}
 
-			// Проверяем доступ пользователя к share
-			if share.Token != "" || strings.Contains(share.UserIDs, userID) {
-				// Проверяем уровень доступа для операции
-				if s.checkAccessLevel(share.AccessType, operation) {
-					return true, nil
-				}
-			}
-		}
+// AuthorizeFileDownload проверяет право на скачивание файла. Если скачать файл можно
+// только по ссылкам с лимитом, скачивание учитывается в одной из них один раз
+// за downloadWindow: докачка и перемотка в течение окна лимит не расходуют,
+// а без открытого окна после исчерпания лимита запрос отклоняется
+func (s *PermissionService) AuthorizeFileDownload(ctx context.Context, userID string, file *domain.File) error {
+	if file.OwnerID == userID {
+		return nil
+	}
 
-		// Переходим к родительской папке
-		if folder.ParentID == nil {
-			break
+	grants, err := s.shareRepo.GetRecipientGrants(ctx, userID, file.UUID.String(), domain.ResourceTypeFile)
+	if err != nil {
+		return fmt.Errorf("failed to get shares: %w", err)
+	}
+	folderGrants, err := s.shareRepo.GetFolderRecipientGrants(ctx, userID, file.FolderID)
+	if err != nil {
+		return fmt.Errorf("failed to get shares: %w", err)
+	}
+	grants = append(grants, folderGrants...)
+
+	if s.anyGrantAllows(grants, OperationDownload) {
+		return nil
+	}
+
+	limitReached := false
+	for _, grant := range grants {
+		if grant.PreviewOnly || grant.MaxDownloads == nil || !s.checkAccessLevel(grant.AccessType, OperationDownload) {
+			continue
 		}
-		currentFolderID = *folder.ParentID
-		folder, err = s.folderRepo.GetByID(ctx, currentFolderID)
+		allowed, err := s.shareRepo.ConsumeDownloadWindow(ctx, grant.ShareID, userID, file.UUID.String(), downloadWindow)
 		if err != nil {
-			return false, fmt.Errorf("failed to get parent folder: %w", err)
+			return err
 		}
+		if allowed {
+			return nil
+		}
+		limitReached = true
+	}
+
+	if limitReached {
+		return fmt.Errorf("access denied: download limit reached")
+	}
+	return fmt.Errorf("access denied")
+}
+
+// GetViewableFile возвращает файл не из корзины, если пользователь может его просматривать
+func (s *PermissionService) GetViewableFile(ctx context.Context, userID string, fileID string) (*domain.File, error) {
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file UUID")
+	}
+	file, err := s.fileRepo.GetByUUID(ctx, fileUUID)
+	if err != nil || file.DeletedAt != nil {
+		return nil, fmt.Errorf("file not found")
+	}
+
+	allowed, err := s.CheckFileViewPermission(ctx, userID, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
+	if !allowed {
+		return nil, fmt.Errorf("access denied")
+	}
+	return file, nil
+}
 
-	return false, nil
+// GetViewableFolder возвращает папку не из корзины, если пользователь может ее просматривать
+func (s *PermissionService) GetViewableFolder(ctx context.Context, userID string, folderID string) (*domain.Folder, error) {
+	id, err := strconv.ParseInt(folderID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+	folder, err := s.folderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("folder not found")
+	}
+
+	if folder.OwnerID != userID {
+		allowed, err := s.CheckSharedFolderPermission(ctx, userID, folder.ID, OperationView)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check permissions: %w", err)
+		}
+		if !allowed {
+			return nil, fmt.Errorf("access denied")
+		}
+	}
+	return folder, nil
 }
@@ -103,9 +103,10 @@ func (s *RecordingService) SaveRecording(ctx context.Context, req *pb.SaveRecord
 		VersionNumber: 1,
 		S3Key:         s3Path,
 		SizeBytes:     req.SizeBytes,
+		UploadedBy:    optionalString(req.UserId),
 	}
 
-	if err := s.fileRepo.CreateFileVersion(ctx, tx, version); err != nil {
+	if err := s.fileRepo.CreateFileVersion(ctx, tx.Tx, version); err != nil {
 		return nil, fmt.Errorf("failed to create file version: %w", err)
 	}
 
@@ -226,7 +227,7 @@ func (s *RecordingService) waitForRecordingFile(ctx context.Context, fileUUID uu
 			}
 
 			// Обновляем размер файла
-			if err := s.fileRepo.UpdateFileSize(ctx, tx, fileUUID, size); err != nil {
+			if err := s.fileRepo.UpdateFileSize(ctx, tx.Tx, fileUUID, size); err != nil {
 				tx.Rollback()
 				log.Printf("[RecordingService] Error updating file size: %v", err)
 				return
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"mime/multipart"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -46,11 +47,21 @@ func NewClient(conf *Config) (*Client, error) {
 		"",
 	))
 
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	region := conf.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
 	// Создаем клиента с кастомными настройками
 	client := s3.New(s3.Options{
-		BaseEndpoint:     aws.String("https://storage.yandexcloud.net"),
-		Region:           "ru-central1",
+		BaseEndpoint:     aws.String(endpoint),
+		Region:           region,
 		Credentials:      creds,
+		UsePathStyle:     conf.UsePathStyle,
 		RetryMode:        aws.RetryModeAdaptive,
 		RetryMaxAttempts: 3,
 	})
@@ -83,9 +94,9 @@ func (h *Client) UploadFile(key string, file *multipart.File) error {
 	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
 	defer cancel()
 
-	// Читаем файл в буфер
-	buf := bytes.NewBuffer(make([]byte, 0, defaultChunkSize))
-	if _, err := io.Copy(buf, *file); err != nil {
+	// multipart.File поддерживает Seek, поэтому передаем его в S3 напрямую,
+	// не копируя содержимое в память
+	if _, err := (*file).Seek(0, io.SeekStart); err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
@@ -93,7 +104,7 @@ func (h *Client) UploadFile(key string, file *multipart.File) error {
 	_, err := h.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(h.bucket),
 		Key:    aws.String(key),
-		Body:   bytes.NewReader(buf.Bytes()),
+		Body:   *file,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to upload file to S3: %w", err)
@@ -198,6 +209,31 @@ func (h *Client) DeleteObject(key string) error {
 	return nil
 }
 
+// CopyObject копирует объект внутри бакета без передачи данных через сервер
+func (h *Client) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	if srcKey == "" || dstKey == "" {
+		return fmt.Errorf("source and destination keys are required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+
+	_, err := h.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(h.bucket),
+		CopySource: aws.String(url.PathEscape(h.bucket + "/" + srcKey)),
+		Key:        aws.String(dstKey),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return fmt.Errorf("object not found: %s", srcKey)
+		}
+		return fmt.Errorf("failed to copy object in S3: %w", err)
+	}
+
+	return nil
+}
+
 // UploadBytes загружает байты в S3
 func (h *Client) UploadBytes(key string, data []byte) error {
 	if key == "" {
@@ -253,6 +289,26 @@ func (h *Client) UploadPart(ctx context.Context, uploadID string, key string, pa
 	return *result.ETag, nil
 }
 
+// UploadPartCopy загружает часть из диапазона другого объекта без передачи данных через сервер.
+// Границы диапазона включительные
+func (h *Client) UploadPartCopy(ctx context.Context, uploadID string, key string, partNumber int, srcKey string, start, end int64) (string, error) {
+	input := &s3.UploadPartCopyInput{
+		Bucket:          aws.String(h.bucket),
+		Key:             aws.String(key),
+		PartNumber:      aws.Int32(int32(partNumber)),
+		UploadId:        aws.String(uploadID),
+		CopySource:      aws.String(url.PathEscape(h.bucket + "/" + srcKey)),
+		CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+	}
+
+	result, err := h.client.UploadPartCopy(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+	}
+
+	return *result.CopyPartResult.ETag, nil
+}
+
 // CompleteMultipartUpload завершает загрузку по частям
 func (h *Client) CompleteMultipartUpload(ctx context.Context, uploadID string, key string, parts []CompletedPart) error {
 	var completedParts []types.CompletedPart
@@ -5,16 +5,50 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	// DriverS3 - S3-совместимое хранилище (Yandex Object Storage, MinIO и т.д.)
+	DriverS3 = "s3"
+	// DriverLocal - хранение объектов в локальной файловой системе
+	DriverLocal = "local"
+
+	defaultEndpoint  = "https://storage.yandexcloud.net"
+	defaultRegion    = "ru-central1"
+	defaultLocalRoot = "/tmp/storage"
+)
+
 type Config struct {
+	Driver          string `mapstructure:"Driver"`
 	AccessKeyID     string `mapstructure:"AccessKeyID"`
 	SecretAccessKey string `mapstructure:"SecretAccessKey"`
 	Bucket          string `mapstructure:"Bucket"`
+	Endpoint        string `mapstructure:"Endpoint"`
+	Region          string `mapstructure:"Region"`
+	UsePathStyle    bool   `mapstructure:"UsePathStyle"`
+	LocalRoot       string `mapstructure:"LocalRoot"`
+	// Шифрование объектов: пустая строка - выключено, local - ключи в EncryptionKeyDir
+	EncryptionProvider string `mapstructure:"EncryptionProvider"`
+	EncryptionKeyDir   string `mapstructure:"EncryptionKeyDir"`
 }
 
 func NewConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
+	viper.SetDefault("Driver", DriverS3)
+	viper.SetDefault("Endpoint", defaultEndpoint)
+	viper.SetDefault("Region", defaultRegion)
+	viper.SetDefault("LocalRoot", defaultLocalRoot)
+	viper.BindEnv("Driver", "STORAGE_DRIVER")
+	viper.BindEnv("Endpoint", "STORAGE_ENDPOINT")
+	viper.BindEnv("Region", "STORAGE_REGION")
+	viper.BindEnv("UsePathStyle", "STORAGE_USE_PATH_STYLE")
+	viper.BindEnv("LocalRoot", "STORAGE_LOCAL_ROOT")
+	viper.BindEnv("EncryptionProvider", "STORAGE_ENCRYPTION_PROVIDER")
+	viper.BindEnv("EncryptionKeyDir", "STORAGE_ENCRYPTION_KEY_DIR")
+
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("cannot read config from %s: %w", path, err)
+		// Для локального драйвера файл конфигурации не обязателен
+		if viper.GetString("Driver") != DriverLocal {
+			return nil, fmt.Errorf("cannot read config from %s: %w", path, err)
+		}
 	}
 
 	var cfg Config
@@ -22,15 +56,34 @@ func NewConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("cannot unmarshal config: %w", err)
 	}
 
-	// Проверяем, что все необходимые поля заполнены
-	if cfg.AccessKeyID == "" {
-		return nil, fmt.Errorf("AccessKeyID is required")
-	}
-	if cfg.SecretAccessKey == "" {
-		return nil, fmt.Errorf("SecretAccessKey is required")
+	switch cfg.Driver {
+	case DriverLocal:
+		if cfg.LocalRoot == "" {
+			return nil, fmt.Errorf("LocalRoot is required for local driver")
+		}
+	case DriverS3:
+		// Проверяем, что все необходимые поля заполнены
+		if cfg.AccessKeyID == "" {
+			return nil, fmt.Errorf("AccessKeyID is required")
+		}
+		if cfg.SecretAccessKey == "" {
+			return nil, fmt.Errorf("SecretAccessKey is required")
+		}
+		if cfg.Bucket == "" {
+			return nil, fmt.Errorf("Bucket is required")
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Driver)
 	}
-	if cfg.Bucket == "" {
-		return nil, fmt.Errorf("Bucket is required")
+
+	switch cfg.EncryptionProvider {
+	case "":
+	case EncryptionProviderLocal:
+		if cfg.EncryptionKeyDir == "" {
+			return nil, fmt.Errorf("EncryptionKeyDir is required for local encryption key provider")
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption key provider: %s", cfg.EncryptionProvider)
 	}
 
 	return &cfg, nil
@@ -0,0 +1,910 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Формат зашифрованного объекта: заголовок, за которым следуют кадры AES-GCM.
+// Каждый кадр шифрует до encryptionFrameSize байт и хранит свой тег, поэтому
+// для чтения диапазона достаточно расшифровать только затронутые кадры.
+// Объект, загруженный по частям, состоит из независимых последовательностей
+// кадров для каждой части; размер частей (кроме последней) записан в заголовке.
+// Начиная со второй версии формата последний кадр каждой части помечается
+// в связанных данных AEAD, поэтому обрезка объекта по границе кадра внутри части
+// обнаруживается при чтении. Потерю целых частей в конце объекта, загруженного
+// по частям, формат не обнаруживает: число частей при загрузке заранее неизвестно
+const (
+	encryptionMagic      = "SXE"
+	encryptionVersion    = 2
+	encryptionFrameSize  = 64 * 1024
+	encryptionTagSize    = 16
+	encryptionFixedSize  = 28
+	encryptionMaxHeader  = 2048
+	encryptionPrefixSize = 4
+	dataKeySize          = 32
+
+	// encryptionUploadsPrefix - служебные объекты с ключами незавершенных загрузок по частям
+	encryptionUploadsPrefix = "encryption_uploads/"
+
+	// При перешифровании копии первая часть содержит заголовок и начало кадров,
+	// остальные части копируются хранилищем
+	rewrapFirstPartSize = defaultChunkSize
+	rewrapCopyPartSize  = 1024 * 1024 * 1024
+
+	// encryptionUploadIdle - через сколько без обращений ключ загрузки по частям
+	// вытесняется из памяти; при следующей части он читается из служебного объекта
+	encryptionUploadIdle = time.Hour
+
+	// SystemKeyID - ключ для объектов, которые нельзя отнести к пользователю
+	SystemKeyID = "system"
+)
+
+// errNotEncrypted означает, что объект был сохранен до включения шифрования
+var errNotEncrypted = errors.New("object is not encrypted")
+
+// KeyResolver определяет, ключом какого пользователя шифруется объект
+type KeyResolver func(objectKey string) string
+
+// OwnerKeyID возвращает владельца объекта по его ключу в хранилище
+func OwnerKeyID(objectKey string) string {
+	for _, prefix := range []string{"personal_drive_files/", "recordings/personal_recordings/"} {
+		if rest, ok := strings.CutPrefix(objectKey, prefix); ok {
+			if owner, _, found := strings.Cut(rest, "/"); found && owner != "" {
+				return owner
+			}
+		}
+	}
+	return SystemKeyID
+}
+
+// encryptionHeader - заголовок зашифрованного объекта
+type encryptionHeader struct {
+	version     byte
+	frameSize   uint32
+	partSize    uint64 // 0 для объектов, загруженных одним запросом
+	noncePrefix [encryptionPrefixSize]byte
+	keyID       string
+	wrappedKey  []byte
+}
+
+func (h *encryptionHeader) size() int64 {
+	return int64(encryptionFixedSize + len(h.keyID) + len(h.wrappedKey))
+}
+
+func (h *encryptionHeader) marshal() []byte {
+	buf := make([]byte, 0, h.size())
+	buf = append(buf, encryptionMagic...)
+	buf = append(buf, '0'+h.version)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(h.size()))
+	buf = binary.BigEndian.AppendUint32(buf, h.frameSize)
+	buf = binary.BigEndian.AppendUint64(buf, h.partSize)
+	buf = append(buf, h.noncePrefix[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.wrappedKey)))
+	buf = append(buf, h.wrappedKey...)
+	return buf
+}
+
+// parseEncryptionHeader разбирает заголовок. Если данных недостаточно,
+// возвращает требуемый размер заголовка
+func parseEncryptionHeader(data []byte) (*encryptionHeader, int, error) {
+	if len(data) < encryptionFixedSize || string(data[:3]) != encryptionMagic {
+		return nil, 0, errNotEncrypted
+	}
+	version := data[3] - '0'
+	if version < 1 || version > encryptionVersion {
+		return nil, 0, errNotEncrypted
+	}
+
+	size := int(binary.BigEndian.Uint32(data[4:8]))
+	if size < encryptionFixedSize || size > encryptionMaxHeader {
+		return nil, 0, fmt.Errorf("invalid encryption header size: %d", size)
+	}
+	if len(data) < size {
+		return nil, size, nil
+	}
+
+	h := &encryptionHeader{
+		version:   version,
+		frameSize: binary.BigEndian.Uint32(data[8:12]),
+		partSize:  binary.BigEndian.Uint64(data[12:20]),
+	}
+	copy(h.noncePrefix[:], data[20:24])
+
+	rest := data[24:size]
+	keyIDLen := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+keyIDLen+2 {
+		return nil, 0, fmt.Errorf("invalid encryption header")
+	}
+	h.keyID = string(rest[2 : 2+keyIDLen])
+	rest = rest[2+keyIDLen:]
+	wrappedLen := int(binary.BigEndian.Uint16(rest))
+	if len(rest) != 2+wrappedLen {
+		return nil, 0, fmt.Errorf("invalid encryption header")
+	}
+	h.wrappedKey = append([]byte(nil), rest[2:]...)
+
+	if h.frameSize == 0 {
+		return nil, 0, fmt.Errorf("invalid encryption frame size")
+	}
+	return h, size, nil
+}
+
+// frameCipherSize - размер кадра в объекте
+func (h *encryptionHeader) frameCipherSize() int64 {
+	return int64(h.frameSize) + encryptionTagSize
+}
+
+// partCipherSize - размер полной части в объекте без учета заголовка
+func (h *encryptionHeader) partCipherSize() int64 {
+	frames := (int64(h.partSize) + int64(h.frameSize) - 1) / int64(h.frameSize)
+	return int64(h.partSize) + frames*encryptionTagSize
+}
+
+// plainSize вычисляет размер исходных данных по размеру объекта
+func (h *encryptionHeader) plainSize(objectSize int64) int64 {
+	body := objectSize - h.size()
+	if body <= 0 {
+		return 0
+	}
+
+	var plain int64
+	if h.partSize > 0 {
+		plain = (body / h.partCipherSize()) * int64(h.partSize)
+		body %= h.partCipherSize()
+	}
+	frames := (body + h.frameCipherSize() - 1) / h.frameCipherSize()
+	return plain + body - frames*encryptionTagSize
+}
+
+// locate возвращает номер части, номер кадра в ней, смещение кадра в объекте
+// и смещение начала кадра в исходных данных для указанной позиции
+func (h *encryptionHeader) locate(offset int64) (uint32, uint32, int64, int64) {
+	part, inPart := int64(0), offset
+	if h.partSize > 0 {
+		part, inPart = offset/int64(h.partSize), offset%int64(h.partSize)
+	}
+	frame := inPart / int64(h.frameSize)
+
+	cipherOffset := h.size() + frame*h.frameCipherSize()
+	if part > 0 {
+		cipherOffset += part * h.partCipherSize()
+	}
+	plainOffset := offset - inPart + frame*int64(h.frameSize)
+	return uint32(part + 1), uint32(frame), cipherOffset, plainOffset
+}
+
+// frameNonce формирует уникальный nonce кадра из префикса объекта, номера части и номера кадра
+func frameNonce(prefix [encryptionPrefixSize]byte, part, frame uint32) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix[:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, part)
+	return binary.BigEndian.AppendUint32(nonce, frame)
+}
+
+func newDataCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameAD возвращает связанные данные кадра: признак последнего кадра части
+func (h *encryptionHeader) frameAD(final bool) []byte {
+	if h.version < 2 {
+		return nil
+	}
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// sealPart шифрует данные одной части кадрами и дописывает их в dst.
+// Пустая часть состоит из одного пустого последнего кадра
+func sealPart(dst []byte, aead cipher.AEAD, h *encryptionHeader, part uint32, data []byte) []byte {
+	for frame := uint32(0); ; frame++ {
+		n := min(len(data), int(h.frameSize))
+		final := n == len(data)
+		dst = aead.Seal(dst, frameNonce(h.noncePrefix, part, frame), data[:n], h.frameAD(final))
+		data = data[n:]
+		if final {
+			return dst
+		}
+	}
+}
+
+// sealStream шифрует поток как одну часть и записывает кадры в w.
+// Следующий кадр читается заранее, чтобы пометить последний
+func sealStream(w io.Writer, aead cipher.AEAD, h *encryptionHeader, part uint32, r io.Reader) error {
+	frameSize := int(h.frameSize)
+	br := bufio.NewReaderSize(r, frameSize+1)
+	sealed := make([]byte, 0, h.frameCipherSize())
+	for frame := uint32(0); ; frame++ {
+		data, err := br.Peek(frameSize + 1)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		final := len(data) <= frameSize
+		data = data[:min(len(data), frameSize)]
+
+		sealed = aead.Seal(sealed[:0], frameNonce(h.noncePrefix, part, frame), data, h.frameAD(final))
+		if _, err := w.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write temporary file: %w", err)
+		}
+		if final {
+			return nil
+		}
+		if _, err := br.Discard(len(data)); err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+}
+
+// EncryptedStorage прозрачно шифрует содержимое объектов поверх другого хранилища.
+// Каждый объект шифруется собственным случайным ключом данных, который хранится
+// в заголовке объекта зашифрованным ключом владельца. Объекты без заголовка
+// (сохраненные до включения шифрования или записанные извне) читаются как есть
+type EncryptedStorage struct {
+	inner    Storage
+	provider KeyProvider
+	resolve  KeyResolver
+	// Ключи незавершенных загрузок по частям, чтобы не расшифровывать их для каждой части.
+	// Брошенные загрузки вытесняются после encryptionUploadIdle без обращений
+	uploads  sync.Map
+	prunedAt atomic.Int64
+}
+
+// multipartEncryption - параметры шифрования загрузки по частям
+type multipartEncryption struct {
+	header *encryptionHeader
+	aead   cipher.AEAD
+	usedAt atomic.Int64
+}
+
+// NewEncryptedStorage создает шифрующее хранилище
+func NewEncryptedStorage(inner Storage, provider KeyProvider, resolve KeyResolver) *EncryptedStorage {
+	if resolve == nil {
+		resolve = OwnerKeyID
+	}
+	return &EncryptedStorage{
+		inner:    inner,
+		provider: provider,
+		resolve:  resolve,
+	}
+}
+
+// newHeader создает ключ данных для нового объекта
+func (s *EncryptedStorage) newHeader(ctx context.Context, key string) (*encryptionHeader, cipher.AEAD, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	keyID := s.resolve(key)
+	wrapped, err := s.provider.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	h := &encryptionHeader{
+		version:    encryptionVersion,
+		frameSize:  encryptionFrameSize,
+		keyID:      keyID,
+		wrappedKey: wrapped,
+	}
+	if _, err := rand.Read(h.noncePrefix[:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+
+	aead, err := newDataCipher(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, aead, nil
+}
+
+// openHeader расшифровывает ключ данных объекта
+func (s *EncryptedStorage) openHeader(ctx context.Context, h *encryptionHeader) (cipher.AEAD, error) {
+	dataKey, err := s.provider.UnwrapKey(ctx, h.keyID, h.wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return newDataCipher(dataKey)
+}
+
+// UploadFile шифрует файл во временный файл на диске и загружает его
+func (s *EncryptedStorage) UploadFile(key string, file *multipart.File) error {
+	if key == "" || file == nil {
+		return fmt.Errorf("key and file are required")
+	}
+
+	h, aead, err := s.newHeader(context.Background(), key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := (*file).Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp("", "encrypted-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.Write(h.marshal()); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := sealStream(w, aead, h, 1, *file); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read temporary file: %w", err)
+	}
+
+	var encrypted multipart.File = tmp
+	return s.inner.UploadFile(key, &encrypted)
+}
+
+// UploadBytes шифрует и загружает данные
+func (s *EncryptedStorage) UploadBytes(key string, data []byte) error {
+	h, aead, err := s.newHeader(context.Background(), key)
+	if err != nil {
+		return err
+	}
+
+	frames := max(1, (len(data)+int(h.frameSize)-1)/int(h.frameSize))
+	out := make([]byte, 0, int(h.size())+len(data)+frames*encryptionTagSize)
+	out = append(out, h.marshal()...)
+	out = sealPart(out, aead, h, 1, data)
+
+	return s.inner.UploadBytes(key, out)
+}
+
+// GetObject получает и расшифровывает объект целиком
+func (s *EncryptedStorage) GetObject(ctx context.Context, key string) (S3Object, error) {
+	obj, err := s.inner.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(obj, encryptionMaxHeader)
+	h, err := peekEncryptionHeader(r)
+	if errors.Is(err, errNotEncrypted) {
+		return &s3Object{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{r, obj},
+			contentLength: obj.ContentLength(),
+			contentType:   obj.ContentType(),
+		}, nil
+	}
+	if err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	aead, err := s.openHeader(ctx, h)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+
+	if _, err := r.Discard(int(h.size())); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	return &s3Object{
+		ReadCloser:    newDecryptReader(r, obj, aead, h, 1, 0, 0, 0, -1),
+		contentLength: h.plainSize(obj.ContentLength()),
+		contentType:   obj.ContentType(),
+	}, nil
+}
+
+// GetObjectRange читает диапазон исходных данных, расшифровывая только нужные кадры.
+// Границы диапазона включительные, как в HTTP-заголовке Range
+func (s *EncryptedStorage) GetObjectRange(ctx context.Context, key string, start, end int64) (S3Object, error) {
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("invalid range %d-%d", start, end)
+	}
+
+	h, err := s.readHeader(ctx, key)
+	if errors.Is(err, errNotEncrypted) {
+		return s.inner.GetObjectRange(ctx, key, start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := s.openHeader(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+
+	part, frame, cipherStart, plainStart := h.locate(start)
+	_, _, lastFrame, _ := h.locate(end)
+	cipherEnd := lastFrame + h.frameCipherSize() - 1
+
+	obj, err := s.inner.GetObjectRange(ctx, key, cipherStart, cipherEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	length := end - start + 1
+	return &s3Object{
+		ReadCloser:    newDecryptReader(obj, obj, aead, h, part, frame, plainStart, start-plainStart, length),
+		contentLength: length,
+		contentType:   obj.ContentType(),
+	}, nil
+}
+
+// readHeader читает заголовок объекта отдельным запросом
+func (s *EncryptedStorage) readHeader(ctx context.Context, key string) (*encryptionHeader, error) {
+	obj, err := s.inner.GetObjectRange(ctx, key, 0, encryptionMaxHeader-1)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(io.LimitReader(obj, encryptionMaxHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	h, need, err := parseEncryptionHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		return nil, fmt.Errorf("truncated encryption header in %s: need %d bytes", key, need)
+	}
+	return h, nil
+}
+
+// peekEncryptionHeader читает заголовок, не извлекая данные из потока
+func peekEncryptionHeader(r *bufio.Reader) (*encryptionHeader, error) {
+	data, err := r.Peek(encryptionFixedSize)
+	if err != nil && len(data) < encryptionFixedSize {
+		return nil, errNotEncrypted
+	}
+
+	h, need, err := parseEncryptionHeader(data)
+	if err != nil || h != nil {
+		return h, err
+	}
+
+	data, err = r.Peek(need)
+	if err != nil {
+		return nil, fmt.Errorf("truncated encryption header: %w", err)
+	}
+	h, _, err = parseEncryptionHeader(data)
+	return h, err
+}
+
+// CopyObject копирует объект без перешифрования данных. Если копия принадлежит
+// другому владельцу, ключ данных в заголовке перешифровывается его ключом,
+// а кадры копируются на стороне хранилища
+func (s *EncryptedStorage) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	h, err := s.readHeader(ctx, srcKey)
+	if errors.Is(err, errNotEncrypted) {
+		return s.inner.CopyObject(ctx, srcKey, dstKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	keyID := s.resolve(dstKey)
+	if h.keyID == keyID {
+		return s.inner.CopyObject(ctx, srcKey, dstKey)
+	}
+
+	rewrapped, err := s.rewrapHeader(ctx, h, keyID)
+	if err != nil {
+		return err
+	}
+	return s.copyWithHeader(ctx, srcKey, dstKey, h, rewrapped)
+}
+
+// copyWithHeader записывает копию объекта с новым заголовком. Заголовок может
+// отличаться по размеру, поэтому первая часть составляется из нового заголовка
+// и начала кадров, а остальные копируются из исходного объекта по диапазонам
+func (s *EncryptedStorage) copyWithHeader(ctx context.Context, srcKey, dstKey string, h, rewrapped *encryptionHeader) error {
+	copier, ok := s.inner.(partCopier)
+	if !ok {
+		return fmt.Errorf("storage does not support copying object parts")
+	}
+
+	obj, err := s.inner.GetObject(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	objectSize := obj.ContentLength()
+
+	// Старый заголовок пропускаем, начало кадров переносим в первую часть
+	var head []byte
+	_, err = io.CopyN(io.Discard, obj, h.size())
+	if err == nil {
+		head, err = io.ReadAll(io.LimitReader(obj, rewrapFirstPartSize))
+	}
+	obj.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", srcKey, err)
+	}
+
+	first := append(rewrapped.marshal(), head...)
+	offset := h.size() + int64(len(head))
+	if offset >= objectSize {
+		return s.inner.UploadBytes(dstKey, first)
+	}
+
+	uploadID, err := s.inner.CreateMultipartUpload(ctx, dstKey)
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.copyParts(ctx, copier, uploadID, srcKey, dstKey, first, offset, objectSize)
+	if err == nil {
+		err = s.inner.CompleteMultipartUpload(ctx, uploadID, dstKey, parts)
+	}
+	if err != nil {
+		if abortErr := s.inner.AbortMultipartUpload(ctx, uploadID, dstKey); abortErr != nil {
+			log.Printf("[Encryption] Failed to abort copy of %s: %v", srcKey, abortErr)
+		}
+		return fmt.Errorf("failed to copy object %s: %w", srcKey, err)
+	}
+	return nil
+}
+
+// copyParts загружает первую часть копии и копирует остаток объекта начиная с offset
+func (s *EncryptedStorage) copyParts(
+	ctx context.Context,
+	copier partCopier,
+	uploadID, srcKey, dstKey string,
+	first []byte,
+	offset, objectSize int64,
+) ([]CompletedPart, error) {
+	etag, err := s.inner.UploadPart(ctx, uploadID, dstKey, 1, first)
+	if err != nil {
+		return nil, err
+	}
+	parts := []CompletedPart{{PartNumber: 1, ETag: etag}}
+
+	for partNumber := 2; offset < objectSize; partNumber++ {
+		end := min(offset+rewrapCopyPartSize, objectSize) - 1
+		etag, err := copier.UploadPartCopy(ctx, uploadID, dstKey, partNumber, srcKey, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, CompletedPart{PartNumber: partNumber, ETag: etag})
+		offset = end + 1
+	}
+	return parts, nil
+}
+
+// rewrapHeader возвращает копию заголовка с ключом данных, зашифрованным ключом keyID
+func (s *EncryptedStorage) rewrapHeader(ctx context.Context, h *encryptionHeader, keyID string) (*encryptionHeader, error) {
+	dataKey, err := s.provider.UnwrapKey(ctx, h.keyID, h.wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	wrapped, err := s.provider.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	rewrapped := *h
+	rewrapped.keyID = keyID
+	rewrapped.wrappedKey = wrapped
+	return &rewrapped, nil
+}
+
+// DeleteObject удаляет объект
+func (s *EncryptedStorage) DeleteObject(key string) error {
+	return s.inner.DeleteObject(key)
+}
+
+// CreateMultipartUpload начинает загрузку по частям. Заголовок с ключом данных
+// сохраняется в служебный объект, так как части могут приходить в разных запросах
+func (s *EncryptedStorage) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	h, aead, err := s.newHeader(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	uploadID, err := s.inner.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.inner.UploadBytes(encryptionUploadKey(key, uploadID), h.marshal()); err != nil {
+		if abortErr := s.inner.AbortMultipartUpload(ctx, uploadID, key); abortErr != nil {
+			log.Printf("[Encryption] Failed to abort multipart upload %s: %v", uploadID, abortErr)
+		}
+		return "", fmt.Errorf("failed to save upload encryption header: %w", err)
+	}
+
+	s.storeUpload(uploadID, &multipartEncryption{header: h, aead: aead})
+	return uploadID, nil
+}
+
+// storeUpload запоминает параметры загрузки и вытесняет давно не используемые
+func (s *EncryptedStorage) storeUpload(uploadID string, enc *multipartEncryption) {
+	now := time.Now()
+	enc.usedAt.Store(now.UnixNano())
+	s.uploads.Store(uploadID, enc)
+
+	// Проверяем не чаще, чем раз в минуту
+	last := s.prunedAt.Load()
+	if now.UnixNano()-last < int64(time.Minute) || !s.prunedAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	idleSince := now.Add(-encryptionUploadIdle).UnixNano()
+	s.uploads.Range(func(key, value any) bool {
+		if value.(*multipartEncryption).usedAt.Load() < idleSince {
+			s.uploads.Delete(key)
+		}
+		return true
+	})
+}
+
+// multipartEncryption возвращает параметры шифрования незавершенной загрузки
+func (s *EncryptedStorage) multipartEncryption(ctx context.Context, uploadID, key string) (*multipartEncryption, error) {
+	if value, ok := s.uploads.Load(uploadID); ok {
+		enc := value.(*multipartEncryption)
+		enc.usedAt.Store(time.Now().UnixNano())
+		return enc, nil
+	}
+
+	obj, err := s.inner.GetObject(ctx, encryptionUploadKey(key, uploadID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload encryption header: %w", err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(io.LimitReader(obj, encryptionMaxHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload encryption header: %w", err)
+	}
+
+	h, _, err := parseEncryptionHeader(data)
+	if err == nil && h == nil {
+		err = fmt.Errorf("truncated encryption header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload encryption header: %w", err)
+	}
+
+	aead, err := s.openHeader(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &multipartEncryption{header: h, aead: aead}
+	s.storeUpload(uploadID, enc)
+	return enc, nil
+}
+
+// UploadPart шифрует и загружает часть. Все части, кроме последней, должны
+// быть одного размера: он записывается в заголовок вместе с первой частью
+func (s *EncryptedStorage) UploadPart(ctx context.Context, uploadID string, key string, partNumber int, data []byte) (string, error) {
+	if partNumber < 1 {
+		return "", fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	enc, err := s.multipartEncryption(ctx, uploadID, key)
+	if err != nil {
+		return "", err
+	}
+
+	var out []byte
+	if partNumber == 1 {
+		h := *enc.header
+		h.partSize = uint64(len(data))
+		out = h.marshal()
+	}
+	out = sealPart(out, enc.aead, enc.header, uint32(partNumber), data)
+
+	return s.inner.UploadPart(ctx, uploadID, key, partNumber, out)
+}
+
+// CompleteMultipartUpload завершает загрузку и удаляет служебный объект
+func (s *EncryptedStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, key string, parts []CompletedPart) error {
+	if err := s.inner.CompleteMultipartUpload(ctx, uploadID, key, parts); err != nil {
+		return err
+	}
+	s.forgetUpload(uploadID, key)
+	return nil
+}
+
+// AbortMultipartUpload отменяет загрузку и удаляет служебный объект
+func (s *EncryptedStorage) AbortMultipartUpload(ctx context.Context, uploadID string, key string) error {
+	if err := s.inner.AbortMultipartUpload(ctx, uploadID, key); err != nil {
+		return err
+	}
+	s.forgetUpload(uploadID, key)
+	return nil
+}
+
+func (s *EncryptedStorage) forgetUpload(uploadID, key string) {
+	s.uploads.Delete(uploadID)
+	if err := s.inner.DeleteObject(encryptionUploadKey(key, uploadID)); err != nil {
+		log.Printf("[Encryption] Failed to delete encryption header of upload %s: %v", uploadID, err)
+	}
+}
+
+// encryptionUploadKey возвращает ключ служебного объекта загрузки по частям
+func encryptionUploadKey(key, uploadID string) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + uploadID))
+	return encryptionUploadsPrefix + hex.EncodeToString(sum[:])
+}
+
+// decryptReader расшифровывает поток кадров, начиная с указанного кадра
+type decryptReader struct {
+	src    io.Reader
+	closer io.Closer
+	aead   cipher.AEAD
+	header *encryptionHeader
+
+	part       uint32
+	frame      uint32
+	partOffset int64 // позиция текущего кадра внутри части в исходных данных
+	skip       int64 // сколько байт пропустить в начале первого кадра
+	remaining  int64 // сколько байт осталось отдать, -1 без ограничения
+
+	final bool // последний прочитанный кадр завершает часть
+
+	buf      []byte
+	plainBuf []byte
+	plain    []byte
+	err      error
+}
+
+func newDecryptReader(
+	src io.Reader,
+	closer io.Closer,
+	aead cipher.AEAD,
+	h *encryptionHeader,
+	part, frame uint32,
+	plainOffset, skip, length int64,
+) *decryptReader {
+	partOffset := int64(frame) * int64(h.frameSize)
+	if h.partSize > 0 {
+		partOffset = plainOffset % int64(h.partSize)
+	}
+	return &decryptReader{
+		src:        src,
+		closer:     closer,
+		aead:       aead,
+		header:     h,
+		part:       part,
+		frame:      frame,
+		partOffset: partOffset,
+		skip:       skip,
+		remaining:  length,
+		buf:        make([]byte, h.frameCipherSize()),
+		plainBuf:   make([]byte, h.frameSize),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			// Объект закончился раньше запрошенного диапазона
+			if r.err == io.EOF && r.remaining > 0 {
+				return 0, fmt.Errorf("corrupted encrypted object: %w", io.ErrUnexpectedEOF)
+			}
+			return 0, r.err
+		}
+		r.err = r.nextFrame()
+	}
+
+	n := len(p)
+	if n > len(r.plain) {
+		n = len(r.plain)
+	}
+	if r.remaining >= 0 && int64(n) > r.remaining {
+		n = int(r.remaining)
+	}
+
+	copy(p, r.plain[:n])
+	r.plain = r.plain[n:]
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+	}
+	return n, nil
+}
+
+// nextFrame читает и расшифровывает следующий кадр
+func (r *decryptReader) nextFrame() error {
+	frameLen := int64(r.header.frameSize)
+	if r.header.partSize > 0 {
+		// Переход к следующей части
+		if r.partOffset >= int64(r.header.partSize) {
+			r.part++
+			r.frame = 0
+			r.partOffset = 0
+		}
+		frameLen = min(frameLen, int64(r.header.partSize)-r.partOffset)
+	}
+
+	n, err := io.ReadFull(r.src, r.buf[:frameLen+encryptionTagSize])
+	if err == io.EOF {
+		// Объект может закончиться только после последнего кадра части
+		if r.header.version >= 2 && !r.final {
+			return fmt.Errorf("corrupted encrypted object: truncated at frame %d of part %d", r.frame, r.part)
+		}
+		return io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read encrypted frame: %w", err)
+	}
+	if n < encryptionTagSize || (n == encryptionTagSize && r.header.version < 2) {
+		return fmt.Errorf("corrupted encrypted object: truncated frame")
+	}
+
+	// Неполный кадр может быть только последним, полный - любым
+	nonce := frameNonce(r.header.noncePrefix, r.part, r.frame)
+	final := err == io.ErrUnexpectedEOF
+	plain, openErr := r.aead.Open(r.plainBuf[:0], nonce, r.buf[:n], r.header.frameAD(final))
+	if openErr != nil && !final && r.header.version >= 2 {
+		final = true
+		plain, openErr = r.aead.Open(r.plainBuf[:0], nonce, r.buf[:n], r.header.frameAD(final))
+	}
+	if openErr != nil {
+		return fmt.Errorf("failed to decrypt frame %d of part %d: %w", r.frame, r.part, openErr)
+	}
+
+	r.final = final
+	r.frame++
+	r.partOffset += int64(len(plain))
+
+	if r.skip > 0 {
+		skip := min(r.skip, int64(len(plain)))
+		plain = plain[skip:]
+		r.skip -= skip
+	}
+	r.plain = plain
+
+	// Последний кадр неполной части - последний в объекте
+	if final && (r.header.partSize == 0 || r.partOffset < int64(r.header.partSize)) {
+		return io.EOF
+	}
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,382 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestEncryptedStorage(t *testing.T) (*EncryptedStorage, *LocalStorage) {
+	t.Helper()
+
+	inner, err := NewLocalStorage(&Config{LocalRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	provider, err := NewLocalKeyProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalKeyProvider: %v", err)
+	}
+	return NewEncryptedStorage(inner, provider, OwnerKeyID), inner
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	return data
+}
+
+func readObject(obj S3Object, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+func readRaw(t *testing.T, storage Storage, key string) []byte {
+	t.Helper()
+
+	data, err := readObject(storage.GetObject(context.Background(), key))
+	if err != nil {
+		t.Fatalf("read raw object: %v", err)
+	}
+	return data
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, encryptionFrameSize - 1, encryptionFrameSize, encryptionFrameSize + 1, 3*encryptionFrameSize + 5}
+	uploads := map[string]func(s *EncryptedStorage, key string, data []byte) error{
+		"bytes": func(s *EncryptedStorage, key string, data []byte) error {
+			return s.UploadBytes(key, data)
+		},
+		"file": func(s *EncryptedStorage, key string, data []byte) error {
+			path := filepath.Join(t.TempDir(), "upload")
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// Файл прочитан до конца, загрузка должна начать с начала
+			if _, err := f.Seek(0, io.SeekEnd); err != nil {
+				return err
+			}
+			var file multipart.File = f
+			return s.UploadFile(key, &file)
+		},
+	}
+
+	for name, upload := range uploads {
+		for _, size := range sizes {
+			storage, inner := newTestEncryptedStorage(t)
+			key := "personal_drive_files/user-1/object"
+			data := randomBytes(t, size)
+
+			if err := upload(storage, key, data); err != nil {
+				t.Fatalf("%s/%d: upload: %v", name, size, err)
+			}
+
+			obj, err := storage.GetObject(context.Background(), key)
+			if err != nil {
+				t.Fatalf("%s/%d: GetObject: %v", name, size, err)
+			}
+			if obj.ContentLength() != int64(size) {
+				t.Errorf("%s/%d: ContentLength = %d", name, size, obj.ContentLength())
+			}
+			got, err := readObject(obj, nil)
+			if err != nil {
+				t.Fatalf("%s/%d: read: %v", name, size, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s/%d: decrypted content differs", name, size)
+			}
+
+			if raw := readRaw(t, inner, key); size >= encryptionTagSize && bytes.Contains(raw, data) {
+				t.Errorf("%s/%d: object is stored in plaintext", name, size)
+			}
+		}
+	}
+}
+
+func TestEncryptedStorageRange(t *testing.T) {
+	storage, _ := newTestEncryptedStorage(t)
+	key := "personal_drive_files/user-1/object"
+	data := randomBytes(t, 3*encryptionFrameSize+100)
+	if err := storage.UploadBytes(key, data); err != nil {
+		t.Fatalf("UploadBytes: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int64
+	}{
+		{"first byte", 0, 0},
+		{"inside first frame", 10, 1000},
+		{"frame boundary", encryptionFrameSize - 1, encryptionFrameSize},
+		{"several frames", 100, 2*encryptionFrameSize + 50},
+		{"tail", 3 * encryptionFrameSize, int64(len(data)) - 1},
+		{"whole object", 0, int64(len(data)) - 1},
+	}
+
+	for _, tt := range tests {
+		got, err := readObject(storage.GetObjectRange(context.Background(), key, tt.start, tt.end))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data[tt.start:tt.end+1]) {
+			t.Errorf("%s: range %d-%d differs", tt.name, tt.start, tt.end)
+		}
+	}
+}
+
+func TestEncryptedStorageMultipart(t *testing.T) {
+	partSize := 2*encryptionFrameSize + 3
+
+	tests := []struct {
+		name  string
+		parts []int
+	}{
+		{"single part", []int{partSize}},
+		{"short last part", []int{partSize, partSize, 10}},
+		{"full last part", []int{partSize, partSize}},
+	}
+
+	for _, tt := range tests {
+		storage, _ := newTestEncryptedStorage(t)
+		ctx := context.Background()
+		key := "personal_drive_files/user-1/object"
+
+		uploadID, err := storage.CreateMultipartUpload(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: CreateMultipartUpload: %v", tt.name, err)
+		}
+
+		var data []byte
+		var parts []CompletedPart
+		for i, size := range tt.parts {
+			part := randomBytes(t, size)
+			data = append(data, part...)
+			etag, err := storage.UploadPart(ctx, uploadID, key, i+1, part)
+			if err != nil {
+				t.Fatalf("%s: UploadPart: %v", tt.name, err)
+			}
+			parts = append(parts, CompletedPart{PartNumber: i + 1, ETag: etag})
+		}
+		if err := storage.CompleteMultipartUpload(ctx, uploadID, key, parts); err != nil {
+			t.Fatalf("%s: CompleteMultipartUpload: %v", tt.name, err)
+		}
+
+		got, err := readObject(storage.GetObject(ctx, key))
+		if err != nil {
+			t.Fatalf("%s: GetObject: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: decrypted content differs", tt.name)
+		}
+
+		// Диапазон через границу частей
+		start, end := int64(partSize-5), int64(len(data)-1)
+		got, err = readObject(storage.GetObjectRange(ctx, key, start, end))
+		if err != nil {
+			t.Fatalf("%s: GetObjectRange: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data[start:end+1]) {
+			t.Errorf("%s: range %d-%d differs", tt.name, start, end)
+		}
+	}
+}
+
+func TestEncryptedStorageDetectsTruncation(t *testing.T) {
+	storage, inner := newTestEncryptedStorage(t)
+	key := "personal_drive_files/user-1/object"
+	data := randomBytes(t, 3*encryptionFrameSize)
+	if err := storage.UploadBytes(key, data); err != nil {
+		t.Fatalf("UploadBytes: %v", err)
+	}
+
+	raw := readRaw(t, inner, key)
+	h, headerSize, err := parseEncryptionHeader(raw)
+	if err != nil || h == nil {
+		t.Fatalf("parseEncryptionHeader: %v", err)
+	}
+	frame := int(h.frameCipherSize())
+
+	tests := []struct {
+		name   string
+		length int
+	}{
+		{"header only", headerSize},
+		{"at frame boundary", headerSize + frame},
+		{"before last frame", headerSize + 2*frame},
+		{"inside frame", headerSize + frame + 100},
+		{"last tag cut", len(raw) - 1},
+	}
+
+	for _, tt := range tests {
+		truncatedKey := "personal_drive_files/user-1/truncated"
+		if err := inner.UploadBytes(truncatedKey, raw[:tt.length]); err != nil {
+			t.Fatalf("%s: UploadBytes: %v", tt.name, err)
+		}
+
+		if _, err := readObject(storage.GetObject(context.Background(), truncatedKey)); err == nil {
+			t.Errorf("%s: truncated object was read without error", tt.name)
+		}
+	}
+
+	// Диапазон за пределами обрезанного объекта тоже не должен читаться молча
+	if err := inner.UploadBytes(key, raw[:headerSize+frame]); err != nil {
+		t.Fatalf("UploadBytes: %v", err)
+	}
+	if _, err := readObject(storage.GetObjectRange(context.Background(), key, 0, int64(len(data))-1)); err == nil {
+		t.Errorf("range over truncated object was read without error")
+	}
+}
+
+func TestEncryptedStorageReadsVersion1(t *testing.T) {
+	storage, inner := newTestEncryptedStorage(t)
+	key := "personal_drive_files/user-1/object"
+
+	// Первая версия формата не помечала последний кадр
+	h, aead, err := storage.newHeader(context.Background(), key)
+	if err != nil {
+		t.Fatalf("newHeader: %v", err)
+	}
+	h.version = 1
+
+	data := randomBytes(t, 2*encryptionFrameSize+7)
+	raw := sealPart(h.marshal(), aead, h, 1, data)
+	if err := inner.UploadBytes(key, raw); err != nil {
+		t.Fatalf("UploadBytes: %v", err)
+	}
+
+	got, err := readObject(storage.GetObject(context.Background(), key))
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("decrypted content differs")
+	}
+}
+
+func TestEncryptedStorageReadsPlainObjects(t *testing.T) {
+	storage, inner := newTestEncryptedStorage(t)
+	key := "personal_drive_files/user-1/plain"
+	data := []byte("stored before encryption was enabled")
+	if err := inner.UploadBytes(key, data); err != nil {
+		t.Fatalf("UploadBytes: %v", err)
+	}
+
+	got, err := readObject(storage.GetObject(context.Background(), key))
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("plain object content differs")
+	}
+}
+
+func TestOwnerKeyID(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"personal_drive_files/user-1/file", "user-1"},
+		{"personal_drive_files/user-1/blobs/ab/abcdef", "user-1"},
+		{"recordings/personal_recordings/user-2/video.mp4", "user-2"},
+		{"blobs/ab/abcdef", SystemKeyID},
+		{"personal_drive_files//file", SystemKeyID},
+		{"previews/file", SystemKeyID},
+	}
+
+	for _, tt := range tests {
+		if got := OwnerKeyID(tt.key); got != tt.want {
+			t.Errorf("OwnerKeyID(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEncryptedStorageCopyRewrapsKey(t *testing.T) {
+	sizes := []int{0, 1000, rewrapFirstPartSize + 3*encryptionFrameSize + 17}
+
+	for _, size := range sizes {
+		storage, inner := newTestEncryptedStorage(t)
+		ctx := context.Background()
+		srcKey := "personal_drive_files/user-1/object"
+		dstKey := "personal_drive_files/user-2/object"
+		data := randomBytes(t, size)
+		if err := storage.UploadBytes(srcKey, data); err != nil {
+			t.Fatalf("%d: UploadBytes: %v", size, err)
+		}
+
+		if err := storage.CopyObject(ctx, srcKey, dstKey); err != nil {
+			t.Fatalf("%d: CopyObject: %v", size, err)
+		}
+
+		h, _, err := parseEncryptionHeader(readRaw(t, inner, dstKey))
+		if err != nil || h == nil {
+			t.Fatalf("%d: parseEncryptionHeader: %v", size, err)
+		}
+		if h.keyID != "user-2" {
+			t.Errorf("%d: copy is wrapped by %q, want user-2", size, h.keyID)
+		}
+
+		got, err := readObject(storage.GetObject(ctx, dstKey))
+		if err != nil {
+			t.Fatalf("%d: GetObject: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%d: copied content differs", size)
+		}
+	}
+}
+
+func TestEncryptedStorageEvictsIdleUploads(t *testing.T) {
+	storage, _ := newTestEncryptedStorage(t)
+	ctx := context.Background()
+	key := "personal_drive_files/user-1/object"
+
+	idleID, err := storage.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	value, _ := storage.uploads.Load(idleID)
+	value.(*multipartEncryption).usedAt.Store(time.Now().Add(-2 * encryptionUploadIdle).UnixNano())
+	storage.prunedAt.Store(0)
+
+	if _, err := storage.CreateMultipartUpload(ctx, key); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if _, ok := storage.uploads.Load(idleID); ok {
+		t.Fatalf("idle upload was not evicted")
+	}
+
+	// Вытесненная загрузка продолжается с ключом из служебного объекта
+	data := randomBytes(t, 1000)
+	etag, err := storage.UploadPart(ctx, idleID, key, 1, data)
+	if err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if err := storage.CompleteMultipartUpload(ctx, idleID, key, []CompletedPart{{PartNumber: 1, ETag: etag}}); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	got, err := readObject(storage.GetObject(ctx, key))
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("content differs")
+	}
+}
@@ -0,0 +1,157 @@
+package s3
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const (
+	// EncryptionProviderLocal - ключи пользователей хранятся в файлах на диске
+	EncryptionProviderLocal = "local"
+
+	masterKeySize = 32
+)
+
+// KeyProvider шифрует ключи данных ключами пользователей.
+// Реализация может хранить ключи локально или во внешнем KMS
+type KeyProvider interface {
+	// WrapKey шифрует ключ данных ключом keyID, при необходимости создавая его
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey расшифровывает ключ данных, зашифрованный ключом keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// keyIDPattern ограничивает идентификаторы ключей, чтобы их можно было использовать как имена файлов
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// LocalKeyProvider хранит ключи пользователей в файлах <dir>/<keyID>.key.
+// Предназначен для разработки: ключи лежат рядом с приложением в открытом виде
+type LocalKeyProvider struct {
+	dir  string
+	mu   sync.Mutex
+	keys map[string]cipher.AEAD
+}
+
+// NewLocalKeyProvider создает провайдер ключей в указанной директории
+func NewLocalKeyProvider(dir string) (*LocalKeyProvider, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("missing required configuration: encryption key dir is required")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	log.Printf("[Encryption] Using local key provider at %s", dir)
+	return &LocalKeyProvider{dir: dir, keys: make(map[string]cipher.AEAD)}, nil
+}
+
+// WrapKey шифрует ключ данных ключом пользователя
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := p.masterKey(keyID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+// UnwrapKey расшифровывает ключ данных ключом пользователя
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.masterKey(keyID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// masterKey загружает ключ пользователя, создавая его при первом шифровании
+func (p *LocalKeyProvider) masterKey(keyID string, create bool) (cipher.AEAD, error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return nil, fmt.Errorf("invalid key id: %q", keyID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if aead, ok := p.keys[keyID]; ok {
+		return aead, nil
+	}
+
+	keyPath := filepath.Join(p.dir, keyID+".key")
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, fmt.Errorf("encryption key %s not found", keyID)
+		}
+		key, err = createMasterKey(keyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key %s: %w", keyID, err)
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("invalid encryption key %s: unexpected size %d", keyID, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	p.keys[keyID] = aead
+	return aead, nil
+}
+
+// createMasterKey создает файл со случайным ключом. Если файл уже создан
+// другим процессом, используется его содержимое
+func createMasterKey(keyPath string) ([]byte, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(keyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(keyPath)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(keyPath)
+		return nil, err
+	}
+
+	return key, nil
+}
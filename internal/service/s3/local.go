@@ -0,0 +1,408 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	localObjectsDir   = "objects"
+	localMultipartDir = "multipart"
+	localUploadKey    = "key"
+)
+
+// LocalStorage хранит объекты в локальной файловой системе.
+// Используется для разработки и CI, где нет доступа к облачному хранилищу.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage создает новое локальное хранилище в указанной директории
+func NewLocalStorage(conf *Config) (*LocalStorage, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("configuration is required")
+	}
+	if conf.LocalRoot == "" {
+		return nil, fmt.Errorf("missing required configuration: local root is required")
+	}
+
+	root, err := filepath.Abs(conf.LocalRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local root: %w", err)
+	}
+
+	// Создаем директории для объектов и незавершенных загрузок
+	for _, dir := range []string{localObjectsDir, localMultipartDir} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+
+	log.Printf("[LocalStorage] Using local storage at %s", root)
+	return &LocalStorage{root: root}, nil
+}
+
+// objectPath возвращает путь к файлу объекта, не позволяя выйти за пределы корня
+func (l *LocalStorage) objectPath(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("key is required")
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return filepath.Join(l.root, localObjectsDir, filepath.FromSlash(cleaned)), nil
+}
+
+// uploadPath возвращает директорию незавершенной загрузки по частям
+func (l *LocalStorage) uploadPath(uploadID string) (string, error) {
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return "", fmt.Errorf("invalid upload id: %s", uploadID)
+	}
+	return filepath.Join(l.root, localMultipartDir, uploadID), nil
+}
+
+// writeObject атомарно записывает содержимое объекта через временный файл
+func (l *LocalStorage) writeObject(key string, r io.Reader) error {
+	objPath, err := l.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objPath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpName, objPath); err != nil {
+		return fmt.Errorf("failed to store object: %w", err)
+	}
+	return nil
+}
+
+// openObject открывает файл объекта и возвращает его размер
+func (l *LocalStorage) openObject(key string) (*os.File, int64, error) {
+	objPath, err := l.objectPath(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(objPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("object not found: %s", key)
+		}
+		return nil, 0, fmt.Errorf("failed to open object: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return f, info.Size(), nil
+}
+
+// UploadFile сохраняет файл в локальное хранилище
+func (l *LocalStorage) UploadFile(key string, file *multipart.File) error {
+	if key == "" || file == nil {
+		return fmt.Errorf("key and file are required")
+	}
+
+	// Как и S3-клиент, загружаем файл с начала, даже если его уже читали
+	if _, err := (*file).Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return l.writeObject(key, *file)
+}
+
+// UploadBytes сохраняет байты в локальное хранилище
+func (l *LocalStorage) UploadBytes(key string, data []byte) error {
+	return l.writeObject(key, bytes.NewReader(data))
+}
+
+// GetObject получает объект из локального хранилища
+func (l *LocalStorage) GetObject(ctx context.Context, key string) (S3Object, error) {
+	f, size, err := l.openObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Object{
+		ReadCloser:    f,
+		contentLength: size,
+		contentType:   localContentType(key),
+	}, nil
+}
+
+// GetObjectRange получает часть объекта из локального хранилища.
+// Границы диапазона включительные, как в HTTP-заголовке Range.
+func (l *LocalStorage) GetObjectRange(ctx context.Context, key string, start, end int64) (S3Object, error) {
+	f, size, err := l.openObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if end >= size {
+		end = size - 1
+	}
+	if start < 0 || start > end {
+		f.Close()
+		return nil, fmt.Errorf("invalid range %d-%d for object of size %d", start, end, size)
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek object: %w", err)
+	}
+
+	length := end - start + 1
+	return &s3Object{
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(f, length), f},
+		contentLength: length,
+		contentType:   localContentType(key),
+	}, nil
+}
+
+// CopyObject копирует объект внутри локального хранилища
+func (l *LocalStorage) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	f, _, err := l.openObject(srcKey)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return l.writeObject(dstKey, f)
+}
+
+// DeleteObject удаляет объект из локального хранилища
+func (l *LocalStorage) DeleteObject(key string) error {
+	objPath, err := l.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	// Если объект не существует, считаем операцию успешной
+	if err := os.Remove(objPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// CreateMultipartUpload инициализирует загрузку по частям
+func (l *LocalStorage) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	if _, err := l.objectPath(key); err != nil {
+		return "", err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	uploadID := hex.EncodeToString(idBytes)
+
+	dir, err := l.uploadPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	// Запоминаем ключ, чтобы проверить его при завершении загрузки
+	if err := os.WriteFile(filepath.Join(dir, localUploadKey), []byte(key), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// checkUpload проверяет, что загрузка существует и относится к указанному ключу
+func (l *LocalStorage) checkUpload(uploadID, key string) (string, error) {
+	dir, err := l.uploadPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	storedKey, err := os.ReadFile(filepath.Join(dir, localUploadKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("multipart upload not found: %s", uploadID)
+		}
+		return "", fmt.Errorf("failed to read multipart upload: %w", err)
+	}
+	if string(storedKey) != key {
+		return "", fmt.Errorf("multipart upload %s does not belong to key %s", uploadID, key)
+	}
+	return dir, nil
+}
+
+// UploadPart сохраняет часть файла
+func (l *LocalStorage) UploadPart(ctx context.Context, uploadID string, key string, partNumber int, data []byte) (string, error) {
+	if partNumber < 1 || partNumber > 10000 {
+		return "", fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	dir, err := l.checkUpload(uploadID, key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, localPartName(partNumber)), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+
+	return localETag(data), nil
+}
+
+// UploadPartCopy сохраняет часть из диапазона другого объекта.
+// Границы диапазона включительные
+func (l *LocalStorage) UploadPartCopy(ctx context.Context, uploadID string, key string, partNumber int, srcKey string, start, end int64) (string, error) {
+	if partNumber < 1 || partNumber > 10000 {
+		return "", fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	dir, err := l.checkUpload(uploadID, key)
+	if err != nil {
+		return "", err
+	}
+
+	src, size, err := l.openObject(srcKey)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	if start < 0 || start > end || end >= size {
+		return "", fmt.Errorf("invalid range %d-%d for object of size %d", start, end, size)
+	}
+
+	part, err := os.Create(filepath.Join(dir, localPartName(partNumber)))
+	if err != nil {
+		return "", fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+	}
+	defer part.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(part, hash), io.NewSectionReader(src, start, end-start+1)); err != nil {
+		return "", fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+	}
+	if err := part.Close(); err != nil {
+		return "", fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// CompleteMultipartUpload собирает части в итоговый объект
+func (l *LocalStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, key string, parts []CompletedPart) error {
+	dir, err := l.checkUpload(uploadID, key)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("failed to complete multipart upload: no parts specified")
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	prevPart := 0
+	for _, part := range parts {
+		// Части должны идти по возрастанию номеров, как требует S3
+		if part.PartNumber <= prevPart {
+			return fmt.Errorf("failed to complete multipart upload: parts must be in ascending order")
+		}
+		prevPart = part.PartNumber
+
+		partPath := filepath.Join(dir, localPartName(part.PartNumber))
+		data, err := os.ReadFile(partPath)
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: part %d not found", part.PartNumber)
+		}
+		if part.ETag != "" && strings.Trim(part.ETag, `"`) != strings.Trim(localETag(data), `"`) {
+			return fmt.Errorf("failed to complete multipart upload: etag mismatch for part %d", part.PartNumber)
+		}
+
+		f, err := os.Open(partPath)
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	if err := l.writeObject(key, io.MultiReader(readers...)); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("[LocalStorage] Failed to remove multipart upload dir %s: %v", dir, err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload отменяет загрузку по частям и удаляет загруженные части
+func (l *LocalStorage) AbortMultipartUpload(ctx context.Context, uploadID string, key string) error {
+	dir, err := l.checkUpload(uploadID, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func localPartName(partNumber int) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+// localETag вычисляет ETag части так же, как это делает S3 (MD5 в кавычках)
+func localETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func localContentType(key string) string {
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -3,6 +3,7 @@ package s3
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"mime/multipart"
 )
@@ -36,6 +37,7 @@ type Storage interface {
 	UploadBytes(key string, data []byte) error
 	GetObject(ctx context.Context, key string) (S3Object, error)
 	DeleteObject(key string) error
+	CopyObject(ctx context.Context, srcKey, dstKey string) error
 	GetObjectRange(ctx context.Context, key string, start, end int64) (S3Object, error)
 	// Новые методы для поддержки параллельной загрузки
 	CreateMultipartUpload(ctx context.Context, key string) (string, error)
@@ -44,8 +46,53 @@ type Storage interface {
 	AbortMultipartUpload(ctx context.Context, uploadID string, key string) error
 }
 
+// partCopier реализуют хранилища, которые могут загрузить часть из диапазона
+// другого объекта без передачи данных через сервер
+type partCopier interface {
+	UploadPartCopy(ctx context.Context, uploadID string, key string, partNumber int, srcKey string, start, end int64) (string, error)
+}
+
 // CompletedPart представляет загруженную часть файла
 type CompletedPart struct {
 	PartNumber int
 	ETag       string
 }
+
+// NewStorage создает хранилище в зависимости от драйвера, указанного в конфигурации
+func NewStorage(conf *Config) (Storage, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("configuration is required")
+	}
+
+	var storage Storage
+	switch conf.Driver {
+	case DriverLocal:
+		local, err := NewLocalStorage(conf)
+		if err != nil {
+			return nil, err
+		}
+		storage = local
+	case DriverS3, "":
+		client, err := NewClient(conf)
+		if err != nil {
+			return nil, err
+		}
+		storage = client
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", conf.Driver)
+	}
+
+	// Шифрование включается поверх любого драйвера
+	switch conf.EncryptionProvider {
+	case "":
+		return storage, nil
+	case EncryptionProviderLocal:
+		provider, err := NewLocalKeyProvider(conf.EncryptionKeyDir)
+		if err != nil {
+			return nil, err
+		}
+		return NewEncryptedStorage(storage, provider, OwnerKeyID), nil
+	default:
+		return nil, fmt.Errorf("unknown encryption key provider: %s", conf.EncryptionProvider)
+	}
+}
@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// ErrStreamTooLarge возвращается, когда поток превышает допустимый размер
+var ErrStreamTooLarge = errors.New("stream exceeds maximum allowed size")
+
+// StreamResult содержит размер и контрольную сумму загруженных данных
+type StreamResult struct {
+	Size   int64
+	SHA256 string
+}
+
+// UploadStream загружает данные из r в хранилище частями по partSize байт.
+// В памяти одновременно находится не больше одной части, поэтому размер
+// потока заранее знать не нужно. Функция validate вызывается после чтения
+// всех данных, но до завершения загрузки: если она вернет ошибку, объект
+// по ключу key останется нетронутым.
+func UploadStream(
+	ctx context.Context,
+	storage Storage,
+	key string,
+	r io.Reader,
+	partSize int64,
+	maxSize int64,
+	validate func(*StreamResult) error,
+) (*StreamResult, error) {
+	if partSize < defaultChunkSize {
+		partSize = defaultChunkSize
+	}
+
+	hasher := sha256.New()
+	// Читаем на один байт больше лимита, чтобы обнаружить превышение
+	reader := io.TeeReader(io.LimitReader(r, maxSize+1), hasher)
+	buf := make([]byte, partSize)
+	result := &StreamResult{}
+
+	readPart := func() (int, bool, error) {
+		n, err := io.ReadFull(reader, buf)
+		result.Size += int64(n)
+		if result.Size > maxSize {
+			return n, false, ErrStreamTooLarge
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, true, nil
+		}
+		if err != nil {
+			return n, false, fmt.Errorf("failed to read stream: %w", err)
+		}
+		return n, false, nil
+	}
+
+	finish := func() error {
+		result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+		if validate != nil {
+			return validate(result)
+		}
+		return nil
+	}
+
+	n, last, err := readPart()
+	if err != nil {
+		return nil, err
+	}
+
+	// Небольшой файл загружаем одним запросом
+	if last {
+		if err := finish(); err != nil {
+			return nil, err
+		}
+		if err := storage.UploadBytes(key, buf[:n]); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	uploadID, err := storage.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	abort := func(cause error) (*StreamResult, error) {
+		if abortErr := storage.AbortMultipartUpload(context.Background(), uploadID, key); abortErr != nil {
+			log.Printf("[S3] Failed to abort multipart upload %s: %v", uploadID, abortErr)
+		}
+		return nil, cause
+	}
+
+	var parts []CompletedPart
+	for partNumber := 1; ; partNumber++ {
+		if n > 0 || partNumber == 1 {
+			etag, err := storage.UploadPart(ctx, uploadID, key, partNumber, buf[:n])
+			if err != nil {
+				return abort(err)
+			}
+			parts = append(parts, CompletedPart{PartNumber: partNumber, ETag: etag})
+		}
+
+		if last {
+			break
+		}
+
+		n, last, err = readPart()
+		if err != nil {
+			return abort(err)
+		}
+	}
+
+	if err := finish(); err != nil {
+		return abort(err)
+	}
+
+	if err := storage.CompleteMultipartUpload(ctx, uploadID, key, parts); err != nil {
+		return abort(err)
+	}
+
+	return result, nil
+}
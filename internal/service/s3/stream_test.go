@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recordingStorage запоминает, какими запросами загружались данные
+type recordingStorage struct {
+	Storage
+	single  []int
+	parts   []int
+	aborted int
+}
+
+func (s *recordingStorage) UploadBytes(key string, data []byte) error {
+	s.single = append(s.single, len(data))
+	return s.Storage.UploadBytes(key, data)
+}
+
+func (s *recordingStorage) UploadPart(ctx context.Context, uploadID string, key string, partNumber int, data []byte) (string, error) {
+	s.parts = append(s.parts, len(data))
+	return s.Storage.UploadPart(ctx, uploadID, key, partNumber, data)
+}
+
+func (s *recordingStorage) AbortMultipartUpload(ctx context.Context, uploadID string, key string) error {
+	s.aborted++
+	return s.Storage.AbortMultipartUpload(ctx, uploadID, key)
+}
+
+func TestUploadStream(t *testing.T) {
+	const partSize = defaultChunkSize
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name       string
+		size       int
+		partSize   int64
+		maxSize    int64
+		reject     bool
+		wantSingle []int
+		wantParts  []int
+		wantErr    error
+	}{
+		{name: "empty", size: 0, partSize: partSize, maxSize: partSize, wantSingle: []int{0}},
+		{name: "smaller than part", size: 1000, partSize: partSize, maxSize: partSize, wantSingle: []int{1000}},
+		{name: "exactly one part", size: partSize, partSize: partSize, maxSize: 2 * partSize, wantParts: []int{partSize}},
+		{name: "short last part", size: 2*partSize + 10, partSize: partSize, maxSize: 3 * partSize, wantParts: []int{partSize, partSize, 10}},
+		{name: "part size below minimum", size: partSize + 1, partSize: 1024, maxSize: 2 * partSize, wantParts: []int{partSize, 1}},
+		{name: "at size limit", size: 1000, partSize: partSize, maxSize: 1000, wantSingle: []int{1000}},
+		{name: "over size limit", size: 1001, partSize: partSize, maxSize: 1000, wantErr: ErrStreamTooLarge},
+		{name: "over size limit in parts", size: 2*partSize + 1, partSize: partSize, maxSize: 2 * partSize, wantErr: ErrStreamTooLarge},
+		{name: "rejected by validate", size: partSize + 1, partSize: partSize, maxSize: 2 * partSize, reject: true, wantErr: errRejected},
+	}
+
+	for _, tt := range tests {
+		inner, err := NewLocalStorage(&Config{LocalRoot: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewLocalStorage: %v", err)
+		}
+		storage := &recordingStorage{Storage: inner}
+		data := bytes.Repeat([]byte{7}, tt.size)
+		key := "personal_drive_files/user-1/object"
+
+		var validate func(*StreamResult) error
+		if tt.reject {
+			validate = func(*StreamResult) error { return errRejected }
+		}
+
+		result, err := UploadStream(context.Background(), storage, key, bytes.NewReader(data), tt.partSize, tt.maxSize, validate)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if _, err := inner.GetObject(context.Background(), key); err == nil {
+				t.Errorf("%s: object was stored after a failed upload", tt.name)
+			}
+			if len(storage.parts) > 0 && storage.aborted != 1 {
+				t.Errorf("%s: multipart upload was not aborted", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: UploadStream: %v", tt.name, err)
+		}
+
+		sum := sha256.Sum256(data)
+		if result.Size != int64(tt.size) || result.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: result = %+v", tt.name, result)
+		}
+		if !slices.Equal(storage.single, tt.wantSingle) || !slices.Equal(storage.parts, tt.wantParts) {
+			t.Errorf("%s: single = %v, parts = %v; want %v, %v", tt.name, storage.single, storage.parts, tt.wantSingle, tt.wantParts)
+		}
+
+		got, err := readObject(inner.GetObject(context.Background(), key))
+		if err != nil {
+			t.Fatalf("%s: GetObject: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: stored content differs", tt.name)
+		}
+	}
+}
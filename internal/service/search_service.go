@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"unicode/utf8"
+)
+
+const (
+	maxSearchTextLength = 255 // Ограничивает длину поискового запроса
+	maxSearchTags       = 20  // Максимальное количество меток в фильтре
+)
+
+type SearchService struct {
+	searchRepo        *repository.SearchRepository
+	permissionService *PermissionService
+}
+
+func NewSearchService(searchRepo *repository.SearchRepository, permissionService *PermissionService) *SearchService {
+	return &SearchService{
+		searchRepo:        searchRepo,
+		permissionService: permissionService,
+	}
+}
+
+// Search ищет файлы и папки пользователя и ресурсы, к которым ему открыт доступ.
+// Элементы чужих папок возвращаются только при наличии права на просмотр
+func (s *SearchService) Search(ctx context.Context, query domain.SearchQuery, userID string) (*domain.SearchResult, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" && len(query.TagIDs) == 0 {
+		return nil, fmt.Errorf("invalid search query: text or tag is required")
+	}
+	if utf8.RuneCountInString(query.Text) > maxSearchTextLength {
+		return nil, fmt.Errorf("invalid search query: text is too long (max %d characters)", maxSearchTextLength)
+	}
+	if query.ItemType != "" && query.ItemType != "file" && query.ItemType != "folder" {
+		return nil, fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+	if query.MinSize != nil && query.MaxSize != nil && *query.MinSize > *query.MaxSize {
+		return nil, fmt.Errorf("invalid size range")
+	}
+	if query.UpdatedFrom != nil && query.UpdatedTo != nil && !query.UpdatedFrom.Before(*query.UpdatedTo) {
+		return nil, fmt.Errorf("invalid date range")
+	}
+	query.TagIDs = uniqueTagIDs(query.TagIDs)
+	if len(query.TagIDs) > maxSearchTags {
+		return nil, fmt.Errorf("invalid search query: too many tags (max %d)", maxSearchTags)
+	}
+	if query.Limit <= 0 {
+		query.Limit = domain.DefaultSearchLimit
+	}
+	if query.Limit > domain.MaxSearchLimit {
+		query.Limit = domain.MaxSearchLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	hits, total, err := s.searchRepo.Search(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]domain.SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		if hit.Shared {
+			allowed, err := s.canView(ctx, hit, userID)
+			if err != nil {
+				log.Printf("[Search] Failed to check access to %s: %v", hit.ItemType, err)
+				continue
+			}
+			if !allowed {
+				continue
+			}
+		}
+		hit.Snippet = highlightSnippet(hit.Snippet)
+		visible = append(visible, hit)
+	}
+
+	return &domain.SearchResult{
+		Query:   query.Text,
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		HasMore: query.Offset+len(hits) < total,
+		Hits:    visible,
+	}, nil
+}
+
+// canView проверяет право на просмотр найденного чужого элемента
+func (s *SearchService) canView(ctx context.Context, hit domain.SearchHit, userID string) (bool, error) {
+	if hit.File != nil {
+		return s.permissionService.CheckFileViewPermission(ctx, userID, hit.File)
+	}
+	return s.permissionService.CheckSharedFolderPermission(ctx, userID, hit.Folder.ID, OperationView)
+}
+
+// highlightSnippet экранирует фрагмент содержимого и заменяет маркеры совпадений на <mark>
+func highlightSnippet(snippet string) string {
+	if snippet == "" {
+		return ""
+	}
+	return strings.NewReplacer(domain.SnippetStart, "<mark>", domain.SnippetStop, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// uniqueTagIDs убирает повторяющиеся метки из фильтра
+func uniqueTagIDs(tagIDs []int64) []int64 {
+	seen := make(map[int64]bool, len(tagIDs))
+	unique := tagIDs[:0]
+	for _, id := range tagIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
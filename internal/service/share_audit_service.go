@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"synxrondrive/internal/auth"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"time"
+)
+
+// defaultShareAccessLogRetention - срок хранения журнала обращений к ссылкам по умолчанию
+const defaultShareAccessLogRetention = 90 * 24 * time.Hour
+
+// ShareAuditService ведет журнал обращений к ссылкам. Запись журнала не должна
+// мешать основной операции, поэтому ошибки записи только логируются
+type ShareAuditService struct {
+	auditRepo *repository.ShareAuditRepository
+	shareRepo *repository.ShareRepository
+	retention time.Duration
+}
+
+// NewShareAuditService создает сервис журнала. retentionDays <= 0 означает срок по умолчанию
+func NewShareAuditService(auditRepo *repository.ShareAuditRepository, shareRepo *repository.ShareRepository, retentionDays int) *ShareAuditService {
+	retention := defaultShareAccessLogRetention
+	if retentionDays > 0 {
+		retention = time.Duration(retentionDays) * 24 * time.Hour
+	}
+	return &ShareAuditService{
+		auditRepo: auditRepo,
+		shareRepo: shareRepo,
+		retention: retention,
+	}
+}
+
+// RecordToken записывает обращение к ссылке по токену. resourceID - файл или папка
+// внутри ссылки, пустая строка - сама ссылка
+func (s *ShareAuditService) RecordToken(ctx context.Context, token string, accessor domain.ShareAccessor, action domain.ShareAccessAction, resourceID string) {
+	if err := s.auditRepo.RecordByToken(ctx, token, accessor, action, optionalString(resourceID)); err != nil {
+		log.Printf("[ShareAudit] Failed to record %s of share by token: %v", action, err)
+	}
+}
+
+// RecordShare записывает обращение к ссылке по ее ID
+func (s *ShareAuditService) RecordShare(ctx context.Context, shareID string, accessor domain.ShareAccessor, action domain.ShareAccessAction, resourceID string) {
+	id, err := uuid.Parse(shareID)
+	if err != nil {
+		return
+	}
+	if err := s.auditRepo.RecordByID(ctx, id, accessor, action, optionalString(resourceID)); err != nil {
+		log.Printf("[ShareAudit] Failed to record %s of share %s: %v", action, shareID, err)
+	}
+}
+
+// RecordFileAccess записывает скачивание или просмотр чужого файла в журналы
+// ссылок, через которые файл открыт пользователю
+func (s *ShareAuditService) RecordFileAccess(ctx context.Context, file *domain.File, userID string, action domain.ShareAccessAction) {
+	if file == nil || userID == "" || file.OwnerID == userID {
+		return
+	}
+	if err := s.auditRepo.RecordFileAccess(ctx, userID, file, action); err != nil {
+		log.Printf("[ShareAudit] Failed to record %s of file %s by %s: %v", action, file.UUID, userID, err)
+	}
+}
+
+// RecordTokenFileAccess записывает обращение к файлу внутри ссылки с токеном token,
+// в том числе анонимное
+func (s *ShareAuditService) RecordTokenFileAccess(ctx context.Context, token string, accessor domain.ShareAccessor, file *domain.File, action domain.ShareAccessAction) {
+	if file == nil || token == "" {
+		return
+	}
+	if err := s.auditRepo.RecordFileAccessByToken(ctx, token, accessor, file, action); err != nil {
+		log.Printf("[ShareAudit] Failed to record %s of file %s by token: %v", action, file.UUID, err)
+	}
+}
+
+// GetAccessLog возвращает владельцу страницу журнала обращений к его ссылке
+func (s *ShareAuditService) GetAccessLog(ctx context.Context, shareID string, ownerID string, limit int, offset int) (*domain.ShareAccessLogPage, error) {
+	id, err := uuid.Parse(shareID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share ID")
+	}
+	if _, err := s.shareRepo.GetOwnedShare(ctx, id.String(), ownerID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = domain.DefaultShareAccessLogLimit
+	}
+	if limit > domain.MaxShareAccessLogLimit {
+		limit = domain.MaxShareAccessLogLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, total, err := s.auditRepo.List(ctx, id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.loadUsers(ctx, entries)
+
+	return &domain.ShareAccessLogPage{
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: offset+len(entries) < total,
+		Entries: entries,
+	}, nil
+}
+
+// PruneAccessLog удаляет записи журнала старше срока хранения
+func (s *ShareAuditService) PruneAccessLog(ctx context.Context) error {
+	deleted, err := s.auditRepo.DeleteOlderThan(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("[ShareAudit] Pruned %d share access log entries", deleted)
+	}
+	return nil
+}
+
+// loadUsers дополняет записи именами и email пользователей
+func (s *ShareAuditService) loadUsers(ctx context.Context, entries []domain.ShareAccessEntry) {
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.UserID != nil && !seen[*entry.UserID] {
+			seen[*entry.UserID] = true
+			userIDs = append(userIDs, *entry.UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	users, err := auth.GetUsersByIds(ctx, userIDs)
+	if err != nil {
+		log.Printf("[ShareAudit] Failed to get users: %v", err)
+		return
+	}
+	usersByID := make(map[string]auth.UserInfo, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	for i := range entries {
+		if entries[i].UserID == nil {
+			continue
+		}
+		if user, ok := usersByID[*entries[i].UserID]; ok {
+			entries[i].Email = user.Email
+			entries[i].Name = user.Name
+			entries[i].Lastname = user.Lastname
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"synxrondrive/internal/domain"
+	"time"
+)
+
+const (
+	// linkAccessTTL - время жизни токена доступа, выданного после проверки пароля
+	linkAccessTTL = 30 * time.Minute
+
+	minLinkPasswordLength = 4
+	// bcrypt учитывает только первые 72 байта пароля
+	maxLinkPasswordLength = 72
+
+	// После linkPasswordAttempts неверных паролей подряд проверка пароля ссылки
+	// блокируется на linkPasswordLockout
+	linkPasswordAttempts = 5
+	linkPasswordLockout  = time.Minute
+)
+
+// errUploadOnly - ссылка запроса файлов не открывает содержимое папки
+var errUploadOnly = fmt.Errorf("access denied: link only accepts uploads")
+
+// ShareLinkOptions - ограничения ссылки, задаваемые при создании
+type ShareLinkOptions struct {
+	Password     string
+	MaxDownloads *int
+	PreviewOnly  bool
+	UploadOnly   bool
+}
+
+// restricted сообщает, задано ли хотя бы одно ограничение
+func (o ShareLinkOptions) restricted() bool {
+	return o.Password != "" || o.MaxDownloads != nil || o.PreviewOnly || o.UploadOnly
+}
+
+// linkAttempts считает неверные пароли по каждой ссылке
+type linkAttempts struct {
+	mu       sync.Mutex
+	failures map[uuid.UUID]*linkFailures
+}
+
+type linkFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func newLinkAttempts() *linkAttempts {
+	return &linkAttempts{failures: make(map[uuid.UUID]*linkFailures)}
+}
+
+func (a *linkAttempts) locked(shareID uuid.UUID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[shareID]
+	return ok && time.Now().Before(f.lockedUntil)
+}
+
+func (a *linkAttempts) fail(shareID uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[shareID]
+	if !ok {
+		f = &linkFailures{}
+		a.failures[shareID] = f
+	}
+	f.count++
+	if f.count >= linkPasswordAttempts {
+		f.count = 0
+		f.lockedUntil = time.Now().Add(linkPasswordLockout)
+	}
+}
+
+func (a *linkAttempts) reset(shareID uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, shareID)
+}
+
+// newLinkSecret возвращает ключ подписи токенов доступа. Без заданного ключа
+// генерируется случайный: выданные токены перестанут действовать после перезапуска
+func newLinkSecret(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	log.Printf("[ShareService] Share link secret is not configured, using a random one")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("[ShareService] Failed to generate share link secret: %v", err)
+	}
+	return b
+}
+
+// VerifyLinkPassword проверяет пароль ссылки и выдает короткоживущий токен доступа
+func (s *ShareService) VerifyLinkPassword(ctx context.Context, token string, password string) (*domain.LinkAccess, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !share.HasPassword() {
+		return nil, fmt.Errorf("invalid request: share is not password protected")
+	}
+	if s.attempts.locked(share.ID) {
+		return nil, fmt.Errorf("too many password attempts, try again later")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)); err != nil {
+		s.attempts.fail(share.ID)
+		return nil, fmt.Errorf("access denied: wrong password")
+	}
+	s.attempts.reset(share.ID)
+
+	expiresAt := time.Now().Add(linkAccessTTL)
+	return &domain.LinkAccess{
+		ShareID:     share.ID,
+		AccessToken: s.signLinkAccess(share, expiresAt),
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// checkLinkAccess проверяет, что по ссылке можно просматривать ресурс: ссылка
+// запроса файлов содержимое не открывает, а для ссылки с паролем нужен его ввод
+func (s *ShareService) checkLinkAccess(ctx context.Context, share *domain.Share, userID string, accessTokens []string) error {
+	if share.UploadOnly && share.OwnerID != userID {
+		return errUploadOnly
+	}
+	return s.checkLinkPassword(ctx, share, userID, accessTokens)
+}
+
+// checkLinkPassword проверяет пароль ссылки. Без пароля могут войти владелец,
+// получатели ссылки и предъявившие действующий токен доступа
+func (s *ShareService) checkLinkPassword(ctx context.Context, share *domain.Share, userID string, accessTokens []string) error {
+	if !share.HasPassword() || share.OwnerID == userID {
+		return nil
+	}
+	for _, accessToken := range accessTokens {
+		if s.verifyLinkAccess(share, accessToken) {
+			return nil
+		}
+	}
+
+	isRecipient, err := s.shareRepo.IsRecipient(ctx, share.ID, userID)
+	if err != nil {
+		return err
+	}
+	if isRecipient {
+		return nil
+	}
+	return fmt.Errorf("password required")
+}
+
+// signLinkAccess подписывает ID ссылки и срок действия токена. В подпись входит
+// хеш пароля, поэтому смена пароля отзывает все выданные токены
+func (s *ShareService) signLinkAccess(share *domain.Share, expiresAt time.Time) string {
+	payload := share.ID.String() + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.linkAccessMAC(payload, share.PasswordHash))
+}
+
+func (s *ShareService) verifyLinkAccess(share *domain.Share, accessToken string) bool {
+	encodedPayload, encodedMAC, ok := strings.Cut(accessToken, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.linkAccessMAC(string(payload), share.PasswordHash)) {
+		return false
+	}
+
+	shareID, expires, ok := strings.Cut(string(payload), ".")
+	if !ok || shareID != share.ID.String() {
+		return false
+	}
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	return err == nil && time.Now().Unix() < expiresUnix
+}
+
+func (s *ShareService) linkAccessMAC(payload string, passwordHash string) []byte {
+	mac := hmac.New(sha256.New, s.linkSecret)
+	mac.Write([]byte(payload + "." + passwordHash))
+	return mac.Sum(nil)
+}
+
+// hashLinkPassword проверяет длину пароля ссылки и возвращает его bcrypt-хеш
+func hashLinkPassword(password string) (string, error) {
+	if len(password) < minLinkPasswordLength || len(password) > maxLinkPasswordLength {
+		return "", fmt.Errorf("invalid password: length must be between %d and %d bytes",
+			minLinkPasswordLength, maxLinkPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// validateMaxDownloads проверяет лимит скачиваний ссылки
+func validateMaxDownloads(maxDownloads *int) error {
+	if maxDownloads != nil && *maxDownloads <= 0 {
+		return fmt.Errorf("invalid max_downloads: must be positive")
+	}
+	return nil
+}
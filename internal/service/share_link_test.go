@@ -0,0 +1,138 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"strings"
+	"synxrondrive/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestLinkAccessToken(t *testing.T) {
+	s := &ShareService{linkSecret: []byte("test-secret")}
+	share := &domain.Share{ID: uuid.New(), PasswordHash: "hash-1"}
+	otherShare := &domain.Share{ID: uuid.New(), PasswordHash: "hash-1"}
+	changedPassword := &domain.Share{ID: share.ID, PasswordHash: "hash-2"}
+
+	valid := s.signLinkAccess(share, time.Now().Add(time.Minute))
+	expired := s.signLinkAccess(share, time.Now().Add(-time.Second))
+	payload, _, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name  string
+		share *domain.Share
+		token string
+		want  bool
+	}{
+		{"valid", share, valid, true},
+		{"expired", share, expired, false},
+		{"other share", otherShare, valid, false},
+		{"password changed", changedPassword, valid, false},
+		{"other secret", share, (&ShareService{linkSecret: []byte("other")}).signLinkAccess(share, time.Now().Add(time.Minute)), false},
+		{"forged signature", share, payload + ".AAAA", false},
+		{"missing signature", share, payload, false},
+		{"garbage", share, "not a token", false},
+		{"empty", share, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := s.verifyLinkAccess(tt.share, tt.token); got != tt.want {
+			t.Errorf("%s: verifyLinkAccess = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnyGrantAllowsDownload(t *testing.T) {
+	s := &PermissionService{}
+	limit := 3
+
+	tests := []struct {
+		name  string
+		grant domain.ShareGrant
+		op    OperationType
+		want  bool
+	}{
+		{"view link downloads", domain.ShareGrant{AccessType: domain.AccessTypeView}, OperationDownload, true},
+		{"preview only", domain.ShareGrant{AccessType: domain.AccessTypeFull, PreviewOnly: true}, OperationDownload, false},
+		{"preview only still views", domain.ShareGrant{AccessType: domain.AccessTypeView, PreviewOnly: true}, OperationView, true},
+		{"limited needs counting", domain.ShareGrant{AccessType: domain.AccessTypeView, MaxDownloads: &limit}, OperationDownload, false},
+		{"limited still views", domain.ShareGrant{AccessType: domain.AccessTypeView, MaxDownloads: &limit}, OperationView, true},
+		{"view cannot edit", domain.ShareGrant{AccessType: domain.AccessTypeView}, OperationEdit, false},
+		{"edit cannot share", domain.ShareGrant{AccessType: domain.AccessTypeEdit}, OperationShare, false},
+		{"full shares", domain.ShareGrant{AccessType: domain.AccessTypeFull}, OperationShare, true},
+	}
+
+	for _, tt := range tests {
+		if got := s.anyGrantAllows([]domain.ShareGrant{tt.grant}, tt.op); got != tt.want {
+			t.Errorf("%s: anyGrantAllows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Одна ссылка без ограничений разрешает скачивание, даже если другие ограничены
+	grants := []domain.ShareGrant{
+		{AccessType: domain.AccessTypeFull, PreviewOnly: true},
+		{AccessType: domain.AccessTypeView, MaxDownloads: &limit},
+		{AccessType: domain.AccessTypeView},
+	}
+	if !s.anyGrantAllows(grants, OperationDownload) {
+		t.Errorf("unrestricted grant does not allow download")
+	}
+}
+
+func TestLinkAttemptsLockout(t *testing.T) {
+	attempts := newLinkAttempts()
+	shareID := uuid.New()
+
+	for i := 1; i < linkPasswordAttempts; i++ {
+		attempts.fail(shareID)
+		if attempts.locked(shareID) {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	attempts.fail(shareID)
+	if !attempts.locked(shareID) {
+		t.Fatalf("not locked after %d failures", linkPasswordAttempts)
+	}
+	if attempts.locked(uuid.New()) {
+		t.Errorf("lockout leaked to another share")
+	}
+
+	attempts.reset(shareID)
+	if attempts.locked(shareID) {
+		t.Errorf("still locked after reset")
+	}
+}
+
+func TestValidateLinkOptions(t *testing.T) {
+	zero, negative, positive := 0, -1, 5
+
+	maxDownloads := []struct {
+		value   *int
+		wantErr bool
+	}{
+		{nil, false},
+		{&positive, false},
+		{&zero, true},
+		{&negative, true},
+	}
+	for _, tt := range maxDownloads {
+		if err := validateMaxDownloads(tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("validateMaxDownloads(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+	}
+
+	passwords := []struct {
+		password string
+		wantErr  bool
+	}{
+		{"abc", true},
+		{"abcd", false},
+		{strings.Repeat("a", maxLinkPasswordLength), false},
+		{strings.Repeat("a", maxLinkPasswordLength+1), true},
+	}
+	for _, tt := range passwords {
+		if _, err := hashLinkPassword(tt.password); (err != nil) != tt.wantErr {
+			t.Errorf("hashLinkPassword(len %d) error = %v, wantErr %v", len(tt.password), err, tt.wantErr)
+		}
+	}
+}
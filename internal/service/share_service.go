@@ -9,6 +9,7 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"synxrondrive/internal/auth"
 	"synxrondrive/internal/domain"
 	"synxrondrive/internal/repository"
 	"time"
@@ -18,12 +19,16 @@ type ShareService struct {
 	shareRepo  *repository.ShareRepository
 	fileRepo   *repository.FileRepository
 	folderRepo *repository.FolderRepository
+	linkSecret []byte
+	attempts   *linkAttempts
 }
 
 type SharedResource struct {
-	ResourceType domain.ResourceType `json:"resource_type"`
-	AccessType   domain.AccessType   `json:"access_type"`
-	Data         interface{}         `json:"data"`
+	ResourceType  domain.ResourceType `json:"resource_type"`
+	AccessType    domain.AccessType   `json:"access_type"`
+	PreviewOnly   bool                `json:"preview_only"`
+	DownloadsLeft *int                `json:"downloads_left,omitempty"`
+	Data          interface{}         `json:"data"`
 }
 
 type SharedWithMeResource struct {
@@ -35,11 +40,14 @@ func NewShareService(
 	shareRepo *repository.ShareRepository,
 	fileRepo *repository.FileRepository,
 	folderRepo *repository.FolderRepository,
+	linkSecret string,
 ) *ShareService {
 	return &ShareService{
 		shareRepo:  shareRepo,
 		fileRepo:   fileRepo,
 		folderRepo: folderRepo,
+		linkSecret: newLinkSecret(linkSecret),
+		attempts:   newLinkAttempts(),
 	}
 }
 
@@ -59,7 +67,12 @@ func (s *ShareService) CreateShare(
 	accessType domain.AccessType,
 	expiresIn *time.Duration,
 	userID string,
+	options ShareLinkOptions,
 ) (*domain.Share, error) {
+	if err := validateMaxDownloads(options.MaxDownloads); err != nil {
+		return nil, err
+	}
+
 	// Проверяем владельца ресурса
 	switch resourceType {
 	case domain.ResourceTypeFile:
@@ -95,9 +108,21 @@ func (s *ShareService) CreateShare(
 		expiresAt = &t
 	}
 
-	existingShare, err := s.shareRepo.GetExistingShare(ctx, resourceID, resourceType, ownerID, accessType, expiresAt)
-	if err == nil && existingShare != nil {
-		return existingShare, nil
+	// Ссылки с ограничениями всегда создаются заново
+	if !options.restricted() {
+		existingShare, err := s.shareRepo.GetExistingShare(ctx, resourceID, resourceType, ownerID, accessType, expiresAt)
+		if err == nil && existingShare != nil {
+			return existingShare, nil
+		}
+	}
+
+	var passwordHash string
+	if options.Password != "" {
+		hash, err := hashLinkPassword(options.Password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = hash
 	}
 
 	// Если не нашли существующий share, создаем новый
@@ -114,6 +139,10 @@ func (s *ShareService) CreateShare(
 		AccessType:   accessType,
 		Token:        token,
 		ExpiresAt:    expiresAt,
+		PasswordHash: passwordHash,
+		MaxDownloads: options.MaxDownloads,
+		PreviewOnly:  options.PreviewOnly,
+		UploadOnly:   options.UploadOnly,
 	}
 
 	err = s.shareRepo.Create(ctx, share)
@@ -131,9 +160,29 @@ func (s *ShareService) GetSharedResource(ctx context.Context, token string) (*Sh
 		return nil, fmt.Errorf("share not found or expired: %w", err)
 	}
 
+	return s.sharedResource(ctx, share)
+}
+
+// OpenLink возвращает ресурс, открытый по ссылке. Для ссылки с паролем
+// без действующего токена доступа возвращается ошибка "password required"
+func (s *ShareService) OpenLink(ctx context.Context, token string, userID string, accessTokens []string) (*SharedResource, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
+
+	return s.sharedResource(ctx, share)
+}
+
+func (s *ShareService) sharedResource(ctx context.Context, share *domain.Share) (*SharedResource, error) {
 	var resource SharedResource
 	resource.ResourceType = share.ResourceType
 	resource.AccessType = share.AccessType
+	resource.PreviewOnly = share.PreviewOnly
+	resource.DownloadsLeft = share.DownloadsLeft()
 
 	// В зависимости от типа ресурса получаем данные
 	switch share.ResourceType {
@@ -161,7 +210,7 @@ func (s *ShareService) GetSharedResource(ctx context.Context, token string) (*Sh
 		}
 
 		// Получаем содержимое папки, используя ID владельца
-		content, err := s.folderRepo.GetContent(ctx, folderID, folder.OwnerID)
+		content, err := s.folderRepo.GetContent(ctx, folderID, folder.OwnerID, domain.ListOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("failed to get folder content: %w", err)
 		}
@@ -208,7 +257,7 @@ func (s *ShareService) GetSharedWithUser(ctx context.Context, userID string) ([]
 			}
 
 			// Получаем содержимое папки
-			content, err := s.folderRepo.GetContent(ctx, folderID, folder.OwnerID)
+			content, err := s.folderRepo.GetContent(ctx, folderID, folder.OwnerID, domain.ListOptions{})
 			if err != nil {
 				continue
 			}
@@ -228,9 +277,17 @@ func (s *ShareService) GetSharedWithUser(ctx context.Context, userID string) ([]
 }
 
 // GetSharedContent получает содержимое общего ресурса с учетом путей
-func (s *ShareService) GetSharedContent(ctx context.Context, shareID string, path string, userID string) (*domain.SharedContent, error) {
+func (s *ShareService) GetSharedContent(ctx context.Context, shareID string, path string, userID string, accessTokens []string) (*domain.SharedContent, error) {
 	log.Printf("[GetSharedContent] Starting with path: %s", path)
 
+	share, err := s.shareRepo.GetByID(ctx, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
+
 	// Если путь указывает на папку, проверяем доступ к ней
 	if strings.HasPrefix(path, "/folders/") {
 		folderIDStr := strings.TrimPrefix(path, "/folders/")
@@ -248,7 +305,7 @@ func (s *ShareService) GetSharedContent(ctx context.Context, shareID string, pat
 	}
 
 	// Получаем содержимое
-	content, err := s.shareRepo.GetShareContent(ctx, shareID, path)
+	content, err := s.shareRepo.GetShareContent(ctx, shareID, path, domain.ListOptions{})
 	if err != nil {
 		log.Printf("[GetSharedContent] Error getting content: %v", err)
 		return nil, fmt.Errorf("failed to get content: %w", err)
@@ -270,7 +327,15 @@ func (s *ShareService) AddUserToShare(ctx context.Context, shareID string, userI
 		return fmt.Errorf("share has expired")
 	}
 
-	return s.shareRepo.AddUserToShare(ctx, shareID, userID)
+	// Владелец не добавляется в получатели собственной ссылки
+	if share.OwnerID == userID {
+		return nil
+	}
+	if share.UploadOnly {
+		return errUploadOnly
+	}
+
+	return s.shareRepo.AddRecipient(ctx, share, userID)
 }
 
 // GetUserSharedContent получает все доступные пользователю ресурсы
@@ -285,7 +350,7 @@ func (s *ShareService) GetUserSharedContent(ctx context.Context, userID string)
 	for _, share := range shares {
 		// Дополнительная проверка, что это не собственный ресурс
 		if share.OwnerID != userID {
-			content, err := s.shareRepo.GetShareContent(ctx, share.ID.String(), "/")
+			content, err := s.shareRepo.GetShareContent(ctx, share.ID.String(), "/", domain.ListOptions{})
 			if err != nil {
 				continue // Пропускаем недоступные ресурсы
 			}
@@ -308,16 +373,7 @@ func (s *ShareService) hasAccess(share *domain.Share, userID string) bool {
 		return true // Для публичных ссылок разрешаем доступ всем
 	}
 
-	// 3. Для непубличных ресурсов проверяем список пользователей
-	if share.UserIDs != "" {
-		userIDs := strings.Split(share.UserIDs, ",")
-		for _, id := range userIDs {
-			if id == userID {
-				return true
-			}
-		}
-	}
-
+	// Доступ получателей к ресурсу вне ссылки проверяет PermissionService
 	return false
 }
 
@@ -346,22 +402,28 @@ func (s *ShareService) generateSharedBreadcrumbs(content *domain.SharedContent)
 }
 
 // GrantAccess предоставляет доступ пользователю к ресурсу
-func (s *ShareService) GrantAccess(ctx context.Context, token string, userID string) (*domain.Share, interface{}, error) {
+func (s *ShareService) GrantAccess(ctx context.Context, token string, userID string, accessTokens []string) (*domain.Share, interface{}, error) {
 	// Получаем share по токену
 	share, err := s.shareRepo.GetByToken(ctx, token)
 	if err != nil {
 		return nil, nil, fmt.Errorf("share not found or expired: %w", err)
 	}
 
+	// Ссылка с паролем открывается только после его проверки
+	if err := s.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, nil, err
+	}
+
 	// Проверяем срок действия
 	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
 		return nil, nil, fmt.Errorf("share has expired")
 	}
 
-	// Для публичных ссылок НЕ добавляем пользователя в UserIDs
-	// Добавляем пользователя только если это не публичная ссылка
-	if share.Token == "" {
-		if err = s.shareRepo.AddUserToShare(ctx, share.ID.String(), userID); err != nil {
+	// Открывший ссылку пользователь становится получателем: так ресурс появляется
+	// в "Доступные мне" и открывается без токена с уровнем доступа ссылки.
+	// Ограничения ссылки на скачивание действуют и для получателей
+	if share.OwnerID != userID {
+		if err = s.shareRepo.AddRecipient(ctx, share, userID); err != nil {
 			return nil, nil, fmt.Errorf("failed to add user to share: %w", err)
 		}
 	}
@@ -392,7 +454,15 @@ func (s *ShareService) GrantAccess(ctx context.Context, token string, userID str
 	return share, resource, nil
 }
 
-func (s *ShareService) GetSharedFolderContent(ctx context.Context, token string, folderID string, userID string) (*domain.SharedContent, error) {
+// GetSharedFolderContent возвращает страницу содержимого папки внутри общего ресурса
+func (s *ShareService) GetSharedFolderContent(
+	ctx context.Context,
+	token string,
+	folderID string,
+	userID string,
+	accessTokens []string,
+	opts domain.ListOptions,
+) (*domain.SharedContent, error) {
 	// Получаем share по токену
 	share, err := s.shareRepo.GetByToken(ctx, token)
 	if err != nil {
@@ -403,6 +473,9 @@ func (s *ShareService) GetSharedFolderContent(ctx context.Context, token string,
 	if !s.hasAccess(share, userID) {
 		return nil, fmt.Errorf("access denied")
 	}
+	if err := s.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
 
 	// Конвертируем folderID в int64
 	folderIDInt, err := strconv.ParseInt(folderID, 10, 64)
@@ -413,7 +486,7 @@ func (s *ShareService) GetSharedFolderContent(ctx context.Context, token string,
 	// Если это корневая папка share
 	rootFolderID := share.ResourceID
 	if rootFolderID == folderID {
-		return s.shareRepo.GetShareContent(ctx, share.ID.String(), "/")
+		return s.shareRepo.GetShareContent(ctx, share.ID.String(), "/", opts)
 	}
 
 	// Проверяем иерархию папок
@@ -427,7 +500,7 @@ func (s *ShareService) GetSharedFolderContent(ctx context.Context, token string,
 	}
 
 	// Получаем содержимое папки
-	return s.shareRepo.GetShareContent(ctx, share.ID.String(), fmt.Sprintf("/folders/%d", folderIDInt))
+	return s.shareRepo.GetShareContent(ctx, share.ID.String(), fmt.Sprintf("/folders/%d", folderIDInt), opts)
 }
 
 func (s *ShareService) validateFolderAccess(ctx context.Context, shareID string, folderID int64, userID string) error {
@@ -482,7 +555,7 @@ func (s *ShareService) validateFolderAccess(ctx context.Context, shareID string,
 	return nil
 }
 
-func (s *ShareService) GetSharedFolderStructure(ctx context.Context, shareID string, userID string) ([]domain.Folder, error) {
+func (s *ShareService) GetSharedFolderStructure(ctx context.Context, shareID string, userID string, accessTokens []string) ([]domain.Folder, error) {
 	// Получаем share
 	share, err := s.shareRepo.GetByID(ctx, shareID)
 	if err != nil {
@@ -493,6 +566,9 @@ func (s *ShareService) GetSharedFolderStructure(ctx context.Context, shareID str
 	if !s.hasAccess(share, userID) {
 		return nil, fmt.Errorf("access denied")
 	}
+	if err := s.checkLinkAccess(ctx, share, userID, accessTokens); err != nil {
+		return nil, err
+	}
 
 	// Получаем структуру папок
 	folders, err := s.shareRepo.GetSharedFolderStructure(ctx, shareID)
@@ -502,3 +578,238 @@ func (s *ShareService) GetSharedFolderStructure(ctx context.Context, shareID str
 
 	return folders, nil
 }
+
+// ShareUpdate - изменения ссылки; nil оставляет значение без изменений.
+// Нулевой ExpiresIn снимает ограничение срока действия. Recipients заменяет
+// список получателей; получатель без уровня доступа получает уровень ссылки
+type ShareUpdate struct {
+	AccessType *domain.AccessType
+	ExpiresIn  *time.Duration
+	Recipients *[]domain.ShareRecipient
+	// Password задает пароль ссылки, пустая строка снимает его
+	Password *string
+	// MaxDownloads задает лимит скачиваний, 0 снимает его
+	MaxDownloads *int
+	PreviewOnly  *bool
+}
+
+// ListMyShares возвращает все ссылки пользователя с именами ресурсов и получателями
+func (s *ShareService) ListMyShares(ctx context.Context, ownerID string) ([]domain.OwnedShare, error) {
+	shares, err := s.shareRepo.GetOwnerShares(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadRecipients(ctx, shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// UpdateShare изменяет уровень доступа, срок действия и получателей ссылки.
+// Токен ссылки сохраняется, исключенные получатели сразу теряют доступ
+func (s *ShareService) UpdateShare(ctx context.Context, shareID string, ownerID string, update ShareUpdate) (*domain.OwnedShare, error) {
+	if _, err := uuid.Parse(shareID); err != nil {
+		return nil, fmt.Errorf("invalid share ID")
+	}
+	owned, err := s.shareRepo.GetOwnedShare(ctx, shareID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	share := owned.Share
+	previousAccess := share.AccessType
+
+	if update.AccessType != nil {
+		if !isValidAccessType(*update.AccessType) {
+			return nil, fmt.Errorf("invalid access type: must be 'view', 'edit' or 'full'")
+		}
+		share.AccessType = *update.AccessType
+	}
+
+	if update.ExpiresIn != nil {
+		switch {
+		case *update.ExpiresIn < 0:
+			return nil, fmt.Errorf("invalid expires_in: must not be negative")
+		case *update.ExpiresIn == 0:
+			share.ExpiresAt = nil
+		default:
+			t := time.Now().Add(*update.ExpiresIn)
+			share.ExpiresAt = &t
+		}
+	}
+
+	if update.Password != nil {
+		share.PasswordHash = ""
+		if *update.Password != "" {
+			if share.PasswordHash, err = hashLinkPassword(*update.Password); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if update.MaxDownloads != nil {
+		switch {
+		case *update.MaxDownloads < 0:
+			return nil, fmt.Errorf("invalid max_downloads: must not be negative")
+		case *update.MaxDownloads == 0:
+			share.MaxDownloads = nil
+		default:
+			maxDownloads := *update.MaxDownloads
+			share.MaxDownloads = &maxDownloads
+		}
+	}
+
+	if update.PreviewOnly != nil {
+		share.PreviewOnly = *update.PreviewOnly
+	}
+
+	var recipients []domain.ShareRecipient
+	switch {
+	case update.Recipients != nil:
+		recipients, err = s.normalizeRecipients(ctx, *update.Recipients, &share)
+		if err != nil {
+			return nil, err
+		}
+	case share.AccessType != previousAccess:
+		// Без явного списка получатели с прежним уровнем ссылки получают новый
+		current, err := s.shareRepo.GetRecipients(ctx, []string{shareID})
+		if err != nil {
+			return nil, err
+		}
+		recipients = make([]domain.ShareRecipient, 0, len(current))
+		for _, recipient := range current {
+			if recipient.AccessType == previousAccess {
+				recipient.AccessType = share.AccessType
+			}
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	if err := s.shareRepo.Update(ctx, &share, recipients); err != nil {
+		return nil, err
+	}
+
+	owned.Share = share
+	owned.PasswordProtected = share.HasPassword()
+	owned.Expired = share.ExpiresAt != nil && !share.ExpiresAt.After(time.Now())
+	shares := []domain.OwnedShare{*owned}
+	if err := s.loadRecipients(ctx, shares); err != nil {
+		return nil, err
+	}
+	return &shares[0], nil
+}
+
+// RevokeShare удаляет ссылку. Доступ проверяется по ссылке при каждом запросе,
+// поэтому отзыв сразу действует и для токена, и для получателей
+func (s *ShareService) RevokeShare(ctx context.Context, shareID string, ownerID string) error {
+	if _, err := uuid.Parse(shareID); err != nil {
+		return fmt.Errorf("invalid share ID")
+	}
+	if _, err := s.shareRepo.GetOwnedShare(ctx, shareID, ownerID); err != nil {
+		return err
+	}
+	if err := s.shareRepo.DeleteShare(ctx, shareID, ownerID); err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+	log.Printf("[ShareService] Share %s revoked by owner %s", shareID, ownerID)
+	return nil
+}
+
+// normalizeRecipients убирает пустые значения, дубликаты и владельца ссылки,
+// проверяет уровни доступа и то, что все пользователи существуют
+func (s *ShareService) normalizeRecipients(ctx context.Context, recipients []domain.ShareRecipient, share *domain.Share) ([]domain.ShareRecipient, error) {
+	// Получатели ссылки видят папку, а запрос файлов ее содержимое не открывает
+	if share.UploadOnly && len(recipients) > 0 {
+		return nil, fmt.Errorf("invalid recipients: file request links have no recipients")
+	}
+	result := make([]domain.ShareRecipient, 0, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	userIDs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		id := strings.TrimSpace(recipient.ID)
+		if id == "" || id == share.OwnerID || seen[id] {
+			continue
+		}
+		accessType := recipient.AccessType
+		if accessType == "" {
+			accessType = share.AccessType
+		}
+		if !isValidAccessType(accessType) {
+			return nil, fmt.Errorf("invalid access type for user %s", id)
+		}
+		seen[id] = true
+		userIDs = append(userIDs, id)
+		result = append(result, domain.ShareRecipient{ID: id, AccessType: accessType})
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	users, err := auth.GetUsersByIds(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	known := make(map[string]bool, len(users))
+	for _, user := range users {
+		known[user.ID] = true
+	}
+	for _, id := range userIDs {
+		if !known[id] {
+			return nil, fmt.Errorf("invalid user ID: %s", id)
+		}
+	}
+	return result, nil
+}
+
+// loadRecipients заполняет получателей ссылок вместе с данными пользователей.
+// Список полезен и без имен, поэтому ошибка сервиса авторизации только логируется
+func (s *ShareService) loadRecipients(ctx context.Context, shares []domain.OwnedShare) error {
+	shareIDs := make([]string, 0, len(shares))
+	byShare := make(map[uuid.UUID]*domain.OwnedShare, len(shares))
+	for i := range shares {
+		shares[i].Recipients = []domain.ShareRecipient{}
+		shareIDs = append(shareIDs, shares[i].ID.String())
+		byShare[shares[i].ID] = &shares[i]
+	}
+
+	recipients, err := s.shareRepo.GetRecipients(ctx, shareIDs)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	userIDs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		userIDs = append(userIDs, recipient.ID)
+	}
+	users, err := auth.GetUsersByIds(ctx, userIDs)
+	if err != nil {
+		log.Printf("[ShareService] Failed to get share recipients: %v", err)
+	}
+	usersByID := make(map[string]auth.UserInfo, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	for _, recipient := range recipients {
+		if user, ok := usersByID[recipient.ID]; ok {
+			recipient.Email = user.Email
+			recipient.Name = user.Name
+			recipient.Lastname = user.Lastname
+			recipient.Photo = user.Photo
+		}
+		if share := byShare[recipient.ShareID]; share != nil {
+			share.Recipients = append(share.Recipients, recipient)
+		}
+	}
+	return nil
+}
+
+func isValidAccessType(accessType domain.AccessType) bool {
+	switch accessType {
+	case domain.AccessTypeView, domain.AccessTypeEdit, domain.AccessTypeFull:
+		return true
+	}
+	return false
+}
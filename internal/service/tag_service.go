@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"unicode/utf8"
+)
+
+// maxTagNameLength ограничивает длину имени метки
+const maxTagNameLength = 64
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagService struct {
+	tagRepo           *repository.TagRepository
+	permissionService *PermissionService
+}
+
+func NewTagService(tagRepo *repository.TagRepository, permissionService *PermissionService) *TagService {
+	return &TagService{
+		tagRepo:           tagRepo,
+		permissionService: permissionService,
+	}
+}
+
+// ListTags возвращает метки пользователя
+func (s *TagService) ListTags(ctx context.Context, userID string) ([]domain.Tag, error) {
+	return s.tagRepo.List(ctx, userID)
+}
+
+// CreateTag создает метку пользователя
+func (s *TagService) CreateTag(ctx context.Context, tag *domain.Tag) error {
+	if tag.Color == "" {
+		tag.Color = domain.DefaultTagColor
+	}
+	if err := normalizeTag(tag); err != nil {
+		return err
+	}
+	return s.tagRepo.Create(ctx, tag)
+}
+
+// UpdateTag изменяет имя и/или цвет метки; nil оставляет значение без изменений
+func (s *TagService) UpdateTag(ctx context.Context, tagID int64, name *string, color *string, userID string) (*domain.Tag, error) {
+	tag, err := s.getOwnTag(ctx, tagID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if name != nil {
+		tag.Name = *name
+	}
+	if color != nil {
+		tag.Color = *color
+	}
+	if err := normalizeTag(tag); err != nil {
+		return nil, err
+	}
+
+	if err := s.tagRepo.Update(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag удаляет метку и снимает ее со всех элементов
+func (s *TagService) DeleteTag(ctx context.Context, tagID int64, userID string) error {
+	if _, err := s.getOwnTag(ctx, tagID, userID); err != nil {
+		return err
+	}
+	return s.tagRepo.Delete(ctx, tagID)
+}
+
+// TagItem отмечает файл или папку меткой. Отметить можно любой элемент,
+// который пользователь может просматривать, в том числе чужой
+func (s *TagService) TagItem(ctx context.Context, tagID int64, itemType domain.ResourceType, itemID string, userID string) error {
+	if _, err := s.getOwnTag(ctx, tagID, userID); err != nil {
+		return err
+	}
+
+	switch itemType {
+	case domain.ResourceTypeFile:
+		file, err := s.permissionService.GetViewableFile(ctx, userID, itemID)
+		if err != nil {
+			return err
+		}
+		return s.tagRepo.TagFile(ctx, tagID, file.UUID)
+	case domain.ResourceTypeFolder:
+		folder, err := s.permissionService.GetViewableFolder(ctx, userID, itemID)
+		if err != nil {
+			return err
+		}
+		return s.tagRepo.TagFolder(ctx, tagID, folder.ID)
+	default:
+		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+}
+
+// UntagItem снимает метку с файла или папки
+func (s *TagService) UntagItem(ctx context.Context, tagID int64, itemType domain.ResourceType, itemID string, userID string) error {
+	if _, err := s.getOwnTag(ctx, tagID, userID); err != nil {
+		return err
+	}
+
+	switch itemType {
+	case domain.ResourceTypeFile:
+		fileUUID, err := uuid.Parse(itemID)
+		if err != nil {
+			return fmt.Errorf("invalid file UUID")
+		}
+		return s.tagRepo.UntagFile(ctx, tagID, fileUUID)
+	case domain.ResourceTypeFolder:
+		folderID, err := strconv.ParseInt(itemID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid folder ID")
+		}
+		return s.tagRepo.UntagFolder(ctx, tagID, folderID)
+	default:
+		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
+	}
+}
+
+// GetTaggedItems возвращает элементы с меткой. Чужие элементы, доступ к которым
+// был отозван, не показываются, но метка с них не снимается
+func (s *TagService) GetTaggedItems(ctx context.Context, tagID int64, userID string) (*domain.TaggedItems, error) {
+	tag, err := s.getOwnTag(ctx, tagID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, folders, err := s.tagRepo.GetTaggedItems(ctx, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.TaggedItems{
+		Tag:     *tag,
+		Files:   make([]domain.File, 0, len(files)),
+		Folders: make([]domain.Folder, 0, len(folders)),
+	}
+	for _, file := range files {
+		if file.OwnerID != userID && !s.canViewFile(ctx, &file, userID) {
+			continue
+		}
+		result.Files = append(result.Files, file)
+	}
+	for _, folder := range folders {
+		if folder.OwnerID != userID && !s.canViewFolder(ctx, folder.ID, userID) {
+			continue
+		}
+		result.Folders = append(result.Folders, folder)
+	}
+	return result, nil
+}
+
+// getOwnTag возвращает метку пользователя. Чужие метки не раскрываются
+func (s *TagService) getOwnTag(ctx context.Context, tagID int64, userID string) (*domain.Tag, error) {
+	tag, err := s.tagRepo.GetByID(ctx, tagID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.OwnerID != userID {
+		return nil, fmt.Errorf("tag not found")
+	}
+	return tag, nil
+}
+
+// canViewFile проверяет доступ к чужому файлу напрямую или через его папку
+func (s *TagService) canViewFile(ctx context.Context, file *domain.File, userID string) bool {
+	allowed, err := s.permissionService.CheckFileViewPermission(ctx, userID, file)
+	if err != nil {
+		log.Printf("[Tags] Failed to check access to file %s: %v", file.UUID, err)
+		return false
+	}
+	return allowed
+}
+
+func (s *TagService) canViewFolder(ctx context.Context, folderID int64, userID string) bool {
+	allowed, err := s.permissionService.CheckSharedFolderPermission(ctx, userID, folderID, OperationView)
+	if err != nil {
+		log.Printf("[Tags] Failed to check access to folder %d: %v", folderID, err)
+		return false
+	}
+	return allowed
+}
+
+// normalizeTag проверяет имя и цвет метки
+func normalizeTag(tag *domain.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return fmt.Errorf("invalid tag name: name is required")
+	}
+	if utf8.RuneCountInString(tag.Name) > maxTagNameLength {
+		return fmt.Errorf("invalid tag name: name is too long (max %d characters)", maxTagNameLength)
+	}
+	if !tagColorPattern.MatchString(tag.Color) {
+		return fmt.Errorf("invalid tag color: expected #rrggbb")
+	}
+	tag.Color = strings.ToLower(tag.Color)
+	return nil
+}
@@ -17,6 +17,7 @@ type TrashService struct {
 	folderRepo   *repository.FolderRepository
 	s3Client     s3.Storage
 	quotaService *StorageQuotaService // Добавляем quotaService
+	blobService  *BlobService
 }
 
 func NewTrashService(
@@ -25,6 +26,7 @@ func NewTrashService(
 	folderRepo *repository.FolderRepository,
 	s3Client s3.Storage,
 	quotaService *StorageQuotaService, // Добавляем параметр
+	blobService *BlobService,
 ) *TrashService {
 	return &TrashService{
 		trashRepo:    trashRepo,
@@ -32,6 +34,7 @@ func NewTrashService(
 		folderRepo:   folderRepo,
 		s3Client:     s3Client,
 		quotaService: quotaService,
+		blobService:  blobService,
 	}
 }
 
@@ -77,8 +80,9 @@ func (s *TrashService) MoveToTrash(ctx context.Context, itemID string, itemType
 	return s.trashRepo.MoveToTrash(ctx, itemID, itemType, ownerID)
 }
 
-// RestoreFromTrash восстанавливает элемент из корзины
-func (s *TrashService) RestoreFromTrash(ctx context.Context, itemID string, itemType string, ownerID string) error {
+// RestoreFromTrash восстанавливает элемент из корзины.
+// Если на исходном месте уже есть элемент с таким именем, конфликт разрешается по policy
+func (s *TrashService) RestoreFromTrash(ctx context.Context, itemID string, itemType string, policy domain.ConflictPolicy, ownerID string) error {
 	if itemID == "" || itemType == "" || ownerID == "" {
 		return fmt.Errorf("all parameters are required")
 	}
@@ -87,7 +91,7 @@ func (s *TrashService) RestoreFromTrash(ctx context.Context, itemID string, item
 		return fmt.Errorf("invalid item type: must be 'file' or 'folder'")
 	}
 
-	return s.trashRepo.RestoreItem(ctx, itemID, itemType, ownerID)
+	return s.trashRepo.RestoreItem(ctx, itemID, itemType, ownerID, policy)
 }
 
 // EmptyTrash полностью очищает корзину пользователя
@@ -102,6 +106,12 @@ func (s *TrashService) EmptyTrash(ctx context.Context, ownerID string) error {
 		return fmt.Errorf("failed to get trash items: %w", err)
 	}
 
+	// Ключи версий получаем до удаления записей о них
+	versionKeys, err := s.trashRepo.GetTrashedVersionKeys(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
 	// Начинаем транзакцию
 	tx, err := s.trashRepo.BeginTx(ctx)
 	if err != nil {
@@ -130,6 +140,9 @@ func (s *TrashService) EmptyTrash(ctx context.Context, ownerID string) error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	s.deleteVersionObjects(versionKeys, "")
+	s.collectBlobs(ctx)
+
 	// После успешного удаления обновляем использованное пространство
 	if err := s.quotaService.UpdateUsedSpace(ctx, ownerID); err != nil {
 		// Логируем ошибку, но не прерываем выполнение
@@ -148,66 +161,104 @@ func (s *TrashService) GetSettings(ctx context.Context, ownerID string) (*domain
 	return s.trashRepo.GetSettings(ctx, ownerID)
 }
 
-// DeletePermanently окончательно удаляет элемент из корзины
+// DeletePermanently окончательно удаляет элемент из корзины.
+// Объекты в хранилище удаляются после фиксации транзакции базы данных
 func (s *TrashService) DeletePermanently(ctx context.Context, itemID string, itemType string, ownerID string) error {
-	// Если удаляем файл, пытаемся удалить его из S3
+	var versionKeys []string
+	var file *domain.File
+
 	if itemType == "file" {
+		// Ключи версий получаем до удаления записей о них
+		keys, err := s.trashRepo.GetFileVersionKeys(ctx, []string{itemID})
+		if err != nil {
+			log.Printf("Warning: failed to get file version keys: %v", err)
+		}
+		versionKeys = keys
+
 		// Получаем полную информацию о файле перед удалением
-		fileUUID, err := uuid.Parse(itemID)
-		if err == nil {
-			// Пытаемся получить информацию о файле из базы данных
-			file, err := s.fileRepo.GetByUUID(ctx, fileUUID)
-			if err == nil {
-				// Определяем правильный путь к файлу в S3
-				s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, itemID)
-
-				// Проверяем, является ли файл записью конференции
-				if file.Metadata != nil {
-					// Проверяем наличие признака записи в метаданных
-					if isRecording, ok := file.Metadata["isRecording"]; ok && isRecording.(bool) {
-						// Если в метаданных есть прямой путь, используем его
-						if s3Path, ok := file.Metadata["s3Path"].(string); ok && s3Path != "" {
-							s3Key = s3Path
-							log.Printf("Используем путь из метаданных для удаления файла: %s", s3Key)
-						} else {
-							// Используем альтернативный путь для записей
-							s3Key = fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, file.Name)
-							log.Printf("Используем альтернативный путь для удаления записи: %s", s3Key)
-						}
-					}
-				}
+		if fileUUID, err := uuid.Parse(itemID); err == nil {
+			if info, err := s.fileRepo.GetByUUID(ctx, fileUUID); err == nil {
+				file = info
+			}
+		}
+	}
 
-				// Удаляем файл из S3
-				if err := s.s3Client.DeleteObject(s3Key); err != nil {
-					log.Printf("Warning: failed to delete file from S3 by primary path: %v", err)
-
-					// Если не удалось удалить по основному пути, пробуем альтернативный
-					if s3Key != fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, file.Name) {
-						altKey := fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, file.Name)
-						if altErr := s.s3Client.DeleteObject(altKey); altErr != nil {
-							log.Printf("Warning: also failed to delete file from S3 by alternative path: %v", altErr)
-						} else {
-							log.Printf("Successfully deleted file by alternative path: %s", altKey)
-						}
-					}
-				}
+	if err := s.trashRepo.DeleteItemPermanently(ctx, itemID, itemType, ownerID); err != nil {
+		return err
+	}
+
+	repository.AfterCommit(ctx, func() {
+		if itemType == "file" {
+			s.deleteFileObject(itemID, ownerID, file)
+		}
+		s.deleteVersionObjects(versionKeys, fmt.Sprintf("personal_drive_files/%s/%s", ownerID, itemID))
+		s.collectBlobs(context.Background())
+	})
+	return nil
+}
+
+// deleteFileObject удаляет из S3 основной объект файла
+func (s *TrashService) deleteFileObject(itemID string, ownerID string, file *domain.File) {
+	// Если не удалось получить информацию о файле, удаляем по стандартному пути
+	s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, itemID)
+	if file == nil {
+		if err := s.s3Client.DeleteObject(s3Key); err != nil {
+			log.Printf("Warning: failed to delete file from S3: %v", err)
+		}
+		return
+	}
+
+	// Проверяем, является ли файл записью конференции
+	if file.Metadata != nil {
+		// Проверяем наличие признака записи в метаданных
+		if isRecording, ok := file.Metadata["isRecording"]; ok && isRecording.(bool) {
+			// Если в метаданных есть прямой путь, используем его
+			if s3Path, ok := file.Metadata["s3Path"].(string); ok && s3Path != "" {
+				s3Key = s3Path
+				log.Printf("Используем путь из метаданных для удаления файла: %s", s3Key)
 			} else {
-				// Если не удалось получить информацию о файле, пытаемся удалить по стандартному пути
-				s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, itemID)
-				if err := s.s3Client.DeleteObject(s3Key); err != nil {
-					log.Printf("Warning: failed to delete file from S3: %v", err)
-				}
+				// Используем альтернативный путь для записей
+				s3Key = fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, file.Name)
+				log.Printf("Используем альтернативный путь для удаления записи: %s", s3Key)
 			}
-		} else {
-			// Если не удалось распарсить UUID, пытаемся удалить по стандартному пути
-			s3Key := fmt.Sprintf("personal_drive_files/%s/%s", ownerID, itemID)
-			if err := s.s3Client.DeleteObject(s3Key); err != nil {
-				log.Printf("Warning: failed to delete file from S3: %v", err)
+		}
+	}
+
+	// Удаляем файл из S3
+	if err := s.s3Client.DeleteObject(s3Key); err != nil {
+		log.Printf("Warning: failed to delete file from S3 by primary path: %v", err)
+
+		// Если не удалось удалить по основному пути, пробуем альтернативный
+		altKey := fmt.Sprintf("recordings/personal_recordings/%s/%s", ownerID, file.Name)
+		if s3Key != altKey {
+			if altErr := s.s3Client.DeleteObject(altKey); altErr != nil {
+				log.Printf("Warning: also failed to delete file from S3 by alternative path: %v", altErr)
+			} else {
+				log.Printf("Successfully deleted file by alternative path: %s", altKey)
 			}
 		}
 	}
+}
+
+// collectBlobs удаляет общие объекты, на которые не осталось ссылок
+func (s *TrashService) collectBlobs(ctx context.Context) {
+	if err := s.blobService.CollectGarbage(ctx); err != nil {
+		log.Printf("Warning: failed to collect unreferenced blobs: %v", err)
+	}
+}
 
-	return s.trashRepo.DeleteItemPermanently(ctx, itemID, itemType, ownerID)
+// deleteVersionObjects удаляет из хранилища объекты версий файлов,
+// пропуская основной ключ, который удаляется отдельно
+func (s *TrashService) deleteVersionObjects(keys []string, primaryKey string) {
+	for _, key := range keys {
+		// Общие объекты удаляются сборщиком после удаления последней ссылки
+		if key == primaryKey || isBlobS3Key(key) {
+			continue
+		}
+		if err := s.s3Client.DeleteObject(key); err != nil {
+			log.Printf("Warning: failed to delete file version %s from S3: %v", key, err)
+		}
+	}
 }
 
 // AutoCleanup запускает автоматическую очистку корзины
@@ -219,6 +270,8 @@ func (s *TrashService) AutoCleanup(ctx context.Context) error {
 
 	// Удаляем файлы из S3
 	for _, file := range deletedFiles {
+		s.deleteVersionObjects(file.VersionKeys, fmt.Sprintf("personal_drive_files/%s/%s", file.OwnerID, file.UUID))
+
 		fileUUID, err := uuid.Parse(file.UUID)
 		if err != nil {
 			log.Printf("Warning: invalid UUID for file: %s", file.UUID)
@@ -268,5 +321,7 @@ func (s *TrashService) AutoCleanup(ctx context.Context) error {
 		}
 	}
 
+	// Версии удаленных файлов больше не ссылаются на общие объекты
+	s.collectBlobs(ctx)
 	return nil
 }
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"hash"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/service/s3"
+	"time"
+)
+
+// Параметры протокола tus 1.0
+const (
+	TusVersion            = "1.0.0"
+	TusExtensions         = "creation,termination,checksum,expiration"
+	TusChecksumAlgorithms = "sha1,md5,sha256"
+
+	tusPartSize = minUploadChunkSize // Размер части multipart-загрузки для tus
+)
+
+var (
+	errTusOffsetMismatch   = errors.New("upload offset mismatch")
+	errTusChecksumMismatch = errors.New("checksum mismatch")
+	errTusInvalidChecksum  = errors.New("invalid checksum header")
+	errTusInvalidMetadata  = errors.New("invalid upload metadata")
+	errTusLengthExceeded   = errors.New("invalid upload: data exceeds upload length")
+)
+
+// TusService реализует загрузку файлов по протоколу tus поверх сессий загрузки.
+// Данные PATCH-запросов нарезаются на части multipart-загрузки S3, а остаток,
+// не заполнивший часть целиком, хранится в хранилище до следующего запроса
+type TusService struct {
+	sessions *UploadSessionService
+	locks    sync.Map // uuid.UUID -> *sync.Mutex
+}
+
+func NewTusService(sessions *UploadSessionService) *TusService {
+	return &TusService{sessions: sessions}
+}
+
+// MaxSize возвращает максимальный размер загружаемого файла
+func (s *TusService) MaxSize() int64 {
+	return maxFileSize
+}
+
+// CreateUpload создает новую tus-загрузку
+func (s *TusService) CreateUpload(ctx context.Context, userID string, length int64, rawMetadata string) (*domain.UploadSession, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("%w: upload length must not be negative", errInvalidFile)
+	}
+
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := firstNonEmpty(metadata["filename"], metadata["name"])
+	if fileName == "" {
+		return nil, fmt.Errorf("%w: filename is required", errTusInvalidMetadata)
+	}
+	mimeType := firstNonEmpty(metadata["filetype"], metadata["type"])
+
+	var folderID int64
+	if raw := firstNonEmpty(metadata["folder_id"], metadata["folderId"]); raw != "" {
+		folderID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: folder_id must be a number", errTusInvalidMetadata)
+		}
+	}
+
+	// Пустой файл сохраняем сразу, без multipart-загрузки
+	if length == 0 {
+		return s.createEmptyUpload(ctx, userID, folderID, fileName, mimeType, rawMetadata)
+	}
+
+	return s.sessions.createSession(ctx, userID, folderID, fileName, mimeType, length, tusPartSize,
+		domain.UploadProtocolTus, rawMetadata)
+}
+
+// createEmptyUpload сохраняет файл нулевого размера и создает уже завершенную сессию
+func (s *TusService) createEmptyUpload(
+	ctx context.Context,
+	userID string,
+	folderID int64,
+	fileName string,
+	mimeType string,
+	rawMetadata string,
+) (*domain.UploadSession, error) {
+	target, err := s.sessions.fileService.PrepareUpload(ctx, fileName, 0, folderID, userID, domain.ConflictPolicyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.s3Client.UploadBytes(target.S3Key, []byte{}); err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	if _, err := s.sessions.fileService.CommitUpload(ctx, target, fileName, mimeType, 0, fmt.Sprintf("%x", sha256.Sum256(nil)), userID); err != nil {
+		return nil, err
+	}
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	session := &domain.UploadSession{
+		UserID:       userID,
+		OwnerID:      target.OwnerID,
+		FolderID:     target.FolderID,
+		FileUUID:     target.FileUUID,
+		FileName:     fileName,
+		MIMEType:     mimeType,
+		ChunkSize:    tusPartSize,
+		S3Key:        target.S3Key,
+		IsNewVersion: target.ExistingFile != nil,
+		Status:       domain.UploadSessionCompleted,
+		Protocol:     domain.UploadProtocolTus,
+		Metadata:     rawMetadata,
+		ExpiresAt:    time.Now(),
+	}
+	if err := s.sessions.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetUpload возвращает состояние tus-загрузки
+func (s *TusService) GetUpload(ctx context.Context, id uuid.UUID, userID string) (*domain.UploadSession, error) {
+	session, err := s.getTusSession(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Завершенная загрузка остается доступной, чтобы клиент увидел итоговое смещение
+	if session.Status == domain.UploadSessionCompleted {
+		return session, nil
+	}
+	if session.Status != domain.UploadSessionActive || session.ExpiresAt.Before(time.Now()) {
+		return nil, errUploadSessionInactive
+	}
+
+	return session, nil
+}
+
+// WriteChunk дописывает данные в загрузку начиная с указанного смещения.
+// checksum - значение заголовка Upload-Checksum, может быть пустым
+func (s *TusService) WriteChunk(
+	ctx context.Context,
+	id uuid.UUID,
+	userID string,
+	offset int64,
+	body io.Reader,
+	checksum string,
+) (*domain.UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.getTusSession(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != domain.UploadSessionActive || session.ExpiresAt.Before(time.Now()) {
+		return nil, errUploadSessionInactive
+	}
+	if offset != session.UploadOffset {
+		return nil, fmt.Errorf("%w: expected %d, got %d", errTusOffsetMismatch, session.UploadOffset, offset)
+	}
+
+	hasher, expectedSum, err := parseTusChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	partSize := session.ChunkSize
+	fullParts := offset / partSize
+	tailLen := offset - fullParts*partSize
+
+	// Восстанавливаем недописанную часть из предыдущего запроса
+	buf := make([]byte, 0, partSize)
+	if tailLen > 0 {
+		tail, err := s.sessions.s3Client.GetObject(ctx, tusTailKey(id, offset))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read buffered data: %v", errS3Operation, err)
+		}
+		buf, err = io.ReadAll(io.LimitReader(tail, partSize))
+		tail.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read buffered data: %w", err)
+		}
+		if int64(len(buf)) != tailLen {
+			return nil, fmt.Errorf("buffered data is corrupted: expected %d bytes, got %d", tailLen, len(buf))
+		}
+		buf = append(make([]byte, 0, partSize), buf...)
+	}
+
+	remaining := session.TotalSize - offset
+	var reader io.Reader = io.LimitReader(body, remaining+1)
+	if hasher != nil {
+		reader = io.TeeReader(reader, hasher)
+	}
+
+	var (
+		pending  []domain.UploadSessionPart
+		received int64
+		readErr  error
+		nextPart = int(fullParts) + 1
+	)
+
+	// Читаем тело запроса частями фиксированного размера и сразу отправляем их в S3
+	for {
+		start := len(buf)
+		buf = buf[:partSize]
+		n, err := io.ReadFull(reader, buf[start:])
+		buf = buf[:start+n]
+		received += int64(n)
+
+		if received > remaining {
+			return nil, errTusLengthExceeded
+		}
+
+		if int64(len(buf)) == partSize {
+			part, err := s.uploadPart(ctx, session, nextPart, buf)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, *part)
+			nextPart++
+			buf = buf[:0]
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	// Данные с контрольной суммой принимаются только целиком
+	if hasher != nil {
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", readErr)
+		}
+		if !bytes.Equal(hasher.Sum(nil), expectedSum) {
+			return nil, errTusChecksumMismatch
+		}
+	}
+
+	newOffset := offset + received
+
+	// Последняя часть может быть меньше минимального размера
+	if newOffset == session.TotalSize && len(buf) > 0 {
+		part, err := s.uploadPart(ctx, session, nextPart, buf)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, *part)
+		buf = buf[:0]
+	}
+
+	// Сохраняем остаток до следующего запроса
+	if len(buf) > 0 {
+		if err := s.sessions.s3Client.UploadBytes(tusTailKey(id, newOffset), buf); err != nil {
+			return nil, fmt.Errorf("%w: failed to buffer data: %v", errS3Operation, err)
+		}
+	}
+
+	for i := range pending {
+		if err := s.sessions.sessionRepo.SavePart(ctx, &pending[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	ok, err := s.sessions.sessionRepo.UpdateOffset(ctx, id, offset, newOffset, time.Now().Add(uploadSessionTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errTusOffsetMismatch
+	}
+	session.UploadOffset = newOffset
+
+	// Предыдущий остаток больше не нужен
+	if tailLen > 0 && newOffset != offset {
+		if err := s.sessions.s3Client.DeleteObject(tusTailKey(id, offset)); err != nil {
+			log.Printf("[Tus] Failed to delete buffered data of upload %s: %v", id, err)
+		}
+	}
+
+	if readErr != nil {
+		return session, fmt.Errorf("failed to read request body: %w", readErr)
+	}
+
+	if newOffset == session.TotalSize {
+		if err := s.finish(ctx, session, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+// Terminate отменяет загрузку и удаляет загруженные данные
+func (s *TusService) Terminate(ctx context.Context, id uuid.UUID, userID string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if _, err := s.getTusSession(ctx, id, userID); err != nil {
+		return err
+	}
+
+	if err := s.sessions.AbortSession(ctx, id, userID); err != nil {
+		return err
+	}
+
+	s.locks.Delete(id)
+	return nil
+}
+
+// finish собирает все части загрузки и регистрирует файл
+func (s *TusService) finish(ctx context.Context, session *domain.UploadSession, userID string) error {
+	parts, err := s.sessions.sessionRepo.GetParts(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
+	completed := make([]s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, s3.CompletedPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	file, err := s.sessions.finalizeSession(ctx, session, completed, userID)
+	if err != nil {
+		return err
+	}
+
+	session.Status = domain.UploadSessionCompleted
+	log.Printf("[Tus] Upload %s finished as file %s", session.ID, file.UUID)
+	s.locks.Delete(session.ID)
+	return nil
+}
+
+// uploadPart отправляет часть в S3 и возвращает запись о ней
+func (s *TusService) uploadPart(ctx context.Context, session *domain.UploadSession, number int, data []byte) (*domain.UploadSessionPart, error) {
+	etag, err := s.sessions.s3Client.UploadPart(ctx, session.S3UploadID, session.S3Key, number, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	return &domain.UploadSessionPart{
+		SessionID:  session.ID,
+		PartNumber: number,
+		ETag:       etag,
+		SizeBytes:  int64(len(data)),
+	}, nil
+}
+
+// getTusSession получает сессию пользователя и проверяет, что это tus-загрузка
+func (s *TusService) getTusSession(ctx context.Context, id uuid.UUID, userID string) (*domain.UploadSession, error) {
+	session, err := s.sessions.getUserSession(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Protocol != domain.UploadProtocolTus {
+		return nil, fmt.Errorf("upload not found")
+	}
+	return session, nil
+}
+
+// lock блокирует параллельную запись в одну загрузку
+func (s *TusService) lock(id uuid.UUID) func() {
+	value, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// tusTailKey возвращает ключ, под которым хранится остаток данных, заканчивающийся на offset
+func tusTailKey(id uuid.UUID, offset int64) string {
+	return fmt.Sprintf("tus_uploads/%s/tail_%d", id, offset)
+}
+
+// parseTusMetadata разбирает заголовок Upload-Metadata: "key base64value,key2 base64value2"
+func parseTusMetadata(raw string) (map[string]string, error) {
+	result := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return result, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			result[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: value of %s is not base64", errTusInvalidMetadata, fields[0])
+			}
+			result[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("%w: malformed pair %q", errTusInvalidMetadata, pair)
+		}
+	}
+
+	return result, nil
+}
+
+// parseTusChecksum разбирает заголовок Upload-Checksum: "algorithm base64digest"
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, errTusInvalidChecksum
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, nil, errTusInvalidChecksum
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported algorithm %s", errTusInvalidChecksum, fields[0])
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,518 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"synxrondrive/internal/service/s3"
+	"time"
+)
+
+const (
+	minUploadChunkSize      = 5 * 1024 * 1024  // 5MB - минимальный размер части в S3
+	maxUploadChunkSize      = 64 * 1024 * 1024 // 64MB
+	uploadSessionTTL        = 24 * time.Hour   // Время жизни сессии без активности
+	uploadSessionHistory    = 7 * 24 * time.Hour
+	uploadCleanupBatch      = 100
+	uploadCompletingLease   = 5 * time.Minute // Завершение без продления аренды дольше этого считается прерванным
+	uploadCompletingRenewal = time.Minute     // Период продления аренды завершающейся сессии
+)
+
+var (
+	errUploadSessionInactive = errors.New("upload session is not active")
+	errInvalidChunk          = errors.New("invalid chunk")
+)
+
+// UploadSessionService управляет возобновляемыми загрузками файлов по частям
+type UploadSessionService struct {
+	sessionRepo *repository.UploadSessionRepository
+	fileRepo    *repository.FileRepository
+	fileService *FileService
+	s3Client    s3.Storage
+}
+
+func NewUploadSessionService(
+	sessionRepo *repository.UploadSessionRepository,
+	fileRepo *repository.FileRepository,
+	fileService *FileService,
+	s3Client s3.Storage,
+) *UploadSessionService {
+	return &UploadSessionService{
+		sessionRepo: sessionRepo,
+		fileRepo:    fileRepo,
+		fileService: fileService,
+		s3Client:    s3Client,
+	}
+}
+
+// CreateSession создает новую сессию загрузки и инициализирует multipart-загрузку в S3
+func (s *UploadSessionService) CreateSession(
+	ctx context.Context,
+	userID string,
+	folderID int64,
+	fileName string,
+	mimeType string,
+	totalSize int64,
+	partSize int64,
+) (*domain.UploadSession, error) {
+	if totalSize <= 0 {
+		return nil, fmt.Errorf("%w: file size must be positive", errInvalidFile)
+	}
+
+	// Размер части по умолчанию совпадает с размером чанка обычной загрузки
+	if partSize == 0 {
+		partSize = chunkSize
+	}
+	if partSize < minUploadChunkSize || partSize > maxUploadChunkSize {
+		return nil, fmt.Errorf("%w: chunk size must be between %d and %d bytes",
+			errInvalidChunk, minUploadChunkSize, maxUploadChunkSize)
+	}
+
+	return s.createSession(ctx, userID, folderID, fileName, mimeType, totalSize, partSize, domain.UploadProtocolChunked, "")
+}
+
+// createSession проверяет права, инициализирует multipart-загрузку и сохраняет сессию
+func (s *UploadSessionService) createSession(
+	ctx context.Context,
+	userID string,
+	folderID int64,
+	fileName string,
+	mimeType string,
+	totalSize int64,
+	partSize int64,
+	protocol string,
+	metadata string,
+) (*domain.UploadSession, error) {
+	// Проверяем квоту, права и определяем, будет ли это новая версия файла
+	target, err := s.fileService.PrepareUpload(ctx, fileName, totalSize, folderID, userID, domain.ConflictPolicyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	uploadID, err := s.s3Client.CreateMultipartUpload(ctx, target.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	session := &domain.UploadSession{
+		UserID:       userID,
+		OwnerID:      target.OwnerID,
+		FolderID:     target.FolderID,
+		FileUUID:     target.FileUUID,
+		FileName:     fileName,
+		MIMEType:     mimeType,
+		TotalSize:    totalSize,
+		ChunkSize:    partSize,
+		S3Key:        target.S3Key,
+		S3UploadID:   uploadID,
+		IsNewVersion: target.ExistingFile != nil,
+		Status:       domain.UploadSessionActive,
+		Protocol:     protocol,
+		Metadata:     metadata,
+		ExpiresAt:    time.Now().Add(uploadSessionTTL),
+	}
+
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		// Отменяем загрузку в S3, чтобы не оставлять висящих частей
+		if abortErr := s.s3Client.AbortMultipartUpload(ctx, uploadID, target.S3Key); abortErr != nil {
+			log.Printf("[UploadSession] Failed to abort multipart upload after db error: %v", abortErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("[UploadSession] Created session %s for %s (%d bytes, %d parts)",
+		session.ID, fileName, totalSize, totalParts(session))
+	return session, nil
+}
+
+// GetSessionState возвращает сессию и список уже загруженных частей
+func (s *UploadSessionService) GetSessionState(ctx context.Context, sessionID uuid.UUID, userID string) (*domain.UploadSessionState, error) {
+	session, err := s.getUserSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := s.sessionRepo.GetParts(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var uploaded int64
+	for _, part := range parts {
+		uploaded += part.SizeBytes
+	}
+
+	return &domain.UploadSessionState{
+		Session:       session,
+		Parts:         parts,
+		TotalParts:    totalParts(session),
+		UploadedBytes: uploaded,
+	}, nil
+}
+
+// UploadPart сохраняет часть файла с указанным номером
+func (s *UploadSessionService) UploadPart(
+	ctx context.Context,
+	sessionID uuid.UUID,
+	userID string,
+	partNumber int,
+	body io.Reader,
+) (*domain.UploadSessionPart, error) {
+	session, err := s.getActiveSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Protocol != domain.UploadProtocolChunked {
+		return nil, fmt.Errorf("%w: session uses %s protocol", errInvalidChunk, session.Protocol)
+	}
+
+	// Проверяем номер части и ожидаемый размер
+	total := totalParts(session)
+	if partNumber < 1 || partNumber > total {
+		return nil, fmt.Errorf("%w: part number must be between 1 and %d", errInvalidChunk, total)
+	}
+
+	expected := session.ChunkSize
+	if partNumber == total {
+		expected = session.TotalSize - int64(total-1)*session.ChunkSize
+	}
+
+	// Читаем не больше ожидаемого размера части
+	data, err := io.ReadAll(io.LimitReader(body, expected+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if int64(len(data)) != expected {
+		return nil, fmt.Errorf("%w: part %d must be %d bytes, got %d",
+			errInvalidChunk, partNumber, expected, len(data))
+	}
+
+	etag, err := s.s3Client.UploadPart(ctx, session.S3UploadID, session.S3Key, partNumber, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	part := &domain.UploadSessionPart{
+		SessionID:  session.ID,
+		PartNumber: partNumber,
+		ETag:       etag,
+		SizeBytes:  int64(len(data)),
+	}
+	if err := s.sessionRepo.SavePart(ctx, part); err != nil {
+		return nil, err
+	}
+
+	// Продлеваем жизнь сессии, пока клиент продолжает загрузку
+	if err := s.sessionRepo.Touch(ctx, session.ID, time.Now().Add(uploadSessionTTL)); err != nil {
+		log.Printf("[UploadSession] Failed to extend session %s: %v", session.ID, err)
+	}
+
+	return part, nil
+}
+
+// CompleteSession собирает загруженные части и регистрирует файл
+func (s *UploadSessionService) CompleteSession(ctx context.Context, sessionID uuid.UUID, userID string) (*domain.File, error) {
+	session, err := s.getActiveSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Protocol != domain.UploadProtocolChunked {
+		return nil, fmt.Errorf("%w: session uses %s protocol", errInvalidChunk, session.Protocol)
+	}
+
+	parts, err := s.sessionRepo.GetParts(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Проверяем, что все части загружены
+	total := totalParts(session)
+	if len(parts) != total {
+		return nil, fmt.Errorf("%w: %d of %d parts uploaded", errInvalidChunk, len(parts), total)
+	}
+
+	completed := make([]s3.CompletedPart, 0, len(parts))
+	var uploaded int64
+	for i, part := range parts {
+		if part.PartNumber != i+1 {
+			return nil, fmt.Errorf("%w: part %d is missing", errInvalidChunk, i+1)
+		}
+		uploaded += part.SizeBytes
+		completed = append(completed, s3.CompletedPart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		})
+	}
+	if uploaded != session.TotalSize {
+		return nil, fmt.Errorf("%w: uploaded %d of %d bytes", errInvalidChunk, uploaded, session.TotalSize)
+	}
+
+	return s.finalizeSession(ctx, session, completed, userID)
+}
+
+// finalizeSession собирает части в S3 и регистрирует файл тем же путем, что и обычная загрузка
+func (s *UploadSessionService) finalizeSession(
+	ctx context.Context,
+	session *domain.UploadSession,
+	completed []s3.CompletedPart,
+	userID string,
+) (*domain.File, error) {
+	sessionID := session.ID
+
+	// Блокируем сессию, чтобы избежать двойного завершения
+	ok, err := s.sessionRepo.UpdateStatus(ctx, sessionID, domain.UploadSessionActive, domain.UploadSessionCompleting)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errUploadSessionInactive
+	}
+
+	// Сборка и регистрация большого файла может занять много времени: продлеваем
+	// аренду, чтобы очистка не приняла сессию за брошенную
+	release := s.holdCompleting(sessionID)
+	defer release()
+
+	if err := s.s3Client.CompleteMultipartUpload(ctx, session.S3UploadID, session.S3Key, completed); err != nil {
+		// Возвращаем сессию в активное состояние, чтобы клиент мог повторить попытку
+		if _, statusErr := s.sessionRepo.UpdateStatus(ctx, sessionID, domain.UploadSessionCompleting, domain.UploadSessionActive); statusErr != nil {
+			log.Printf("[UploadSession] Failed to reset session %s status: %v", sessionID, statusErr)
+		}
+		return nil, fmt.Errorf("%w: %v", errS3Operation, err)
+	}
+
+	return s.commitSession(ctx, session, userID)
+}
+
+// commitSession регистрирует файл, содержимое которого уже собрано в S3
+func (s *UploadSessionService) commitSession(ctx context.Context, session *domain.UploadSession, userID string) (*domain.File, error) {
+	sessionID := session.ID
+
+	target := &UploadTarget{
+		FolderID: session.FolderID,
+		OwnerID:  session.OwnerID,
+		FileUUID: session.FileUUID,
+		S3Key:    session.S3Key,
+		Policy:   domain.ConflictPolicyVersion,
+	}
+	if session.IsNewVersion {
+		existingFile, err := s.fileRepo.GetByUUID(ctx, session.FileUUID)
+		if err != nil {
+			s.markAborted(ctx, sessionID, domain.UploadSessionCompleting)
+			s.deleteAssembledObject(session)
+			return nil, fmt.Errorf("%w: %v", errFileNotFound, err)
+		}
+		target.ExistingFile = existingFile
+	}
+
+	// При ошибке CommitUpload сам удаляет собранный объект
+	file, err := s.fileService.CommitUpload(ctx, target, session.FileName, session.MIMEType, session.TotalSize, "", userID)
+	if err != nil {
+		s.markAborted(ctx, sessionID, domain.UploadSessionCompleting)
+		return nil, err
+	}
+
+	if _, err := s.sessionRepo.UpdateStatus(ctx, sessionID, domain.UploadSessionCompleting, domain.UploadSessionCompleted); err != nil {
+		log.Printf("[UploadSession] Failed to mark session %s completed: %v", sessionID, err)
+	}
+	if err := s.sessionRepo.DeleteParts(ctx, sessionID); err != nil {
+		log.Printf("[UploadSession] Failed to delete parts of session %s: %v", sessionID, err)
+	}
+
+	log.Printf("[UploadSession] Session %s completed, file %s", sessionID, file.UUID)
+	return file, nil
+}
+
+// AbortSession отменяет загрузку и удаляет загруженные части
+func (s *UploadSessionService) AbortSession(ctx context.Context, sessionID uuid.UUID, userID string) error {
+	session, err := s.getUserSession(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.sessionRepo.UpdateStatus(ctx, sessionID, domain.UploadSessionActive, domain.UploadSessionAborted)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errUploadSessionInactive
+	}
+
+	s.releaseSession(ctx, session)
+	return nil
+}
+
+// CleanupExpiredSessions отменяет брошенные сессии и сессии с прерванным
+// завершением, а также удаляет старые записи
+func (s *UploadSessionService) CleanupExpiredSessions(ctx context.Context) error {
+	for {
+		sessions, err := s.sessionRepo.GetExpired(ctx, time.Now().Add(-uploadCompletingLease), uploadCleanupBatch)
+		if err != nil {
+			return err
+		}
+
+		for i := range sessions {
+			session := &sessions[i]
+			if session.Status == domain.UploadSessionCompleting {
+				if err := s.recoverCompleting(ctx, session); err != nil {
+					return err
+				}
+				continue
+			}
+
+			ok, err := s.sessionRepo.UpdateStatus(ctx, session.ID, domain.UploadSessionActive, domain.UploadSessionAborted)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			log.Printf("[UploadSession] Aborting expired session %s (%s)", session.ID, session.FileName)
+			s.releaseSession(ctx, session)
+		}
+
+		if len(sessions) < uploadCleanupBatch {
+			break
+		}
+	}
+
+	deleted, err := s.sessionRepo.DeleteFinished(ctx, time.Now().Add(-uploadSessionHistory))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("[UploadSession] Removed %d finished sessions", deleted)
+	}
+
+	return nil
+}
+
+// holdCompleting периодически продлевает аренду завершающейся сессии.
+// Возвращает функцию, которая прекращает продление
+func (s *UploadSessionService) holdCompleting(sessionID uuid.UUID) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(uploadCompletingRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.sessionRepo.RenewLease(context.Background(), sessionID, domain.UploadSessionCompleting); err != nil {
+					log.Printf("[UploadSession] Failed to renew lease of session %s: %v", sessionID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// recoverCompleting разбирает сессию, завершение которой прервалось вместе с процессом.
+// Если файл успел зарегистрироваться, сессия считается завершенной; иначе она
+// отменяется, а собранный объект удаляется
+func (s *UploadSessionService) recoverCompleting(ctx context.Context, session *domain.UploadSession) error {
+	committed, err := s.fileRepo.IsVersionS3Key(ctx, session.S3Key)
+	if err != nil {
+		return err
+	}
+
+	if committed {
+		ok, err := s.sessionRepo.UpdateStatus(ctx, session.ID, domain.UploadSessionCompleting, domain.UploadSessionCompleted)
+		if err != nil || !ok {
+			return err
+		}
+		log.Printf("[UploadSession] Session %s was committed before interruption, marking completed", session.ID)
+		if err := s.sessionRepo.DeleteParts(ctx, session.ID); err != nil {
+			log.Printf("[UploadSession] Failed to delete parts of session %s: %v", session.ID, err)
+		}
+		return nil
+	}
+
+	ok, err := s.sessionRepo.UpdateStatus(ctx, session.ID, domain.UploadSessionCompleting, domain.UploadSessionAborted)
+	if err != nil || !ok {
+		return err
+	}
+
+	log.Printf("[UploadSession] Aborting interrupted completion of session %s (%s)", session.ID, session.FileName)
+	s.releaseSession(ctx, session)
+	s.deleteAssembledObject(session)
+	return nil
+}
+
+// deleteAssembledObject удаляет объект, собранный из частей сессии, который не попал в файл
+func (s *UploadSessionService) deleteAssembledObject(session *domain.UploadSession) {
+	if err := s.s3Client.DeleteObject(session.S3Key); err != nil {
+		log.Printf("[UploadSession] Failed to delete assembled object of session %s: %v", session.ID, err)
+	}
+}
+
+// releaseSession отменяет multipart-загрузку в S3 и удаляет записи о частях
+func (s *UploadSessionService) releaseSession(ctx context.Context, session *domain.UploadSession) {
+	if err := s.s3Client.AbortMultipartUpload(ctx, session.S3UploadID, session.S3Key); err != nil {
+		log.Printf("[UploadSession] Failed to abort multipart upload for session %s: %v", session.ID, err)
+	}
+	if err := s.sessionRepo.DeleteParts(ctx, session.ID); err != nil {
+		log.Printf("[UploadSession] Failed to delete parts of session %s: %v", session.ID, err)
+	}
+
+	// У tus-загрузок может остаться недописанный хвост последней части
+	if session.Protocol == domain.UploadProtocolTus {
+		if err := s.s3Client.DeleteObject(tusTailKey(session.ID, session.UploadOffset)); err != nil {
+			log.Printf("[UploadSession] Failed to delete buffered tail of session %s: %v", session.ID, err)
+		}
+	}
+}
+
+// markAborted переводит сессию в статус отмененной после неудачного завершения
+func (s *UploadSessionService) markAborted(ctx context.Context, sessionID uuid.UUID, from string) {
+	if _, err := s.sessionRepo.UpdateStatus(ctx, sessionID, from, domain.UploadSessionAborted); err != nil {
+		log.Printf("[UploadSession] Failed to mark session %s aborted: %v", sessionID, err)
+	}
+	if err := s.sessionRepo.DeleteParts(ctx, sessionID); err != nil {
+		log.Printf("[UploadSession] Failed to delete parts of session %s: %v", sessionID, err)
+	}
+}
+
+// getUserSession получает сессию и проверяет, что она принадлежит пользователю
+func (s *UploadSessionService) getUserSession(ctx context.Context, sessionID uuid.UUID, userID string) (*domain.UploadSession, error) {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != userID {
+		return nil, errAccessDenied
+	}
+
+	return session, nil
+}
+
+// getActiveSession получает сессию пользователя, в которую еще можно загружать части
+func (s *UploadSessionService) getActiveSession(ctx context.Context, sessionID uuid.UUID, userID string) (*domain.UploadSession, error) {
+	session, err := s.getUserSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status != domain.UploadSessionActive || session.ExpiresAt.Before(time.Now()) {
+		return nil, errUploadSessionInactive
+	}
+
+	return session, nil
+}
+
+// totalParts вычисляет количество частей в сессии
+func totalParts(session *domain.UploadSession) int {
+	return int((session.TotalSize + session.ChunkSize - 1) / session.ChunkSize)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"synxrondrive/internal/domain"
+	"synxrondrive/internal/repository"
+	"synxrondrive/internal/service/s3"
+)
+
+// versionPruneBatch - сколько устаревших версий обрабатывается за один проход
+const versionPruneBatch = 500
+
+type VersionRetentionService struct {
+	retentionRepo *repository.VersionRetentionRepository
+	folderRepo    *repository.FolderRepository
+	s3Client      s3.Storage
+	quotaService  *StorageQuotaService
+	blobService   *BlobService
+}
+
+func NewVersionRetentionService(
+	retentionRepo *repository.VersionRetentionRepository,
+	folderRepo *repository.FolderRepository,
+	s3Client s3.Storage,
+	quotaService *StorageQuotaService,
+	blobService *BlobService,
+) *VersionRetentionService {
+	return &VersionRetentionService{
+		retentionRepo: retentionRepo,
+		folderRepo:    folderRepo,
+		s3Client:      s3Client,
+		quotaService:  quotaService,
+		blobService:   blobService,
+	}
+}
+
+// GetUserSettings получает настройки хранения версий пользователя
+func (s *VersionRetentionService) GetUserSettings(ctx context.Context, userID string) (*domain.VersionRetentionSettings, error) {
+	return s.retentionRepo.GetUserSettings(ctx, userID)
+}
+
+// UpdateUserSettings сохраняет настройки хранения версий пользователя
+func (s *VersionRetentionService) UpdateUserSettings(ctx context.Context, settings *domain.VersionRetentionSettings) error {
+	if err := validateRetentionLimits(settings); err != nil {
+		return err
+	}
+	settings.FolderID = nil
+
+	if err := s.retentionRepo.SaveUserSettings(ctx, settings); err != nil {
+		return err
+	}
+
+	// Учет старых версий в квоте мог измениться
+	if err := s.quotaService.UpdateUsedSpace(ctx, settings.OwnerID); err != nil {
+		log.Printf("[VersionRetention] Failed to update used space for %s: %v", settings.OwnerID, err)
+	}
+
+	return nil
+}
+
+// GetFolderSettings получает переопределенные настройки папки
+func (s *VersionRetentionService) GetFolderSettings(ctx context.Context, folderID int64, userID string) (*domain.VersionRetentionSettings, error) {
+	if err := s.checkFolderOwner(ctx, folderID, userID); err != nil {
+		return nil, err
+	}
+	return s.retentionRepo.GetFolderSettings(ctx, folderID)
+}
+
+// UpdateFolderSettings переопределяет настройки хранения версий для папки и ее подпапок
+func (s *VersionRetentionService) UpdateFolderSettings(ctx context.Context, settings *domain.VersionRetentionSettings) error {
+	if settings.FolderID == nil {
+		return fmt.Errorf("invalid folder id")
+	}
+	if err := validateRetentionLimits(settings); err != nil {
+		return err
+	}
+	if err := s.checkFolderOwner(ctx, *settings.FolderID, settings.OwnerID); err != nil {
+		return err
+	}
+
+	// Учет в квоте задается только на уровне пользователя
+	settings.CountInQuota = false
+	return s.retentionRepo.SaveFolderSettings(ctx, settings)
+}
+
+// DeleteFolderSettings возвращает папке настройки пользователя
+func (s *VersionRetentionService) DeleteFolderSettings(ctx context.Context, folderID int64, userID string) error {
+	if err := s.checkFolderOwner(ctx, folderID, userID); err != nil {
+		return err
+	}
+	return s.retentionRepo.DeleteFolderSettings(ctx, folderID)
+}
+
+// PruneExpiredVersions удаляет из хранилища версии файлов, вышедшие за пределы
+// политик хранения, и помечает их удаленными
+func (s *VersionRetentionService) PruneExpiredVersions(ctx context.Context) error {
+	owners, err := s.retentionRepo.GetOwnersWithPolicies(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ownerID := range owners {
+		pruned, err := s.pruneOwnerVersions(ctx, ownerID)
+		if err != nil {
+			log.Printf("[VersionRetention] Failed to prune versions for %s: %v", ownerID, err)
+			continue
+		}
+		if pruned == 0 {
+			continue
+		}
+
+		log.Printf("[VersionRetention] Pruned %d versions for %s", pruned, ownerID)
+		if err := s.quotaService.UpdateUsedSpace(ctx, ownerID); err != nil {
+			log.Printf("[VersionRetention] Failed to update used space for %s: %v", ownerID, err)
+		}
+	}
+
+	// Удаленные версии могли быть последними ссылками на общие объекты
+	if err := s.blobService.CollectGarbage(ctx); err != nil {
+		log.Printf("[VersionRetention] Failed to collect unreferenced blobs: %v", err)
+	}
+
+	return nil
+}
+
+// pruneOwnerVersions удаляет устаревшие версии файлов одного пользователя
+func (s *VersionRetentionService) pruneOwnerVersions(ctx context.Context, ownerID string) (int, error) {
+	pruned := 0
+	for {
+		versions, err := s.retentionRepo.GetExpiredVersions(ctx, ownerID, versionPruneBatch)
+		if err != nil {
+			return pruned, err
+		}
+		if len(versions) == 0 {
+			return pruned, nil
+		}
+
+		ids := make([]int64, len(versions))
+		for i, version := range versions {
+			ids[i] = version.ID
+		}
+
+		// Строки помечаются удаленными до удаления объектов, чтобы версию
+		// нельзя было восстановить или скачать в процессе очистки
+		keys, err := s.retentionRepo.MarkVersionsDeleted(ctx, ids)
+		if err != nil {
+			return pruned, err
+		}
+
+		for _, key := range keys {
+			if err := s.s3Client.DeleteObject(key); err != nil {
+				log.Printf("[VersionRetention] Failed to delete version object %s: %v", key, err)
+			}
+		}
+		for _, version := range versions {
+			if err := s.s3Client.DeleteObject(previewS3Key(version.OwnerID, version.FileUUID, version.VersionNumber)); err != nil {
+				log.Printf("[VersionRetention] Failed to delete preview of %s v%d: %v", version.FileUUID, version.VersionNumber, err)
+			}
+		}
+
+		pruned += len(versions)
+		if len(versions) < versionPruneBatch {
+			return pruned, nil
+		}
+	}
+}
+
+// checkFolderOwner проверяет, что папка принадлежит пользователю
+func (s *VersionRetentionService) checkFolderOwner(ctx context.Context, folderID int64, userID string) error {
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if err != nil {
+		return fmt.Errorf("folder not found: %w", err)
+	}
+	if folder.OwnerID != userID {
+		return errAccessDenied
+	}
+	return nil
+}
+
+// validateRetentionLimits проверяет ограничения политики хранения
+func validateRetentionLimits(settings *domain.VersionRetentionSettings) error {
+	if settings.KeepLast != nil && *settings.KeepLast < 1 {
+		return fmt.Errorf("invalid keep_last: must be at least 1")
+	}
+	if settings.KeepDays != nil && *settings.KeepDays < 1 {
+		return fmt.Errorf("invalid keep_days: must be at least 1")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+-- Сессии возобновляемой загрузки файлов по частям
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    owner_id VARCHAR(255) NOT NULL,
+    folder_id INTEGER NOT NULL REFERENCES folders(id),
+    file_uuid UUID NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    total_size BIGINT NOT NULL,
+    chunk_size BIGINT NOT NULL,
+    s3_key TEXT NOT NULL,
+    s3_upload_id TEXT NOT NULL,
+    is_new_version BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'completing', 'completed', 'aborted')),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Загруженные части и их ETag
+CREATE TABLE IF NOT EXISTS upload_session_parts (
+    session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    etag TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, part_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at)
+    WHERE status = 'active';
+
+CREATE TRIGGER update_upload_sessions_updated_at
+    BEFORE UPDATE ON upload_sessions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
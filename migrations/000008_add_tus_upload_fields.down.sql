@@ -0,0 +1,3 @@
+ALTER TABLE upload_sessions DROP COLUMN IF EXISTS upload_metadata;
+ALTER TABLE upload_sessions DROP COLUMN IF EXISTS upload_offset;
+ALTER TABLE upload_sessions DROP COLUMN IF EXISTS protocol;
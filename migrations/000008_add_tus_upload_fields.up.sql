@@ -0,0 +1,6 @@
+-- Поля для загрузок по протоколу tus
+ALTER TABLE upload_sessions
+    ADD COLUMN IF NOT EXISTS protocol VARCHAR(10) NOT NULL DEFAULT 'chunked'
+        CHECK (protocol IN ('chunked', 'tus')),
+    ADD COLUMN IF NOT EXISTS upload_offset BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS upload_metadata TEXT NOT NULL DEFAULT '';
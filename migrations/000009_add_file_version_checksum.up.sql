@@ -0,0 +1,2 @@
+-- Контрольная сумма содержимого версии, вычисляемая при потоковой загрузке
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64);
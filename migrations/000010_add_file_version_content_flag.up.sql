@@ -0,0 +1,12 @@
+-- Раньше все версии файла перезаписывали один и тот же объект в хранилище,
+-- поэтому содержимое сохранилось только у последней версии с этим ключом
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS content_available BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE file_versions v
+SET content_available = FALSE
+WHERE EXISTS (
+    SELECT 1 FROM file_versions n
+    WHERE n.file_uuid = v.file_uuid
+      AND n.s3_key = v.s3_key
+      AND n.version_number > v.version_number
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_version_retention_settings_updated_at ON version_retention_settings;
+DROP INDEX IF EXISTS idx_file_versions_s3_key;
+DROP INDEX IF EXISTS idx_version_retention_folder;
+DROP INDEX IF EXISTS idx_version_retention_owner;
+DROP TABLE IF EXISTS version_retention_settings;
@@ -0,0 +1,27 @@
+-- Политики хранения старых версий файлов.
+-- Строка без folder_id - настройки пользователя, строка с folder_id - переопределение
+-- для папки и всех ее подпапок. NULL в keep_last/keep_days означает отсутствие ограничения
+CREATE TABLE IF NOT EXISTS version_retention_settings (
+    id SERIAL PRIMARY KEY,
+    owner_id VARCHAR(255) NOT NULL,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+    keep_last INTEGER CHECK (keep_last > 0),
+    keep_days INTEGER CHECK (keep_days > 0),
+    count_in_quota BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_version_retention_owner
+    ON version_retention_settings(owner_id) WHERE folder_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_version_retention_folder
+    ON version_retention_settings(folder_id) WHERE folder_id IS NOT NULL;
+
+-- Ускоряет проверку, ссылаются ли другие версии на объект в хранилище
+CREATE INDEX IF NOT EXISTS idx_file_versions_s3_key ON file_versions(s3_key)
+    WHERE deleted_at IS NULL;
+
+CREATE TRIGGER update_version_retention_settings_updated_at
+    BEFORE UPDATE ON version_retention_settings
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+ALTER TABLE file_versions DROP COLUMN IF EXISTS comment;
+ALTER TABLE file_versions DROP COLUMN IF EXISTS label;
+ALTER TABLE file_versions DROP COLUMN IF EXISTS uploaded_by;
@@ -0,0 +1,4 @@
+-- Автор версии, метка и комментарий к изменению
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS uploaded_by VARCHAR(255);
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS label VARCHAR(100);
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS comment TEXT;
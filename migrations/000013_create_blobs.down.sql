@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS file_versions_blob_ref_count ON file_versions;
+DROP FUNCTION IF EXISTS update_blob_ref_count();
+DROP TRIGGER IF EXISTS update_blobs_updated_at ON blobs;
+DROP INDEX IF EXISTS idx_blobs_unreferenced;
+DROP TABLE IF EXISTS blobs;
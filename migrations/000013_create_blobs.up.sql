@@ -0,0 +1,39 @@
+-- Объекты с содержимым, общие для всех версий с одинаковой контрольной суммой.
+-- ref_count - число действующих версий, ссылающихся на объект; поддерживается триггером
+CREATE TABLE IF NOT EXISTS blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    s3_key TEXT NOT NULL UNIQUE,
+    size_bytes BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Объекты без ссылок удаляются сборщиком при очистке корзины
+CREATE INDEX IF NOT EXISTS idx_blobs_unreferenced ON blobs(updated_at) WHERE ref_count <= 0;
+
+CREATE TRIGGER update_blobs_updated_at
+    BEFORE UPDATE ON blobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Версия удерживает ссылку, пока она не удалена (deleted_at IS NULL)
+CREATE OR REPLACE FUNCTION update_blob_ref_count()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.deleted_at IS NULL THEN
+        UPDATE blobs SET ref_count = ref_count - 1 WHERE s3_key = OLD.s3_key;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL THEN
+        UPDATE blobs SET ref_count = ref_count + 1 WHERE s3_key = NEW.s3_key;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER file_versions_blob_ref_count
+    AFTER INSERT OR DELETE OR UPDATE OF s3_key, deleted_at ON file_versions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_blob_ref_count();
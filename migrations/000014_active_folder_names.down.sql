@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS unique_active_folder_name;
+ALTER TABLE folders ADD CONSTRAINT unique_folder_name UNIQUE (parent_id, name, owner_id);
@@ -0,0 +1,5 @@
+-- Имя папки должно быть уникальным только среди неудаленных папок,
+-- иначе папка в корзине мешает создать или переместить папку с тем же именем
+ALTER TABLE folders DROP CONSTRAINT IF EXISTS unique_folder_name;
+CREATE UNIQUE INDEX IF NOT EXISTS unique_active_folder_name ON folders (parent_id, name, owner_id)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_files_listing_context;
+DROP INDEX IF EXISTS idx_files_listing_updated;
+DROP INDEX IF EXISTS idx_files_listing_created;
+DROP INDEX IF EXISTS idx_files_listing_type;
+DROP INDEX IF EXISTS idx_files_listing_size;
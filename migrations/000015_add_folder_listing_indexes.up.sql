@@ -0,0 +1,6 @@
+-- Индексы для постраничного вывода содержимого папок с сортировкой
+CREATE INDEX IF NOT EXISTS idx_files_listing_size ON files(folder_id, size_bytes, uuid) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_files_listing_type ON files(folder_id, mime_type, uuid) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_files_listing_created ON files(folder_id, created_at, uuid) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_files_listing_updated ON files(folder_id, updated_at, uuid) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_files_listing_context ON files(folder_id, context_type) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_folders_name_tsv;
+DROP INDEX IF EXISTS idx_folders_name_trgm;
+DROP INDEX IF EXISTS idx_files_name_tsv;
+DROP INDEX IF EXISTS idx_files_name_trgm;
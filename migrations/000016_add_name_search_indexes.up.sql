@@ -0,0 +1,8 @@
+-- Поиск по именам файлов и папок: триграммы для подстрок и опечаток,
+-- полнотекстовый индекс для поиска по словам
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_files_name_trgm ON files USING gin (name gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_files_name_tsv ON files USING gin (to_tsvector('simple', name)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_folders_name_trgm ON folders USING gin (name gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_folders_name_tsv ON folders USING gin (to_tsvector('simple', name)) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS files_queue_content_index_update ON files;
+DROP TRIGGER IF EXISTS files_queue_content_index_insert ON files;
+DROP FUNCTION IF EXISTS queue_file_content_index();
+DROP TABLE IF EXISTS file_contents;
@@ -0,0 +1,47 @@
+-- Извлеченный текст файлов для полнотекстового поиска по содержимому.
+-- Запись ставится в очередь на индексацию триггером при создании файла и смене текущей версии
+CREATE TABLE IF NOT EXISTS file_contents (
+    file_uuid UUID PRIMARY KEY REFERENCES files(uuid) ON DELETE CASCADE,
+    version_number INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'processing', 'indexed', 'unsupported', 'failed')),
+    content TEXT,
+    content_tsv TSVECTOR,
+    error TEXT,
+    indexed_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_contents_tsv ON file_contents USING gin(content_tsv);
+CREATE INDEX IF NOT EXISTS idx_file_contents_queue ON file_contents(updated_at)
+    WHERE status IN ('pending', 'processing');
+
+CREATE OR REPLACE FUNCTION queue_file_content_index()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO file_contents (file_uuid, version_number, status, updated_at)
+    VALUES (NEW.uuid, COALESCE(NEW.current_version, 1), 'pending', CURRENT_TIMESTAMP)
+    ON CONFLICT (file_uuid) DO UPDATE
+    SET version_number = EXCLUDED.version_number,
+        status = 'pending',
+        updated_at = CURRENT_TIMESTAMP;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER files_queue_content_index_insert
+    AFTER INSERT ON files
+    FOR EACH ROW
+    EXECUTE FUNCTION queue_file_content_index();
+
+CREATE TRIGGER files_queue_content_index_update
+    AFTER UPDATE OF current_version ON files
+    FOR EACH ROW
+    WHEN (OLD.current_version IS DISTINCT FROM NEW.current_version)
+    EXECUTE FUNCTION queue_file_content_index();
+
+-- Ставим в очередь уже существующие файлы
+INSERT INTO file_contents (file_uuid, version_number)
+SELECT uuid, COALESCE(current_version, 1) FROM files WHERE deleted_at IS NULL
+ON CONFLICT (file_uuid) DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS item_tags;
+DROP TRIGGER IF EXISTS update_tags_updated_at ON tags;
+DROP TABLE IF EXISTS tags;
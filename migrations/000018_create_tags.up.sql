@@ -0,0 +1,33 @@
+-- Личные метки пользователя. Метки видны только их владельцу,
+-- в том числе на чужих файлах и папках, открытых ему через общий доступ
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    owner_id VARCHAR(255) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '#9e9e9e',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_owner_name ON tags(owner_id, lower(name));
+
+CREATE TRIGGER update_tags_updated_at
+    BEFORE UPDATE ON tags
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Привязка метки к файлу или папке. Заполнено ровно одно из полей file_uuid/folder_id;
+-- при окончательном удалении элемента привязки удаляются каскадно
+CREATE TABLE IF NOT EXISTS item_tags (
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    file_uuid UUID REFERENCES files(uuid) ON DELETE CASCADE,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((file_uuid IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_tags_file ON item_tags(file_uuid, tag_id)
+    WHERE file_uuid IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_tags_folder ON item_tags(folder_id, tag_id)
+    WHERE folder_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_item_tags_tag ON item_tags(tag_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_owner_updated;
+DROP TABLE IF EXISTS item_activity;
+DROP TABLE IF EXISTS stars;
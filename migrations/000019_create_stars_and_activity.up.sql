@@ -0,0 +1,35 @@
+-- Избранные файлы и папки пользователя. Заполнено ровно одно из полей file_uuid/folder_id
+CREATE TABLE IF NOT EXISTS stars (
+    user_id VARCHAR(255) NOT NULL,
+    file_uuid UUID REFERENCES files(uuid) ON DELETE CASCADE,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((file_uuid IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stars_file ON stars(user_id, file_uuid)
+    WHERE file_uuid IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stars_folder ON stars(user_id, folder_id)
+    WHERE folder_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_stars_user_created ON stars(user_id, created_at DESC);
+
+-- Последнее действие пользователя с файлом или папкой (загрузка, скачивание,
+-- просмотр, переименование). Хранится одна строка на пару пользователь-элемент
+CREATE TABLE IF NOT EXISTS item_activity (
+    user_id VARCHAR(255) NOT NULL,
+    file_uuid UUID REFERENCES files(uuid) ON DELETE CASCADE,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('upload', 'download', 'preview', 'rename')),
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((file_uuid IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_activity_file ON item_activity(user_id, file_uuid)
+    WHERE file_uuid IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_activity_folder ON item_activity(user_id, folder_id)
+    WHERE folder_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_item_activity_user_occurred ON item_activity(user_id, occurred_at DESC);
+
+-- Недавно измененные файлы
+CREATE INDEX IF NOT EXISTS idx_files_owner_updated ON files(owner_id, updated_at DESC)
+    WHERE deleted_at IS NULL;
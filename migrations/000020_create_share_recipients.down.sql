@@ -0,0 +1,12 @@
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS user_ids TEXT NOT NULL DEFAULT '';
+
+UPDATE shares s
+SET user_ids = r.user_ids
+FROM (
+    SELECT share_id, string_agg(user_id, ',' ORDER BY granted_at) AS user_ids
+    FROM share_recipients
+    GROUP BY share_id
+) r
+WHERE r.share_id = s.id;
+
+DROP TABLE IF EXISTS share_recipients;
@@ -0,0 +1,24 @@
+-- Получатели ссылок. Заменяет список shares.user_ids, разделенный запятыми
+CREATE TABLE IF NOT EXISTS share_recipients (
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    access_type VARCHAR(20) NOT NULL CHECK (access_type IN ('view', 'edit', 'full')),
+    granted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    granted_by VARCHAR(255) NOT NULL,
+    PRIMARY KEY (share_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_recipients_user ON share_recipients(user_id, share_id);
+
+-- Переносим существующих получателей с уровнем доступа ссылки
+INSERT INTO share_recipients (share_id, user_id, access_type, granted_at, granted_by)
+SELECT s.id, u.user_id, s.access_type, COALESCE(s.created_at, CURRENT_TIMESTAMP), s.owner_id
+FROM shares s
+CROSS JOIN LATERAL (
+    SELECT DISTINCT btrim(value) AS user_id
+    FROM unnest(string_to_array(s.user_ids, ',')) AS value
+) u
+WHERE u.user_id <> '' AND u.user_id <> s.owner_id
+ON CONFLICT (share_id, user_id) DO NOTHING;
+
+ALTER TABLE shares DROP COLUMN IF EXISTS user_ids;
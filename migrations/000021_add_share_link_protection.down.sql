@@ -0,0 +1,5 @@
+ALTER TABLE shares
+    DROP COLUMN IF EXISTS preview_only,
+    DROP COLUMN IF EXISTS download_count,
+    DROP COLUMN IF EXISTS max_downloads,
+    DROP COLUMN IF EXISTS password_hash;
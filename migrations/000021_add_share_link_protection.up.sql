@@ -0,0 +1,6 @@
+-- Защита ссылок: хеш пароля, лимит скачиваний и режим только просмотра
+ALTER TABLE shares
+    ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS max_downloads INTEGER CHECK (max_downloads > 0),
+    ADD COLUMN IF NOT EXISTS download_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS preview_only BOOLEAN NOT NULL DEFAULT false;
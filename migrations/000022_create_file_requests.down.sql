@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS file_request_uploads;
+DROP TABLE IF EXISTS file_requests;
+ALTER TABLE shares DROP COLUMN IF EXISTS upload_only;
@@ -0,0 +1,23 @@
+-- Ссылки только для загрузки файлов в папку ("запрос файлов")
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS upload_only BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS file_requests (
+    share_id UUID PRIMARY KEY REFERENCES shares(id) ON DELETE CASCADE,
+    max_file_size BIGINT CHECK (max_file_size > 0),
+    allowed_extensions TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- Файлы, загруженные по запросу, и кто их загрузил
+CREATE TABLE IF NOT EXISTS file_request_uploads (
+    id BIGSERIAL PRIMARY KEY,
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    file_uuid UUID REFERENCES files(uuid) ON DELETE SET NULL,
+    file_name VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    uploader_id VARCHAR(255),
+    uploader_name VARCHAR(255) NOT NULL DEFAULT '',
+    uploader_email VARCHAR(255) NOT NULL DEFAULT '',
+    uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_request_uploads_share ON file_request_uploads(share_id, uploaded_at DESC);
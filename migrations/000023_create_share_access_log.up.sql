@@ -0,0 +1,13 @@
+-- Журнал обращений к ссылкам: кто и когда открывал, просматривал и скачивал
+CREATE TABLE IF NOT EXISTS share_access_log (
+    id BIGSERIAL PRIMARY KEY,
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    user_id VARCHAR(255),
+    ip VARCHAR(64),
+    action VARCHAR(20) NOT NULL,
+    resource_id TEXT,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_access_log_share ON share_access_log(share_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_share_access_log_occurred ON share_access_log(occurred_at);
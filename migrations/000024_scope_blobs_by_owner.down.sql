@@ -0,0 +1,3 @@
+ALTER TABLE blobs DROP CONSTRAINT IF EXISTS blobs_pkey;
+ALTER TABLE blobs ADD PRIMARY KEY (sha256);
+ALTER TABLE blobs DROP COLUMN IF EXISTS owner_id;
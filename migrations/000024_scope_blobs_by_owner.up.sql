@@ -0,0 +1,8 @@
+-- Общие объекты принадлежат владельцу: содержимое шифруется ключом пользователя,
+-- поэтому одинаковые файлы разных владельцев хранятся отдельно.
+-- Пустой owner_id - объекты, созданные до разделения, они удаляются сборщиком
+-- после удаления последней ссылки
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS owner_id VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE blobs DROP CONSTRAINT IF EXISTS blobs_pkey;
+ALTER TABLE blobs ADD PRIMARY KEY (owner_id, sha256);
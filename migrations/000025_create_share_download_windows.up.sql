@@ -0,0 +1,12 @@
+-- Окна скачивания по ссылкам с лимитом: скачивание файла засчитывается один раз,
+-- а повторные запросы того же пользователя в течение окна (докачка, перемотка)
+-- лимит не расходуют
+CREATE TABLE IF NOT EXISTS share_download_windows (
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    resource_id TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (share_id, user_id, resource_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_download_windows_expires ON share_download_windows(expires_at);